@@ -0,0 +1,30 @@
+package tork
+
+import "time"
+
+const (
+	AUDIT_TARGET_JOB           = "job"
+	AUDIT_TARGET_TASK          = "task"
+	AUDIT_TARGET_SCHEDULED_JOB = "scheduled-job"
+	AUDIT_TARGET_QUEUE         = "queue"
+	AUDIT_TARGET_NODE          = "node"
+	AUDIT_TARGET_USER          = "user"
+	AUDIT_TARGET_ROLE          = "role"
+	AUDIT_TARGET_NAMESPACE     = "namespace"
+	AUDIT_TARGET_SECRET        = "secret"
+)
+
+// AuditEvent records an operation which changed the state of the
+// cluster: either a mutating API call made by a user or a state
+// transition triggered by the coordinator, in which case Username
+// is empty.
+type AuditEvent struct {
+	ID         string     `json:"id,omitempty"`
+	Username   string     `json:"username,omitempty"`
+	Action     string     `json:"action,omitempty"`
+	TargetType string     `json:"targetType,omitempty"`
+	TargetID   string     `json:"targetId,omitempty"`
+	RemoteIP   string     `json:"remoteIp,omitempty"`
+	Status     int        `json:"status,omitempty"`
+	CreatedAt  *time.Time `json:"createdAt,omitempty"`
+}
@@ -15,12 +15,20 @@ const (
 	TOPIC_JOB_COMPLETED = "job.completed"
 	TOPIC_JOB_FAILED    = "job.failed"
 	TOPIC_SCHEDULED_JOB = "scheduled.job"
+	TOPIC_QUEUE         = "queue.*"
+	TOPIC_QUEUE_PAUSED  = "queue.paused"
+	TOPIC_QUEUE_RESUMED = "queue.resumed"
+	TOPIC_NODE_DRAIN    = "node.drain"
 )
 
 // Broker is the message-queue, pub/sub mechanism used for delivering tasks.
 type Broker interface {
 	PublishTask(ctx context.Context, qname string, t *tork.Task) error
 	SubscribeForTasks(qname string, handler func(t *tork.Task) error) error
+	// UnsubscribeForTasks cancels the subscriptions made through this
+	// broker on the given queue. Handlers which are in the middle of
+	// processing a task are allowed to complete.
+	UnsubscribeForTasks(qname string) error
 
 	PublishTaskProgress(ctx context.Context, t *tork.Task) error
 	SubscribeForTaskProgress(handler func(t *tork.Task) error) error
@@ -38,6 +46,14 @@ type Broker interface {
 	SubscribeForTaskLogPart(handler func(p *tork.TaskLogPart)) error
 
 	Queues(ctx context.Context) ([]QueueInfo, error)
+	// PauseQueue stops the delivery of new messages to the subscribers
+	// of the queue. Messages which are already being handled are allowed
+	// to complete, while new ones accumulate until the queue is resumed.
+	PauseQueue(ctx context.Context, qname string) error
+	ResumeQueue(ctx context.Context, qname string) error
+	// PurgeQueue removes all pending messages from the queue and
+	// returns the number of messages removed.
+	PurgeQueue(ctx context.Context, qname string) (int, error)
 	HealthCheck(ctx context.Context) error
 	Shutdown(ctx context.Context) error
 }
@@ -11,6 +11,7 @@ import (
 	"github.com/runabol/tork"
 
 	"github.com/runabol/tork/internal/syncx"
+	"github.com/runabol/tork/internal/tracing"
 	"github.com/runabol/tork/internal/wildcard"
 )
 
@@ -79,6 +80,11 @@ type queue struct {
 	ch      chan any
 	subs    []*qsub
 	unacked int32
+	paused  bool
+	// changed is closed (and replaced) every time
+	// the paused state of the queue changes so that
+	// subscribers waiting on the queue can react to it
+	changed chan any
 	mu      sync.Mutex
 }
 
@@ -88,6 +94,7 @@ func newQueue(name string) *queue {
 		ch:      make(chan any, defaultQueueSize),
 		subs:    make([]*qsub, 0),
 		unacked: 0,
+		changed: make(chan any),
 	}
 }
 
@@ -104,6 +111,44 @@ func (q *queue) size() int {
 	return len(q.ch)
 }
 
+func (q *queue) state() (bool, chan any) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.paused, q.changed
+}
+
+func (q *queue) setPaused(paused bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.paused == paused {
+		return
+	}
+	q.paused = paused
+	close(q.changed)
+	q.changed = make(chan any)
+}
+
+func (q *queue) purge() int {
+	var n int
+	for {
+		select {
+		case <-q.ch:
+			n = n + 1
+		default:
+			return n
+		}
+	}
+}
+
+func (q *queue) unsubscribe() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, sub := range q.subs {
+		close(sub.terminate)
+	}
+	q.subs = make([]*qsub, 0)
+}
+
 func (q *queue) close() {
 	q.mu.Lock()
 	defer q.mu.Unlock()
@@ -126,10 +171,22 @@ func (q *queue) subscribe(sub func(m any) error) {
 	q.mu.Unlock()
 	go func() {
 		for {
+			paused, changed := q.state()
+			if paused {
+				select {
+				case <-terminate:
+					close(terminated)
+					return
+				case <-changed:
+					continue
+				}
+			}
 			select {
 			case <-terminate:
 				close(terminated)
 				return
+			case <-changed:
+				continue
 			case m := <-q.ch:
 				atomic.AddInt32(&q.unacked, 1)
 				if err := sub(m); err != nil {
@@ -154,7 +211,9 @@ func NewInMemoryBroker() *InMemoryBroker {
 
 func (b *InMemoryBroker) PublishTask(ctx context.Context, qname string, t *tork.Task) error {
 	log.Debug().Msgf("publish task %s to %s queue", t.ID, qname)
-	return b.publish(qname, t.Clone())
+	t = t.Clone()
+	t.Headers = tracing.Inject(ctx, t.Headers)
+	return b.publish(qname, t)
 }
 
 func (b *InMemoryBroker) SubscribeForTasks(qname string, handler func(t *tork.Task) error) error {
@@ -167,13 +226,19 @@ func (b *InMemoryBroker) SubscribeForTasks(qname string, handler func(t *tork.Ta
 	})
 }
 
-func (b *InMemoryBroker) subscribe(qname string, handler func(m any) error) error {
-	log.Debug().Msgf("subscribing for tasks on %s", qname)
+func (b *InMemoryBroker) UnsubscribeForTasks(qname string) error {
+	log.Debug().Msgf("unsubscribing from queue %s", qname)
 	q, ok := b.queues.Get(qname)
 	if !ok {
-		q = newQueue(qname)
-		b.queues.Set(qname, q)
+		return nil
 	}
+	q.unsubscribe()
+	return nil
+}
+
+func (b *InMemoryBroker) subscribe(qname string, handler func(m any) error) error {
+	log.Debug().Msgf("subscribing for tasks on %s", qname)
+	q := b.getQueue(qname)
 	q.subscribe(handler)
 	return nil
 }
@@ -181,16 +246,49 @@ func (b *InMemoryBroker) subscribe(qname string, handler func(m any) error) erro
 func (b *InMemoryBroker) Queues(ctx context.Context) ([]QueueInfo, error) {
 	qi := make([]QueueInfo, 0)
 	b.queues.Iterate(func(_ string, q *queue) {
+		paused, _ := q.state()
 		qi = append(qi, QueueInfo{
 			Name:        q.name,
 			Size:        q.size(),
 			Subscribers: len(q.subs),
 			Unacked:     int(atomic.LoadInt32(&q.unacked)),
+			Paused:      paused,
 		})
 	})
 	return qi, nil
 }
 
+func (b *InMemoryBroker) PauseQueue(ctx context.Context, qname string) error {
+	log.Debug().Msgf("pausing queue %s", qname)
+	b.getQueue(qname).setPaused(true)
+	return b.PublishEvent(ctx, TOPIC_QUEUE_PAUSED, &QueueInfo{Name: qname, Paused: true})
+}
+
+func (b *InMemoryBroker) ResumeQueue(ctx context.Context, qname string) error {
+	log.Debug().Msgf("resuming queue %s", qname)
+	b.getQueue(qname).setPaused(false)
+	return b.PublishEvent(ctx, TOPIC_QUEUE_RESUMED, &QueueInfo{Name: qname})
+}
+
+func (b *InMemoryBroker) PurgeQueue(ctx context.Context, qname string) (int, error) {
+	q, ok := b.queues.Get(qname)
+	if !ok {
+		return 0, errors.Errorf("unknown queue: %s", qname)
+	}
+	n := q.purge()
+	log.Debug().Msgf("purged %d messages from queue %s", n, qname)
+	return n, nil
+}
+
+func (b *InMemoryBroker) getQueue(qname string) *queue {
+	q, ok := b.queues.Get(qname)
+	if !ok {
+		q = newQueue(qname)
+		b.queues.Set(qname, q)
+	}
+	return q
+}
+
 func (b *InMemoryBroker) PublishHeartbeat(_ context.Context, n *tork.Node) error {
 	return b.publish(QUEUE_HEARTBEAT, n.Clone())
 }
@@ -206,7 +304,9 @@ func (b *InMemoryBroker) SubscribeForHeartbeats(handler func(n *tork.Node) error
 }
 
 func (b *InMemoryBroker) PublishJob(ctx context.Context, j *tork.Job) error {
-	return b.publish(QUEUE_JOBS, j.Clone())
+	j = j.Clone()
+	j.Headers = tracing.Inject(ctx, j.Headers)
+	return b.publish(QUEUE_JOBS, j)
 }
 
 func (b *InMemoryBroker) SubscribeForJobs(handler func(j *tork.Job) error) error {
@@ -220,11 +320,7 @@ func (b *InMemoryBroker) SubscribeForJobs(handler func(j *tork.Job) error) error
 }
 
 func (b *InMemoryBroker) publish(qname string, m any) error {
-	q, ok := b.queues.Get(qname)
-	if !ok {
-		q = newQueue(qname)
-		b.queues.Set(qname, q)
-	}
+	q := b.getQueue(qname)
 	q.send(m)
 	return nil
 }
@@ -11,6 +11,7 @@ import (
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 func TestInMemoryPublishAndSubsribeForTask(t *testing.T) {
@@ -38,6 +39,26 @@ func TestInMemoryPublishAndSubsribeForTask(t *testing.T) {
 	assert.Equal(t, "/somevolume", t1.Mounts[0].Target)
 }
 
+func TestInMemoryPublishTaskWithTraceContext(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	ctx, span := tp.Tracer("test").Start(context.Background(), "test")
+	defer span.End()
+	b := broker.NewInMemoryBroker()
+	received := make(chan *tork.Task, 1)
+	err := b.SubscribeForTasks("test-queue", func(t *tork.Task) error {
+		received <- t
+		return nil
+	})
+	assert.NoError(t, err)
+
+	t1 := &tork.Task{ID: uuid.NewUUID()}
+	err = b.PublishTask(ctx, "test-queue", t1)
+	assert.NoError(t, err)
+	t2 := <-received
+	assert.Contains(t, t2.Headers["traceparent"], span.SpanContext().TraceID().String())
+	assert.Empty(t, t1.Headers)
+}
+
 func TestInMemoryGetQueues(t *testing.T) {
 	ctx := context.Background()
 	b := broker.NewInMemoryBroker()
@@ -268,3 +289,127 @@ func TestInMemoryPublishAndSubsribeTaskProgress(t *testing.T) {
 	<-processed
 	assert.NoError(t, err)
 }
+
+func TestInMemoryPauseAndResumeQueue(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+	qname := fmt.Sprintf("test-%s", uuid.NewUUID())
+	processed := make(chan any, 10)
+	err := b.SubscribeForTasks(qname, func(t *tork.Task) error {
+		processed <- 1
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = b.PauseQueue(ctx, qname)
+	assert.NoError(t, err)
+
+	qis, err := b.Queues(ctx)
+	assert.NoError(t, err)
+	for _, qi := range qis {
+		if qi.Name == qname {
+			assert.True(t, qi.Paused)
+		}
+	}
+
+	err = b.PublishTask(ctx, qname, &tork.Task{})
+	assert.NoError(t, err)
+
+	select {
+	case <-processed:
+		t.Fatal("paused queue should not deliver tasks")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	err = b.ResumeQueue(ctx, qname)
+	assert.NoError(t, err)
+
+	select {
+	case <-processed:
+	case <-time.After(time.Second):
+		t.Fatal("resumed queue should deliver tasks")
+	}
+}
+
+func TestInMemoryPauseQueueEvent(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+	qname := fmt.Sprintf("test-%s", uuid.NewUUID())
+	received := make(chan *broker.QueueInfo, 2)
+	err := b.SubscribeForEvents(ctx, broker.TOPIC_QUEUE, func(ev any) {
+		received <- ev.(*broker.QueueInfo)
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, b.PauseQueue(ctx, qname))
+	qi := <-received
+	assert.Equal(t, qname, qi.Name)
+	assert.True(t, qi.Paused)
+	assert.NoError(t, b.ResumeQueue(ctx, qname))
+	qi = <-received
+	assert.Equal(t, qname, qi.Name)
+	assert.False(t, qi.Paused)
+}
+
+func TestInMemoryPurgeQueue(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+	qname := fmt.Sprintf("test-%s", uuid.NewUUID())
+	for i := 0; i < 5; i++ {
+		err := b.PublishTask(ctx, qname, &tork.Task{})
+		assert.NoError(t, err)
+	}
+	n, err := b.PurgeQueue(ctx, qname)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	qis, err := b.Queues(ctx)
+	assert.NoError(t, err)
+	for _, qi := range qis {
+		if qi.Name == qname {
+			assert.Equal(t, 0, qi.Size)
+		}
+	}
+
+	_, err = b.PurgeQueue(ctx, "no-such-queue")
+	assert.Error(t, err)
+}
+
+func TestInMemoryUnsubscribeForTasks(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+	qname := fmt.Sprintf("test-%s", uuid.NewUUID())
+	processed := make(chan any, 10)
+	err := b.SubscribeForTasks(qname, func(t *tork.Task) error {
+		processed <- 1
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = b.PublishTask(ctx, qname, &tork.Task{})
+	assert.NoError(t, err)
+	<-processed
+
+	err = b.UnsubscribeForTasks(qname)
+	assert.NoError(t, err)
+
+	err = b.PublishTask(ctx, qname, &tork.Task{})
+	assert.NoError(t, err)
+
+	select {
+	case <-processed:
+		t.Fatal("unsubscribed handler should not receive tasks")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	qis, err := b.Queues(ctx)
+	assert.NoError(t, err)
+	for _, qi := range qis {
+		if qi.Name == qname {
+			assert.Equal(t, 0, qi.Subscribers)
+			assert.Equal(t, 1, qi.Size)
+		}
+	}
+
+	// shutdown should not trip over the removed subscriptions
+	assert.NoError(t, b.Shutdown(ctx))
+}
@@ -2,55 +2,109 @@ package broker
 
 import (
 	"context"
+	"io"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/runabol/tork"
+	"github.com/runabol/tork/internal/redact"
 )
 
 type LogShipper struct {
-	Broker Broker
-	TaskID string
-	part   int
-	q      chan []byte
+	Broker   Broker
+	TaskID   string
+	part     int
+	q        chan []byte
+	redacter *redact.Stream
+	done     chan struct{}
+	flushed  chan struct{}
+	close    sync.Once
 }
 
-func NewLogShipper(broker Broker, taskID string) *LogShipper {
+// NewLogShipper creates a writer which ships the log of a task in
+// parts, masking the values of the secrets in the log output. It
+// must be closed once the task is done for the last part to ship.
+func NewLogShipper(broker Broker, taskID string, secrets ...string) *LogShipper {
 	f := &LogShipper{
-		Broker: broker,
-		TaskID: taskID,
-		q:      make(chan []byte, 1000),
+		Broker:   broker,
+		TaskID:   taskID,
+		q:        make(chan []byte, 1000),
+		redacter: redact.NewStream(secrets...),
+		done:     make(chan struct{}),
+		flushed:  make(chan struct{}),
 	}
 	go f.startFlushTimer()
 	return f
 }
 
 func (r *LogShipper) Write(p []byte) (int, error) {
+	select {
+	case <-r.done:
+		return 0, io.ErrClosedPipe
+	default:
+	}
 	pc := make([]byte, len(p))
 	copy(pc, p)
 	r.q <- pc
 	return len(p), nil
 }
 
+// Close ships whatever output is left, including the output
+// held back for possibly being the beginning of a secret.
+func (r *LogShipper) Close() error {
+	r.close.Do(func() {
+		close(r.done)
+	})
+	<-r.flushed
+	return nil
+}
+
 func (r *LogShipper) startFlushTimer() {
 	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	defer close(r.flushed)
 	buffer := make([]byte, 0)
 	for {
 		select {
 		case p := <-r.q:
 			buffer = append(buffer, p...)
 		case <-ticker.C:
-			if len(buffer) > 0 {
-				r.part = r.part + 1
-				if err := r.Broker.PublishTaskLogPart(context.Background(), &tork.TaskLogPart{
-					Number:   r.part,
-					TaskID:   r.TaskID,
-					Contents: string(buffer),
-				}); err != nil {
-					log.Error().Err(err).Msgf("error forwarding task log part")
+			// output which may be the beginning of a secret is held
+			// back until more output arrives or the task is done, so
+			// that no secret is ever split across two parts
+			buffer = r.flush(buffer, false)
+		case <-r.done:
+		drain:
+			for {
+				select {
+				case p := <-r.q:
+					buffer = append(buffer, p...)
+				default:
+					break drain
 				}
-				buffer = buffer[:0] // clear buffer
 			}
+			r.flush(buffer, true)
+			return
+		}
+	}
+}
+
+// flush ships the buffered output and returns what was held back.
+func (r *LogShipper) flush(buffer []byte, final bool) []byte {
+	if len(buffer) == 0 {
+		return buffer
+	}
+	contents, pending := r.redacter.Redact(buffer, final)
+	if len(contents) > 0 {
+		r.part = r.part + 1
+		if err := r.Broker.PublishTaskLogPart(context.Background(), &tork.TaskLogPart{
+			Number:   r.part,
+			TaskID:   r.TaskID,
+			Contents: string(contents),
+		}); err != nil {
+			log.Error().Err(err).Msgf("error forwarding task log part")
 		}
 	}
+	return append(buffer[:0], pending...) // clear buffer
 }
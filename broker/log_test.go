@@ -2,6 +2,8 @@ package broker
 
 import (
 	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -61,3 +63,59 @@ func TestLogShipperWriteBufferFull(t *testing.T) {
 		assert.NoError(t, err)
 	}
 }
+
+func TestLogShipperRedact(t *testing.T) {
+	b := NewInMemoryBroker()
+
+	processed := make(chan any)
+	err := b.SubscribeForTaskLogPart(func(p *tork.TaskLogPart) {
+		assert.Equal(t, "password is [REDACTED]\n", p.Contents)
+		close(processed)
+	})
+	assert.NoError(t, err)
+
+	fwd := NewLogShipper(b, "some-task-id", "s3cr3t")
+	_, err = fwd.Write([]byte("password is s3c"))
+	assert.NoError(t, err)
+	_, err = fwd.Write([]byte("r3t\n"))
+	assert.NoError(t, err)
+
+	<-processed
+}
+
+func TestLogShipperRedactPause(t *testing.T) {
+	b := NewInMemoryBroker()
+
+	var mu sync.Mutex
+	parts := make([]string, 0)
+	err := b.SubscribeForTaskLogPart(func(p *tork.TaskLogPart) {
+		mu.Lock()
+		defer mu.Unlock()
+		parts = append(parts, p.Contents)
+	})
+	assert.NoError(t, err)
+
+	fwd := NewLogShipper(b, "some-task-id", "s3cr3t")
+	_, err = fwd.Write([]byte("password is s3c"))
+	assert.NoError(t, err)
+	// the task pauses mid-secret for a few flushes
+	<-time.After(time.Millisecond * 2500)
+	_, err = fwd.Write([]byte("r3t\ndone s3"))
+	assert.NoError(t, err)
+	assert.NoError(t, fwd.Close())
+
+	_, err = fwd.Write([]byte("more"))
+	assert.Error(t, err)
+
+	// parts are delivered asynchronously
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return strings.Join(parts, "") == "password is [REDACTED]\ndone s3"
+	}, time.Second, time.Millisecond*10)
+	mu.Lock()
+	defer mu.Unlock()
+	for _, p := range parts {
+		assert.NotContains(t, p, "s3c")
+	}
+}
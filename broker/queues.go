@@ -42,6 +42,7 @@ type QueueInfo struct {
 	Size        int    `json:"size"`
 	Subscribers int    `json:"subscribers"`
 	Unacked     int    `json:"unacked"`
+	Paused      bool   `json:"paused"`
 }
 
 func IsCoordinatorQueue(qname string) bool {
@@ -3,9 +3,11 @@ package broker
 import (
 	"context"
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -15,7 +17,9 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/runabol/tork"
 	"github.com/runabol/tork/internal/fns"
+	"github.com/runabol/tork/internal/metrics"
 	"github.com/runabol/tork/internal/syncx"
+	"github.com/runabol/tork/internal/tracing"
 	"github.com/runabol/tork/internal/uuid"
 )
 
@@ -23,6 +27,11 @@ const (
 	RABBITMQ_DEFAULT_CONSUMER_TIMEOUT = time.Minute * 30
 )
 
+// pausedQueuePrefix prefixes the durable, empty queues which mark their
+// task queue as paused. Unlike the events announcing the pause, they
+// outlive the brokers, so brokers which connect later find out too.
+const pausedQueuePrefix = QUEUE_EXCLUSIVE_PREFIX + "paused."
+
 const (
 	exchangeTopic       = "amq.topic"
 	exchangeDefault     = ""
@@ -45,13 +54,22 @@ type RabbitMQBroker struct {
 	consumerTimeout int
 	managementURL   string
 	durable         bool
+	paused          map[string][]*subscription
+	queueEvents     sync.Once
 }
 
 type subscription struct {
-	qname string
-	ch    *amqp.Channel
-	name  string
-	done  chan int
+	exchange string
+	key      string
+	qname    string
+	ch       *amqp.Channel
+	name     string
+	handler  func(msg any) error
+	paused   bool
+	// cancelled marks a subscription which was explicitly
+	// unsubscribed and should therefore not reconnect
+	cancelled bool
+	done      chan int
 }
 
 type rabbitq struct {
@@ -112,6 +130,7 @@ func NewRabbitMQBroker(url string, opts ...Option) (*RabbitMQBroker, error) {
 		url:             url,
 		connPool:        connPool,
 		subscriptions:   make([]*subscription, 0),
+		paused:          make(map[string][]*subscription),
 		heartbeatTTL:    defaultHeartbeatTTL,
 		consumerTimeout: int(RABBITMQ_DEFAULT_CONSUMER_TIMEOUT.Milliseconds()),
 	}
@@ -126,18 +145,197 @@ func (b *RabbitMQBroker) Queues(ctx context.Context) ([]QueueInfo, error) {
 	if err != nil {
 		return nil, err
 	}
-	qis := make([]QueueInfo, len(rqs))
-	for i, rq := range rqs {
-		qis[i] = QueueInfo{
+	markers := make(map[string]bool)
+	for _, rq := range rqs {
+		if qname, ok := strings.CutPrefix(rq.Name, pausedQueuePrefix); ok {
+			markers[qname] = true
+		}
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	qis := make([]QueueInfo, 0, len(rqs))
+	for _, rq := range rqs {
+		if strings.HasPrefix(rq.Name, pausedQueuePrefix) {
+			continue
+		}
+		_, paused := b.paused[rq.Name]
+		qis = append(qis, QueueInfo{
 			Name:        rq.Name,
 			Size:        rq.Messages,
 			Subscribers: rq.Consumers,
 			Unacked:     rq.Unacked,
-		}
+			Paused:      paused || markers[rq.Name],
+		})
 	}
 	return qis, nil
 }
 
+// PauseQueue marks the queue as paused in RabbitMQ and announces it to
+// all the brokers connected to it. Each broker cancels its consumers on
+// the queue, letting in-flight messages complete, until the queue is
+// resumed.
+func (b *RabbitMQBroker) PauseQueue(ctx context.Context, qname string) error {
+	if err := b.subscribeForQueueEvents(); err != nil {
+		return err
+	}
+	if err := b.withChannel(func(ch *amqp.Channel) error {
+		_, err := ch.QueueDeclare(pausedQueuePrefix+qname, true, false, false, false, nil)
+		return err
+	}); err != nil {
+		return errors.Wrapf(err, "error marking queue %s as paused", qname)
+	}
+	b.pause(qname)
+	return b.PublishEvent(ctx, TOPIC_QUEUE_PAUSED, &QueueInfo{Name: qname, Paused: true})
+}
+
+func (b *RabbitMQBroker) ResumeQueue(ctx context.Context, qname string) error {
+	if err := b.subscribeForQueueEvents(); err != nil {
+		return err
+	}
+	if err := b.withChannel(func(ch *amqp.Channel) error {
+		_, err := ch.QueueDelete(pausedQueuePrefix+qname, false, false, false)
+		return err
+	}); err != nil {
+		return errors.Wrapf(err, "error unmarking queue %s as paused", qname)
+	}
+	if err := b.resume(qname); err != nil {
+		return err
+	}
+	return b.PublishEvent(ctx, TOPIC_QUEUE_RESUMED, &QueueInfo{Name: qname})
+}
+
+// isPaused reports whether the queue is marked as paused in RabbitMQ.
+func (b *RabbitMQBroker) isPaused(qname string) (bool, error) {
+	err := b.withChannel(func(ch *amqp.Channel) error {
+		_, err := ch.QueueDeclarePassive(pausedQueuePrefix+qname, true, false, false, false, nil)
+		return err
+	})
+	var aerr *amqp.Error
+	if errors.As(err, &aerr) && aerr.Code == amqp.NotFound {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "error checking whether queue %s is paused", qname)
+	}
+	return true, nil
+}
+
+// withChannel calls f with a channel of its own, as
+// RabbitMQ closes the channels on which an error occurs.
+func (b *RabbitMQBroker) withChannel(f func(ch *amqp.Channel) error) error {
+	conn, err := b.getConnection()
+	if err != nil {
+		return errors.Wrapf(err, "error getting a connection")
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return errors.Wrapf(err, "error creating channel")
+	}
+	defer fns.CloseIgnore(ch)
+	return f(ch)
+}
+
+func (b *RabbitMQBroker) PurgeQueue(ctx context.Context, qname string) (int, error) {
+	conn, err := b.getConnection()
+	if err != nil {
+		return 0, errors.Wrapf(err, "error getting a connection")
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return 0, errors.Wrapf(err, "error creating channel")
+	}
+	defer fns.CloseIgnore(ch)
+	n, err := ch.QueuePurge(qname, false)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error purging queue %s", qname)
+	}
+	return n, nil
+}
+
+func (b *RabbitMQBroker) subscribeForQueueEvents() error {
+	var err error
+	b.queueEvents.Do(func() {
+		err = b.SubscribeForEvents(context.Background(), TOPIC_QUEUE, func(ev any) {
+			qi, ok := ev.(*QueueInfo)
+			if !ok {
+				log.Error().Msgf("expecting a *broker.QueueInfo but got %T", ev)
+				return
+			}
+			if qi.Paused {
+				b.pause(qi.Name)
+			} else if err := b.resume(qi.Name); err != nil {
+				log.Error().Err(err).Msgf("error resuming queue %s", qi.Name)
+			}
+		})
+	})
+	return err
+}
+
+func (b *RabbitMQBroker) pause(qname string) {
+	b.mu.Lock()
+	if _, ok := b.paused[qname]; ok {
+		b.mu.Unlock()
+		return
+	}
+	log.Debug().Msgf("pausing queue %s", qname)
+	b.paused[qname] = make([]*subscription, 0)
+	subs := make([]*subscription, 0)
+	for _, sub := range b.subscriptions {
+		if sub.qname == qname {
+			sub.paused = true
+			subs = append(subs, sub)
+		}
+	}
+	b.mu.Unlock()
+	for _, sub := range subs {
+		if err := sub.ch.Cancel(sub.name, false); err != nil {
+			log.Error().
+				Err(err).
+				Msgf("error cancelling consumer on %s", sub.qname)
+		}
+	}
+}
+
+func (b *RabbitMQBroker) resume(qname string) error {
+	b.mu.Lock()
+	subs, ok := b.paused[qname]
+	delete(b.paused, qname)
+	b.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	log.Debug().Msgf("resuming queue %s", qname)
+	for _, sub := range subs {
+		if err := b.subscribe(sub.exchange, sub.key, sub.qname, sub.handler); err != nil {
+			return errors.Wrapf(err, "error re-subscribing to %s", qname)
+		}
+	}
+	return nil
+}
+
+// park removes a paused subscription from the list of active
+// subscriptions so it can be re-created when the queue is resumed.
+func (b *RabbitMQBroker) park(sub *subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscriptions = slices.DeleteFunc(b.subscriptions, func(s *subscription) bool {
+		return s == sub
+	})
+	if subs, ok := b.paused[sub.qname]; ok {
+		b.paused[sub.qname] = append(subs, sub)
+		return
+	}
+	if b.shuttingDown {
+		return
+	}
+	// the queue was resumed while the
+	// subscription was winding down
+	go func() {
+		if err := b.subscribe(sub.exchange, sub.key, sub.qname, sub.handler); err != nil {
+			log.Error().Err(err).Msgf("error re-subscribing to %s", sub.qname)
+		}
+	}()
+}
+
 func (b *RabbitMQBroker) rabbitQueues(ctx context.Context) ([]rabbitq, error) {
 	u, err := url.Parse(b.url)
 	if err != nil {
@@ -181,10 +379,25 @@ func (b *RabbitMQBroker) PublishTask(ctx context.Context, qname string, t *tork.
 		return errors.Wrapf(err, "error creating channel")
 	}
 	defer fns.CloseIgnore(ch)
+	t = t.Clone()
+	t.Headers = tracing.Inject(ctx, t.Headers)
 	return b.publish(ctx, exchangeDefault, qname, t)
 }
 
 func (b *RabbitMQBroker) SubscribeForTasks(qname string, handler func(t *tork.Task) error) error {
+	if IsTaskQueue(qname) {
+		if err := b.subscribeForQueueEvents(); err != nil {
+			return errors.Wrapf(err, "error subscribing for queue events")
+		}
+		// the queue may have been paused before this broker connected
+		paused, err := b.isPaused(qname)
+		if err != nil {
+			return err
+		}
+		if paused {
+			b.pause(qname)
+		}
+	}
 	return b.subscribe(exchangeDefault, keyDefault, qname, func(msg any) error {
 		t, ok := msg.(*tork.Task)
 		if !ok {
@@ -194,7 +407,56 @@ func (b *RabbitMQBroker) SubscribeForTasks(qname string, handler func(t *tork.Ta
 	})
 }
 
+func (b *RabbitMQBroker) UnsubscribeForTasks(qname string) error {
+	b.mu.Lock()
+	subs := make([]*subscription, 0)
+	remaining := make([]*subscription, 0, len(b.subscriptions))
+	for _, sub := range b.subscriptions {
+		if sub.qname == qname {
+			sub.cancelled = true
+			subs = append(subs, sub)
+		} else {
+			remaining = append(remaining, sub)
+		}
+	}
+	b.subscriptions = remaining
+	// drop any subscriptions waiting
+	// for the queue to be resumed
+	if _, ok := b.paused[qname]; ok {
+		b.paused[qname] = make([]*subscription, 0)
+	}
+	b.mu.Unlock()
+	log.Debug().Msgf("unsubscribing from queue %s", qname)
+	// cancel all the consumers, even if some fail,
+	// rather than leaving the rest subscribed
+	var errs []error
+	for _, sub := range subs {
+		if err := sub.ch.Cancel(sub.name, false); err != nil {
+			errs = append(errs, errors.Wrapf(err, "error cancelling consumer %s on %s", sub.name, qname))
+		}
+	}
+	return stderrors.Join(errs...)
+}
+
 func (b *RabbitMQBroker) subscribe(exchange, key, qname string, handler func(msg any) error) error {
+	b.mu.Lock()
+	if subs, ok := b.paused[qname]; ok {
+		// don't consume from a paused queue. The subscription
+		// will be created once the queue is resumed.
+		b.paused[qname] = append(subs, &subscription{
+			exchange: exchange,
+			key:      key,
+			qname:    qname,
+			handler:  handler,
+		})
+		b.mu.Unlock()
+		// declare the queue nonetheless so
+		// messages published to it are kept
+		return b.withChannel(func(ch *amqp.Channel) error {
+			return b.declareQueue(exchange, key, qname, ch)
+		})
+	}
+	b.mu.Unlock()
 	conn, err := b.getConnection()
 	if err != nil {
 		return errors.Wrapf(err, "error getting a connection")
@@ -224,10 +486,13 @@ func (b *RabbitMQBroker) subscribe(exchange, key, qname string, handler func(msg
 	}
 	log.Debug().Msgf("created channel %s for queue: %s", cname, qname)
 	sub := &subscription{
-		ch:    ch,
-		qname: qname,
-		name:  cname,
-		done:  make(chan int),
+		exchange: exchange,
+		key:      key,
+		ch:       ch,
+		qname:    qname,
+		name:     cname,
+		handler:  handler,
+		done:     make(chan int),
 	}
 	b.mu.Lock()
 	b.subscriptions = append(b.subscriptions, sub)
@@ -262,6 +527,19 @@ func (b *RabbitMQBroker) subscribe(exchange, key, qname string, handler func(msg
 				}
 			}
 		}
+		b.mu.RLock()
+		paused := sub.paused
+		cancelled := sub.cancelled
+		b.mu.RUnlock()
+		if cancelled {
+			fns.CloseIgnore(ch)
+			return
+		}
+		if paused {
+			fns.CloseIgnore(ch)
+			b.park(sub)
+			return
+		}
 		maxAttempts := 20
 		for attempt := 1; !b.shuttingDown && attempt <= maxAttempts; attempt++ {
 			log.Info().Msgf("%s channel closed. reconnecting", qname)
@@ -281,7 +559,7 @@ func (b *RabbitMQBroker) subscribe(exchange, key, qname string, handler func(msg
 
 func serialize(msg any) ([]byte, error) {
 	mtype := fmt.Sprintf("%T", msg)
-	if mtype != "*tork.Task" && mtype != "*tork.Job" && mtype != "*tork.Node" && mtype != "*tork.TaskLogPart" && mtype != "*tork.TaskProgress" && mtype != "*tork.ScheduledJob" {
+	if mtype != "*tork.Task" && mtype != "*tork.Job" && mtype != "*tork.Node" && mtype != "*tork.TaskLogPart" && mtype != "*tork.TaskProgress" && mtype != "*tork.ScheduledJob" && mtype != "*broker.QueueInfo" {
 		return nil, errors.Errorf("unnknown type: %T", msg)
 	}
 	body, err := json.Marshal(msg)
@@ -323,6 +601,12 @@ func deserialize(tname string, body []byte) (any, error) {
 			return nil, err
 		}
 		return &p, nil
+	case "*broker.QueueInfo":
+		qi := QueueInfo{}
+		if err := json.Unmarshal(body, &qi); err != nil {
+			return nil, err
+		}
+		return &qi, nil
 	}
 	return nil, errors.Errorf("unknown message type: %s", tname)
 }
@@ -366,7 +650,12 @@ func (b *RabbitMQBroker) PublishHeartbeat(ctx context.Context, n *tork.Node) err
 	return b.publish(ctx, exchangeDefault, QUEUE_HEARTBEAT, n)
 }
 
-func (b *RabbitMQBroker) publish(ctx context.Context, exchange, key string, msg any) error {
+func (b *RabbitMQBroker) publish(ctx context.Context, exchange, key string, msg any) (err error) {
+	defer func() {
+		if err != nil {
+			metrics.BrokerPublishErrors.WithLabelValues(BROKER_RABBITMQ, key).Inc()
+		}
+	}()
 	var priority = defaultPriority
 	task, ok := msg.(*tork.Task)
 	if ok {
@@ -413,6 +702,8 @@ func (b *RabbitMQBroker) SubscribeForHeartbeats(handler func(n *tork.Node) error
 }
 
 func (b *RabbitMQBroker) PublishJob(ctx context.Context, j *tork.Job) error {
+	j = j.Clone()
+	j.Headers = tracing.Inject(ctx, j.Headers)
 	return b.publish(ctx, exchangeDefault, QUEUE_JOBS, j)
 }
 
@@ -0,0 +1,100 @@
+package tork
+
+import (
+	"slices"
+	"time"
+)
+
+type BulkAction string
+
+const (
+	BulkActionCancel  BulkAction = "cancel"
+	BulkActionRestart BulkAction = "restart"
+	BulkActionDelete  BulkAction = "delete"
+	BulkActionRetag   BulkAction = "retag"
+)
+
+type BulkOperationState string
+
+const (
+	BulkOperationStateRunning   BulkOperationState = "RUNNING"
+	BulkOperationStateCompleted BulkOperationState = "COMPLETED"
+	BulkOperationStateFailed    BulkOperationState = "FAILED"
+)
+
+type BulkOutcome string
+
+const (
+	BulkOutcomeOK BulkOutcome = "OK"
+	// BulkOutcomeSkipped is the outcome of jobs the action
+	// doesn't apply to, e.g. cancelling a completed job.
+	BulkOutcomeSkipped BulkOutcome = "SKIPPED"
+	BulkOutcomeFailed  BulkOutcome = "FAILED"
+)
+
+// BulkOperation applies an action to many jobs at once -- either
+// the jobs listed by ID or the jobs matching a search query -- in
+// the background, reporting its progress and the outcome for each
+// job as it goes.
+type BulkOperation struct {
+	ID          string             `json:"id,omitempty"`
+	Action      BulkAction         `json:"action,omitempty"`
+	Namespace   string             `json:"namespace,omitempty"`
+	Query       string             `json:"query,omitempty"`
+	Tags        []string           `json:"tags,omitempty"`
+	State       BulkOperationState `json:"state,omitempty"`
+	Total       int                `json:"total"`
+	Succeeded   int                `json:"succeeded"`
+	Skipped     int                `json:"skipped"`
+	Failed      int                `json:"failed"`
+	Error       string             `json:"error,omitempty"`
+	Results     []*BulkResult      `json:"results"`
+	CreatedBy   string             `json:"createdBy,omitempty"`
+	CreatedAt   *time.Time         `json:"createdAt,omitempty"`
+	CompletedAt *time.Time         `json:"completedAt,omitempty"`
+}
+
+// BulkResult is the outcome of a bulk operation for one job.
+type BulkResult struct {
+	JobID   string      `json:"jobId"`
+	Outcome BulkOutcome `json:"outcome"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// AddResult records the outcome for a job and counts it.
+func (o *BulkOperation) AddResult(r *BulkResult) {
+	o.Results = append(o.Results, r)
+	switch r.Outcome {
+	case BulkOutcomeOK:
+		o.Succeeded = o.Succeeded + 1
+	case BulkOutcomeSkipped:
+		o.Skipped = o.Skipped + 1
+	case BulkOutcomeFailed:
+		o.Failed = o.Failed + 1
+	}
+}
+
+func (o *BulkOperation) Clone() *BulkOperation {
+	results := make([]*BulkResult, len(o.Results))
+	for i, r := range o.Results {
+		rc := *r
+		results[i] = &rc
+	}
+	return &BulkOperation{
+		ID:          o.ID,
+		Action:      o.Action,
+		Namespace:   o.Namespace,
+		Query:       o.Query,
+		Tags:        slices.Clone(o.Tags),
+		State:       o.State,
+		Total:       o.Total,
+		Succeeded:   o.Succeeded,
+		Skipped:     o.Skipped,
+		Failed:      o.Failed,
+		Error:       o.Error,
+		Results:     results,
+		CreatedBy:   o.CreatedBy,
+		CreatedAt:   o.CreatedAt,
+		CompletedAt: o.CompletedAt,
+	}
+}
@@ -0,0 +1,32 @@
+package tork_test
+
+import (
+	"testing"
+
+	"github.com/runabol/tork"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulkOperationAddResult(t *testing.T) {
+	op := &tork.BulkOperation{}
+	op.AddResult(&tork.BulkResult{JobID: "1", Outcome: tork.BulkOutcomeOK})
+	op.AddResult(&tork.BulkResult{JobID: "2", Outcome: tork.BulkOutcomeSkipped})
+	op.AddResult(&tork.BulkResult{JobID: "3", Outcome: tork.BulkOutcomeFailed})
+	op.AddResult(&tork.BulkResult{JobID: "4", Outcome: tork.BulkOutcomeOK})
+	assert.Len(t, op.Results, 4)
+	assert.Equal(t, 2, op.Succeeded)
+	assert.Equal(t, 1, op.Skipped)
+	assert.Equal(t, 1, op.Failed)
+}
+
+func TestBulkOperationClone(t *testing.T) {
+	op := &tork.BulkOperation{Tags: []string{"a"}}
+	op.AddResult(&tork.BulkResult{JobID: "1", Outcome: tork.BulkOutcomeOK})
+	oc := op.Clone()
+	oc.Tags[0] = "b"
+	oc.Results[0].Outcome = tork.BulkOutcomeFailed
+	oc.AddResult(&tork.BulkResult{JobID: "2", Outcome: tork.BulkOutcomeOK})
+	assert.Equal(t, "a", op.Tags[0])
+	assert.Equal(t, tork.BulkOutcomeOK, op.Results[0].Outcome)
+	assert.Len(t, op.Results, 1)
+}
@@ -33,7 +33,11 @@ func (c *CLI) Run() error {
 }
 
 func (c *CLI) before(ctx *ucli.Context) error {
-	displayBanner()
+	// the banner would get in the way of the output of the
+	// commands which call the API, e.g. when piped to jq
+	if !c.isClientCommand(ctx.Args().First()) {
+		displayBanner()
+	}
 
 	if err := logging.SetupLogging(); err != nil {
 		return err
@@ -46,5 +50,19 @@ func (c *CLI) commands() []*ucli.Command {
 		c.runCmd(),
 		c.migrationCmd(),
 		c.healthCmd(),
+		c.jobCmd(),
+		c.taskCmd(),
+		c.scheduledJobCmd(),
+		c.nodeCmd(),
+		c.queueCmd(),
+	}
+}
+
+func (c *CLI) isClientCommand(name string) bool {
+	switch name {
+	case "job", "task", "scheduled-job", "node", "queue":
+		return true
+	default:
+		return false
 	}
 }
@@ -0,0 +1,153 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/runabol/tork/conf"
+	ucli "github.com/urfave/cli/v2"
+)
+
+const defaultEndpoint = "http://localhost:8000"
+
+// client calls the API of the coordinator on behalf of the
+// commands which manage jobs, tasks, nodes and queues.
+type client struct {
+	endpoint  string
+	token     string
+	username  string
+	password  string
+	namespace string
+	http      *http.Client
+}
+
+// clientFlags are the flags common to all the commands calling the
+// API. Unless set, they follow the [client] section of the config,
+// which the TORK_CLIENT_* environment variables override.
+func clientFlags() []ucli.Flag {
+	return []ucli.Flag{
+		&ucli.StringFlag{
+			Name:  "endpoint",
+			Usage: "the URL of the Tork API",
+		},
+		&ucli.StringFlag{
+			Name:    "namespace",
+			Aliases: []string{"n"},
+			Usage:   "the namespace of the jobs",
+		},
+		&ucli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Usage:   "the output format: table, json or yaml",
+			Value:   outputTable,
+		},
+	}
+}
+
+func newClient(ctx *ucli.Context) *client {
+	endpoint := ctx.String("endpoint")
+	if endpoint == "" {
+		endpoint = clientEndpoint()
+	}
+	namespace := ctx.String("namespace")
+	if namespace == "" {
+		namespace = conf.String("client.namespace")
+	}
+	return &client{
+		endpoint:  strings.TrimSuffix(endpoint, "/"),
+		token:     conf.String("client.token"),
+		username:  conf.String("client.username"),
+		password:  conf.String("client.password"),
+		namespace: namespace,
+		http:      &http.Client{Timeout: conf.DurationDefault("client.timeout", time.Minute)},
+	}
+}
+
+func clientEndpoint() string {
+	if endpoint := conf.String("client.endpoint"); endpoint != "" {
+		return endpoint
+	}
+	return conf.StringDefault("endpoint", defaultEndpoint)
+}
+
+// get fetches the resource at the path into out.
+func (c *client) get(ctx context.Context, path string, query url.Values, out any) error {
+	return c.do(ctx, http.MethodGet, path, query, nil, "", out)
+}
+
+// put updates the resource at the path, discarding the response.
+func (c *client) put(ctx context.Context, path string) error {
+	return c.do(ctx, http.MethodPut, path, nil, nil, "", nil)
+}
+
+// delete deletes the resource at the path, discarding the response.
+func (c *client) delete(ctx context.Context, path string) error {
+	return c.do(ctx, http.MethodDelete, path, nil, nil, "", nil)
+}
+
+func (c *client) do(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string, out any) error {
+	if c.namespace != "" {
+		if query == nil {
+			query = url.Values{}
+		}
+		query.Set("namespace", c.namespace)
+	}
+	u := c.endpoint + path
+	if len(query) > 0 {
+		u = u + "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return errors.Wrapf(err, "error creating request")
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	switch {
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case c.username != "":
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "error calling %s", c.endpoint)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrapf(err, "error reading response")
+	}
+	if resp.StatusCode >= 300 {
+		return apiError(resp.StatusCode, b)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		return errors.Wrapf(err, "error unmarshalling response")
+	}
+	return nil
+}
+
+// apiError turns the error the API responded with into an error,
+// using its message when there is one.
+func apiError(status int, body []byte) error {
+	var e struct {
+		Message any `json:"message"`
+	}
+	if err := json.Unmarshal(body, &e); err == nil && e.Message != nil {
+		return errors.Errorf("%s (status: %d)", fmt.Sprint(e.Message), status)
+	}
+	if msg := strings.TrimSpace(string(body)); msg != "" {
+		return errors.Errorf("%s (status: %d)", msg, status)
+	}
+	return errors.Errorf("request failed with status: %d", status)
+}
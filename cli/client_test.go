@@ -0,0 +1,206 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientGet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/jobs/1234", r.URL.Path)
+		assert.Equal(t, "Bearer tork_abc", r.Header.Get("Authorization"))
+		assert.Equal(t, "ns1", r.URL.Query().Get("namespace"))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(tork.Job{ID: "1234", State: tork.JobStateRunning})
+	}))
+	defer srv.Close()
+
+	c := &client{endpoint: srv.URL, token: "tork_abc", namespace: "ns1", http: srv.Client()}
+	j := &tork.Job{}
+	assert.NoError(t, c.get(context.Background(), "/jobs/1234", nil, j))
+	assert.Equal(t, "1234", j.ID)
+	assert.Equal(t, tork.JobStateRunning, j.State)
+}
+
+func TestClientBasicAuth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "someuser", user)
+		assert.Equal(t, "secret", pass)
+		assert.Equal(t, http.MethodPut, r.Method)
+		_, _ = w.Write([]byte(`{"status":"OK"}`))
+	}))
+	defer srv.Close()
+
+	c := &client{endpoint: srv.URL, username: "someuser", password: "secret", http: srv.Client()}
+	assert.NoError(t, c.put(context.Background(), "/jobs/1234/cancel"))
+}
+
+func TestClientError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"message":"job is not running"}`))
+	}))
+	defer srv.Close()
+
+	c := &client{endpoint: srv.URL, http: srv.Client()}
+	err := c.put(context.Background(), "/jobs/1234/cancel")
+	assert.EqualError(t, err, "job is not running (status: 400)")
+
+	assert.EqualError(t, apiError(http.StatusBadGateway, nil), "request failed with status: 502")
+	assert.EqualError(t, apiError(http.StatusBadGateway, []byte("bad gateway")), "bad gateway (status: 502)")
+}
+
+func TestLogReader(t *testing.T) {
+	var mu sync.Mutex
+	var parts []*tork.TaskLogPart
+	write := func(n int) {
+		mu.Lock()
+		defer mu.Unlock()
+		for i := 0; i < n; i++ {
+			id := len(parts) + 1
+			parts = append(parts, &tork.TaskLogPart{ID: strconv.Itoa(id), Number: id, Contents: fmt.Sprintf("line %d\n", id)})
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+		// newest first, as the API does
+		items := slices.Clone(parts)
+		slices.Reverse(items)
+		start := min((page-1)*size, len(items))
+		end := min(start+size, len(items))
+		_ = json.NewEncoder(w).Encode(datastore.Page[*tork.TaskLogPart]{
+			Items:      items[start:end],
+			Number:     page,
+			Size:       size,
+			TotalItems: len(items),
+			TotalPages: (len(items) + size - 1) / size,
+		})
+	}))
+	defer srv.Close()
+
+	r := newLogReader(&client{endpoint: srv.URL, http: srv.Client()}, "/jobs/1234/log")
+
+	// more than a page
+	write(logPageSize + 5)
+	ps, err := r.next(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, ps, logPageSize+5)
+	assert.Equal(t, "1", ps[0].ID)
+	assert.Equal(t, strconv.Itoa(logPageSize+5), ps[len(ps)-1].ID)
+
+	ps, err = r.next(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, ps)
+
+	write(2)
+	buf := &bytes.Buffer{}
+	assert.NoError(t, printLogs(context.Background(), r, buf))
+	assert.Equal(t, fmt.Sprintf("line %d\nline %d\n", logPageSize+6, logPageSize+7), buf.String())
+}
+
+func TestJobLogReader(t *testing.T) {
+	var mu sync.Mutex
+	tasks := []*tork.TaskSummary{
+		{ID: "t1", Position: 1, State: tork.TaskStateRunning},
+		{ID: "t2", Position: 1, State: tork.TaskStateRunning},
+	}
+	logs := map[string][]*tork.TaskLogPart{}
+	calls := map[string]int{}
+	write := func(taskID, contents string) {
+		mu.Lock()
+		defer mu.Unlock()
+		n := len(logs[taskID]) + 1
+		logs[taskID] = append(logs[taskID], &tork.TaskLogPart{ID: fmt.Sprintf("%s-%d", taskID, n), Number: n, TaskID: taskID, Contents: contents})
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/jobs/1234/tasks" {
+			_ = json.NewEncoder(w).Encode(datastore.Page[*tork.TaskSummary]{Items: tasks, TotalItems: len(tasks), TotalPages: 1})
+			return
+		}
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/tasks/"), "/log")
+		calls[id]++
+		// newest first, as the API does
+		items := slices.Clone(logs[id])
+		slices.Reverse(items)
+		_ = json.NewEncoder(w).Encode(datastore.Page[*tork.TaskLogPart]{Items: items, TotalItems: len(items), TotalPages: 1})
+	}))
+	defer srv.Close()
+
+	r := newJobLogReader(&client{endpoint: srv.URL, http: srv.Client()}, "1234")
+
+	write("t1", "t1 line 1\n")
+	write("t2", "t2 line 1\n")
+	buf := &bytes.Buffer{}
+	assert.NoError(t, printLogs(context.Background(), r, buf))
+	assert.Equal(t, "t1 line 1\nt2 line 1\n", buf.String())
+
+	// new output of an earlier task after output of a later one
+	write("t2", "t2 line 2\n")
+	write("t1", "t1 line 2\n")
+	buf.Reset()
+	assert.NoError(t, printLogs(context.Background(), r, buf))
+	assert.Equal(t, "t1 line 2\nt2 line 2\n", buf.String())
+
+	// the log of a task is read one last time once it is over
+	mu.Lock()
+	tasks[0].State = tork.TaskStateCompleted
+	mu.Unlock()
+	write("t1", "t1 line 3\n")
+	buf.Reset()
+	assert.NoError(t, printLogs(context.Background(), r, buf))
+	assert.Equal(t, "t1 line 3\n", buf.String())
+	assert.NoError(t, printLogs(context.Background(), r, buf))
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 3, calls["t1"])
+	assert.Equal(t, 4, calls["t2"])
+}
+
+func TestWriteOutput(t *testing.T) {
+	p := datastore.Page[*tork.JobSummary]{
+		Items: []*tork.JobSummary{{ID: "1234", Name: "my job", State: tork.JobStateCompleted, Position: 3, TaskCount: 2}},
+	}
+	tbl := func() table {
+		return table{
+			headers: []string{"ID", "NAME", "PROGRESS"},
+			rows:    [][]string{{p.Items[0].ID, p.Items[0].Name, jobProgress(p.Items[0].Position, p.Items[0].TaskCount)}},
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, writeOutput(buf, outputTable, p, tbl))
+	assert.Equal(t, "ID     NAME     PROGRESS\n1234   my job   2/2\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, writeOutput(buf, outputJSON, p, tbl))
+	var out datastore.Page[*tork.JobSummary]
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &out))
+	assert.Equal(t, "1234", out.Items[0].ID)
+
+	buf.Reset()
+	assert.NoError(t, writeOutput(buf, outputYAML, p, tbl))
+	assert.Contains(t, buf.String(), "    id: \"1234\"\n")
+	assert.Contains(t, buf.String(), "    taskCount: 2\n")
+
+	assert.Error(t, writeOutput(buf, "xml", p, tbl))
+}
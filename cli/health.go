@@ -7,7 +7,6 @@ import (
 	"net/http"
 
 	"github.com/pkg/errors"
-	"github.com/runabol/tork/conf"
 	ucli "github.com/urfave/cli/v2"
 )
 
@@ -20,7 +19,7 @@ func (c *CLI) healthCmd() *ucli.Command {
 }
 
 func health(_ *ucli.Context) error {
-	chk, err := http.Get(fmt.Sprintf("%s/health", conf.StringDefault("endpoint", "http://localhost:8000")))
+	chk, err := http.Get(fmt.Sprintf("%s/health", clientEndpoint()))
 	if err != nil {
 		return err
 	}
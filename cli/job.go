@@ -0,0 +1,288 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore"
+	ucli "github.com/urfave/cli/v2"
+)
+
+func (c *CLI) jobCmd() *ucli.Command {
+	return &ucli.Command{
+		Name:  "job",
+		Usage: "Manage jobs",
+		Subcommands: []*ucli.Command{
+			{
+				Name:      "submit",
+				Usage:     "Submit a job",
+				UsageText: "tork job submit -f job.yaml [--wait] [--follow]",
+				Flags: append(clientFlags(),
+					&ucli.StringFlag{
+						Name:     "file",
+						Aliases:  []string{"f"},
+						Usage:    "the YAML or JSON file of the job, or - to read it from stdin",
+						Required: true,
+					},
+					&ucli.BoolFlag{
+						Name:  "wait",
+						Usage: "wait for the job to complete",
+					},
+					&ucli.BoolFlag{
+						Name:  "follow",
+						Usage: "print the log of the job until it completes",
+					},
+				),
+				Action: submitJob,
+			},
+			{
+				Name:      "list",
+				Usage:     "List jobs",
+				UsageText: "tork job list [--query q] [--page n] [--size n]",
+				Flags: append(clientFlags(),
+					&ucli.StringFlag{
+						Name:    "query",
+						Aliases: []string{"q"},
+						Usage:   "the search query, e.g. state:failed",
+					},
+					&ucli.IntFlag{
+						Name:  "page",
+						Usage: "the page number",
+						Value: 1,
+					},
+					&ucli.IntFlag{
+						Name:  "size",
+						Usage: "the page size",
+						Value: 10,
+					},
+				),
+				Action: listJobs,
+			},
+			{
+				Name:      "get",
+				Usage:     "Get a job",
+				UsageText: "tork job get <id>",
+				Flags:     clientFlags(),
+				Action:    getJob,
+			},
+			{
+				Name:      "cancel",
+				Usage:     "Cancel a running job",
+				UsageText: "tork job cancel <id>",
+				Flags:     clientFlags(),
+				Action:    jobAction("cancel", "cancelled"),
+			},
+			{
+				Name:      "restart",
+				Usage:     "Restart a failed or cancelled job",
+				UsageText: "tork job restart <id>",
+				Flags:     clientFlags(),
+				Action:    jobAction("restart", "restarted"),
+			},
+			{
+				Name:      "logs",
+				Usage:     "Print the log of a job",
+				UsageText: "tork job logs <id> [--follow]",
+				Flags: append(clientFlags(),
+					&ucli.BoolFlag{
+						Name:  "follow",
+						Usage: "print the log until the job completes",
+					},
+				),
+				Action: jobLogs,
+			},
+		},
+	}
+}
+
+func submitJob(ctx *ucli.Context) error {
+	fname := ctx.String("file")
+	var body []byte
+	var err error
+	if fname == "-" {
+		body, err = io.ReadAll(os.Stdin)
+	} else {
+		body, err = os.ReadFile(fname)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "error reading job file %s", fname)
+	}
+	contentType := "text/yaml"
+	if strings.EqualFold(filepath.Ext(fname), ".json") {
+		contentType = "application/json"
+	}
+	c := newClient(ctx)
+	j := &tork.Job{}
+	if err := c.do(ctx.Context, http.MethodPost, "/jobs", nil, bytes.NewReader(body), contentType, j); err != nil {
+		return errors.Wrapf(err, "error submitting job")
+	}
+	if !ctx.Bool("wait") && !ctx.Bool("follow") {
+		return printJob(ctx, j)
+	}
+	if ctx.Bool("follow") {
+		// the log goes to stdout, so the job does not
+		fmt.Fprintf(os.Stderr, "Job %s submitted\n", j.ID)
+		if err := followLogs(ctx.Context, newJobLogReader(c, j.ID), os.Stdout, jobDone(c, j)); err != nil {
+			return err
+		}
+	} else {
+		if err := waitForJob(ctx.Context, c, j); err != nil {
+			return err
+		}
+		if err := printJob(ctx, j); err != nil {
+			return err
+		}
+	}
+	if j.State != tork.JobStateCompleted {
+		return errors.Errorf("job %s %s: %s", j.ID, strings.ToLower(j.State), j.Error)
+	}
+	return nil
+}
+
+// jobDone reports whether the job is over, keeping its latest state in j.
+func jobDone(c *client, j *tork.Job) func(context.Context) (bool, error) {
+	return func(ctx context.Context) (bool, error) {
+		if err := c.get(ctx, "/jobs/"+j.ID, nil, j); err != nil {
+			return false, err
+		}
+		return isJobDone(j.State), nil
+	}
+}
+
+func waitForJob(ctx context.Context, c *client, j *tork.Job) error {
+	done := jobDone(c, j)
+	for {
+		over, err := done(ctx)
+		if err != nil || over {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func isJobDone(state tork.JobState) bool {
+	return state == tork.JobStateCompleted ||
+		state == tork.JobStateFailed ||
+		state == tork.JobStateCancelled
+}
+
+func listJobs(ctx *ucli.Context) error {
+	q := url.Values{}
+	q.Set("page", strconv.Itoa(ctx.Int("page")))
+	q.Set("size", strconv.Itoa(ctx.Int("size")))
+	if query := ctx.String("query"); query != "" {
+		q.Set("q", query)
+	}
+	var p datastore.Page[*tork.JobSummary]
+	if err := newClient(ctx).get(ctx.Context, "/jobs", q, &p); err != nil {
+		return errors.Wrapf(err, "error listing jobs")
+	}
+	return writeOutput(os.Stdout, ctx.String("output"), p, func() table {
+		t := table{headers: []string{"ID", "NAME", "STATE", "PROGRESS", "CREATED", "DURATION"}}
+		for _, j := range p.Items {
+			t.rows = append(t.rows, []string{
+				j.ID,
+				j.Name,
+				j.State,
+				jobProgress(j.Position, j.TaskCount),
+				formatTime(&j.CreatedAt),
+				formatDuration(j.StartedAt, finishedAt(j.CompletedAt, j.FailedAt)),
+			})
+		}
+		return t
+	})
+}
+
+func getJob(ctx *ucli.Context) error {
+	id, err := requiredArg(ctx, "id")
+	if err != nil {
+		return err
+	}
+	j := &tork.Job{}
+	if err := newClient(ctx).get(ctx.Context, "/jobs/"+id, nil, j); err != nil {
+		return errors.Wrapf(err, "error getting job %s", id)
+	}
+	return printJob(ctx, j)
+}
+
+func printJob(ctx *ucli.Context, j *tork.Job) error {
+	return writeOutput(os.Stdout, ctx.String("output"), j, func() table {
+		return table{
+			headers: []string{"ID", "NAME", "STATE", "PROGRESS", "CREATED", "DURATION", "ERROR"},
+			rows: [][]string{{
+				j.ID,
+				j.Name,
+				j.State,
+				jobProgress(j.Position, j.TaskCount),
+				formatTime(&j.CreatedAt),
+				formatDuration(j.StartedAt, finishedAt(j.CompletedAt, j.FailedAt)),
+				j.Error,
+			}},
+		}
+	})
+}
+
+// jobProgress returns the number of top-level tasks the job is through.
+func jobProgress(position, taskCount int) string {
+	return fmt.Sprintf("%d/%d", min(max(position-1, 0), taskCount), taskCount)
+}
+
+// finishedAt returns when the job or task completed or failed, if it did.
+func finishedAt(completedAt, failedAt *time.Time) *time.Time {
+	if completedAt != nil {
+		return completedAt
+	}
+	return failedAt
+}
+
+// jobAction calls the action of the API on the job.
+func jobAction(action, done string) ucli.ActionFunc {
+	return func(ctx *ucli.Context) error {
+		id, err := requiredArg(ctx, "id")
+		if err != nil {
+			return err
+		}
+		if err := newClient(ctx).put(ctx.Context, fmt.Sprintf("/jobs/%s/%s", id, action)); err != nil {
+			return errors.Wrapf(err, "error calling %s on job %s", action, id)
+		}
+		fmt.Printf("Job %s %s\n", id, done)
+		return nil
+	}
+}
+
+func jobLogs(ctx *ucli.Context) error {
+	id, err := requiredArg(ctx, "id")
+	if err != nil {
+		return err
+	}
+	c := newClient(ctx)
+	r := newJobLogReader(c, id)
+	if ctx.Bool("follow") {
+		return followLogs(ctx.Context, r, os.Stdout, jobDone(c, &tork.Job{ID: id}))
+	}
+	return printLogs(ctx.Context, r, os.Stdout)
+}
+
+// requiredArg returns the first argument of the command.
+func requiredArg(ctx *ucli.Context, name string) (string, error) {
+	arg := ctx.Args().First()
+	if arg == "" {
+		return "", errors.Errorf("missing required argument: %s", name)
+	}
+	return arg, nil
+}
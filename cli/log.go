@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore"
+)
+
+// the number of log parts and of tasks to fetch
+// at once, which is the most the API returns
+const (
+	logPageSize  = 100
+	taskPageSize = 100
+)
+
+// pollInterval is how often the state and logs
+// of the job or task being followed are fetched.
+var pollInterval = time.Second
+
+// logSource returns the log parts which were written
+// since it was last called, oldest first.
+type logSource interface {
+	next(ctx context.Context) ([]*tork.TaskLogPart, error)
+}
+
+// logReader reads the log of a task. The API returns the parts of a
+// task's log newest first, so the reader walks back from the newest
+// part to the last one it returned and returns what it found oldest
+// first.
+type logReader struct {
+	c    *client
+	path string
+	last int
+}
+
+func newLogReader(c *client, path string) *logReader {
+	return &logReader{c: c, path: path}
+}
+
+func (r *logReader) next(ctx context.Context) ([]*tork.TaskLogPart, error) {
+	var parts []*tork.TaskLogPart
+	page, cursor := 1, ""
+	for {
+		q := url.Values{}
+		q.Set("size", strconv.Itoa(logPageSize))
+		if cursor != "" {
+			q.Set("cursor", cursor)
+		} else {
+			q.Set("page", strconv.Itoa(page))
+		}
+		var p datastore.Page[*tork.TaskLogPart]
+		if err := r.c.get(ctx, r.path, q, &p); err != nil {
+			return nil, err
+		}
+		var caughtUp bool
+		for _, part := range p.Items {
+			if part.Number <= r.last {
+				caughtUp = true
+				break
+			}
+			parts = append(parts, part)
+		}
+		if caughtUp || len(p.Items) == 0 || (p.NextCursor == "" && page >= p.TotalPages) {
+			break
+		}
+		page, cursor = page+1, p.NextCursor
+	}
+	if len(parts) > 0 {
+		r.last = parts[0].Number
+	}
+	slices.Reverse(parts)
+	return parts, nil
+}
+
+// jobLogReader reads the log of a job by reading the log of each of
+// its tasks, in the order of the tasks. Parts are only numbered in
+// order within a task, so a job's log, which interleaves the logs of
+// parallel tasks, can't be followed as a whole.
+type jobLogReader struct {
+	c        *client
+	jobID    string
+	tasks    map[string]*logReader
+	finished map[string]bool
+}
+
+func newJobLogReader(c *client, jobID string) *jobLogReader {
+	return &jobLogReader{
+		c:        c,
+		jobID:    jobID,
+		tasks:    make(map[string]*logReader),
+		finished: make(map[string]bool),
+	}
+}
+
+func (r *jobLogReader) next(ctx context.Context) ([]*tork.TaskLogPart, error) {
+	var parts []*tork.TaskLogPart
+	cursor := ""
+	for {
+		q := url.Values{}
+		q.Set("size", strconv.Itoa(taskPageSize))
+		if cursor != "" {
+			q.Set("cursor", cursor)
+		}
+		var p datastore.Page[*tork.TaskSummary]
+		if err := r.c.get(ctx, fmt.Sprintf("/jobs/%s/tasks", r.jobID), q, &p); err != nil {
+			return nil, err
+		}
+		for _, t := range p.Items {
+			if r.finished[t.ID] {
+				continue
+			}
+			tr, ok := r.tasks[t.ID]
+			if !ok {
+				tr = newLogReader(r.c, fmt.Sprintf("/tasks/%s/log", t.ID))
+				r.tasks[t.ID] = tr
+			}
+			ps, err := tr.next(ctx)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, ps...)
+			// the log of a task which is over was read in full
+			if !slices.Contains(tork.TaskStateActive, t.State) {
+				r.finished[t.ID] = true
+				delete(r.tasks, t.ID)
+			}
+		}
+		if p.NextCursor == "" {
+			break
+		}
+		cursor = p.NextCursor
+	}
+	return parts, nil
+}
+
+// printLogs writes the log parts which were written since
+// it was last called.
+func printLogs(ctx context.Context, r logSource, w io.Writer) error {
+	parts, err := r.next(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range parts {
+		fmt.Fprint(w, p.Contents)
+	}
+	return nil
+}
+
+// follow writes the log as it is written until done
+// reports that the job or task is over.
+func followLogs(ctx context.Context, r logSource, w io.Writer, done func(context.Context) (bool, error)) error {
+	for {
+		over, err := done(ctx)
+		if err != nil {
+			return err
+		}
+		if err := printLogs(ctx, r, w); err != nil {
+			return err
+		}
+		if over {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
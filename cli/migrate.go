@@ -6,36 +6,66 @@ import (
 	"github.com/runabol/tork/conf"
 	"github.com/runabol/tork/datastore"
 	"github.com/runabol/tork/datastore/postgres"
-	schema "github.com/runabol/tork/db/postgres"
+	"github.com/runabol/tork/internal/secrets"
 	ucli "github.com/urfave/cli/v2"
 )
 
 func (c *CLI) migrationCmd() *ucli.Command {
 	return &ucli.Command{
 		Name:   "migration",
-		Usage:  "Run the db migration script",
+		Usage:  "Create or upgrade the db schema",
 		Action: migration,
+		Subcommands: []*ucli.Command{
+			{
+				Name:   "rekey",
+				Usage:  "Encrypt the sensitive fields of jobs and tasks with the primary datastore encryption key",
+				Action: rekey,
+			},
+		},
 	}
 }
 
 func migration(ctx *ucli.Context) error {
+	pg, err := postgresDatastore()
+	if err != nil {
+		return errors.Wrapf(err, "can't perform db migration")
+	}
+	if err := pg.Migrate(ctx.Context); err != nil {
+		return errors.Wrapf(err, "error when trying to migrate the db schema")
+	}
+	log.Info().Msg("migration completed!")
+	return nil
+}
+
+func rekey(ctx *ucli.Context) error {
+	pg, err := postgresDatastore()
+	if err != nil {
+		return errors.Wrapf(err, "can't perform db rekey")
+	}
+	n, err := pg.Rekey(ctx.Context)
+	if err != nil {
+		return errors.Wrapf(err, "error when trying to rekey the db")
+	}
+	log.Info().Msgf("rekey completed! %d rows updated", n)
+	return nil
+}
+
+func postgresDatastore() (*postgres.PostgresDatastore, error) {
 	dstype := conf.StringDefault("datastore.type", datastore.DATASTORE_POSTGRES)
-	switch dstype {
-	case datastore.DATASTORE_POSTGRES:
-		dsn := conf.StringDefault(
-			"datastore.postgres.dsn",
-			"host=localhost user=tork password=tork dbname=tork port=5432 sslmode=disable",
-		)
-		pg, err := postgres.NewPostgresDataStore(dsn)
+	if dstype != datastore.DATASTORE_POSTGRES {
+		return nil, errors.Errorf("unsupported datastore type: %s", dstype)
+	}
+	dsn := conf.StringDefault(
+		"datastore.postgres.dsn",
+		"host=localhost user=tork password=tork dbname=tork port=5432 sslmode=disable",
+	)
+	opts := []postgres.Option{postgres.WithDisableCleanup(true)}
+	if k := conf.String("datastore.encryption.key"); k != "" {
+		kr, err := secrets.ParseKeyring(k, conf.Strings("datastore.encryption.previous")...)
 		if err != nil {
-			return err
+			return nil, errors.Wrapf(err, "invalid datastore encryption key")
 		}
-		if err := pg.ExecScript(schema.SCHEMA); err != nil {
-			return errors.Wrapf(err, "error when trying to create db schema")
-		}
-	default:
-		return errors.Errorf("can't perform db migration on: %s", dstype)
+		opts = append(opts, postgres.WithKeyring(kr))
 	}
-	log.Info().Msg("migration completed!")
-	return nil
+	return postgres.NewPostgresDataStore(dsn, opts...)
 }
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/runabol/tork"
+	ucli "github.com/urfave/cli/v2"
+)
+
+func (c *CLI) nodeCmd() *ucli.Command {
+	return &ucli.Command{
+		Name:  "node",
+		Usage: "Inspect nodes",
+		Subcommands: []*ucli.Command{
+			{
+				Name:      "list",
+				Usage:     "List the active nodes",
+				UsageText: "tork node list",
+				Flags:     clientFlags(),
+				Action:    listNodes,
+			},
+		},
+	}
+}
+
+func listNodes(ctx *ucli.Context) error {
+	var nodes []*tork.Node
+	if err := newClient(ctx).get(ctx.Context, "/nodes", nil, &nodes); err != nil {
+		return errors.Wrapf(err, "error listing nodes")
+	}
+	return writeOutput(os.Stdout, ctx.String("output"), nodes, func() table {
+		t := table{headers: []string{"ID", "NAME", "HOSTNAME", "QUEUE", "STATUS", "TASKS", "CPU", "VERSION", "LAST HEARTBEAT"}}
+		for _, n := range nodes {
+			t.rows = append(t.rows, []string{
+				n.ID,
+				n.Name,
+				n.Hostname,
+				n.Queue,
+				string(n.Status),
+				strconv.Itoa(n.TaskCount),
+				fmt.Sprintf("%.1f%%", n.CPUPercent),
+				n.Version,
+				formatTime(&n.LastHeartbeatAt),
+			})
+		}
+		return t
+	})
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// table is what a resource looks like in the table output.
+type table struct {
+	headers []string
+	rows    [][]string
+}
+
+// writeOutput writes v in the format. v is written as it
+// is in JSON and YAML, and as the table t otherwise.
+func writeOutput(w io.Writer, format string, v any, t func() table) error {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case outputYAML:
+		// go through JSON to keep the names of the fields of the API
+		b, err := json.Marshal(v)
+		if err != nil {
+			return errors.Wrapf(err, "error marshalling output")
+		}
+		var m any
+		if err := json.Unmarshal(b, &m); err != nil {
+			return errors.Wrapf(err, "error unmarshalling output")
+		}
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(m); err != nil {
+			return errors.Wrapf(err, "error writing output")
+		}
+		return enc.Close()
+	case outputTable, "":
+		return writeTable(w, t())
+	default:
+		return errors.Errorf("unknown output format: %s", format)
+	}
+}
+
+func writeTable(w io.Writer, t table) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(t.headers, "\t"))
+	for _, row := range t.rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+// formatDuration returns the time between start and end,
+// or since start while there is no end yet.
+func formatDuration(start, end *time.Time) string {
+	if start == nil {
+		return ""
+	}
+	until := time.Now()
+	if end != nil {
+		until = *end
+	}
+	return until.Sub(*start).Round(time.Second).String()
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/runabol/tork/broker"
+	ucli "github.com/urfave/cli/v2"
+)
+
+func (c *CLI) queueCmd() *ucli.Command {
+	return &ucli.Command{
+		Name:  "queue",
+		Usage: "Inspect queues",
+		Subcommands: []*ucli.Command{
+			{
+				Name:      "list",
+				Usage:     "List the queues",
+				UsageText: "tork queue list",
+				Flags:     clientFlags(),
+				Action:    listQueues,
+			},
+		},
+	}
+}
+
+func listQueues(ctx *ucli.Context) error {
+	var qs []*broker.QueueInfo
+	if err := newClient(ctx).get(ctx.Context, "/queues", nil, &qs); err != nil {
+		return errors.Wrapf(err, "error listing queues")
+	}
+	return writeOutput(os.Stdout, ctx.String("output"), qs, func() table {
+		t := table{headers: []string{"NAME", "SIZE", "SUBSCRIBERS", "UNACKED", "PAUSED"}}
+		for _, q := range qs {
+			t.rows = append(t.rows, []string{
+				q.Name,
+				strconv.Itoa(q.Size),
+				strconv.Itoa(q.Subscribers),
+				strconv.Itoa(q.Unacked),
+				strconv.FormatBool(q.Paused),
+			})
+		}
+		return t
+	})
+}
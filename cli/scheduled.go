@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore"
+	ucli "github.com/urfave/cli/v2"
+)
+
+func (c *CLI) scheduledJobCmd() *ucli.Command {
+	return &ucli.Command{
+		Name:  "scheduled-job",
+		Usage: "Manage scheduled jobs",
+		Subcommands: []*ucli.Command{
+			{
+				Name:      "list",
+				Usage:     "List scheduled jobs",
+				UsageText: "tork scheduled-job list [--page n] [--size n]",
+				Flags: append(clientFlags(),
+					&ucli.IntFlag{
+						Name:  "page",
+						Usage: "the page number",
+						Value: 1,
+					},
+					&ucli.IntFlag{
+						Name:  "size",
+						Usage: "the page size",
+						Value: 10,
+					},
+				),
+				Action: listScheduledJobs,
+			},
+			{
+				Name:      "pause",
+				Usage:     "Pause a scheduled job",
+				UsageText: "tork scheduled-job pause <id>",
+				Flags:     clientFlags(),
+				Action:    scheduledJobAction("pause", "paused"),
+			},
+			{
+				Name:      "resume",
+				Usage:     "Resume a paused scheduled job",
+				UsageText: "tork scheduled-job resume <id>",
+				Flags:     clientFlags(),
+				Action:    scheduledJobAction("resume", "resumed"),
+			},
+			{
+				Name:      "delete",
+				Usage:     "Delete a scheduled job",
+				UsageText: "tork scheduled-job delete <id>",
+				Flags:     clientFlags(),
+				Action:    deleteScheduledJob,
+			},
+		},
+	}
+}
+
+func listScheduledJobs(ctx *ucli.Context) error {
+	q := url.Values{}
+	q.Set("page", strconv.Itoa(ctx.Int("page")))
+	q.Set("size", strconv.Itoa(ctx.Int("size")))
+	var p datastore.Page[*tork.ScheduledJobSummary]
+	if err := newClient(ctx).get(ctx.Context, "/scheduled-jobs", q, &p); err != nil {
+		return errors.Wrapf(err, "error listing scheduled jobs")
+	}
+	return writeOutput(os.Stdout, ctx.String("output"), p, func() table {
+		t := table{headers: []string{"ID", "NAME", "CRON", "STATE", "CREATED"}}
+		for _, sj := range p.Items {
+			t.rows = append(t.rows, []string{
+				sj.ID,
+				sj.Name,
+				sj.Cron,
+				string(sj.State),
+				formatTime(&sj.CreatedAt),
+			})
+		}
+		return t
+	})
+}
+
+// scheduledJobAction calls the action of the API on the scheduled job.
+func scheduledJobAction(action, done string) ucli.ActionFunc {
+	return func(ctx *ucli.Context) error {
+		id, err := requiredArg(ctx, "id")
+		if err != nil {
+			return err
+		}
+		if err := newClient(ctx).put(ctx.Context, fmt.Sprintf("/scheduled-jobs/%s/%s", id, action)); err != nil {
+			return errors.Wrapf(err, "error calling %s on scheduled job %s", action, id)
+		}
+		fmt.Printf("Scheduled job %s %s\n", id, done)
+		return nil
+	}
+}
+
+func deleteScheduledJob(ctx *ucli.Context) error {
+	id, err := requiredArg(ctx, "id")
+	if err != nil {
+		return err
+	}
+	if err := newClient(ctx).delete(ctx.Context, "/scheduled-jobs/"+id); err != nil {
+		return errors.Wrapf(err, "error deleting scheduled job %s", id)
+	}
+	fmt.Printf("Scheduled job %s deleted\n", id)
+	return nil
+}
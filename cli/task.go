@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/runabol/tork"
+	ucli "github.com/urfave/cli/v2"
+)
+
+func (c *CLI) taskCmd() *ucli.Command {
+	return &ucli.Command{
+		Name:  "task",
+		Usage: "Inspect tasks",
+		Subcommands: []*ucli.Command{
+			{
+				Name:      "get",
+				Usage:     "Get a task",
+				UsageText: "tork task get <id>",
+				Flags:     clientFlags(),
+				Action:    getTask,
+			},
+			{
+				Name:      "logs",
+				Usage:     "Print the log of a task",
+				UsageText: "tork task logs <id> [--follow]",
+				Flags: append(clientFlags(),
+					&ucli.BoolFlag{
+						Name:  "follow",
+						Usage: "print the log until the task completes",
+					},
+				),
+				Action: taskLogs,
+			},
+		},
+	}
+}
+
+func getTask(ctx *ucli.Context) error {
+	id, err := requiredArg(ctx, "id")
+	if err != nil {
+		return err
+	}
+	t := &tork.Task{}
+	if err := newClient(ctx).get(ctx.Context, "/tasks/"+id, nil, t); err != nil {
+		return errors.Wrapf(err, "error getting task %s", id)
+	}
+	return writeOutput(os.Stdout, ctx.String("output"), t, func() table {
+		return table{
+			headers: []string{"ID", "JOB ID", "NAME", "STATE", "IMAGE", "NODE", "CREATED", "DURATION", "ERROR"},
+			rows: [][]string{{
+				t.ID,
+				t.JobID,
+				t.Name,
+				t.State,
+				t.Image,
+				t.NodeID,
+				formatTime(t.CreatedAt),
+				formatDuration(t.StartedAt, finishedAt(t.CompletedAt, t.FailedAt)),
+				t.Error,
+			}},
+		}
+	})
+}
+
+func taskLogs(ctx *ucli.Context) error {
+	id, err := requiredArg(ctx, "id")
+	if err != nil {
+		return err
+	}
+	c := newClient(ctx)
+	r := newLogReader(c, fmt.Sprintf("/tasks/%s/log", id))
+	if ctx.Bool("follow") {
+		return followLogs(ctx.Context, r, os.Stdout, func(ctx context.Context) (bool, error) {
+			t := &tork.Task{}
+			if err := c.get(ctx, "/tasks/"+id, nil, t); err != nil {
+				return false, err
+			}
+			return !t.IsActive(), nil
+		})
+	}
+	return printLogs(ctx.Context, r, os.Stdout)
+}
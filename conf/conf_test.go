@@ -219,6 +219,23 @@ func TestBoolDefault(t *testing.T) {
 	assert.True(t, conf.BoolDefault("main.other", true))
 }
 
+func TestFloat64Default(t *testing.T) {
+	konf := `
+	[main]
+	some.ratio = 0.25
+	`
+	err := os.WriteFile("config.toml", []byte(konf), os.ModePerm)
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, os.Remove("config.toml"))
+	}()
+	err = conf.LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0.25, conf.Float64Default("main.some.ratio", 1))
+	assert.Equal(t, 1.0, conf.Float64Default("main.other.ratio", 1))
+}
+
 func TestDurationDefault(t *testing.T) {
 	konf := `
 	[main]
@@ -2,21 +2,33 @@ package datastore
 
 import (
 	"context"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore/search"
 )
 
 type Provider func() (Datastore, error)
 
 var (
-	ErrTaskNotFound         = errors.New("task not found")
-	ErrNodeNotFound         = errors.New("node not found")
-	ErrJobNotFound          = errors.New("job not found")
-	ErrScheduledJobNotFound = errors.New("scheduled job not found")
-	ErrUserNotFound         = errors.New("user not found")
-	ErrRoleNotFound         = errors.New("role not found")
-	ErrContextNotFound      = errors.New("context not found")
+	ErrTaskNotFound          = errors.New("task not found")
+	ErrNodeNotFound          = errors.New("node not found")
+	ErrJobNotFound           = errors.New("job not found")
+	ErrScheduledJobNotFound  = errors.New("scheduled job not found")
+	ErrUserNotFound          = errors.New("user not found")
+	ErrUserInUse             = errors.New("user owns jobs and can not be deleted")
+	ErrRoleNotFound          = errors.New("role not found")
+	ErrTokenNotFound         = errors.New("token not found")
+	ErrIdentityNotFound      = errors.New("identity not found")
+	ErrPolicyNotFound        = errors.New("policy not found")
+	ErrContextNotFound       = errors.New("context not found")
+	ErrNamespaceNotFound     = errors.New("namespace not found")
+	ErrNamespaceInUse        = errors.New("namespace has jobs and can not be deleted")
+	ErrSecretNotFound        = errors.New("secret not found")
+	ErrInvalidCursor         = errors.New("invalid cursor")
+	ErrBulkOperationNotFound = errors.New("bulk operation not found")
+	ErrInvalidStatsGroup     = errors.New("invalid stats group")
 )
 
 const (
@@ -28,49 +40,159 @@ type Datastore interface {
 	UpdateTask(ctx context.Context, id string, modify func(u *tork.Task) error) error
 	GetTaskByID(ctx context.Context, id string) (*tork.Task, error)
 	GetActiveTasks(ctx context.Context, jobID string) ([]*tork.Task, error)
+	GetActiveTasksByNodeID(ctx context.Context, nodeID string) ([]*tork.Task, error)
 	GetNextTask(ctx context.Context, parentTaskID string) (*tork.Task, error)
 	CreateTaskLogPart(ctx context.Context, p *tork.TaskLogPart) error
-	GetTaskLogParts(ctx context.Context, taskID, q string, page, size int) (*Page[*tork.TaskLogPart], error)
+	GetTaskLogParts(ctx context.Context, taskID, q, cursor string, page, size int) (*Page[*tork.TaskLogPart], error)
 
 	CreateNode(ctx context.Context, n *tork.Node) error
 	UpdateNode(ctx context.Context, id string, modify func(u *tork.Node) error) error
 	GetNodeByID(ctx context.Context, id string) (*tork.Node, error)
 	GetActiveNodes(ctx context.Context) ([]*tork.Node, error)
+	// GetStaleNodes returns the nodes which are still marked as UP or
+	// DRAINING but haven't sent a heartbeat since the given time.
+	GetStaleNodes(ctx context.Context, lastHeartbeatBefore time.Time) ([]*tork.Node, error)
+	// CreateNodeSample records the telemetry a node sent with a heartbeat.
+	CreateNodeSample(ctx context.Context, nodeID string, s *tork.NodeSample) error
+	// GetNodeSamples returns the telemetry history of
+	// the node since the given time, oldest first.
+	GetNodeSamples(ctx context.Context, nodeID string, since time.Time) ([]*tork.NodeSample, error)
 
 	CreateJob(ctx context.Context, j *tork.Job) error
 	UpdateJob(ctx context.Context, id string, modify func(u *tork.Job) error) error
 	GetJobByID(ctx context.Context, id string) (*tork.Job, error)
-	GetJobLogParts(ctx context.Context, jobID, q string, page, size int) (*Page[*tork.TaskLogPart], error)
-	GetJobs(ctx context.Context, currentUser, q string, page, size int) (*Page[*tork.JobSummary], error)
+	// GetJobNamespace returns the namespace of a job
+	// without loading the rest of the job.
+	GetJobNamespace(ctx context.Context, id string) (string, error)
+	GetJobLogParts(ctx context.Context, jobID, q, cursor string, page, size int) (*Page[*tork.TaskLogPart], error)
+	// GetJobTasks returns a page of the tasks of a job, in the order
+	// of their position.
+	GetJobTasks(ctx context.Context, jobID string, q TaskQuery, cursor string, page, size int) (*Page[*tork.TaskSummary], error)
+	// GetJobs returns a page of the jobs matching the query. Pages are
+	// selected by number or, when a cursor is given, follow the page
+	// the cursor was returned with.
+	GetJobs(ctx context.Context, currentUser, namespace string, q *search.Query, cursor string, page, size int) (*Page[*tork.JobSummary], error)
+	// DeleteJob deletes a job along with its tasks and their logs.
+	DeleteJob(ctx context.Context, id string) error
+
+	CreateBulkOperation(ctx context.Context, o *tork.BulkOperation) error
+	UpdateBulkOperation(ctx context.Context, id string, modify func(u *tork.BulkOperation) error) error
+	GetBulkOperationByID(ctx context.Context, id string) (*tork.BulkOperation, error)
 
 	CreateScheduledJob(ctx context.Context, s *tork.ScheduledJob) error
 	GetActiveScheduledJobs(ctx context.Context) ([]*tork.ScheduledJob, error)
-	GetScheduledJobs(ctx context.Context, currentUser string, page, size int) (*Page[*tork.ScheduledJobSummary], error)
+	GetScheduledJobs(ctx context.Context, currentUser, namespace, cursor string, page, size int) (*Page[*tork.ScheduledJobSummary], error)
 	GetScheduledJobByID(ctx context.Context, id string) (*tork.ScheduledJob, error)
 	UpdateScheduledJob(ctx context.Context, id string, modify func(u *tork.ScheduledJob) error) error
 	DeleteScheduledJob(ctx context.Context, id string) error
 
 	CreateUser(ctx context.Context, u *tork.User) error
 	GetUser(ctx context.Context, username string) (*tork.User, error)
+	UpdateUser(ctx context.Context, id string, modify func(u *tork.User) error) error
+	DeleteUser(ctx context.Context, id string) error
+
+	CreateUserToken(ctx context.Context, t *tork.UserToken) error
+	GetUserTokens(ctx context.Context, userID string) ([]*tork.UserToken, error)
+	GetUserTokenByHash(ctx context.Context, tokenHash string) (*tork.UserToken, error)
+	UpdateUserTokenLastUsed(ctx context.Context, id string, lastUsedAt time.Time) error
+	DeleteUserToken(ctx context.Context, userID, id string) error
+
+	CreateUserIdentity(ctx context.Context, i *tork.UserIdentity) error
+	GetUserIdentities(ctx context.Context, userID string) ([]*tork.UserIdentity, error)
+	GetUserByIdentity(ctx context.Context, issuer, subject string) (*tork.User, error)
+	DeleteUserIdentity(ctx context.Context, userID, id string) error
 
 	CreateRole(ctx context.Context, r *tork.Role) error
 	GetRole(ctx context.Context, id string) (*tork.Role, error)
 	GetRoles(ctx context.Context) ([]*tork.Role, error)
+	DeleteRole(ctx context.Context, id string) error
 	GetUserRoles(ctx context.Context, userID string) ([]*tork.Role, error)
 	AssignRole(ctx context.Context, userID, roleID string) error
 	UnassignRole(ctx context.Context, userID, roleID string) error
 
-	GetMetrics(ctx context.Context) (*tork.Metrics, error)
+	CreatePolicy(ctx context.Context, p *tork.Policy) error
+	GetPolicies(ctx context.Context, roleID string) ([]*tork.Policy, error)
+	GetUserPolicies(ctx context.Context, userID string) ([]*tork.Policy, error)
+	DeletePolicy(ctx context.Context, id string) error
+
+	CreateAuditEvent(ctx context.Context, e *tork.AuditEvent) error
+	GetAuditEvents(ctx context.Context, q AuditQuery, page, size int) (*Page[*tork.AuditEvent], error)
+
+	CreateNamespace(ctx context.Context, n *tork.Namespace) error
+	GetNamespace(ctx context.Context, name string) (*tork.Namespace, error)
+	GetNamespaces(ctx context.Context) ([]*tork.Namespace, error)
+	UpdateNamespace(ctx context.Context, name string, modify func(n *tork.Namespace) error) error
+	DeleteNamespace(ctx context.Context, name string) error
+	AddNamespaceMember(ctx context.Context, namespaceID string, m *tork.NamespaceMember) error
+	RemoveNamespaceMember(ctx context.Context, namespaceID string, m *tork.NamespaceMember) error
+	// IsNamespaceMember reports whether the user is a member of
+	// the namespace, either directly or through one of its roles.
+	IsNamespaceMember(ctx context.Context, namespaceID, userID string) (bool, error)
+	// CountActiveJobs returns the number of pending, scheduled
+	// and running jobs in the namespace.
+	CountActiveJobs(ctx context.Context, namespace string) (int, error)
+
+	CreateSecret(ctx context.Context, s *tork.Secret) error
+	GetSecret(ctx context.Context, namespace, name string) (*tork.Secret, error)
+	GetSecrets(ctx context.Context, namespace string) ([]*tork.Secret, error)
+	UpdateSecret(ctx context.Context, namespace, name string, modify func(s *tork.Secret) error) error
+	DeleteSecret(ctx context.Context, namespace, name string) error
+
+	GetMetrics(ctx context.Context, namespace string) (*tork.Metrics, error)
+	// GetJobStats aggregates the jobs which completed, failed or were
+	// cancelled, by the group of the query, from the most frequent.
+	GetJobStats(ctx context.Context, currentUser, namespace string, q StatsQuery) ([]*tork.Stats, error)
+	// GetTaskStats aggregates the tasks which completed, failed or were
+	// cancelled, by the group of the query, from the most frequent.
+	GetTaskStats(ctx context.Context, currentUser, namespace string, q StatsQuery) ([]*tork.Stats, error)
 
 	WithTx(ctx context.Context, f func(tx Datastore) error) error
 
 	HealthCheck(ctx context.Context) error
 }
 
+// AuditQuery filters audit events. Empty
+// fields don't restrict the result.
+type AuditQuery struct {
+	Username   string
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      *time.Time
+	Until      *time.Time
+}
+
+// The groups of job and task stats. Jobs can't
+// be grouped by queue or image.
+const (
+	StatsByName  = "name"
+	StatsByTag   = "tag"
+	StatsByQueue = "queue"
+	StatsByImage = "image"
+	StatsByUser  = "user"
+)
+
+// StatsQuery selects the jobs or tasks created within a
+// time window, and how to group them. Empty bounds don't
+// restrict the window.
+type StatsQuery struct {
+	GroupBy string
+	Since   *time.Time
+	Until   *time.Time
+}
+
+// TaskQuery filters the tasks of a job. Empty
+// fields don't restrict the result.
+type TaskQuery struct {
+	State    string
+	ParentID string
+}
+
 type Page[T any] struct {
-	Items      []T `json:"items"`
-	Number     int `json:"number"`
-	Size       int `json:"size"`
-	TotalPages int `json:"totalPages"`
-	TotalItems int `json:"totalItems"`
+	Items      []T    `json:"items"`
+	Number     int    `json:"number"`
+	Size       int    `json:"size"`
+	TotalPages int    `json:"totalPages"`
+	TotalItems int    `json:"totalItems"`
+	NextCursor string `json:"nextCursor,omitempty"`
 }
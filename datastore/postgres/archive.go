@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/internal/archive"
+	"github.com/runabol/tork/internal/uuid"
+)
+
+// WithArchiver exports expired jobs, tasks and logs with the archiver
+// before the cleanup deletes them. Should archiving fail, nothing is
+// deleted until a later cleanup succeeds archiving them.
+func WithArchiver(a *archive.Archiver) Option {
+	return func(ds *PostgresDatastore) {
+		ds.archiver = a
+	}
+}
+
+// archiveName names a new archive of the kind of records,
+// grouping archives in a directory per day.
+func archiveName(kind string) string {
+	now := time.Now().UTC()
+	return fmt.Sprintf("%s/%s-%s-%s.ndjson.gz", now.Format("2006/01/02"), kind, now.Format("20060102T150405Z"), uuid.NewShortUUID())
+}
+
+// archiveJobs exports the jobs, along with their tasks
+// and logs, to a new archive ahead of their deletion.
+func (ds *PostgresDatastore) archiveJobs(ctx context.Context, ids []string) error {
+	if ds.archiver == nil || len(ids) == 0 {
+		return nil
+	}
+	return ds.archiver.Archive(ctx, archiveName("jobs"), func(w *archive.Writer) error {
+		for _, id := range ids {
+			j, err := ds.GetJobByID(ctx, id)
+			if err != nil {
+				return err
+			}
+			rs := make([]taskRecord, 0)
+			if err := ds.select_(&rs, `SELECT * FROM tasks where job_id = $1 ORDER BY position, created_at, id`, id); err != nil {
+				return errors.Wrapf(err, "error getting the tasks of job %s", id)
+			}
+			tasks := make([]*tork.Task, len(rs))
+			for i, r := range rs {
+				t, err := r.toTask(ds.keyring)
+				if err != nil {
+					return err
+				}
+				tasks[i] = t
+			}
+			if err := w.WriteJob(j, tasks); err != nil {
+				return err
+			}
+			for _, t := range tasks {
+				ls := make([]taskLogPartRecord, 0)
+				if err := ds.select_(&ls, `SELECT * FROM tasks_log_parts where task_id = $1 ORDER BY number_, id`, t.ID); err != nil {
+					return errors.Wrapf(err, "error getting the log of task %s", t.ID)
+				}
+				for _, l := range ls {
+					if err := w.WriteLogPart(l.toTaskLogPart()); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// archiveExpiredTaskLogParts exports the log parts which outlived
+// their retention to a new archive and then deletes them. The export
+// happens outside of any transaction, so that none stays open for as
+// long as the upload: log parts never change, and the deletion only
+// removes the ones exported.
+func (ds *PostgresDatastore) archiveExpiredTaskLogParts() (int, error) {
+	rs := make([]taskLogPartRecord, 0)
+	q := `select * from tasks_log_parts where created_at < $1 order by created_at limit 1000`
+	if err := ds.select_(&rs, q, time.Now().UTC().Add(-*ds.logsRetentionDuration)); err != nil {
+		return 0, errors.Wrapf(err, "error getting expired task log parts from the db")
+	}
+	if len(rs) == 0 {
+		return 0, nil
+	}
+	ids := make([]string, len(rs))
+	if err := ds.archiver.Archive(context.Background(), archiveName("logs"), func(w *archive.Writer) error {
+		for i, r := range rs {
+			ids[i] = r.ID
+			if err := w.WriteLogPart(r.toTaskLogPart()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	res, err := ds.exec(`delete from tasks_log_parts where id = ANY($1)`, pq.StringArray(ids))
+	if err != nil {
+		return 0, errors.Wrapf(err, "error deleting task log parts from the db")
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrapf(err, "error getting the number of deleted log parts")
+	}
+	return int(rows), nil
+}
@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/internal/archive"
+	"github.com/runabol/tork/internal/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func readArchives(t *testing.T, dir string) []archive.Record {
+	records := make([]archive.Record, 0)
+	err := filepath.WalkDir(dir, func(fname string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		f, err := os.Open(fname)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(gz)
+		for scanner.Scan() {
+			r := archive.Record{}
+			if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+				return err
+			}
+			records = append(records, r)
+		}
+		return scanner.Err()
+	})
+	assert.NoError(t, err)
+	return records
+}
+
+func TestPostgresArchiveExpiredJobs(t *testing.T) {
+	ctx := context.Background()
+	ds, err := NewTestDatastore()
+	assert.NoError(t, err)
+	dir := t.TempDir()
+	ds.archiver = archive.NewArchiver(archive.NewDirStore(dir), nil)
+
+	now := time.Now().UTC()
+	j1 := &tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateCompleted,
+		CreatedAt: now,
+	}
+	assert.NoError(t, ds.CreateJob(ctx, j1))
+	assert.NoError(t, ds.UpdateJob(ctx, j1.ID, func(u *tork.Job) error {
+		u.DeleteAt = &now
+		return nil
+	}))
+	t1 := &tork.Task{
+		ID:        uuid.NewUUID(),
+		JobID:     j1.ID,
+		CreatedAt: &now,
+	}
+	assert.NoError(t, ds.CreateTask(ctx, t1))
+	assert.NoError(t, ds.CreateTaskLogPart(ctx, &tork.TaskLogPart{Number: 1, TaskID: t1.ID, Contents: "line 1"}))
+
+	n, err := ds.expungeExpiredJobs()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = ds.GetJobByID(ctx, j1.ID)
+	assert.ErrorIs(t, err, datastore.ErrJobNotFound)
+
+	records := readArchives(t, dir)
+	assert.Len(t, records, 3)
+	assert.Equal(t, archive.RecordTypeJob, records[0].Type)
+	assert.Equal(t, j1.ID, records[0].Job.ID)
+	assert.Equal(t, archive.RecordTypeTask, records[1].Type)
+	assert.Equal(t, t1.ID, records[1].Task.ID)
+	assert.Equal(t, archive.RecordTypeLog, records[2].Type)
+	assert.Equal(t, "line 1", records[2].Log.Contents)
+	assert.NoError(t, ds.Close())
+}
+
+func TestPostgresArchiveExpiredTaskLogParts(t *testing.T) {
+	ctx := context.Background()
+	ds, err := NewTestDatastore()
+	assert.NoError(t, err)
+	dir := t.TempDir()
+	ds.archiver = archive.NewArchiver(archive.NewDirStore(dir), nil)
+	retention := time.Nanosecond
+	ds.logsRetentionDuration = &retention
+
+	now := time.Now().UTC()
+	j1 := &tork.Job{
+		ID:    uuid.NewUUID(),
+		State: tork.JobStateRunning,
+	}
+	assert.NoError(t, ds.CreateJob(ctx, j1))
+	t1 := &tork.Task{
+		ID:        uuid.NewUUID(),
+		JobID:     j1.ID,
+		CreatedAt: &now,
+	}
+	assert.NoError(t, ds.CreateTask(ctx, t1))
+	assert.NoError(t, ds.CreateTaskLogPart(ctx, &tork.TaskLogPart{Number: 1, TaskID: t1.ID, Contents: "line 1"}))
+	time.Sleep(time.Millisecond)
+
+	n, err := ds.expungeExpiredTaskLogPart()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	records := readArchives(t, dir)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "line 1", records[0].Log.Contents)
+	assert.NoError(t, ds.Close())
+}
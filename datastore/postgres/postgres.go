@@ -3,9 +3,11 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"strconv"
 	"strings"
 	"time"
 
@@ -15,27 +17,36 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/runabol/tork"
 	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/datastore/search"
 	"github.com/runabol/tork/db/postgres"
+	"github.com/runabol/tork/internal/archive"
+	"github.com/runabol/tork/internal/secrets"
 	"github.com/runabol/tork/internal/slices"
 	"github.com/runabol/tork/internal/uuid"
+	"github.com/runabol/tork/locker"
 )
 
 type PostgresDatastore struct {
-	db                    *sqlx.DB
-	tx                    *sqlx.Tx
-	logsRetentionDuration *time.Duration
-	jobsRetentionDuration *time.Duration
-	cleanupInterval       *time.Duration
-	rand                  *rand.Rand
-	disableCleanup        bool
+	db                     *sqlx.DB
+	tx                     *sqlx.Tx
+	logsRetentionDuration  *time.Duration
+	jobsRetentionDuration  *time.Duration
+	auditRetentionDuration *time.Duration
+	cleanupInterval        *time.Duration
+	rand                   *rand.Rand
+	disableCleanup         bool
+	elector                locker.Elector
+	keyring                *secrets.Keyring
+	archiver               *archive.Archiver
 }
 
 var (
-	initialCleanupInterval       = minCleanupInterval
-	minCleanupInterval           = time.Minute
-	maxCleanupInterval           = time.Hour
-	DefaultLogsRetentionDuration = time.Hour * 24 * 7   // 1 week
-	DefaultJobsRetentionDuration = time.Hour * 24 * 365 // 1 year
+	initialCleanupInterval        = minCleanupInterval
+	minCleanupInterval            = time.Minute
+	maxCleanupInterval            = time.Hour
+	DefaultLogsRetentionDuration  = time.Hour * 24 * 7   // 1 week
+	DefaultJobsRetentionDuration  = time.Hour * 24 * 365 // 1 year
+	DefaultAuditRetentionDuration = time.Hour * 24 * 365 // 1 year
 )
 
 type Option = func(ds *PostgresDatastore)
@@ -52,12 +63,35 @@ func WithJobsRetentionDuration(dur time.Duration) Option {
 	}
 }
 
+func WithAuditRetentionDuration(dur time.Duration) Option {
+	return func(ds *PostgresDatastore) {
+		ds.auditRetentionDuration = &dur
+	}
+}
+
 func WithDisableCleanup(val bool) Option {
 	return func(ds *PostgresDatastore) {
 		ds.disableCleanup = val
 	}
 }
 
+// WithElector restricts the cleanup of expired logs and
+// jobs to the process which is the cluster leader.
+func WithElector(e locker.Elector) Option {
+	return func(ds *PostgresDatastore) {
+		ds.elector = e
+	}
+}
+
+// WithKeyring encrypts the sensitive columns of jobs, scheduled
+// jobs and tasks -- secrets, environment variables, registry
+// credentials and webhook headers -- with the keys of the keyring.
+func WithKeyring(kr *secrets.Keyring) Option {
+	return func(ds *PostgresDatastore) {
+		ds.keyring = kr
+	}
+}
+
 func NewTestDatastore() (*PostgresDatastore, error) {
 	schemaName := fmt.Sprintf("tork%s", uuid.NewUUID())
 	dsn := `host=localhost user=tork password=tork dbname=tork search_path=%s sslmode=disable`
@@ -68,7 +102,7 @@ func NewTestDatastore() (*PostgresDatastore, error) {
 	if _, err := ds.db.Exec(fmt.Sprintf("create schema %s", schemaName)); err != nil {
 		return nil, errors.Wrapf(err, "error creating schema %s", schemaName)
 	}
-	if err := ds.ExecScript(postgres.SCHEMA); err != nil {
+	if err := ds.Migrate(context.Background()); err != nil {
 		return nil, errors.Wrapf(err, "error initializing schema %s", schemaName)
 	}
 	return ds, nil
@@ -93,6 +127,9 @@ func NewPostgresDataStore(dsn string, opts ...Option) (*PostgresDatastore, error
 	if ds.jobsRetentionDuration == nil {
 		ds.jobsRetentionDuration = &DefaultJobsRetentionDuration
 	}
+	if ds.auditRetentionDuration == nil {
+		ds.auditRetentionDuration = &DefaultAuditRetentionDuration
+	}
 	if *ds.cleanupInterval < time.Minute {
 		return nil, errors.Errorf("cleanup interval can not be under 1 minute")
 	}
@@ -102,6 +139,9 @@ func NewPostgresDataStore(dsn string, opts ...Option) (*PostgresDatastore, error
 	if *ds.jobsRetentionDuration < time.Minute {
 		return nil, errors.Errorf("jobs retention period can not be under 1 minute")
 	}
+	if *ds.auditRetentionDuration < time.Minute {
+		return nil, errors.Errorf("audit retention period can not be under 1 minute")
+	}
 	if !ds.disableCleanup {
 		go ds.cleanupProcess()
 	}
@@ -112,6 +152,9 @@ func (ds *PostgresDatastore) cleanupProcess() {
 	for {
 		jitter := time.Second * (time.Duration(ds.rand.Intn(60) + 1))
 		time.Sleep(*ds.cleanupInterval + jitter)
+		if ds.elector != nil && !ds.elector.IsLeader() {
+			continue
+		}
 		if err := ds.cleanup(); err != nil {
 			log.Error().Err(err).Msg("error expunging task logs")
 		}
@@ -133,7 +176,21 @@ func (ds *PostgresDatastore) cleanup() error {
 	if n2 > 0 {
 		log.Debug().Msgf("Expunged %d expired jobs from the DB", n2)
 	}
-	n := n1 + n2
+	n3, err := ds.expungeExpiredAuditEvents()
+	if err != nil {
+		return err
+	}
+	if n3 > 0 {
+		log.Debug().Msgf("Expunged %d expired audit events from the DB", n3)
+	}
+	n4, err := ds.expungeExpiredNodeSamples()
+	if err != nil {
+		return err
+	}
+	if n4 > 0 {
+		log.Debug().Msgf("Expunged %d expired node samples from the DB", n4)
+	}
+	n := n1 + n2 + n3 + n4
 	if n > 0 {
 		newCleanupInterval := (*ds.cleanupInterval) / 2
 		if newCleanupInterval < minCleanupInterval {
@@ -155,10 +212,70 @@ func (ds *PostgresDatastore) ExecScript(script string) error {
 	return err
 }
 
+// migrationsLockID is the key of the advisory lock which
+// keeps concurrent migrations from running at once.
+const migrationsLockID = 7_243_191
+
+// Migrate brings the database schema up to date. A database
+// without tables is initialized with the full schema, while
+// an existing one gets the migrations it hasn't seen yet.
+func (ds *PostgresDatastore) Migrate(ctx context.Context) error {
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		ptx, ok := tx.(*PostgresDatastore)
+		if !ok {
+			return errors.New("unable to cast to a postgres datastore")
+		}
+		if _, err := ptx.exec(`select pg_advisory_xact_lock($1)`, migrationsLockID); err != nil {
+			return errors.Wrapf(err, "error acquiring the migrations lock")
+		}
+		if _, err := ptx.exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		    version     int       not null primary key,
+		    description text      not null,
+		    applied_at  timestamp not null
+		)`); err != nil {
+			return errors.Wrapf(err, "error creating the schema_migrations table")
+		}
+		var fresh bool
+		if err := ptx.get(&fresh, `select to_regclass('jobs') is null`); err != nil {
+			return errors.Wrapf(err, "error inspecting the db schema")
+		}
+		applied := make(map[int]bool)
+		if fresh {
+			if _, err := ptx.exec(postgres.SCHEMA); err != nil {
+				return errors.Wrapf(err, "error creating the db schema")
+			}
+		} else {
+			versions := make([]int, 0)
+			if err := ptx.select_(&versions, `select version from schema_migrations`); err != nil {
+				return errors.Wrapf(err, "error getting the applied migrations")
+			}
+			for _, v := range versions {
+				applied[v] = true
+			}
+		}
+		for _, m := range postgres.MIGRATIONS {
+			if applied[m.Version] {
+				continue
+			}
+			if !fresh {
+				log.Info().Msgf("applying migration %d: %s", m.Version, m.Description)
+				if _, err := ptx.exec(m.Script); err != nil {
+					return errors.Wrapf(err, "error applying migration %d", m.Version)
+				}
+			}
+			if _, err := ptx.exec(`insert into schema_migrations (version,description,applied_at) values ($1,$2,$3)`,
+				m.Version, m.Description, time.Now().UTC()); err != nil {
+				return errors.Wrapf(err, "error recording migration %d", m.Version)
+			}
+		}
+		return nil
+	})
+}
+
 func (ds *PostgresDatastore) CreateTask(ctx context.Context, t *tork.Task) error {
 	var env *string
 	if t.Env != nil {
-		b, err := json.Marshal(t.Env)
+		b, err := ds.sealJSON(t.Env)
 		if err != nil {
 			return errors.Wrapf(err, "failed to serialize task.env")
 		}
@@ -174,11 +291,11 @@ func (ds *PostgresDatastore) CreateTask(ctx context.Context, t *tork.Task) error
 		s := string(b)
 		files = &s
 	}
-	pre, err := json.Marshal(t.Pre)
+	pre, err := ds.sealJSON(t.Pre)
 	if err != nil {
 		return errors.Wrapf(err, "failed to serialize task.pre")
 	}
-	post, err := json.Marshal(t.Post)
+	post, err := ds.sealJSON(t.Post)
 	if err != nil {
 		return errors.Wrapf(err, "failed to serialize task.post")
 	}
@@ -202,7 +319,7 @@ func (ds *PostgresDatastore) CreateTask(ctx context.Context, t *tork.Task) error
 	}
 	var parallel *string
 	if t.Parallel != nil {
-		b, err := json.Marshal(t.Parallel)
+		b, err := ds.sealJSON(t.Parallel)
 		if err != nil {
 			return errors.Wrapf(err, "failed to serialize task.parallel")
 		}
@@ -211,7 +328,7 @@ func (ds *PostgresDatastore) CreateTask(ctx context.Context, t *tork.Task) error
 	}
 	var each *string
 	if t.Each != nil {
-		b, err := json.Marshal(t.Each)
+		b, err := ds.sealJSON(t.Each)
 		if err != nil {
 			return errors.Wrapf(err, "failed to serialize task.each")
 		}
@@ -220,7 +337,7 @@ func (ds *PostgresDatastore) CreateTask(ctx context.Context, t *tork.Task) error
 	}
 	var subjob *string
 	if t.SubJob != nil {
-		b, err := json.Marshal(t.SubJob)
+		b, err := ds.sealJSON(t.SubJob)
 		if err != nil {
 			return errors.Wrapf(err, "failed to serialize task.subjob")
 		}
@@ -229,7 +346,7 @@ func (ds *PostgresDatastore) CreateTask(ctx context.Context, t *tork.Task) error
 	}
 	var registry *string
 	if t.Registry != nil {
-		b, err := json.Marshal(t.Registry)
+		b, err := ds.sealJSON(t.Registry)
 		if err != nil {
 			return errors.Wrapf(err, "failed to serialize task.registry")
 		}
@@ -245,6 +362,24 @@ func (ds *PostgresDatastore) CreateTask(ctx context.Context, t *tork.Task) error
 		s := string(b)
 		mounts = &s
 	}
+	var nodeSelector *string
+	if len(t.NodeSelector) > 0 {
+		b, err := json.Marshal(t.NodeSelector)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize task.nodeSelector")
+		}
+		s := string(b)
+		nodeSelector = &s
+	}
+	var resources *string
+	if t.Resources != nil {
+		b, err := json.Marshal(t.Resources)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize task.resources")
+		}
+		s := string(b)
+		resources = &s
+	}
 	q := `insert into tasks (
 		    id, -- $1
 			job_id, -- $2
@@ -284,13 +419,15 @@ func (ds *PostgresDatastore) CreateTask(ctx context.Context, t *tork.Task) error
 			if_, -- $36
 			tags, -- $37
 			priority, -- $38
-			workdir -- $39
+			workdir, -- $39
+			node_selector, -- $40
+			resources -- $41
 		  ) 
 	      values (
 			$1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,
 		    $15,$16,$17,$18,$19,$20,$21,$22,$23,$24,$25,$26,
 			$27,$28,$29,$30,$31,$32,$33,$34,$35,$36,$37,$38,
-			$39)`
+			$39,$40,$41)`
 	_, err = ds.exec(q,
 		t.ID,                         // $1
 		t.JobID,                      // $2
@@ -331,6 +468,8 @@ func (ds *PostgresDatastore) CreateTask(ctx context.Context, t *tork.Task) error
 		pq.StringArray(t.Tags),       // $37
 		t.Priority,                   // $38
 		t.Workdir,                    // $39
+		nodeSelector,                 // $40
+		resources,                    // $41
 	)
 	if err != nil {
 		return errors.Wrapf(err, "error inserting task to the db")
@@ -350,7 +489,7 @@ func (ds *PostgresDatastore) GetTaskByID(ctx context.Context, id string) (*tork.
 		}
 		return nil, errors.Wrapf(err, "error fetching task from db")
 	}
-	return r.toTask()
+	return r.toTask(ds.keyring)
 }
 
 func (ds *PostgresDatastore) UpdateTask(ctx context.Context, id string, modify func(t *tork.Task) error) error {
@@ -363,7 +502,7 @@ func (ds *PostgresDatastore) UpdateTask(ctx context.Context, id string, modify f
 		if err := ptx.get(&tr, `SELECT * FROM tasks where id = $1 for update`, id); err != nil {
 			return errors.Wrapf(err, "error fetching task %s from db", id)
 		}
-		t, err := tr.toTask()
+		t, err := tr.toTask(ds.keyring)
 		if err != nil {
 			return err
 		}
@@ -372,7 +511,7 @@ func (ds *PostgresDatastore) UpdateTask(ctx context.Context, id string, modify f
 		}
 		var each *string
 		if t.Each != nil {
-			b, err := json.Marshal(t.Each)
+			b, err := ds.sealJSON(t.Each)
 			if err != nil {
 				return errors.Wrapf(err, "failed to serialize task.each")
 			}
@@ -381,7 +520,7 @@ func (ds *PostgresDatastore) UpdateTask(ctx context.Context, id string, modify f
 		}
 		var parallel *string
 		if t.Parallel != nil {
-			b, err := json.Marshal(t.Parallel)
+			b, err := ds.sealJSON(t.Parallel)
 			if err != nil {
 				return errors.Wrapf(err, "failed to serialize task.parallel")
 			}
@@ -390,7 +529,7 @@ func (ds *PostgresDatastore) UpdateTask(ctx context.Context, id string, modify f
 		}
 		var subjob *string
 		if t.SubJob != nil {
-			b, err := json.Marshal(t.SubJob)
+			b, err := ds.sealJSON(t.SubJob)
 			if err != nil {
 				return errors.Wrapf(err, "failed to serialize task.subjob")
 			}
@@ -415,6 +554,15 @@ func (ds *PostgresDatastore) UpdateTask(ctx context.Context, id string, modify f
 			s := string(b)
 			retry = &s
 		}
+		var usage *string
+		if t.Usage != nil {
+			b, err := json.Marshal(t.Usage)
+			if err != nil {
+				return errors.Wrapf(err, "failed to serialize task.usage")
+			}
+			s := string(b)
+			usage = &s
+		}
 		q := `update tasks set 
 				position = $1,
 				state = $2,
@@ -433,8 +581,9 @@ func (ds *PostgresDatastore) UpdateTask(ctx context.Context, id string, modify f
 				retry = $15,
 				queue = $16,
 				progress = $17,
-				priority = $18
-			  where id = $19`
+				priority = $18,
+				usage_ = $19
+			  where id = $20`
 		_, err = ptx.exec(q,
 			t.Position,               // $1
 			t.State,                  // $2
@@ -454,7 +603,8 @@ func (ds *PostgresDatastore) UpdateTask(ctx context.Context, id string, modify f
 			t.Queue,                  // $16
 			t.Progress,               // $17
 			t.Priority,               // $18
-			t.ID,                     // $19
+			usage,                    // $19
+			t.ID,                     // $20
 		)
 		if err != nil {
 			return errors.Wrapf(err, "error updating task %s", t.ID)
@@ -464,11 +614,21 @@ func (ds *PostgresDatastore) UpdateTask(ctx context.Context, id string, modify f
 }
 
 func (ds *PostgresDatastore) CreateNode(ctx context.Context, n *tork.Node) error {
+	labels, capacity, allocated, err := serializeNodeResources(n)
+	if err != nil {
+		return err
+	}
+	rt, err := serializeNodeRuntime(n)
+	if err != nil {
+		return err
+	}
 	q := `insert into nodes 
-	       (id,name,started_at,last_heartbeat_at,cpu_percent,queue,status,hostname,task_count,version_,port)
+	       (id,name,started_at,last_heartbeat_at,cpu_percent,queue,status,hostname,task_count,version_,port,labels,capacity,allocated,leader,
+	        memory_used,memory_total,disk_free,load_average,runtime)
 	      values
-	       ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)`
-	_, err := ds.exec(q, n.ID, n.Name, n.StartedAt, n.LastHeartbeatAt, n.CPUPercent, n.Queue, n.Status, n.Hostname, n.TaskCount, n.Version, n.Port)
+	       ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20)`
+	_, err = ds.exec(q, n.ID, n.Name, n.StartedAt, n.LastHeartbeatAt, n.CPUPercent, n.Queue, n.Status, n.Hostname, n.TaskCount, n.Version, n.Port, labels, capacity, allocated, n.Leader,
+		n.MemoryUsed, n.MemoryTotal, n.DiskFree, pq.Float64Array(n.LoadAverage), rt)
 	if err != nil {
 		return errors.Wrapf(err, "error inserting node to the db")
 	}
@@ -485,17 +645,38 @@ func (ds *PostgresDatastore) UpdateNode(ctx context.Context, id string, modify f
 		if err := ptx.get(&nr, `SELECT * FROM nodes where id = $1 for update`, id); err != nil {
 			return errors.Wrapf(err, "error fetching node from db")
 		}
-		n := nr.toNode()
+		n, err := nr.toNode()
+		if err != nil {
+			return err
+		}
 		if err := modify(n); err != nil {
 			return err
 		}
+		labels, capacity, allocated, err := serializeNodeResources(n)
+		if err != nil {
+			return err
+		}
+		rt, err := serializeNodeRuntime(n)
+		if err != nil {
+			return err
+		}
 		q := `update nodes set 
 	        last_heartbeat_at = $1,
 			cpu_percent = $2,
 			status = $3,
-			task_count = $4
-		  where id = $5`
-		_, err := ptx.exec(q, n.LastHeartbeatAt, n.CPUPercent, n.Status, n.TaskCount, id)
+			task_count = $4,
+			labels = $5,
+			capacity = $6,
+			allocated = $7,
+			leader = $8,
+			memory_used = $9,
+			memory_total = $10,
+			disk_free = $11,
+			load_average = $12,
+			runtime = $13
+		  where id = $14`
+		_, err = ptx.exec(q, n.LastHeartbeatAt, n.CPUPercent, n.Status, n.TaskCount, labels, capacity, allocated, n.Leader,
+			n.MemoryUsed, n.MemoryTotal, n.DiskFree, pq.Float64Array(n.LoadAverage), rt, id)
 		if err != nil {
 			return errors.Wrapf(err, "error update node in db")
 		}
@@ -503,6 +684,70 @@ func (ds *PostgresDatastore) UpdateNode(ctx context.Context, id string, modify f
 	})
 }
 
+func serializeNodeResources(n *tork.Node) (labels, capacity, allocated *string, err error) {
+	if len(n.Labels) > 0 {
+		b, err := json.Marshal(n.Labels)
+		if err != nil {
+			return nil, nil, nil, errors.Wrapf(err, "failed to serialize node.labels")
+		}
+		s := string(b)
+		labels = &s
+	}
+	if n.Capacity != nil {
+		b, err := json.Marshal(n.Capacity)
+		if err != nil {
+			return nil, nil, nil, errors.Wrapf(err, "failed to serialize node.capacity")
+		}
+		s := string(b)
+		capacity = &s
+	}
+	if n.Allocated != nil {
+		b, err := json.Marshal(n.Allocated)
+		if err != nil {
+			return nil, nil, nil, errors.Wrapf(err, "failed to serialize node.allocated")
+		}
+		s := string(b)
+		allocated = &s
+	}
+	return labels, capacity, allocated, nil
+}
+
+func serializeNodeRuntime(n *tork.Node) (*string, error) {
+	if n.Runtime == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(n.Runtime)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to serialize node.runtime")
+	}
+	s := string(b)
+	return &s, nil
+}
+
+func (ds *PostgresDatastore) CreateNodeSample(ctx context.Context, nodeID string, s *tork.NodeSample) error {
+	q := `insert into nodes_samples 
+	       (id,node_id,created_at,cpu_percent,memory_used,disk_free,load_average,task_count,containers)
+	      values
+	       ($1,$2,$3,$4,$5,$6,$7,$8,$9)`
+	if _, err := ds.exec(q, uuid.NewUUID(), nodeID, s.Time, s.CPUPercent, s.MemoryUsed, s.DiskFree, s.LoadAverage, s.TaskCount, s.Containers); err != nil {
+		return errors.Wrapf(err, "error inserting node sample to the db")
+	}
+	return nil
+}
+
+func (ds *PostgresDatastore) GetNodeSamples(ctx context.Context, nodeID string, since time.Time) ([]*tork.NodeSample, error) {
+	rs := make([]nodeSampleRecord, 0)
+	q := `SELECT * FROM nodes_samples WHERE node_id = $1 AND created_at >= $2 ORDER BY created_at ASC`
+	if err := ds.select_(&rs, q, nodeID, since); err != nil {
+		return nil, errors.Wrapf(err, "error getting the samples of node %s from the db", nodeID)
+	}
+	result := make([]*tork.NodeSample, len(rs))
+	for i, r := range rs {
+		result[i] = r.toNodeSample()
+	}
+	return result, nil
+}
+
 func (ds *PostgresDatastore) GetNodeByID(ctx context.Context, id string) (*tork.Node, error) {
 	nr := nodeRecord{}
 	if err := ds.get(&nr, `SELECT * FROM nodes where id = $1`, id); err != nil {
@@ -511,7 +756,7 @@ func (ds *PostgresDatastore) GetNodeByID(ctx context.Context, id string) (*tork.
 		}
 		return nil, errors.Wrapf(err, "error fetching task from db")
 	}
-	return nr.toNode(), nil
+	return nr.toNode()
 }
 
 func (ds *PostgresDatastore) GetActiveNodes(ctx context.Context) ([]*tork.Node, error) {
@@ -525,9 +770,34 @@ func (ds *PostgresDatastore) GetActiveNodes(ctx context.Context) ([]*tork.Node,
 		return nil, errors.Wrapf(err, "error getting active nodes from db")
 	}
 	ns := make([]*tork.Node, len(nrs))
-	for i, n := range nrs {
+	for i, nr := range nrs {
+		n, err := nr.toNode()
+		if err != nil {
+			return nil, err
+		}
+		ns[i] = n
+	}
+	return ns, nil
+}
 
-		ns[i] = n.toNode()
+func (ds *PostgresDatastore) GetStaleNodes(ctx context.Context, lastHeartbeatBefore time.Time) ([]*tork.Node, error) {
+	nrs := []nodeRecord{}
+	q := `SELECT * 
+	      FROM nodes 
+		  where last_heartbeat_at < $1 
+		  AND status = ANY($2)
+		  ORDER BY name ASC`
+	statuses := pq.StringArray{string(tork.NodeStatusUP), string(tork.NodeStatusDraining)}
+	if err := ds.select_(&nrs, q, lastHeartbeatBefore, statuses); err != nil {
+		return nil, errors.Wrapf(err, "error getting stale nodes from db")
+	}
+	ns := make([]*tork.Node, len(nrs))
+	for i, nr := range nrs {
+		n, err := nr.toNode()
+		if err != nil {
+			return nil, err
+		}
+		ns[i] = n
 	}
 	return ns, nil
 }
@@ -543,11 +813,14 @@ func (ds *PostgresDatastore) CreateJob(ctx context.Context, j *tork.Job) error {
 		}
 		j.CreatedBy = guest
 	}
-	tasks, err := json.Marshal(j.Tasks)
+	if j.Namespace == "" {
+		j.Namespace = tork.NAMESPACE_DEFAULT
+	}
+	tasks, err := ds.sealJSON(j.Tasks)
 	if err != nil {
 		return errors.Wrapf(err, "failed to serialize job.tasks")
 	}
-	c, err := json.Marshal(j.Context)
+	c, err := ds.sealJSON(j.Context)
 	if err != nil {
 		return errors.Wrapf(err, "failed to serialize tork.Context")
 	}
@@ -573,7 +846,7 @@ func (ds *PostgresDatastore) CreateJob(ctx context.Context, j *tork.Job) error {
 		s := string(b)
 		autoDelete = &s
 	}
-	webhooks, err := json.Marshal(j.Webhooks)
+	webhooks, err := ds.sealJSON(j.Webhooks)
 	if err != nil {
 		return errors.Wrapf(err, "failed to serialize job.webhooks")
 	}
@@ -582,7 +855,7 @@ func (ds *PostgresDatastore) CreateJob(ctx context.Context, j *tork.Job) error {
 	}
 	var secrets *string
 	if j.Secrets != nil {
-		b, err := json.Marshal(j.Secrets)
+		b, err := ds.sealJSON(j.Secrets)
 		if err != nil {
 			return errors.Wrapf(err, "failed to serialize job.secrets")
 		}
@@ -600,12 +873,12 @@ func (ds *PostgresDatastore) CreateJob(ctx context.Context, j *tork.Job) error {
 		}
 		sql := `insert into jobs (id,name,description,state,created_at,started_at,tasks,position,
 					inputs,context,parent_id,task_count,output_,result,error_,defaults,webhooks,
-					created_by,tags,auto_delete,secrets,scheduled_job_id) 
+					created_by,tags,auto_delete,secrets,scheduled_job_id,namespace) 
 				values
-					($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22)`
+					($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23)`
 		if _, err := ptx.exec(sql, j.ID, j.Name, j.Description, j.State, j.CreatedAt, j.StartedAt, tasks, j.Position,
 			inputs, c, j.ParentID, j.TaskCount, j.Output, j.Result, j.Error, defaults, webhooks, j.CreatedBy.ID,
-			pq.StringArray(j.Tags), autoDelete, secrets, scheduledJobID); err != nil {
+			pq.StringArray(j.Tags), autoDelete, secrets, scheduledJobID, j.Namespace); err != nil {
 			return errors.Wrapf(err, "error inserting job to the db")
 		}
 		for _, perm := range j.Permissions {
@@ -642,21 +915,24 @@ func (ds *PostgresDatastore) UpdateJob(ctx context.Context, id string, modify fu
 			return errors.Wrapf(err, "error fetching job from db")
 		}
 		tasks := make([]*tork.Task, 0)
-		if err := json.Unmarshal(r.Tasks, &tasks); err != nil {
+		if err := unmarshalSealed(ds.keyring, r.Tasks, &tasks); err != nil {
 			return errors.Wrapf(err, "error desiralizing job.tasks")
 		}
 		createdBy, err := ds.GetUser(ctx, r.CreatedBy)
 		if err != nil {
 			return err
 		}
-		j, err := r.toJob(tasks, []*tork.Task{}, createdBy, []*tork.Permission{})
+		j, err := r.toJob(ds.keyring, tasks, []*tork.Task{}, createdBy, []*tork.Permission{})
 		if err != nil {
 			return errors.Wrapf(err, "failed to convert jobRecord")
 		}
 		if err := modify(j); err != nil {
 			return err
 		}
-		c, err := json.Marshal(j.Context)
+		if j.Tags == nil {
+			j.Tags = make([]string, 0)
+		}
+		c, err := ds.sealJSON(j.Context)
 		if err != nil {
 			return errors.Wrapf(err, "failed to serialize tork.Context")
 		}
@@ -670,9 +946,10 @@ func (ds *PostgresDatastore) UpdateJob(ctx context.Context, id string, modify fu
 				result = $7,
 				error_ = $8,
 				delete_at = $9,
-				progress = $10
-			  where id = $11`
-		_, err = ptx.exec(q, j.State, j.StartedAt, j.CompletedAt, j.FailedAt, j.Position, c, j.Result, j.Error, j.DeleteAt, j.Progress, j.ID)
+				progress = $10,
+				tags = $11
+			  where id = $12`
+		_, err = ptx.exec(q, j.State, j.StartedAt, j.CompletedAt, j.FailedAt, j.Position, c, j.Result, j.Error, j.DeleteAt, j.Progress, pq.StringArray(j.Tags), j.ID)
 		return err
 	})
 }
@@ -686,7 +963,7 @@ func (ds *PostgresDatastore) GetJobByID(ctx context.Context, id string) (*tork.J
 		return nil, errors.Wrapf(err, "error fetching job from db")
 	}
 	tasks := make([]*tork.Task, 0)
-	if err := json.Unmarshal(r.Tasks, &tasks); err != nil {
+	if err := unmarshalSealed(ds.keyring, r.Tasks, &tasks); err != nil {
 		return nil, errors.Wrapf(err, "error desiralizing job.tasks")
 	}
 	rse := make([]taskRecord, 0)
@@ -699,7 +976,7 @@ func (ds *PostgresDatastore) GetJobByID(ctx context.Context, id string) (*tork.J
 	}
 	exec := make([]*tork.Task, len(rse))
 	for i, r := range rse {
-		t, err := r.toTask()
+		t, err := r.toTask(ds.keyring)
 		if err != nil {
 			return nil, err
 		}
@@ -734,7 +1011,18 @@ func (ds *PostgresDatastore) GetJobByID(ctx context.Context, id string) (*tork.J
 		}
 		perms[i] = p
 	}
-	return r.toJob(tasks, exec, u, perms)
+	return r.toJob(ds.keyring, tasks, exec, u, perms)
+}
+
+func (ds *PostgresDatastore) GetJobNamespace(ctx context.Context, id string) (string, error) {
+	var namespace string
+	if err := ds.get(&namespace, `SELECT namespace FROM jobs where id = $1`, id); err != nil {
+		if err == sql.ErrNoRows {
+			return "", datastore.ErrJobNotFound
+		}
+		return "", errors.Wrapf(err, "error fetching the namespace of job %s", id)
+	}
+	return namespace, nil
 }
 
 func (ds *PostgresDatastore) GetActiveTasks(ctx context.Context, jobID string) ([]*tork.Task, error) {
@@ -750,7 +1038,7 @@ func (ds *PostgresDatastore) GetActiveTasks(ctx context.Context, jobID string) (
 	}
 	actives := make([]*tork.Task, len(rs))
 	for i, r := range rs {
-		t, err := r.toTask()
+		t, err := r.toTask(ds.keyring)
 		if err != nil {
 			return nil, err
 		}
@@ -760,6 +1048,30 @@ func (ds *PostgresDatastore) GetActiveTasks(ctx context.Context, jobID string) (
 	return actives, nil
 }
 
+func (ds *PostgresDatastore) GetActiveTasksByNodeID(ctx context.Context, nodeID string) ([]*tork.Task, error) {
+	rs := make([]taskRecord, 0)
+	// tasks placed on the node's own queue which it
+	// never started are orphaned as well
+	q := `SELECT * 
+	      FROM tasks 
+		  where (node_id = $1 AND state = ANY($2))
+		  OR (state = 'SCHEDULED' AND queue = (SELECT queue FROM nodes WHERE id = $1))
+		  ORDER BY created_at ASC`
+	activeStates := slices.Map(tork.TaskStateActive, func(state tork.TaskState) string { return string(state) })
+	if err := ds.select_(&rs, q, nodeID, pq.StringArray(activeStates)); err != nil {
+		return nil, errors.Wrapf(err, "error getting active tasks for node %s from db", nodeID)
+	}
+	actives := make([]*tork.Task, len(rs))
+	for i, r := range rs {
+		t, err := r.toTask(ds.keyring)
+		if err != nil {
+			return nil, err
+		}
+		actives[i] = t
+	}
+	return actives, nil
+}
+
 func (ds *PostgresDatastore) GetNextTask(ctx context.Context, parentTaskID string) (*tork.Task, error) {
 	r := taskRecord{}
 	if err := ds.get(&r, `SELECT * FROM tasks where parent_id = $1 and state = 'CREATED' limit 1`, parentTaskID); err != nil {
@@ -768,7 +1080,7 @@ func (ds *PostgresDatastore) GetNextTask(ctx context.Context, parentTaskID strin
 		}
 		return nil, errors.Wrapf(err, "error fetching task from db")
 	}
-	return r.toTask()
+	return r.toTask(ds.keyring)
 }
 
 func (ds *PostgresDatastore) CreateTaskLogPart(ctx context.Context, p *tork.TaskLogPart) error {
@@ -790,6 +1102,9 @@ func (ds *PostgresDatastore) CreateTaskLogPart(ctx context.Context, p *tork.Task
 }
 
 func (ds *PostgresDatastore) expungeExpiredTaskLogPart() (int, error) {
+	if ds.archiver != nil {
+		return ds.archiveExpiredTaskLogParts()
+	}
 	q := `delete from tasks_log_parts where id in ( 
 	        select id 
 		    from   tasks_log_parts 
@@ -798,7 +1113,7 @@ func (ds *PostgresDatastore) expungeExpiredTaskLogPart() (int, error) {
 	      )`
 	res, err := ds.exec(q, time.Now().UTC().Add(-*ds.logsRetentionDuration))
 	if err != nil {
-		return 0, errors.Wrapf(err, "error deleting expired task log parts from the db")
+		return 0, errors.Wrapf(err, "error deleting task log parts from the db")
 	}
 	rows, err := res.RowsAffected()
 	if err != nil {
@@ -807,18 +1122,69 @@ func (ds *PostgresDatastore) expungeExpiredTaskLogPart() (int, error) {
 	return int(rows), nil
 }
 
+func (ds *PostgresDatastore) expungeExpiredAuditEvents() (int, error) {
+	q := `delete from audit_events where id in ( 
+	        select id 
+		    from   audit_events 
+		    where  created_at < $1 
+		    limit  1000
+	      )`
+	res, err := ds.exec(q, time.Now().UTC().Add(-*ds.auditRetentionDuration))
+	if err != nil {
+		return 0, errors.Wrapf(err, "error deleting expired audit events from the db")
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrapf(err, "error getting the number of deleted audit events")
+	}
+	return int(rows), nil
+}
+
+func (ds *PostgresDatastore) expungeExpiredNodeSamples() (int, error) {
+	q := `delete from nodes_samples where id in ( 
+	        select id 
+		    from   nodes_samples 
+		    where  created_at < $1 
+		    limit  1000
+	      )`
+	res, err := ds.exec(q, time.Now().UTC().Add(-tork.NODE_HISTORY_DURATION))
+	if err != nil {
+		return 0, errors.Wrapf(err, "error deleting expired node samples from the db")
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrapf(err, "error getting the number of deleted node samples")
+	}
+	return int(rows), nil
+}
+
 func (ds *PostgresDatastore) expungeExpiredJobs() (int, error) {
+	const expired = "(delete_at < current_timestamp) OR (created_at < $1 AND (state = 'COMPLETED' or state = 'FAILED' or state = 'CANCELLED'))"
+	retention := time.Now().UTC().Add(-*ds.jobsRetentionDuration)
+	ids := []string{}
+	if err := ds.select_(&ids, "select id from jobs where "+expired+" limit 1000", retention); err != nil {
+		return 0, errors.Wrapf(err, "error getting list of expired job ids from the db")
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	// export ahead of the transaction, which would
+	// otherwise stay open for as long as the upload
+	if err := ds.archiveJobs(context.Background(), ids); err != nil {
+		return 0, err
+	}
 	var n int
 	if err := ds.WithTx(context.Background(), func(tx datastore.Datastore) error {
 		ptx, ok := tx.(*PostgresDatastore)
 		if !ok {
 			return errors.New("unable to cast to a postgres datastore")
 		}
-		ids := []string{}
-		if err := ptx.select_(&ids, "select id from jobs where (delete_at < current_timestamp) OR (created_at < $1 AND (state = 'COMPLETED' or state = 'FAILED' or state = 'CANCELLED')) limit 1000", time.Now().UTC().Add(-*ds.jobsRetentionDuration)); err != nil {
-			return errors.Wrapf(err, "error getting list of expired job ids from the db")
+		// leave out any job which stopped being expired since, e.g. restarted
+		locked := []string{}
+		if err := ptx.select_(&locked, "select id from jobs where id = ANY($2) AND ("+expired+") for update", retention, pq.StringArray(ids)); err != nil {
+			return errors.Wrapf(err, "error locking expired jobs in the db")
 		}
-		res, err := ds.deleteJobs(ptx, ids)
+		res, err := ds.deleteJobs(ptx, locked)
 		if err != nil {
 			return err
 		}
@@ -836,17 +1202,17 @@ func (ds *PostgresDatastore) deleteJobs(ptx *PostgresDatastore, ids []string) (i
 		return 0, nil
 	}
 	if _, err := ptx.exec(`delete from jobs_perms where job_id = ANY($1);`, pq.StringArray(ids)); err != nil {
-		return 0, errors.Wrapf(err, "error deleting expired job perms from the db")
+		return 0, errors.Wrapf(err, "error deleting job perms from the db")
 	}
 	if _, err := ptx.exec(`delete from tasks_log_parts where task_id in (select id from tasks where job_id = ANY($1));`, pq.StringArray(ids)); err != nil {
-		return 0, errors.Wrapf(err, "error deleting expired task log parts from the db")
+		return 0, errors.Wrapf(err, "error deleting task log parts from the db")
 	}
 	if _, err := ptx.exec(`delete from tasks where job_id = ANY($1);`, pq.StringArray(ids)); err != nil {
-		return 0, errors.Wrapf(err, "error deleting expired tasks from the db")
+		return 0, errors.Wrapf(err, "error deleting tasks from the db")
 	}
 	res, err := ptx.exec(`delete from jobs where id = ANY($1);`, pq.StringArray(ids))
 	if err != nil {
-		return 0, errors.Wrapf(err, "error deleting expired jobs from the db")
+		return 0, errors.Wrapf(err, "error deleting jobs from the db")
 	}
 	rows, err := res.RowsAffected()
 	if err != nil {
@@ -856,17 +1222,49 @@ func (ds *PostgresDatastore) deleteJobs(ptx *PostgresDatastore, ids []string) (i
 	return n, nil
 }
 
-func (ds *PostgresDatastore) GetTaskLogParts(ctx context.Context, taskID, q string, page, size int) (*datastore.Page[*tork.TaskLogPart], error) {
+func (ds *PostgresDatastore) DeleteJob(ctx context.Context, id string) error {
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		ptx, ok := tx.(*PostgresDatastore)
+		if !ok {
+			return errors.New("unable to cast to a postgres datastore")
+		}
+		n, err := ds.deleteJobs(ptx, []string{id})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return datastore.ErrJobNotFound
+		}
+		return nil
+	})
+}
+
+func (ds *PostgresDatastore) GetTaskLogParts(ctx context.Context, taskID, q, cursor string, page, size int) (*datastore.Page[*tork.TaskLogPart], error) {
 	searchTerm, _ := parseQuery(q)
 	offset := (page - 1) * size
+	args := []any{taskID, searchTerm}
+	where := `task_id = $1 and ($2 = '' OR ts @@ plainto_tsquery('english', $2))`
+	if cursor != "" {
+		keys, err := decodeCursor(cursor, "task-log", 2)
+		if err != nil {
+			return nil, err
+		}
+		number, err := parseCursorInt(keys[0])
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, number, keys[1])
+		where = where + ` and (number_, id) < ($3, $4)`
+		offset = 0
+	}
 	rs := []taskLogPartRecord{}
 	qry := fmt.Sprintf(`select * 
 	      from tasks_log_parts 
-		  where task_id = $1 and ($2 = '' OR ts @@ plainto_tsquery('english', $2))
-		  order by number_ DESC
-		  offset %d limit %d`, offset, size)
+		  where %s
+		  order by number_ DESC, id DESC
+		  offset %d limit %d`, where, offset, size)
 
-	if err := ds.select_(&rs, qry, taskID, searchTerm); err != nil {
+	if err := ds.select_(&rs, qry, args...); err != nil {
 		return nil, errors.Wrapf(err, "error task log parts from db")
 	}
 	items := make([]*tork.TaskLogPart, len(rs))
@@ -881,28 +1279,61 @@ func (ds *PostgresDatastore) GetTaskLogParts(ctx context.Context, taskID, q stri
 	if *count%size != 0 {
 		totalPages = totalPages + 1
 	}
+	var next string
+	if len(rs) == size {
+		last := rs[len(rs)-1]
+		next = encodeCursor("task-log", strconv.Itoa(last.Number), last.ID)
+	}
 	return &datastore.Page[*tork.TaskLogPart]{
 		Items:      items,
 		Number:     page,
 		Size:       len(items),
 		TotalPages: totalPages,
 		TotalItems: *count,
+		NextCursor: next,
 	}, nil
 }
 
-func (ds *PostgresDatastore) GetJobLogParts(ctx context.Context, jobID, q string, page, size int) (*datastore.Page[*tork.TaskLogPart], error) {
+func (ds *PostgresDatastore) GetJobLogParts(ctx context.Context, jobID, q, cursor string, page, size int) (*datastore.Page[*tork.TaskLogPart], error) {
 	searchTerm, _ := parseQuery(q)
 	offset := (page - 1) * size
-	rs := []taskLogPartRecord{}
-	qry := fmt.Sprintf(`select tlp.* 
+	args := []any{jobID, searchTerm}
+	where := `t.job_id = $1 and ($2 = '' OR ts @@ plainto_tsquery('english', $2))`
+	if cursor != "" {
+		keys, err := decodeCursor(cursor, "job-log", 5)
+		if err != nil {
+			return nil, err
+		}
+		position, err := parseCursorInt(keys[0])
+		if err != nil {
+			return nil, err
+		}
+		taskCreatedAt, err := parseCursorTime(keys[1])
+		if err != nil {
+			return nil, err
+		}
+		number, err := parseCursorInt(keys[2])
+		if err != nil {
+			return nil, err
+		}
+		createdAt, err := parseCursorTime(keys[3])
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, position, taskCreatedAt, number, createdAt, keys[4])
+		where = where + ` and (t.position, t.created_at, tlp.number_, tlp.created_at, tlp.id) < ($3, $4, $5, $6, $7)`
+		offset = 0
+	}
+	rs := []jobLogPartRecord{}
+	qry := fmt.Sprintf(`select tlp.*, t.position as task_position, t.created_at as task_created_at
 	      from tasks_log_parts tlp
 		  join tasks t
 		  on t.id = tlp.task_id
-		  where t.job_id = $1 and ($2 = '' OR ts @@ plainto_tsquery('english', $2))
-		  order by t.position desc, t.created_at desc, tlp.number_ desc, tlp.created_at DESC
-		  offset %d limit %d`, offset, size)
+		  where %s
+		  order by t.position desc, t.created_at desc, tlp.number_ desc, tlp.created_at DESC, tlp.id DESC
+		  offset %d limit %d`, where, offset, size)
 
-	if err := ds.select_(&rs, qry, jobID, searchTerm); err != nil {
+	if err := ds.select_(&rs, qry, args...); err != nil {
 		return nil, errors.Wrapf(err, "error task log parts from db")
 	}
 	items := make([]*tork.TaskLogPart, len(rs))
@@ -921,25 +1352,35 @@ func (ds *PostgresDatastore) GetJobLogParts(ctx context.Context, jobID, q string
 	if *count%size != 0 {
 		totalPages = totalPages + 1
 	}
+	var next string
+	if len(rs) == size {
+		last := rs[len(rs)-1]
+		next = encodeCursor("job-log",
+			strconv.Itoa(last.TaskPosition),
+			cursorTime(last.TaskCreatedAt),
+			strconv.Itoa(last.Number),
+			cursorTime(last.CreateAt),
+			last.ID,
+		)
+	}
 	return &datastore.Page[*tork.TaskLogPart]{
 		Items:      items,
 		Number:     page,
 		Size:       len(items),
 		TotalPages: totalPages,
 		TotalItems: *count,
+		NextCursor: next,
 	}, nil
 }
 
-func (ds *PostgresDatastore) GetJobs(ctx context.Context, currentUser, q string, page, size int) (*datastore.Page[*tork.JobSummary], error) {
-	searchTerm, tags := parseQuery(q)
-
-	offset := (page - 1) * size
-	rs := make([]jobRecord, 0)
-	qry := fmt.Sprintf(`
+// jobsVisibility selects, as visible_jobs, the jobs visible to the
+// user bound to $1: those without permissions and those the user,
+// or one of the user's roles, is permitted to see.
+const jobsVisibility = `
       WITH user_info AS (
         SELECT id AS user_id
         FROM users
-        WHERE username_ = $3
+        WHERE username_ = $1
       ),
       role_info AS (
         SELECT role_id
@@ -958,22 +1399,62 @@ func (ds *PostgresDatastore) GetJobs(ctx context.Context, currentUser, q string,
         where not exists (
 		  select 1 from jobs_perms jp where j.id = jp.job_id
 		)
-      )
-      SELECT j.*
-      FROM jobs j
-      WHERE 
-        ($1 = '' OR ts @@ plainto_tsquery('english', $1))
-      AND 
-        (coalesce(array_length($2::text[], 1),0) = 0 OR j.tags && $2)
-      AND
-        ($3 = '' OR EXISTS (select 1 from no_job_perms njp where njp.job_id=j.id) OR EXISTS (
+      )`
+
+var jobsSortColumns = map[string]string{
+	search.SortCreated: "j.created_at",
+	search.SortName:    "COALESCE(j.name,'')",
+	search.SortState:   "j.state",
+}
+
+func (ds *PostgresDatastore) GetJobs(ctx context.Context, currentUser, namespace string, q *search.Query, cursor string, page, size int) (*datastore.Page[*tork.JobSummary], error) {
+	if q == nil {
+		q = &search.Query{Sort: search.DefaultSort}
+	}
+	args := []any{currentUser, namespace}
+	filter, err := jobsFilter(q.Expr, &args)
+	if err != nil {
+		return nil, err
+	}
+	where := fmt.Sprintf(`
+        ($1 = '' OR EXISTS (select 1 from no_job_perms njp where njp.job_id=j.id) OR EXISTS (
            SELECT 1
            FROM job_perms_info jpi
            WHERE jpi.job_id = j.id
         ))
-	  ORDER BY created_at DESC 
-	  OFFSET %d LIMIT %d`, offset, size)
-	if err := ds.select_(&rs, qry, searchTerm, pq.StringArray(tags), currentUser); err != nil {
+      AND
+        ($2 = '' OR j.namespace = $2)
+      AND
+        %s`, filter)
+	countQuery := fmt.Sprintf(`%s SELECT count(*) FROM jobs j WHERE %s`, jobsVisibility, where)
+	countArgs := append([]any{}, args...)
+
+	sortCol, ok := jobsSortColumns[q.Sort.Field]
+	if !ok {
+		return nil, errors.Errorf("can't sort jobs by %s", q.Sort.Field)
+	}
+	dir, cmp := "ASC", ">"
+	if q.Sort.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	offset := (page - 1) * size
+	if cursor != "" {
+		after, err := parseJobsCursor(cursor, q.Sort)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, after...)
+		where = fmt.Sprintf("%s AND (%s, j.id) %s ($%d, $%d)", where, sortCol, cmp, len(args)-1, len(args))
+		offset = 0
+	}
+	rs := make([]jobRecord, 0)
+	qry := fmt.Sprintf(`%s
+      SELECT j.*
+      FROM jobs j
+      WHERE %s
+	  ORDER BY %s %s, j.id %s
+	  OFFSET %d LIMIT %d`, jobsVisibility, where, sortCol, dir, dir, offset, size)
+	if err := ds.select_(&rs, qry, args...); err != nil {
 		return nil, errors.Wrapf(err, "error getting a page of jobs")
 	}
 	result := make([]*tork.JobSummary, len(rs))
@@ -982,7 +1463,7 @@ func (ds *PostgresDatastore) GetJobs(ctx context.Context, currentUser, q string,
 		if err != nil {
 			return nil, err
 		}
-		j, err := r.toJob([]*tork.Task{}, []*tork.Task{}, createdBy, []*tork.Permission{})
+		j, err := r.toJob(ds.keyring, []*tork.Task{}, []*tork.Task{}, createdBy, []*tork.Permission{})
 		if err != nil {
 			return nil, err
 		}
@@ -990,43 +1471,7 @@ func (ds *PostgresDatastore) GetJobs(ctx context.Context, currentUser, q string,
 	}
 
 	var count *int
-	if err := ds.get(&count, `
-      WITH user_info AS (
-        SELECT id AS user_id
-        FROM users
-        WHERE username_ = $3
-      ),
-      role_info AS (
-        SELECT role_id
-        FROM users_roles ur
-        JOIN user_info ui ON ur.user_id = ui.user_id
-      ),
-      job_perms_info AS (
-        SELECT job_id
-        FROM jobs_perms jp
-        WHERE jp.user_id = (SELECT user_id FROM user_info)
-        OR jp.role_id IN (SELECT role_id FROM role_info)
-      ),
-      no_job_perms AS (
-        SELECT j.id as job_id
-        FROM jobs j
-        where not exists (
-		  select 1 from jobs_perms jp where j.id = jp.job_id
-		)
-      )
-      SELECT count(*)
-      FROM jobs j
-      WHERE 
-        ($1 = '' OR ts @@ plainto_tsquery('english', $1))
-      AND 
-        (coalesce(array_length($2::text[], 1),0) = 0 OR j.tags && $2)
-      AND
-        ($3 = '' OR EXISTS (select 1 from no_job_perms njp where njp.job_id=j.id) OR EXISTS (
-           SELECT 1
-           FROM job_perms_info jpi
-           WHERE jpi.job_id = j.id
-        ));
-	  `, searchTerm, pq.StringArray(tags), currentUser); err != nil {
+	if err := ds.get(&count, countQuery, countArgs...); err != nil {
 		return nil, errors.Wrapf(err, "error getting the jobs count")
 	}
 
@@ -1035,15 +1480,198 @@ func (ds *PostgresDatastore) GetJobs(ctx context.Context, currentUser, q string,
 		totalPages = totalPages + 1
 	}
 
+	var next string
+	if len(rs) == size {
+		next = newJobsCursor(rs[len(rs)-1], q.Sort)
+	}
+
 	return &datastore.Page[*tork.JobSummary]{
 		Items:      result,
 		Number:     page,
 		Size:       len(result),
 		TotalPages: totalPages,
 		TotalItems: *count,
+		NextCursor: next,
 	}, nil
 }
 
+// pageCursor marks the last item of a page by the values of the
+// columns the items are sorted by, the last of which is its ID.
+type pageCursor struct {
+	Sort string   `json:"s"`
+	Keys []string `json:"k"`
+}
+
+func encodeCursor(sort string, keys ...string) string {
+	b, _ := json.Marshal(pageCursor{Sort: sort, Keys: keys})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor returns the keys of a cursor which must have
+// been returned by a query with the same sort order.
+func decodeCursor(cursor, sort string, n int) ([]string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, datastore.ErrInvalidCursor
+	}
+	c := pageCursor{}
+	if err := json.Unmarshal(b, &c); err != nil || c.Sort != sort || len(c.Keys) != n {
+		return nil, datastore.ErrInvalidCursor
+	}
+	return c.Keys, nil
+}
+
+func cursorTime(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+func parseCursorTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, datastore.ErrInvalidCursor
+	}
+	return t, nil
+}
+
+func parseCursorInt(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, datastore.ErrInvalidCursor
+	}
+	return n, nil
+}
+
+func sortKey(s search.Sort) string {
+	if s.Desc {
+		return "-" + s.Field
+	}
+	return s.Field
+}
+
+func newJobsCursor(r jobRecord, s search.Sort) string {
+	var value string
+	switch s.Field {
+	case search.SortCreated:
+		value = cursorTime(r.CreatedAt)
+	case search.SortName:
+		value = r.Name
+	case search.SortState:
+		value = r.State
+	}
+	return encodeCursor(sortKey(s), value, r.ID)
+}
+
+func parseJobsCursor(cursor string, s search.Sort) ([]any, error) {
+	keys, err := decodeCursor(cursor, sortKey(s), 2)
+	if err != nil {
+		return nil, err
+	}
+	if s.Field == search.SortCreated {
+		t, err := parseCursorTime(keys[0])
+		if err != nil {
+			return nil, err
+		}
+		return []any{t, keys[1]}, nil
+	}
+	return []any{keys[0], keys[1]}, nil
+}
+
+// jobsFilter translates a search expression to a condition
+// on the jobs table, aliased j, appending its parameters.
+func jobsFilter(e search.Expr, args *[]any) (string, error) {
+	arg := func(v any) string {
+		*args = append(*args, v)
+		return fmt.Sprintf("$%d", len(*args))
+	}
+	join := func(exprs []search.Expr, op string) (string, error) {
+		parts := make([]string, len(exprs))
+		for i, e := range exprs {
+			part, err := jobsFilter(e, args)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = part
+		}
+		return fmt.Sprintf("(%s)", strings.Join(parts, op)), nil
+	}
+	switch e := e.(type) {
+	case nil:
+		return "TRUE", nil
+	case *search.And:
+		return join(e.Exprs, " AND ")
+	case *search.Or:
+		return join(e.Exprs, " OR ")
+	case *search.Not:
+		cond, err := jobsFilter(e.Expr, args)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("NOT %s", cond), nil
+	case *search.Text:
+		return fmt.Sprintf("j.ts @@ plainto_tsquery('english', %s)", arg(e.Value)), nil
+	case *search.Filter:
+		switch {
+		case e.Field == search.FieldState:
+			return fmt.Sprintf("j.state = %s", arg(e.Value)), nil
+		case e.Field == search.FieldCreated || e.Field == search.FieldStarted || e.Field == search.FieldCompleted:
+			return timeFilter(e, fmt.Sprintf("j.%s_at", e.Field), arg)
+		case e.Field == search.FieldUser:
+			return fmt.Sprintf("j.created_by IN (SELECT id FROM users WHERE username_ = %s)", arg(e.Value)), nil
+		case e.Field == search.FieldName:
+			return fmt.Sprintf("j.name ILIKE %s", arg(likePattern(e.Value))), nil
+		case e.Field == search.FieldTag:
+			return fmt.Sprintf("%s = ANY(j.tags)", arg(e.Value)), nil
+		case e.Field == search.FieldParent:
+			return fmt.Sprintf("j.parent_id = %s", arg(e.Value)), nil
+		case strings.HasPrefix(e.Field, search.FieldInput):
+			key := arg(strings.TrimPrefix(e.Field, search.FieldInput))
+			if e.Wildcard() {
+				return fmt.Sprintf("j.inputs ->> %s ILIKE %s", key, arg(likePattern(e.Value))), nil
+			}
+			return fmt.Sprintf("j.inputs ->> %s = %s", key, arg(e.Value)), nil
+		}
+		return "", errors.Errorf("unknown search field: %s", e.Field)
+	default:
+		return "", errors.Errorf("unknown search expression: %T", e)
+	}
+}
+
+// timeFilter compares a timestamp column to the value of the filter.
+// A date stands for the whole day, so that created:>2026-01-01
+// matches the jobs created from January 2nd onward.
+func timeFilter(f *search.Filter, col string, arg func(v any) string) (string, error) {
+	t, day, err := f.Time()
+	if err != nil {
+		return "", err
+	}
+	if !day {
+		op := string(f.Op)
+		if f.Op == search.OpEq {
+			op = "="
+		}
+		return fmt.Sprintf("%s %s %s", col, op, arg(t)), nil
+	}
+	next := t.AddDate(0, 0, 1)
+	switch f.Op {
+	case search.OpGt:
+		return fmt.Sprintf("%s >= %s", col, arg(next)), nil
+	case search.OpGte:
+		return fmt.Sprintf("%s >= %s", col, arg(t)), nil
+	case search.OpLt:
+		return fmt.Sprintf("%s < %s", col, arg(t)), nil
+	case search.OpLte:
+		return fmt.Sprintf("%s < %s", col, arg(next)), nil
+	default:
+		return fmt.Sprintf("(%s >= %s AND %s < %s)", col, arg(t), col, arg(next)), nil
+	}
+}
+
+// likePattern converts a value with '*' wildcards to a LIKE pattern.
+func likePattern(v string) string {
+	v = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(v)
+	return strings.ReplaceAll(v, "*", "%")
+}
+
 func (ds *PostgresDatastore) GetUser(ctx context.Context, uid string) (*tork.User, error) {
 	r := userRecord{}
 	if err := ds.get(&r, `SELECT * FROM users where (username_ = $1 or id = $1)`, uid); err != nil {
@@ -1070,6 +1698,200 @@ func (ds *PostgresDatastore) CreateUser(ctx context.Context, u *tork.User) error
 	return nil
 }
 
+func (ds *PostgresDatastore) UpdateUser(ctx context.Context, id string, modify func(u *tork.User) error) error {
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		ptx, ok := tx.(*PostgresDatastore)
+		if !ok {
+			return errors.New("unable to cast to a postgres datastore")
+		}
+		r := userRecord{}
+		if err := ptx.get(&r, `SELECT * FROM users where id = $1 for update`, id); err != nil {
+			if err == sql.ErrNoRows {
+				return datastore.ErrUserNotFound
+			}
+			return errors.Wrapf(err, "error fetching user from db")
+		}
+		u := r.toUser()
+		if err := modify(u); err != nil {
+			return err
+		}
+		q := `update users set 
+		        name = $1,
+		        password_ = $2,
+		        is_disabled = $3
+		      where id = $4`
+		if _, err := ptx.exec(q, u.Name, u.PasswordHash, u.Disabled, id); err != nil {
+			return errors.Wrapf(err, "error updating user in the db")
+		}
+		return nil
+	})
+}
+
+func (ds *PostgresDatastore) DeleteUser(ctx context.Context, id string) error {
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		ptx, ok := tx.(*PostgresDatastore)
+		if !ok {
+			return errors.New("unable to cast to a postgres datastore")
+		}
+		var owned int
+		if err := ptx.get(&owned, `select (select count(*) from jobs where created_by = $1) + (select count(*) from scheduled_jobs where created_by = $1)`, id); err != nil {
+			return errors.Wrapf(err, "error counting the user's jobs")
+		}
+		if owned > 0 {
+			return datastore.ErrUserInUse
+		}
+		if _, err := ptx.exec(`delete from users_roles where user_id = $1`, id); err != nil {
+			return errors.Wrapf(err, "error deleting user roles from db")
+		}
+		if _, err := ptx.exec(`delete from users_tokens where user_id = $1`, id); err != nil {
+			return errors.Wrapf(err, "error deleting user tokens from db")
+		}
+		if _, err := ptx.exec(`delete from users_identities where user_id = $1`, id); err != nil {
+			return errors.Wrapf(err, "error deleting user identities from db")
+		}
+		if _, err := ptx.exec(`delete from jobs_perms where user_id = $1`, id); err != nil {
+			return errors.Wrapf(err, "error deleting user job perms from db")
+		}
+		if _, err := ptx.exec(`delete from scheduled_jobs_perms where user_id = $1`, id); err != nil {
+			return errors.Wrapf(err, "error deleting user scheduled job perms from db")
+		}
+		if _, err := ptx.exec(`delete from namespaces_members where user_id = $1`, id); err != nil {
+			return errors.Wrapf(err, "error deleting user namespace memberships from db")
+		}
+		res, err := ptx.exec(`delete from users where id = $1`, id)
+		if err != nil {
+			return errors.Wrapf(err, "error deleting user from db")
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return errors.Wrapf(err, "error deleting user from db")
+		} else if n == 0 {
+			return datastore.ErrUserNotFound
+		}
+		return nil
+	})
+}
+
+func (ds *PostgresDatastore) CreateUserToken(ctx context.Context, t *tork.UserToken) error {
+	if t.UserID == "" {
+		return errors.Errorf("must provide user id")
+	}
+	if t.TokenHash == "" {
+		return errors.Errorf("must provide token hash")
+	}
+	t.ID = uuid.NewUUID()
+	now := time.Now().UTC()
+	t.CreatedAt = &now
+	q := `insert into users_tokens 
+	       (id,user_id,name,token_hash,scopes,created_at,expires_at) 
+	      values
+	       ($1,$2,$3,$4,$5,$6,$7)`
+	_, err := ds.exec(q, t.ID, t.UserID, t.Name, t.TokenHash, pq.StringArray(t.Scopes), t.CreatedAt, t.ExpiresAt)
+	if err != nil {
+		return errors.Wrapf(err, "error inserting user token to the db")
+	}
+	return nil
+}
+
+func (ds *PostgresDatastore) GetUserTokens(ctx context.Context, userID string) ([]*tork.UserToken, error) {
+	rs := []userTokenRecord{}
+	if err := ds.select_(&rs, `SELECT * FROM users_tokens where user_id = $1 order by created_at`, userID); err != nil {
+		return nil, errors.Wrapf(err, "error fetching user tokens from db")
+	}
+	result := make([]*tork.UserToken, len(rs))
+	for i, r := range rs {
+		result[i] = r.toUserToken()
+	}
+	return result, nil
+}
+
+func (ds *PostgresDatastore) GetUserTokenByHash(ctx context.Context, tokenHash string) (*tork.UserToken, error) {
+	r := userTokenRecord{}
+	if err := ds.get(&r, `SELECT * FROM users_tokens where token_hash = $1`, tokenHash); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, datastore.ErrTokenNotFound
+		}
+		return nil, errors.Wrapf(err, "error fetching user token from db")
+	}
+	return r.toUserToken(), nil
+}
+
+func (ds *PostgresDatastore) UpdateUserTokenLastUsed(ctx context.Context, id string, lastUsedAt time.Time) error {
+	if _, err := ds.exec(`update users_tokens set last_used_at = $1 where id = $2`, lastUsedAt, id); err != nil {
+		return errors.Wrapf(err, "error updating user token in db")
+	}
+	return nil
+}
+
+func (ds *PostgresDatastore) DeleteUserToken(ctx context.Context, userID, id string) error {
+	res, err := ds.exec(`delete from users_tokens where user_id = $1 and id = $2`, userID, id)
+	if err != nil {
+		return errors.Wrapf(err, "error deleting user token from db")
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return errors.Wrapf(err, "error deleting user token from db")
+	} else if n == 0 {
+		return datastore.ErrTokenNotFound
+	}
+	return nil
+}
+
+func (ds *PostgresDatastore) CreateUserIdentity(ctx context.Context, i *tork.UserIdentity) error {
+	if i.UserID == "" {
+		return errors.Errorf("must provide user id")
+	}
+	if i.Issuer == "" || i.Subject == "" {
+		return errors.Errorf("must provide issuer and subject")
+	}
+	i.ID = uuid.NewUUID()
+	now := time.Now().UTC()
+	i.CreatedAt = &now
+	q := `insert into users_identities 
+	       (id,user_id,issuer,subject,created_at) 
+	      values
+	       ($1,$2,$3,$4,$5)`
+	_, err := ds.exec(q, i.ID, i.UserID, i.Issuer, i.Subject, i.CreatedAt)
+	if err != nil {
+		return errors.Wrapf(err, "error inserting user identity to the db")
+	}
+	return nil
+}
+
+func (ds *PostgresDatastore) GetUserIdentities(ctx context.Context, userID string) ([]*tork.UserIdentity, error) {
+	rs := []userIdentityRecord{}
+	if err := ds.select_(&rs, `SELECT * FROM users_identities where user_id = $1 order by created_at`, userID); err != nil {
+		return nil, errors.Wrapf(err, "error fetching user identities from db")
+	}
+	result := make([]*tork.UserIdentity, len(rs))
+	for i, r := range rs {
+		result[i] = r.toUserIdentity()
+	}
+	return result, nil
+}
+
+func (ds *PostgresDatastore) GetUserByIdentity(ctx context.Context, issuer, subject string) (*tork.User, error) {
+	r := userRecord{}
+	if err := ds.get(&r, `SELECT u.* FROM users u inner join users_identities ui on ui.user_id = u.id where ui.issuer = $1 and ui.subject = $2`, issuer, subject); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, datastore.ErrUserNotFound
+		}
+		return nil, errors.Wrapf(err, "error fetching user from db")
+	}
+	return r.toUser(), nil
+}
+
+func (ds *PostgresDatastore) DeleteUserIdentity(ctx context.Context, userID, id string) error {
+	res, err := ds.exec(`delete from users_identities where user_id = $1 and id = $2`, userID, id)
+	if err != nil {
+		return errors.Wrapf(err, "error deleting user identity from db")
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return errors.Wrapf(err, "error deleting user identity from db")
+	} else if n == 0 {
+		return datastore.ErrIdentityNotFound
+	}
+	return nil
+}
+
 func (ds *PostgresDatastore) CreateRole(ctx context.Context, r *tork.Role) error {
 	r.ID = uuid.NewUUID()
 	now := time.Now().UTC()
@@ -1088,6 +1910,9 @@ func (ds *PostgresDatastore) CreateRole(ctx context.Context, r *tork.Role) error
 func (ds *PostgresDatastore) GetRole(ctx context.Context, id string) (*tork.Role, error) {
 	r := roleRecord{}
 	if err := ds.get(&r, `SELECT * FROM roles where id = $1 or slug = $1`, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, datastore.ErrRoleNotFound
+		}
 		return nil, errors.Wrapf(err, "error fetching role from db")
 	}
 	return r.toRole(), nil
@@ -1105,6 +1930,40 @@ func (ds *PostgresDatastore) GetRoles(ctx context.Context) ([]*tork.Role, error)
 	return result, nil
 }
 
+func (ds *PostgresDatastore) DeleteRole(ctx context.Context, id string) error {
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		ptx, ok := tx.(*PostgresDatastore)
+		if !ok {
+			return errors.New("unable to cast to a postgres datastore")
+		}
+		if _, err := ptx.exec(`delete from users_roles where role_id = $1`, id); err != nil {
+			return errors.Wrapf(err, "error deleting role assignments from db")
+		}
+		if _, err := ptx.exec(`delete from jobs_perms where role_id = $1`, id); err != nil {
+			return errors.Wrapf(err, "error deleting role job perms from db")
+		}
+		if _, err := ptx.exec(`delete from roles_policies where role_id = $1`, id); err != nil {
+			return errors.Wrapf(err, "error deleting role policies from db")
+		}
+		if _, err := ptx.exec(`delete from scheduled_jobs_perms where role_id = $1`, id); err != nil {
+			return errors.Wrapf(err, "error deleting role scheduled job perms from db")
+		}
+		if _, err := ptx.exec(`delete from namespaces_members where role_id = $1`, id); err != nil {
+			return errors.Wrapf(err, "error deleting role namespace memberships from db")
+		}
+		res, err := ptx.exec(`delete from roles where id = $1`, id)
+		if err != nil {
+			return errors.Wrapf(err, "error deleting role from db")
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return errors.Wrapf(err, "error deleting role from db")
+		} else if n == 0 {
+			return datastore.ErrRoleNotFound
+		}
+		return nil
+	})
+}
+
 func (ds *PostgresDatastore) GetUserRoles(ctx context.Context, userID string) ([]*tork.Role, error) {
 	rs := []roleRecord{}
 	if err := ds.select_(&rs, `SELECT r.* FROM roles r inner join users_roles ur on ur.role_id=r.id where ur.user_id = $1`, userID); err != nil {
@@ -1137,14 +1996,474 @@ func (ds *PostgresDatastore) UnassignRole(ctx context.Context, userID, roleID st
 	return nil
 }
 
-func (ds *PostgresDatastore) GetMetrics(ctx context.Context) (*tork.Metrics, error) {
+func (ds *PostgresDatastore) CreateAuditEvent(ctx context.Context, e *tork.AuditEvent) error {
+	e.ID = uuid.NewUUID()
+	if e.CreatedAt == nil {
+		now := time.Now().UTC()
+		e.CreatedAt = &now
+	}
+	q := `insert into audit_events 
+	       (id,username_,action,target_type,target_id,remote_ip,status,created_at) 
+	      values
+	       ($1,$2,$3,$4,$5,$6,$7,$8)`
+	if _, err := ds.exec(q, e.ID, e.Username, e.Action, e.TargetType, e.TargetID, e.RemoteIP, e.Status, e.CreatedAt); err != nil {
+		return errors.Wrapf(err, "error inserting audit event to the db")
+	}
+	return nil
+}
+
+func (ds *PostgresDatastore) GetAuditEvents(ctx context.Context, q datastore.AuditQuery, page, size int) (*datastore.Page[*tork.AuditEvent], error) {
+	offset := (page - 1) * size
+	where := `
+	  WHERE ($1 = '' OR username_ = $1)
+	    AND ($2 = '' OR action = $2)
+	    AND ($3 = '' OR target_type = $3)
+	    AND ($4 = '' OR target_id = $4)
+	    AND ($5::timestamp IS NULL OR created_at >= $5)
+	    AND ($6::timestamp IS NULL OR created_at < $6)`
+	args := []any{q.Username, q.Action, q.TargetType, q.TargetID, q.Since, q.Until}
+	rs := make([]auditEventRecord, 0)
+	qry := fmt.Sprintf(`SELECT * FROM audit_events %s ORDER BY created_at DESC OFFSET %d LIMIT %d`, where, offset, size)
+	if err := ds.select_(&rs, qry, args...); err != nil {
+		return nil, errors.Wrapf(err, "error getting a page of audit events")
+	}
+	result := make([]*tork.AuditEvent, len(rs))
+	for i, r := range rs {
+		result[i] = r.toAuditEvent()
+	}
+	var count *int
+	if err := ds.get(&count, `SELECT count(*) FROM audit_events `+where, args...); err != nil {
+		return nil, errors.Wrapf(err, "error getting the audit events count")
+	}
+	totalPages := *count / size
+	if *count%size != 0 {
+		totalPages = totalPages + 1
+	}
+	return &datastore.Page[*tork.AuditEvent]{
+		Items:      result,
+		Number:     page,
+		Size:       len(result),
+		TotalPages: totalPages,
+		TotalItems: *count,
+	}, nil
+}
+
+func (ds *PostgresDatastore) CreatePolicy(ctx context.Context, p *tork.Policy) error {
+	if p.Role == nil || p.Role.ID == "" {
+		return errors.Errorf("must provide role id")
+	}
+	if p.Resource == "" {
+		p.Resource = "*"
+	}
+	p.ID = uuid.NewUUID()
+	now := time.Now().UTC()
+	p.CreatedAt = &now
+	q := `insert into roles_policies 
+	       (id,role_id,action,resource,created_at) 
+	      values
+	       ($1,$2,$3,$4,$5)`
+	if _, err := ds.exec(q, p.ID, p.Role.ID, p.Action, p.Resource, p.CreatedAt); err != nil {
+		return errors.Wrapf(err, "error inserting policy to the db")
+	}
+	return nil
+}
+
+const selectPolicies = `SELECT p.id, p.role_id, r.slug as role_slug, r.name as role_name, p.action, p.resource, p.created_at
+	FROM roles_policies p inner join roles r on r.id = p.role_id`
+
+func (ds *PostgresDatastore) GetPolicies(ctx context.Context, roleID string) ([]*tork.Policy, error) {
+	rs := []policyRecord{}
+	if err := ds.select_(&rs, selectPolicies+` where p.role_id = $1 order by p.action, p.resource`, roleID); err != nil {
+		return nil, errors.Wrapf(err, "error fetching policies from db")
+	}
+	result := make([]*tork.Policy, len(rs))
+	for i, r := range rs {
+		result[i] = r.toPolicy()
+	}
+	return result, nil
+}
+
+func (ds *PostgresDatastore) GetUserPolicies(ctx context.Context, userID string) ([]*tork.Policy, error) {
+	rs := []policyRecord{}
+	q := selectPolicies + ` where r.slug = $2 or p.role_id in (select role_id from users_roles where user_id = $1)
+	  order by p.action, p.resource`
+	if err := ds.select_(&rs, q, userID, tork.ROLE_PUBLIC); err != nil {
+		return nil, errors.Wrapf(err, "error fetching user policies from db")
+	}
+	result := make([]*tork.Policy, len(rs))
+	for i, r := range rs {
+		result[i] = r.toPolicy()
+	}
+	return result, nil
+}
+
+func (ds *PostgresDatastore) DeletePolicy(ctx context.Context, id string) error {
+	res, err := ds.exec(`delete from roles_policies where id = $1`, id)
+	if err != nil {
+		return errors.Wrapf(err, "error deleting policy from db")
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return errors.Wrapf(err, "error deleting policy from db")
+	} else if n == 0 {
+		return datastore.ErrPolicyNotFound
+	}
+	return nil
+}
+
+func (ds *PostgresDatastore) CreateNamespace(ctx context.Context, n *tork.Namespace) error {
+	n.ID = uuid.NewUUID()
+	now := time.Now().UTC()
+	n.CreatedAt = &now
+	var maxActiveJobs int
+	if n.Quota != nil {
+		maxActiveJobs = n.Quota.MaxActiveJobs
+	}
+	q := `insert into namespaces 
+	       (id,name,description,default_queue,max_active_jobs,created_at) 
+	      values
+	       ($1,$2,$3,$4,$5,$6)`
+	if _, err := ds.exec(q, n.ID, n.Name, n.Description, n.DefaultQueue, maxActiveJobs, n.CreatedAt); err != nil {
+		return errors.Wrapf(err, "error inserting namespace to the db")
+	}
+	return nil
+}
+
+func (ds *PostgresDatastore) GetNamespace(ctx context.Context, name string) (*tork.Namespace, error) {
+	r := namespaceRecord{}
+	if err := ds.get(&r, `SELECT * FROM namespaces where name = $1`, name); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, datastore.ErrNamespaceNotFound
+		}
+		return nil, errors.Wrapf(err, "error fetching namespace from db")
+	}
+	n := r.toNamespace()
+	users := []userRecord{}
+	if err := ds.select_(&users, `SELECT u.* FROM users u inner join namespaces_members nm on nm.user_id = u.id 
+	                              where nm.namespace_id = $1 order by u.username_`, n.ID); err != nil {
+		return nil, errors.Wrapf(err, "error fetching namespace users from db")
+	}
+	for _, u := range users {
+		user := u.toUser()
+		user.PasswordHash = ""
+		n.Members = append(n.Members, &tork.NamespaceMember{User: user})
+	}
+	roles := []roleRecord{}
+	if err := ds.select_(&roles, `SELECT r.* FROM roles r inner join namespaces_members nm on nm.role_id = r.id 
+	                              where nm.namespace_id = $1 order by r.slug`, n.ID); err != nil {
+		return nil, errors.Wrapf(err, "error fetching namespace roles from db")
+	}
+	for _, r := range roles {
+		n.Members = append(n.Members, &tork.NamespaceMember{Role: r.toRole()})
+	}
+	return n, nil
+}
+
+func (ds *PostgresDatastore) GetNamespaces(ctx context.Context) ([]*tork.Namespace, error) {
+	rs := []namespaceRecord{}
+	if err := ds.select_(&rs, `SELECT * FROM namespaces order by name`); err != nil {
+		return nil, errors.Wrapf(err, "error fetching namespaces from db")
+	}
+	result := make([]*tork.Namespace, len(rs))
+	for i, r := range rs {
+		result[i] = r.toNamespace()
+	}
+	return result, nil
+}
+
+func (ds *PostgresDatastore) UpdateNamespace(ctx context.Context, name string, modify func(n *tork.Namespace) error) error {
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		ptx, ok := tx.(*PostgresDatastore)
+		if !ok {
+			return errors.New("unable to cast to a postgres datastore")
+		}
+		r := namespaceRecord{}
+		if err := ptx.get(&r, `SELECT * FROM namespaces where name = $1 for update`, name); err != nil {
+			if err == sql.ErrNoRows {
+				return datastore.ErrNamespaceNotFound
+			}
+			return errors.Wrapf(err, "error fetching namespace from db")
+		}
+		n := r.toNamespace()
+		if err := modify(n); err != nil {
+			return err
+		}
+		var maxActiveJobs int
+		if n.Quota != nil {
+			maxActiveJobs = n.Quota.MaxActiveJobs
+		}
+		q := `update namespaces set 
+		        description = $1,
+		        default_queue = $2,
+		        max_active_jobs = $3
+		      where id = $4`
+		if _, err := ptx.exec(q, n.Description, n.DefaultQueue, maxActiveJobs, r.ID); err != nil {
+			return errors.Wrapf(err, "error updating namespace in the db")
+		}
+		return nil
+	})
+}
+
+func (ds *PostgresDatastore) DeleteNamespace(ctx context.Context, name string) error {
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		ptx, ok := tx.(*PostgresDatastore)
+		if !ok {
+			return errors.New("unable to cast to a postgres datastore")
+		}
+		var owned int
+		if err := ptx.get(&owned, `select (select count(*) from jobs where namespace = $1) + (select count(*) from scheduled_jobs where namespace = $1)`, name); err != nil {
+			return errors.Wrapf(err, "error counting the namespace's jobs")
+		}
+		if owned > 0 {
+			return datastore.ErrNamespaceInUse
+		}
+		if _, err := ptx.exec(`delete from namespaces_members where namespace_id = (select id from namespaces where name = $1)`, name); err != nil {
+			return errors.Wrapf(err, "error deleting namespace members from db")
+		}
+		if _, err := ptx.exec(`delete from secrets where namespace = $1`, name); err != nil {
+			return errors.Wrapf(err, "error deleting namespace secrets from db")
+		}
+		res, err := ptx.exec(`delete from namespaces where name = $1`, name)
+		if err != nil {
+			return errors.Wrapf(err, "error deleting namespace from db")
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return errors.Wrapf(err, "error deleting namespace from db")
+		} else if n == 0 {
+			return datastore.ErrNamespaceNotFound
+		}
+		return nil
+	})
+}
+
+func (ds *PostgresDatastore) AddNamespaceMember(ctx context.Context, namespaceID string, m *tork.NamespaceMember) error {
+	var userID, roleID *string
+	if m.User != nil {
+		userID = &m.User.ID
+	} else if m.Role != nil {
+		roleID = &m.Role.ID
+	} else {
+		return errors.New("namespace member must be a user or a role")
+	}
+	q := `insert into namespaces_members 
+	       (id,namespace_id,user_id,role_id,created_at) 
+	      values
+	       ($1,$2,$3,$4,current_timestamp)
+	      on conflict do nothing`
+	if _, err := ds.exec(q, uuid.NewUUID(), namespaceID, userID, roleID); err != nil {
+		return errors.Wrapf(err, "error inserting namespace member to the db")
+	}
+	return nil
+}
+
+func (ds *PostgresDatastore) RemoveNamespaceMember(ctx context.Context, namespaceID string, m *tork.NamespaceMember) error {
+	var q, id string
+	if m.User != nil {
+		q, id = `delete from namespaces_members where namespace_id = $1 and user_id = $2`, m.User.ID
+	} else if m.Role != nil {
+		q, id = `delete from namespaces_members where namespace_id = $1 and role_id = $2`, m.Role.ID
+	} else {
+		return errors.New("namespace member must be a user or a role")
+	}
+	if _, err := ds.exec(q, namespaceID, id); err != nil {
+		return errors.Wrapf(err, "error deleting namespace member from db")
+	}
+	return nil
+}
+
+func (ds *PostgresDatastore) IsNamespaceMember(ctx context.Context, namespaceID, userID string) (bool, error) {
+	var member bool
+	q := `select exists (
+	        select 1 from namespaces_members nm 
+	        where nm.namespace_id = $1 
+	        and (nm.user_id = $2 or nm.role_id in (select role_id from users_roles where user_id = $2))
+	      )`
+	if err := ds.get(&member, q, namespaceID, userID); err != nil {
+		return false, errors.Wrapf(err, "error checking namespace membership")
+	}
+	return member, nil
+}
+
+func (ds *PostgresDatastore) CountActiveJobs(ctx context.Context, namespace string) (int, error) {
+	var count int
+	q := `select count(*) from jobs where namespace = $1 and state in ('PENDING','SCHEDULED','RUNNING')`
+	if err := ds.get(&count, q, namespace); err != nil {
+		return 0, errors.Wrapf(err, "error counting the namespace's active jobs")
+	}
+	return count, nil
+}
+
+func (ds *PostgresDatastore) CreateSecret(ctx context.Context, s *tork.Secret) error {
+	s.ID = uuid.NewUUID()
+	if s.Namespace == "" {
+		s.Namespace = tork.NAMESPACE_DEFAULT
+	}
+	now := time.Now().UTC()
+	s.CreatedAt = &now
+	s.UpdatedAt = &now
+	q := `insert into secrets 
+	       (id,name,namespace,ciphertext,created_at,updated_at) 
+	      values
+	       ($1,$2,$3,$4,$5,$6)`
+	if _, err := ds.exec(q, s.ID, s.Name, s.Namespace, s.Ciphertext, s.CreatedAt, s.UpdatedAt); err != nil {
+		return errors.Wrapf(err, "error inserting secret to the db")
+	}
+	return nil
+}
+
+func (ds *PostgresDatastore) GetSecret(ctx context.Context, namespace, name string) (*tork.Secret, error) {
+	r := secretRecord{}
+	if err := ds.get(&r, `SELECT * FROM secrets where namespace = $1 and name = $2`, namespace, name); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, datastore.ErrSecretNotFound
+		}
+		return nil, errors.Wrapf(err, "error fetching secret from db")
+	}
+	return r.toSecret(), nil
+}
+
+func (ds *PostgresDatastore) GetSecrets(ctx context.Context, namespace string) ([]*tork.Secret, error) {
+	rs := []secretRecord{}
+	if err := ds.select_(&rs, `SELECT * FROM secrets where ($1 = '' or namespace = $1) order by namespace,name`, namespace); err != nil {
+		return nil, errors.Wrapf(err, "error fetching secrets from db")
+	}
+	result := make([]*tork.Secret, len(rs))
+	for i, r := range rs {
+		result[i] = r.toSecret()
+	}
+	return result, nil
+}
+
+func (ds *PostgresDatastore) UpdateSecret(ctx context.Context, namespace, name string, modify func(s *tork.Secret) error) error {
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		ptx, ok := tx.(*PostgresDatastore)
+		if !ok {
+			return errors.New("unable to cast to a postgres datastore")
+		}
+		r := secretRecord{}
+		if err := ptx.get(&r, `SELECT * FROM secrets where namespace = $1 and name = $2 for update`, namespace, name); err != nil {
+			if err == sql.ErrNoRows {
+				return datastore.ErrSecretNotFound
+			}
+			return errors.Wrapf(err, "error fetching secret from db")
+		}
+		s := r.toSecret()
+		if err := modify(s); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		if _, err := ptx.exec(`update secrets set ciphertext = $1, updated_at = $2 where id = $3`, s.Ciphertext, now, r.ID); err != nil {
+			return errors.Wrapf(err, "error updating secret in the db")
+		}
+		return nil
+	})
+}
+
+func (ds *PostgresDatastore) DeleteSecret(ctx context.Context, namespace, name string) error {
+	res, err := ds.exec(`delete from secrets where namespace = $1 and name = $2`, namespace, name)
+	if err != nil {
+		return errors.Wrapf(err, "error deleting secret from db")
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return errors.Wrapf(err, "error deleting secret from db")
+	} else if n == 0 {
+		return datastore.ErrSecretNotFound
+	}
+	return nil
+}
+
+func (ds *PostgresDatastore) CreateBulkOperation(ctx context.Context, o *tork.BulkOperation) error {
+	if o.ID == "" {
+		o.ID = uuid.NewUUID()
+	}
+	if o.Namespace == "" {
+		o.Namespace = tork.NAMESPACE_DEFAULT
+	}
+	if o.CreatedAt == nil {
+		now := time.Now().UTC()
+		o.CreatedAt = &now
+	}
+	if o.Tags == nil {
+		o.Tags = make([]string, 0)
+	}
+	if o.Results == nil {
+		o.Results = make([]*tork.BulkResult, 0)
+	}
+	results, err := json.Marshal(o.Results)
+	if err != nil {
+		return errors.Wrapf(err, "failed to serialize bulk operation results")
+	}
+	q := `insert into bulk_operations 
+	       (id,action,namespace,query,tags,state,total,succeeded,skipped,failed,error_,results,created_by,created_at,completed_at) 
+	      values
+	       ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15)`
+	if _, err := ds.exec(q, o.ID, o.Action, o.Namespace, o.Query, pq.StringArray(o.Tags), o.State, o.Total,
+		o.Succeeded, o.Skipped, o.Failed, o.Error, results, o.CreatedBy, o.CreatedAt, o.CompletedAt); err != nil {
+		return errors.Wrapf(err, "error inserting bulk operation to the db")
+	}
+	return nil
+}
+
+func (ds *PostgresDatastore) UpdateBulkOperation(ctx context.Context, id string, modify func(u *tork.BulkOperation) error) error {
+	return ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		ptx, ok := tx.(*PostgresDatastore)
+		if !ok {
+			return errors.New("unable to cast to a postgres datastore")
+		}
+		r := bulkOperationRecord{}
+		if err := ptx.get(&r, `SELECT * FROM bulk_operations where id = $1 for update`, id); err != nil {
+			if err == sql.ErrNoRows {
+				return datastore.ErrBulkOperationNotFound
+			}
+			return errors.Wrapf(err, "error fetching bulk operation from db")
+		}
+		o, err := r.toBulkOperation()
+		if err != nil {
+			return err
+		}
+		if err := modify(o); err != nil {
+			return err
+		}
+		results, err := json.Marshal(o.Results)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize bulk operation results")
+		}
+		q := `update bulk_operations set 
+				state = $1,
+				total = $2,
+				succeeded = $3,
+				skipped = $4,
+				failed = $5,
+				error_ = $6,
+				results = $7,
+				completed_at = $8
+			  where id = $9`
+		if _, err := ptx.exec(q, o.State, o.Total, o.Succeeded, o.Skipped, o.Failed, o.Error, results, o.CompletedAt, id); err != nil {
+			return errors.Wrapf(err, "error updating bulk operation in the db")
+		}
+		return nil
+	})
+}
+
+func (ds *PostgresDatastore) GetBulkOperationByID(ctx context.Context, id string) (*tork.BulkOperation, error) {
+	r := bulkOperationRecord{}
+	if err := ds.get(&r, `SELECT * FROM bulk_operations where id = $1`, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, datastore.ErrBulkOperationNotFound
+		}
+		return nil, errors.Wrapf(err, "error fetching bulk operation from db")
+	}
+	return r.toBulkOperation()
+}
+
+func (ds *PostgresDatastore) GetMetrics(ctx context.Context, namespace string) (*tork.Metrics, error) {
 	s := &tork.Metrics{}
 
-	if err := ds.get(&s.Jobs.Running, "select count(*) from jobs where state = 'RUNNING'"); err != nil {
+	if err := ds.get(&s.Jobs.Running, "select count(*) from jobs where state = 'RUNNING' and ($1 = '' or namespace = $1)", namespace); err != nil {
 		return nil, errors.Wrapf(err, "error getting the running jobs count")
 	}
 
-	if err := ds.get(&s.Tasks.Running, "select count(*) from tasks where state = 'RUNNING'"); err != nil {
+	if err := ds.get(&s.Tasks.Running, `select count(*) from tasks t where t.state = 'RUNNING' 
+	  and ($1 = '' or exists (select 1 from jobs j where j.id = t.job_id and j.namespace = $1))`, namespace); err != nil {
 		return nil, errors.Wrapf(err, "error getting the running tasks count")
 	}
 
@@ -1159,6 +2478,86 @@ func (ds *PostgresDatastore) GetMetrics(ctx context.Context) (*tork.Metrics, err
 	return s, nil
 }
 
+// the expressions jobs and tasks can be grouped by, with the joins they need
+var (
+	jobStatsGroups = map[string]string{
+		datastore.StatsByName: "COALESCE(j.name,'')",
+		datastore.StatsByTag:  "g.tag",
+		datastore.StatsByUser: "u.username_",
+	}
+	taskStatsGroups = map[string]string{
+		datastore.StatsByName:  "COALESCE(j.name,'')",
+		datastore.StatsByTag:   "g.tag",
+		datastore.StatsByQueue: "COALESCE(t.queue,'')",
+		datastore.StatsByImage: "COALESCE(t.image,'')",
+		datastore.StatsByUser:  "u.username_",
+	}
+)
+
+// statsColumns aggregates the rows of the table with the alias.
+func statsColumns(alias string) string {
+	duration := fmt.Sprintf("extract(epoch from %[1]s.completed_at - %[1]s.started_at)::float8", alias)
+	completed := fmt.Sprintf("%[1]s.state = 'COMPLETED' AND %[1]s.started_at IS NOT NULL", alias)
+	return fmt.Sprintf(`count(*) AS count_,
+	  count(*) FILTER (WHERE %[1]s.state = 'COMPLETED') AS completed,
+	  count(*) FILTER (WHERE %[1]s.state = 'FAILED') AS failed,
+	  count(*) FILTER (WHERE %[1]s.state = 'CANCELLED') AS cancelled,
+	  COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY %[2]s) FILTER (WHERE %[3]s),0) AS p50_duration,
+	  COALESCE(percentile_cont(0.95) WITHIN GROUP (ORDER BY %[2]s) FILTER (WHERE %[3]s),0) AS p95_duration`,
+		alias, duration, completed)
+}
+
+const statsWhere = `
+        ($1 = '' OR EXISTS (select 1 from no_job_perms njp where njp.job_id=j.id) OR EXISTS (
+           SELECT 1
+           FROM job_perms_info jpi
+           WHERE jpi.job_id = j.id
+        ))
+      AND ($2 = '' OR j.namespace = $2)
+      AND ($3::timestamp IS NULL OR %[1]s.created_at >= $3)
+      AND ($4::timestamp IS NULL OR %[1]s.created_at < $4)
+      AND %[1]s.state IN ('COMPLETED','FAILED','CANCELLED')`
+
+func (ds *PostgresDatastore) GetJobStats(ctx context.Context, currentUser, namespace string, q datastore.StatsQuery) ([]*tork.Stats, error) {
+	group, ok := jobStatsGroups[q.GroupBy]
+	if !ok {
+		return nil, errors.Wrapf(datastore.ErrInvalidStatsGroup, "can't group jobs by %s", q.GroupBy)
+	}
+	from := "jobs j JOIN users u ON u.id = j.created_by"
+	if q.GroupBy == datastore.StatsByTag {
+		from = from + " CROSS JOIN LATERAL unnest(j.tags) AS g(tag)"
+	}
+	qry := fmt.Sprintf(`%s SELECT %s AS group_, %s FROM %s WHERE %s GROUP BY 1 ORDER BY count_ DESC, group_`,
+		jobsVisibility, group, statsColumns("j"), from, fmt.Sprintf(statsWhere, "j"))
+	return ds.getStats(qry, currentUser, namespace, q)
+}
+
+func (ds *PostgresDatastore) GetTaskStats(ctx context.Context, currentUser, namespace string, q datastore.StatsQuery) ([]*tork.Stats, error) {
+	group, ok := taskStatsGroups[q.GroupBy]
+	if !ok {
+		return nil, errors.Wrapf(datastore.ErrInvalidStatsGroup, "can't group tasks by %s", q.GroupBy)
+	}
+	from := "tasks t JOIN jobs j ON j.id = t.job_id JOIN users u ON u.id = j.created_by"
+	if q.GroupBy == datastore.StatsByTag {
+		from = from + " CROSS JOIN LATERAL unnest(t.tags) AS g(tag)"
+	}
+	qry := fmt.Sprintf(`%s SELECT %s AS group_, %s FROM %s WHERE %s GROUP BY 1 ORDER BY count_ DESC, group_`,
+		jobsVisibility, group, statsColumns("t"), from, fmt.Sprintf(statsWhere, "t"))
+	return ds.getStats(qry, currentUser, namespace, q)
+}
+
+func (ds *PostgresDatastore) getStats(qry, currentUser, namespace string, q datastore.StatsQuery) ([]*tork.Stats, error) {
+	rs := make([]statsRecord, 0)
+	if err := ds.select_(&rs, qry, currentUser, namespace, q.Since, q.Until); err != nil {
+		return nil, errors.Wrapf(err, "error getting the stats by %s", q.GroupBy)
+	}
+	result := make([]*tork.Stats, len(rs))
+	for i, r := range rs {
+		result[i] = r.toStats()
+	}
+	return result, nil
+}
+
 func (ds *PostgresDatastore) CreateScheduledJob(ctx context.Context, sj *tork.ScheduledJob) error {
 	if sj.ID == "" {
 		return errors.Errorf("scheduled job id must not be empty")
@@ -1170,7 +2569,10 @@ func (ds *PostgresDatastore) CreateScheduledJob(ctx context.Context, sj *tork.Sc
 		}
 		sj.CreatedBy = guest
 	}
-	tasks, err := json.Marshal(sj.Tasks)
+	if sj.Namespace == "" {
+		sj.Namespace = tork.NAMESPACE_DEFAULT
+	}
+	tasks, err := ds.sealJSON(sj.Tasks)
 	if err != nil {
 		return errors.Wrapf(err, "failed to serialize tasks")
 	}
@@ -1196,7 +2598,7 @@ func (ds *PostgresDatastore) CreateScheduledJob(ctx context.Context, sj *tork.Sc
 		s := string(b)
 		autoDelete = &s
 	}
-	webhooks, err := json.Marshal(sj.Webhooks)
+	webhooks, err := ds.sealJSON(sj.Webhooks)
 	if err != nil {
 		return errors.Wrapf(err, "failed to serialize webhooks")
 	}
@@ -1205,7 +2607,7 @@ func (ds *PostgresDatastore) CreateScheduledJob(ctx context.Context, sj *tork.Sc
 	}
 	var secrets *string
 	if sj.Secrets != nil {
-		b, err := json.Marshal(sj.Secrets)
+		b, err := ds.sealJSON(sj.Secrets)
 		if err != nil {
 			return errors.Wrapf(err, "failed to serialize secrets")
 		}
@@ -1218,12 +2620,12 @@ func (ds *PostgresDatastore) CreateScheduledJob(ctx context.Context, sj *tork.Sc
 			return errors.New("unable to cast to a postgres datastore")
 		}
 		sql := `insert into scheduled_jobs (id,name,description,created_at,tasks,inputs,output_,defaults,webhooks,
-					created_by,tags,auto_delete,secrets,cron_expr,state) 
+					created_by,tags,auto_delete,secrets,cron_expr,state,namespace) 
 				values
-					($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15)`
+					($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16)`
 		if _, err := ptx.exec(sql, sj.ID, sj.Name, sj.Description, sj.CreatedAt, tasks,
 			inputs, sj.Output, defaults, webhooks, sj.CreatedBy.ID,
-			pq.StringArray(sj.Tags), autoDelete, secrets, sj.Cron, sj.State); err != nil {
+			pq.StringArray(sj.Tags), autoDelete, secrets, sj.Cron, sj.State, sj.Namespace); err != nil {
 			return errors.Wrapf(err, "error inserting scheduled job to the db")
 		}
 		for _, perm := range sj.Permissions {
@@ -1258,14 +2660,14 @@ func (ds *PostgresDatastore) GetActiveScheduledJobs(ctx context.Context) ([]*tor
 	sjs := make([]*tork.ScheduledJob, len(sjrs))
 	for i, sjr := range sjrs {
 		tasks := make([]*tork.Task, 0)
-		if err := json.Unmarshal(sjr.Tasks, &tasks); err != nil {
+		if err := unmarshalSealed(ds.keyring, sjr.Tasks, &tasks); err != nil {
 			return nil, errors.Wrapf(err, "error desiralizing scheduled job tasks")
 		}
 		u, err := ds.GetUser(ctx, sjr.CreatedBy)
 		if err != nil {
 			return nil, err
 		}
-		sj, err := sjr.toScheduledJob(tasks, u, []*tork.Permission{})
+		sj, err := sjr.toScheduledJob(ds.keyring, tasks, u, []*tork.Permission{})
 		if err != nil {
 			return nil, err
 		}
@@ -1274,8 +2676,23 @@ func (ds *PostgresDatastore) GetActiveScheduledJobs(ctx context.Context) ([]*tor
 	return sjs, nil
 }
 
-func (ds *PostgresDatastore) GetScheduledJobs(ctx context.Context, currentUser string, page, size int) (*datastore.Page[*tork.ScheduledJobSummary], error) {
+func (ds *PostgresDatastore) GetScheduledJobs(ctx context.Context, currentUser, namespace, cursor string, page, size int) (*datastore.Page[*tork.ScheduledJobSummary], error) {
 	offset := (page - 1) * size
+	args := []any{currentUser, namespace}
+	after := ""
+	if cursor != "" {
+		keys, err := decodeCursor(cursor, "-created", 2)
+		if err != nil {
+			return nil, err
+		}
+		createdAt, err := parseCursorTime(keys[0])
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, createdAt, keys[1])
+		after = "AND (j.created_at, j.id) < ($3, $4)"
+		offset = 0
+	}
 	rs := make([]scheduledJobRecord, 0)
 	qry := fmt.Sprintf(`
       WITH user_info AS (
@@ -1308,9 +2725,11 @@ func (ds *PostgresDatastore) GetScheduledJobs(ctx context.Context, currentUser s
            FROM job_perms_info jpi
            WHERE jpi.scheduled_job_id = j.id
         ))
-	  ORDER BY created_at DESC 
-	  OFFSET %d LIMIT %d`, offset, size)
-	if err := ds.select_(&rs, qry, currentUser); err != nil {
+      AND ($2 = '' OR j.namespace = $2)
+      %s
+	  ORDER BY j.created_at DESC, j.id DESC
+	  OFFSET %d LIMIT %d`, after, offset, size)
+	if err := ds.select_(&rs, qry, args...); err != nil {
 		return nil, errors.Wrapf(err, "error getting a page of scheduled jobs")
 	}
 	result := make([]*tork.ScheduledJobSummary, len(rs))
@@ -1319,7 +2738,7 @@ func (ds *PostgresDatastore) GetScheduledJobs(ctx context.Context, currentUser s
 		if err != nil {
 			return nil, err
 		}
-		j, err := r.toScheduledJob([]*tork.Task{}, createdBy, []*tork.Permission{})
+		j, err := r.toScheduledJob(ds.keyring, []*tork.Task{}, createdBy, []*tork.Permission{})
 		if err != nil {
 			return nil, err
 		}
@@ -1357,8 +2776,9 @@ func (ds *PostgresDatastore) GetScheduledJobs(ctx context.Context, currentUser s
            SELECT 1
            FROM job_perms_info jpi
            WHERE jpi.scheduled_job_id = j.id
-        ));
-	  `, currentUser); err != nil {
+        ))
+      AND ($2 = '' OR j.namespace = $2);
+	  `, currentUser, namespace); err != nil {
 		return nil, errors.Wrapf(err, "error getting the scheduled jobs count")
 	}
 
@@ -1367,12 +2787,81 @@ func (ds *PostgresDatastore) GetScheduledJobs(ctx context.Context, currentUser s
 		totalPages = totalPages + 1
 	}
 
+	var next string
+	if len(rs) == size {
+		last := rs[len(rs)-1]
+		next = encodeCursor("-created", cursorTime(last.CreatedAt), last.ID)
+	}
+
 	return &datastore.Page[*tork.ScheduledJobSummary]{
 		Items:      result,
 		Number:     page,
 		Size:       len(result),
 		TotalPages: totalPages,
 		TotalItems: *count,
+		NextCursor: next,
+	}, nil
+}
+
+func (ds *PostgresDatastore) GetJobTasks(ctx context.Context, jobID string, q datastore.TaskQuery, cursor string, page, size int) (*datastore.Page[*tork.TaskSummary], error) {
+	offset := (page - 1) * size
+	args := []any{jobID, q.State, q.ParentID}
+	where := `job_id = $1 AND ($2 = '' OR state = $2) AND ($3 = '' OR parent_id = $3)`
+	count := where
+	if cursor != "" {
+		keys, err := decodeCursor(cursor, "position", 3)
+		if err != nil {
+			return nil, err
+		}
+		position, err := parseCursorInt(keys[0])
+		if err != nil {
+			return nil, err
+		}
+		createdAt, err := parseCursorTime(keys[1])
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, position, createdAt, keys[2])
+		where = where + ` AND (position, created_at, id) > ($4, $5, $6)`
+		offset = 0
+	}
+	rs := make([]taskRecord, 0)
+	qry := fmt.Sprintf(`SELECT * 
+	      FROM tasks 
+		  WHERE %s
+		  ORDER BY position, created_at, id
+		  OFFSET %d LIMIT %d`, where, offset, size)
+	if err := ds.select_(&rs, qry, args...); err != nil {
+		return nil, errors.Wrapf(err, "error getting the tasks of job %s", jobID)
+	}
+	items := make([]*tork.TaskSummary, len(rs))
+	for i, r := range rs {
+		t, err := r.toTask(ds.keyring)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = tork.NewTaskSummary(t)
+	}
+	var total *int
+	if err := ds.get(&total, fmt.Sprintf(`SELECT count(*) FROM tasks WHERE %s`, count), jobID, q.State, q.ParentID); err != nil {
+		return nil, errors.Wrapf(err, "error getting the tasks count")
+	}
+	totalPages := *total / size
+	if *total%size != 0 {
+		totalPages = totalPages + 1
+	}
+	var next string
+	if len(rs) == size {
+		last := rs[len(rs)-1]
+		next = encodeCursor("position", strconv.Itoa(last.Position), cursorTime(last.CreatedAt), last.ID)
+	}
+	return &datastore.Page[*tork.TaskSummary]{
+		Items:      items,
+		Number:     page,
+		Size:       len(items),
+		TotalPages: totalPages,
+		TotalItems: *total,
+		NextCursor: next,
 	}, nil
 }
 
@@ -1385,7 +2874,7 @@ func (ds *PostgresDatastore) GetScheduledJobByID(ctx context.Context, id string)
 		return nil, errors.Wrapf(err, "error fetching scheduled job from db")
 	}
 	tasks := make([]*tork.Task, 0)
-	if err := json.Unmarshal(r.Tasks, &tasks); err != nil {
+	if err := unmarshalSealed(ds.keyring, r.Tasks, &tasks); err != nil {
 		return nil, errors.Wrapf(err, "error deserializing scheduled job tasks")
 	}
 	u, err := ds.GetUser(ctx, r.CreatedBy)
@@ -1417,7 +2906,7 @@ func (ds *PostgresDatastore) GetScheduledJobByID(ctx context.Context, id string)
 		}
 		perms[i] = p
 	}
-	return r.toScheduledJob(tasks, u, perms)
+	return r.toScheduledJob(ds.keyring, tasks, u, perms)
 }
 
 func (ds *PostgresDatastore) UpdateScheduledJob(ctx context.Context, id string, modify func(u *tork.ScheduledJob) error) error {
@@ -1431,14 +2920,14 @@ func (ds *PostgresDatastore) UpdateScheduledJob(ctx context.Context, id string,
 			return errors.Wrapf(err, "error fetching scheduled job from db")
 		}
 		tasks := make([]*tork.Task, 0)
-		if err := json.Unmarshal(r.Tasks, &tasks); err != nil {
+		if err := unmarshalSealed(ds.keyring, r.Tasks, &tasks); err != nil {
 			return errors.Wrapf(err, "error deserializing scheduled job tasks")
 		}
 		createdBy, err := ds.GetUser(ctx, r.CreatedBy)
 		if err != nil {
 			return err
 		}
-		j, err := r.toScheduledJob(tasks, createdBy, []*tork.Permission{})
+		j, err := r.toScheduledJob(ds.keyring, tasks, createdBy, []*tork.Permission{})
 		if err != nil {
 			return errors.Wrapf(err, "failed to convert jobRecord")
 		}
@@ -1474,6 +2963,134 @@ func (ds *PostgresDatastore) DeleteScheduledJob(ctx context.Context, id string)
 	})
 }
 
+// sealedColumns lists the columns which are encrypted when
+// the datastore is configured with a keyring.
+var sealedColumns = []struct {
+	table   string
+	columns []string
+}{
+	{"jobs", []string{"tasks", "context", "webhooks", "secrets"}},
+	{"scheduled_jobs", []string{"tasks", "webhooks", "secrets"}},
+	{"tasks", []string{"env", "registry", "pre_tasks", "post_tasks", "parallel", "each_", "subjob"}},
+}
+
+const rekeyBatchSize = 100
+
+// Rekey encrypts the sensitive columns which are still stored in
+// plaintext and re-wraps the values encrypted under a previous key
+// with the primary key. It returns the number of updated rows.
+func (ds *PostgresDatastore) Rekey(ctx context.Context) (int, error) {
+	if ds.keyring == nil {
+		return 0, errors.New("no encryption key is configured")
+	}
+	count := 0
+	for _, sc := range sealedColumns {
+		n, err := ds.rekeyTable(ctx, sc.table, sc.columns)
+		if err != nil {
+			return count, errors.Wrapf(err, "error rekeying %s", sc.table)
+		}
+		count = count + n
+	}
+	return count, nil
+}
+
+func (ds *PostgresDatastore) rekeyTable(ctx context.Context, table string, columns []string) (int, error) {
+	type row struct {
+		id     string
+		values []sql.NullString
+	}
+	cols := make([]string, len(columns))
+	for i, col := range columns {
+		cols[i] = fmt.Sprintf("%s::text", col)
+	}
+	q := fmt.Sprintf(`SELECT id, %s FROM %s WHERE id > $1 ORDER BY id LIMIT %d`, strings.Join(cols, ", "), table, rekeyBatchSize)
+	count := 0
+	last := ""
+	for {
+		rows, err := ds.db.QueryContext(ctx, q, last)
+		if err != nil {
+			return count, err
+		}
+		batch := make([]row, 0, rekeyBatchSize)
+		for rows.Next() {
+			r := row{values: make([]sql.NullString, len(columns))}
+			dest := []any{&r.id}
+			for i := range r.values {
+				dest = append(dest, &r.values[i])
+			}
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return count, err
+			}
+			batch = append(batch, r)
+		}
+		if err := rows.Close(); err != nil {
+			return count, err
+		}
+		if err := rows.Err(); err != nil {
+			return count, err
+		}
+		if len(batch) == 0 {
+			return count, nil
+		}
+		for _, r := range batch {
+			last = r.id
+			var sets, guards []string
+			var args []any
+			for i, v := range r.values {
+				if !v.Valid || v.String == "null" {
+					continue
+				}
+				updated, ok, err := ds.rekeyValue([]byte(v.String))
+				if err != nil {
+					return count, errors.Wrapf(err, "error rekeying %s.%s of %s", table, columns[i], r.id)
+				}
+				if !ok {
+					continue
+				}
+				args = append(args, updated, v.String)
+				sets = append(sets, fmt.Sprintf("%s = $%d", columns[i], len(args)-1))
+				// skip the row if it was modified in the meantime
+				guards = append(guards, fmt.Sprintf("%s = $%d::jsonb", columns[i], len(args)))
+			}
+			if len(sets) == 0 {
+				continue
+			}
+			args = append(args, r.id)
+			u := fmt.Sprintf(`UPDATE %s SET %s WHERE id = $%d AND %s`, table, strings.Join(sets, ", "), len(args), strings.Join(guards, " AND "))
+			res, err := ds.db.ExecContext(ctx, u, args...)
+			if err != nil {
+				return count, err
+			}
+			if n, err := res.RowsAffected(); err != nil {
+				return count, err
+			} else if n > 0 {
+				count = count + 1
+			}
+		}
+	}
+}
+
+// rekeyValue seals a plaintext column value or re-wraps a sealed
+// one, reporting whether the value needs to be updated.
+func (ds *PostgresDatastore) rekeyValue(b []byte) ([]byte, bool, error) {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil && secrets.IsEnvelope(s) {
+		rewrapped, ok, err := ds.keyring.Rewrap(s)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		updated, err := json.Marshal(rewrapped)
+		return updated, true, err
+	}
+	sealed, err := ds.keyring.Seal(b)
+	if err != nil {
+		return nil, false, err
+	}
+	updated, err := json.Marshal(sealed)
+	return updated, true, err
+}
+
 func (ds *PostgresDatastore) get(dest interface{}, query string, args ...interface{}) error {
 	if ds.tx != nil {
 		return ds.tx.Get(dest, query, args...)
@@ -1512,7 +3129,8 @@ func (ds *PostgresDatastore) WithTx(ctx context.Context, f func(tx datastore.Dat
 		}
 	}
 	dsx := &PostgresDatastore{
-		tx: tx,
+		tx:      tx,
+		keyring: ds.keyring,
 	}
 	if err := f(dsx); err != nil {
 		if owner {
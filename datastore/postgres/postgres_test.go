@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"context"
+	crand "crypto/rand"
 	"fmt"
 	"math/rand"
 	"strings"
@@ -11,7 +12,10 @@ import (
 
 	"github.com/runabol/tork"
 	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/datastore/search"
 	"github.com/runabol/tork/db/postgres"
+	"github.com/runabol/tork/internal/hash"
+	"github.com/runabol/tork/internal/secrets"
 
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/stretchr/testify/assert"
@@ -35,18 +39,20 @@ func TestPostgresCreateAndGetTask(t *testing.T) {
 	assert.Equal(t, tork.USER_GUEST, j2.CreatedBy.Username)
 
 	t1 := tork.Task{
-		ID:          uuid.NewUUID(),
-		CreatedAt:   &now,
-		JobID:       j1.ID,
-		Description: "some description",
-		Networks:    []string{"some-network"},
-		Files:       map[string]string{"myfile": "hello world"},
-		Registry:    &tork.Registry{Username: "me", Password: "secret"},
-		GPUs:        "all",
-		If:          "true",
-		Tags:        []string{"tag1", "tag2"},
-		Workdir:     "/some/dir",
-		Priority:    2,
+		ID:           uuid.NewUUID(),
+		CreatedAt:    &now,
+		JobID:        j1.ID,
+		Description:  "some description",
+		Networks:     []string{"some-network"},
+		Files:        map[string]string{"myfile": "hello world"},
+		Registry:     &tork.Registry{Username: "me", Password: "secret"},
+		GPUs:         "all",
+		If:           "true",
+		Tags:         []string{"tag1", "tag2"},
+		Workdir:      "/some/dir",
+		Priority:     2,
+		NodeSelector: map[string]string{"region": "eu"},
+		Resources:    &tork.TaskResources{CPUs: "2", Memory: "1g", GPUs: 1},
 	}
 	err = ds.CreateTask(ctx, &t1)
 	assert.NoError(t, err)
@@ -64,6 +70,9 @@ func TestPostgresCreateAndGetTask(t *testing.T) {
 	assert.Equal(t, []string([]string{"tag1", "tag2"}), t2.Tags)
 	assert.Equal(t, "/some/dir", t2.Workdir)
 	assert.Equal(t, 2, t2.Priority)
+	assert.Equal(t, map[string]string{"region": "eu"}, t2.NodeSelector)
+	assert.Equal(t, "1g", t2.Resources.Memory)
+	assert.Equal(t, 1, t2.Resources.GPUs)
 }
 
 func TestPostgresCreateJob(t *testing.T) {
@@ -160,6 +169,107 @@ func TestPostgresCreateTaskBadOutput(t *testing.T) {
 	assert.Equal(t, t1.Description, t2.Description)
 }
 
+func TestPostgresGetActiveTasksByNodeID(t *testing.T) {
+	ctx := context.Background()
+	dsn := "host=localhost user=tork password=tork dbname=tork port=5432 sslmode=disable"
+	ds, err := NewPostgresDataStore(dsn)
+	assert.NoError(t, err)
+
+	j1 := tork.Job{
+		ID:        uuid.NewUUID(),
+		CreatedAt: time.Now().UTC(),
+	}
+	err = ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+	nodeID := uuid.NewUUID()
+
+	tasks := []*tork.Task{{
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateRunning,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+		NodeID:    nodeID,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateCompleted,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+		NodeID:    nodeID,
+	}, {
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateRunning,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+		NodeID:    uuid.NewUUID(),
+	}}
+
+	for _, ta := range tasks {
+		err := ds.CreateTask(ctx, ta)
+		assert.NoError(t, err)
+	}
+
+	actives, err := ds.GetActiveTasksByNodeID(ctx, nodeID)
+	assert.NoError(t, err)
+	assert.Len(t, actives, 1)
+	assert.Equal(t, tasks[0].ID, actives[0].ID)
+}
+
+func TestPostgresGetActiveTasksByNodeIDPlaced(t *testing.T) {
+	ctx := context.Background()
+	ds, err := NewTestDatastore()
+	assert.NoError(t, err)
+
+	j1 := tork.Job{
+		ID:        uuid.NewUUID(),
+		CreatedAt: time.Now().UTC(),
+	}
+	assert.NoError(t, ds.CreateJob(ctx, &j1))
+
+	now := time.Now().UTC()
+	n := &tork.Node{
+		ID:              uuid.NewShortUUID(),
+		StartedAt:       now,
+		LastHeartbeatAt: now,
+		Status:          tork.NodeStatusUP,
+	}
+	n.Queue = "x-" + n.ID
+	assert.NoError(t, ds.CreateNode(ctx, n))
+
+	tasks := []*tork.Task{{
+		// placed on the node but not started yet
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateScheduled,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+		Queue:     n.Queue,
+	}, {
+		// placed on the node and completed
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateCompleted,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+		Queue:     n.Queue,
+	}, {
+		// scheduled on a shared queue
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateScheduled,
+		CreatedAt: &now,
+		JobID:     j1.ID,
+		Queue:     "default",
+	}}
+	for _, ta := range tasks {
+		assert.NoError(t, ds.CreateTask(ctx, ta))
+	}
+
+	actives, err := ds.GetActiveTasksByNodeID(ctx, n.ID)
+	assert.NoError(t, err)
+	assert.Len(t, actives, 1)
+	assert.Equal(t, tasks[0].ID, actives[0].ID)
+	assert.NoError(t, ds.Close())
+}
+
 func TestPostgresGetActiveTasks(t *testing.T) {
 	ctx := context.Background()
 	dsn := "host=localhost user=tork password=tork dbname=tork port=5432 sslmode=disable"
@@ -341,6 +451,8 @@ func TestPostgresCreateAndGetNode(t *testing.T) {
 		Hostname: "some-name",
 		Port:     1234,
 		Version:  "1.0.0",
+		Labels:   map[string]string{"region": "eu"},
+		Capacity: &tork.NodeResources{CPUs: 4, Memory: 1024},
 	}
 	err = ds.CreateNode(ctx, n1)
 	assert.NoError(t, err)
@@ -351,6 +463,9 @@ func TestPostgresCreateAndGetNode(t *testing.T) {
 	assert.Equal(t, 1234, n2.Port)
 	assert.Equal(t, "1.0.0", n2.Version)
 	assert.Equal(t, "some node", n2.Name)
+	assert.Equal(t, map[string]string{"region": "eu"}, n2.Labels)
+	assert.Equal(t, float64(4), n2.Capacity.CPUs)
+	assert.Nil(t, n2.Allocated)
 }
 
 func TestPostgresUpdateNode(t *testing.T) {
@@ -371,6 +486,7 @@ func TestPostgresUpdateNode(t *testing.T) {
 	err = ds.UpdateNode(ctx, n1.ID, func(u *tork.Node) error {
 		u.LastHeartbeatAt = now
 		u.TaskCount = 2
+		u.Allocated = &tork.NodeResources{CPUs: 1.5}
 		return nil
 	})
 	assert.NoError(t, err)
@@ -381,6 +497,7 @@ func TestPostgresUpdateNode(t *testing.T) {
 	assert.Equal(t, now.Minute(), n2.LastHeartbeatAt.Minute())
 	assert.Equal(t, now.Second(), n2.LastHeartbeatAt.Second())
 	assert.Equal(t, 2, n2.TaskCount)
+	assert.Equal(t, 1.5, n2.Allocated.CPUs)
 }
 
 func TestPostgresUpdateNodeConcurrently(t *testing.T) {
@@ -466,6 +583,53 @@ func TestPostgresGetActiveNodes(t *testing.T) {
 	assert.Equal(t, tork.NodeStatusOffline, ns[1].Status)
 }
 
+func TestPostgresGetStaleNodes(t *testing.T) {
+	ctx := context.Background()
+	schemaName := fmt.Sprintf("tork%d", rand.Int())
+	dsn := `host=localhost user=tork password=tork dbname=tork search_path=%s sslmode=disable`
+	ds, err := NewPostgresDataStore(fmt.Sprintf(dsn, schemaName))
+	assert.NoError(t, err)
+	_, err = ds.db.Exec(fmt.Sprintf("create schema %s", schemaName))
+	assert.NoError(t, err)
+	defer func() {
+		_, err = ds.db.Exec(fmt.Sprintf("drop schema %s cascade", schemaName))
+		assert.NoError(t, err)
+	}()
+	err = ds.ExecScript(postgres.SCHEMA)
+	assert.NoError(t, err)
+	n1 := &tork.Node{ // active
+		ID:              uuid.NewUUID(),
+		Status:          tork.NodeStatusUP,
+		LastHeartbeatAt: time.Now().UTC().Add(-time.Second * 20),
+	}
+	n2 := &tork.Node{
+		ID:              uuid.NewUUID(),
+		Status:          tork.NodeStatusUP,
+		LastHeartbeatAt: time.Now().UTC().Add(-time.Minute * 10),
+	}
+	n3 := &tork.Node{
+		ID:              uuid.NewUUID(),
+		Status:          tork.NodeStatusDraining,
+		LastHeartbeatAt: time.Now().UTC().Add(-time.Minute * 10),
+	}
+	n4 := &tork.Node{ // already down
+		ID:              uuid.NewUUID(),
+		Status:          tork.NodeStatusDown,
+		LastHeartbeatAt: time.Now().UTC().Add(-time.Minute * 10),
+	}
+	for _, n := range []*tork.Node{n1, n2, n3, n4} {
+		err = ds.CreateNode(ctx, n)
+		assert.NoError(t, err)
+	}
+
+	ns, err := ds.GetStaleNodes(ctx, time.Now().UTC().Add(-tork.LAST_HEARTBEAT_TIMEOUT))
+	assert.NoError(t, err)
+	assert.Len(t, ns, 2)
+	ids := []string{ns[0].ID, ns[1].ID}
+	assert.Contains(t, ids, n2.ID)
+	assert.Contains(t, ids, n3.ID)
+}
+
 func TestPostgresCreateAndGetJob(t *testing.T) {
 	ctx := context.Background()
 	dsn := "host=localhost user=tork password=tork dbname=tork port=5432 sslmode=disable"
@@ -537,6 +701,23 @@ func TestPostgresCreateAndGetJob(t *testing.T) {
 	assert.Equal(t, "public", j4.Permissions[0].Role.Slug)
 }
 
+func TestPostgresGetJobNamespace(t *testing.T) {
+	ctx := context.Background()
+	ds, err := NewTestDatastore()
+	assert.NoError(t, err)
+	j1 := tork.Job{
+		ID:        uuid.NewUUID(),
+		Namespace: tork.NAMESPACE_DEFAULT,
+	}
+	assert.NoError(t, ds.CreateJob(ctx, &j1))
+	ns, err := ds.GetJobNamespace(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.NAMESPACE_DEFAULT, ns)
+	_, err = ds.GetJobNamespace(ctx, uuid.NewUUID())
+	assert.ErrorIs(t, err, datastore.ErrJobNotFound)
+	assert.NoError(t, ds.Close())
+}
+
 func TestPostgresUpdateJob(t *testing.T) {
 	ctx := context.Background()
 	dsn := "host=localhost user=tork password=tork dbname=tork port=5432 sslmode=disable"
@@ -613,6 +794,12 @@ func TestPostgresUpdateJobConcurrently(t *testing.T) {
 	assert.Equal(t, 5, j2.Position)
 }
 
+func mustParseQuery(t *testing.T, q string) *search.Query {
+	query, err := search.Parse(q)
+	assert.NoError(t, err)
+	return query
+}
+
 func TestPostgresGetJobs(t *testing.T) {
 	ctx := context.Background()
 	schemaName := fmt.Sprintf("tork%d", rand.Int())
@@ -649,20 +836,20 @@ func TestPostgresGetJobs(t *testing.T) {
 		})
 		assert.NoError(t, err)
 	}
-	p1, err := ds.GetJobs(ctx, "", "", 1, 10)
+	p1, err := ds.GetJobs(ctx, "", "", nil, "", 1, 10)
 	assert.NoError(t, err)
 	assert.Equal(t, 10, p1.Size)
 	assert.Equal(t, 101, p1.TotalItems)
 
-	p2, err := ds.GetJobs(ctx, "", "", 2, 10)
+	p2, err := ds.GetJobs(ctx, "", "", nil, "", 2, 10)
 	assert.NoError(t, err)
 	assert.Equal(t, 10, p2.Size)
 
-	p10, err := ds.GetJobs(ctx, "", "", 10, 10)
+	p10, err := ds.GetJobs(ctx, "", "", nil, "", 10, 10)
 	assert.NoError(t, err)
 	assert.Equal(t, 10, p10.Size)
 
-	p11, err := ds.GetJobs(ctx, "", "", 11, 10)
+	p11, err := ds.GetJobs(ctx, "", "", nil, "", 11, 10)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, p11.Size)
 
@@ -770,58 +957,265 @@ func TestPostgresSearchJobs(t *testing.T) {
 		assert.NoError(t, err)
 	}
 
-	p1, err := ds.GetJobs(ctx, "", "", 1, 10)
+	p1, err := ds.GetJobs(ctx, "", "", nil, "", 1, 10)
 	assert.NoError(t, err)
 	assert.Equal(t, 10, p1.Size)
 	assert.Equal(t, 101, p1.TotalItems)
 
-	p1, err = ds.GetJobs(ctx, "", "101", 1, 10)
+	p1, err = ds.GetJobs(ctx, "", "", mustParseQuery(t, "101"), "", 1, 10)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, p1.Size)
 	assert.Equal(t, 1, p1.TotalItems)
 
-	p1, err = ds.GetJobs(ctx, "", "tag:tag-1", 1, 10)
+	p1, err = ds.GetJobs(ctx, "", "", mustParseQuery(t, "tag:tag-1"), "", 1, 10)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, p1.Size)
 	assert.Equal(t, 1, p1.TotalItems)
 
-	p1, err = ds.GetJobs(ctx, "", "tag:not-a-tag", 1, 10)
+	p1, err = ds.GetJobs(ctx, "", "", mustParseQuery(t, "tag:not-a-tag"), "", 1, 10)
 	assert.NoError(t, err)
 	assert.Equal(t, 0, p1.Size)
 	assert.Equal(t, 0, p1.TotalItems)
 
-	p1, err = ds.GetJobs(ctx, "", "tags:not-a-tag,tag-1", 1, 10)
+	p1, err = ds.GetJobs(ctx, "", "", mustParseQuery(t, "tags:not-a-tag,tag-1"), "", 1, 10)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, p1.Size)
 	assert.Equal(t, 1, p1.TotalItems)
 
-	p1, err = ds.GetJobs(ctx, "", "Job", 1, 10)
+	p1, err = ds.GetJobs(ctx, "", "", mustParseQuery(t, "Job"), "", 1, 10)
 	assert.NoError(t, err)
 	assert.Equal(t, 10, p1.Size)
 	assert.Equal(t, 101, p1.TotalItems)
 
-	p1, err = ds.GetJobs(ctx, "", "running", 1, 10)
+	p1, err = ds.GetJobs(ctx, "", "", mustParseQuery(t, "running"), "", 1, 10)
 	assert.NoError(t, err)
 	assert.Equal(t, 10, p1.Size)
 	assert.Equal(t, 101, p1.TotalItems)
 
-	p1, err = ds.GetJobs(ctx, u1.Username, "running", 1, 10)
+	p1, err = ds.GetJobs(ctx, u1.Username, "", mustParseQuery(t, "running"), "", 1, 10)
 	assert.NoError(t, err)
 	assert.Equal(t, 10, p1.Size)
 	assert.Equal(t, 101, p1.TotalItems)
 
-	p1, err = ds.GetJobs(ctx, u2.Username, "running", 1, 10)
+	p1, err = ds.GetJobs(ctx, u2.Username, "", mustParseQuery(t, "running"), "", 1, 10)
 	assert.NoError(t, err)
 	assert.Equal(t, 10, p1.Size)
 	assert.Equal(t, 101, p1.TotalItems)
 
-	p1, err = ds.GetJobs(ctx, u3.Username, "running", 1, 10)
+	p1, err = ds.GetJobs(ctx, u3.Username, "", mustParseQuery(t, "running"), "", 1, 10)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, p1.Size)
 	assert.Equal(t, 1, p1.TotalItems)
 
 }
 
+func TestPostgresGetJobsQuery(t *testing.T) {
+	ctx := context.Background()
+	ds, err := NewTestDatastore()
+	assert.NoError(t, err)
+
+	alice := &tork.User{ID: uuid.NewUUID(), Username: "alice", Name: "Alice"}
+	assert.NoError(t, ds.CreateUser(ctx, alice))
+	bob := &tork.User{ID: uuid.NewUUID(), Username: "bob", Name: "Bob"}
+	assert.NoError(t, ds.CreateUser(ctx, bob))
+
+	day := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	parentID := uuid.NewUUID()
+	for i := 0; i < 30; i++ {
+		createdAt := day.AddDate(0, 0, i%3)
+		j := &tork.Job{
+			ID:        uuid.NewUUID(),
+			Name:      fmt.Sprintf("etl-%d", i),
+			State:     tork.JobStateCompleted,
+			CreatedAt: createdAt,
+			CreatedBy: alice,
+			Inputs:    map[string]string{"region": "us"},
+			Tags:      []string{"nightly"},
+		}
+		if i%5 == 0 {
+			j.Name = fmt.Sprintf("report-%d", i)
+			j.State = tork.JobStateFailed
+			j.CreatedBy = bob
+			j.Inputs = map[string]string{"region": "eu"}
+			j.Tags = []string{}
+			j.ParentID = parentID
+		}
+		assert.NoError(t, ds.CreateJob(ctx, j))
+	}
+
+	tests := []struct {
+		q     string
+		count int
+	}{
+		{"state:FAILED", 6},
+		{"state:failed OR state:RUNNING", 6},
+		{"NOT state:FAILED", 24},
+		{"user:bob", 6},
+		{"user:alice -tag:nightly", 0},
+		{`name:"etl*"`, 24},
+		{`name:ETL-1`, 1},
+		{"input.region:eu", 6},
+		{"input.region:e*", 6},
+		{fmt.Sprintf("parent:%s", parentID), 6},
+		{"created:2026-01-01", 10},
+		{"created:>2026-01-01", 20},
+		{"created:<=2026-01-02", 20},
+		{"created:>=2026-01-02T12:00:00Z", 20},
+		{"(user:bob OR tag:nightly) AND created:2026-01-03", 10},
+	}
+	for _, test := range tests {
+		p, err := ds.GetJobs(ctx, "", "", mustParseQuery(t, test.q), "", 1, 100)
+		assert.NoError(t, err, test.q)
+		assert.Equal(t, test.count, p.TotalItems, test.q)
+	}
+
+	p, err := ds.GetJobs(ctx, "", "", mustParseQuery(t, "state:FAILED sort:name"), "", 1, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, "report-0", p.Items[0].Name)
+	assert.Equal(t, "report-5", p.Items[5].Name)
+
+	// walk the jobs by cursor
+	seen := make(map[string]bool)
+	q := mustParseQuery(t, "sort:-created")
+	cursor := ""
+	var last time.Time
+	for {
+		p, err := ds.GetJobs(ctx, "", "", q, cursor, 1, 7)
+		assert.NoError(t, err)
+		for _, j := range p.Items {
+			assert.False(t, seen[j.ID])
+			seen[j.ID] = true
+			if !last.IsZero() {
+				assert.False(t, j.CreatedAt.After(last))
+			}
+			last = j.CreatedAt
+		}
+		if p.NextCursor == "" {
+			break
+		}
+		cursor = p.NextCursor
+	}
+	assert.Len(t, seen, 30)
+
+	_, err = ds.GetJobs(ctx, "", "", mustParseQuery(t, "sort:name"), cursor, 1, 7)
+	assert.ErrorIs(t, err, datastore.ErrInvalidCursor)
+	_, err = ds.GetJobs(ctx, "", "", q, "garbage", 1, 7)
+	assert.ErrorIs(t, err, datastore.ErrInvalidCursor)
+
+	assert.NoError(t, ds.Close())
+}
+
+func TestPostgresGetJobAndTaskStats(t *testing.T) {
+	ctx := context.Background()
+	ds, err := NewTestDatastore()
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, ds.Close())
+	}()
+
+	now := time.Now().UTC()
+	for i := 0; i < 10; i++ {
+		state := tork.JobStateCompleted
+		if i%5 == 0 {
+			state = tork.JobStateFailed
+		}
+		createdAt := now.Add(-time.Minute * time.Duration(i+1))
+		j := &tork.Job{
+			ID:        uuid.NewUUID(),
+			Name:      "some job",
+			Tags:      []string{"a", "b"},
+			State:     tork.JobStateRunning,
+			CreatedAt: createdAt,
+			StartedAt: &createdAt,
+		}
+		assert.NoError(t, ds.CreateJob(ctx, j))
+		task := &tork.Task{
+			ID:        uuid.NewUUID(),
+			JobID:     j.ID,
+			Queue:     "some-queue",
+			Image:     "some:image",
+			State:     tork.TaskStateRunning,
+			CreatedAt: &createdAt,
+			StartedAt: &createdAt,
+		}
+		assert.NoError(t, ds.CreateTask(ctx, task))
+		endedAt := createdAt.Add(time.Second * time.Duration(i+1))
+		assert.NoError(t, ds.UpdateJob(ctx, j.ID, func(u *tork.Job) error {
+			u.State = state
+			if state == tork.JobStateCompleted {
+				u.CompletedAt = &endedAt
+			} else {
+				u.FailedAt = &endedAt
+			}
+			return nil
+		}))
+		assert.NoError(t, ds.UpdateTask(ctx, task.ID, func(u *tork.Task) error {
+			u.State = tork.TaskState(state)
+			if state == tork.JobStateCompleted {
+				u.CompletedAt = &endedAt
+			} else {
+				u.FailedAt = &endedAt
+			}
+			return nil
+		}))
+	}
+	// still running, so left out
+	assert.NoError(t, ds.CreateJob(ctx, &tork.Job{
+		ID:        uuid.NewUUID(),
+		Name:      "some job",
+		State:     tork.JobStateRunning,
+		CreatedAt: now,
+	}))
+
+	stats, err := ds.GetJobStats(ctx, "", "", datastore.StatsQuery{GroupBy: datastore.StatsByName})
+	assert.NoError(t, err)
+	assert.Len(t, stats, 1)
+	assert.Equal(t, "some job", stats[0].Group)
+	assert.Equal(t, 10, stats[0].Count)
+	assert.Equal(t, 8, stats[0].Completed)
+	assert.Equal(t, 2, stats[0].Failed)
+	assert.Equal(t, 0.8, stats[0].SuccessRate)
+	assert.InDelta(t, 6, stats[0].P50Duration, 0.01)
+	assert.Greater(t, stats[0].P95Duration, stats[0].P50Duration)
+
+	stats, err = ds.GetJobStats(ctx, "", "", datastore.StatsQuery{GroupBy: datastore.StatsByTag})
+	assert.NoError(t, err)
+	assert.Len(t, stats, 2)
+	assert.Equal(t, "a", stats[0].Group)
+	assert.Equal(t, 10, stats[0].Count)
+
+	stats, err = ds.GetJobStats(ctx, "", "", datastore.StatsQuery{GroupBy: datastore.StatsByUser})
+	assert.NoError(t, err)
+	assert.Len(t, stats, 1)
+	assert.Equal(t, tork.USER_GUEST, stats[0].Group)
+
+	since := now.Add(-time.Minute*3 - time.Second)
+	stats, err = ds.GetJobStats(ctx, "", "", datastore.StatsQuery{GroupBy: datastore.StatsByName, Since: &since})
+	assert.NoError(t, err)
+	assert.Len(t, stats, 1)
+	assert.Equal(t, 3, stats[0].Count)
+
+	_, err = ds.GetJobStats(ctx, "", "", datastore.StatsQuery{GroupBy: datastore.StatsByQueue})
+	assert.ErrorIs(t, err, datastore.ErrInvalidStatsGroup)
+
+	stats, err = ds.GetTaskStats(ctx, "", "", datastore.StatsQuery{GroupBy: datastore.StatsByQueue})
+	assert.NoError(t, err)
+	assert.Len(t, stats, 1)
+	assert.Equal(t, "some-queue", stats[0].Group)
+	assert.Equal(t, 10, stats[0].Count)
+	assert.Equal(t, 8, stats[0].Completed)
+
+	stats, err = ds.GetTaskStats(ctx, "", "", datastore.StatsQuery{GroupBy: datastore.StatsByImage})
+	assert.NoError(t, err)
+	assert.Len(t, stats, 1)
+	assert.Equal(t, "some:image", stats[0].Group)
+
+	stats, err = ds.GetTaskStats(ctx, "", "", datastore.StatsQuery{GroupBy: datastore.StatsByName})
+	assert.NoError(t, err)
+	assert.Len(t, stats, 1)
+	assert.Equal(t, "some job", stats[0].Group)
+}
+
 func TestPostgresGetMetrics(t *testing.T) {
 	ctx := context.Background()
 	schemaName := fmt.Sprintf("tork%d", rand.Int())
@@ -836,7 +1230,7 @@ func TestPostgresGetMetrics(t *testing.T) {
 	}()
 	err = ds.ExecScript(postgres.SCHEMA)
 	assert.NoError(t, err)
-	s, err := ds.GetMetrics(ctx)
+	s, err := ds.GetMetrics(ctx, "")
 	assert.NoError(t, err)
 	assert.Equal(t, 0, s.Jobs.Running)
 	assert.Equal(t, 0, s.Tasks.Running)
@@ -889,7 +1283,7 @@ func TestPostgresGetMetrics(t *testing.T) {
 		assert.NoError(t, err)
 	}
 
-	s, err = ds.GetMetrics(ctx)
+	s, err = ds.GetMetrics(ctx, "")
 	assert.NoError(t, err)
 	assert.Equal(t, 50, s.Jobs.Running)
 	assert.Equal(t, 50, s.Tasks.Running)
@@ -996,7 +1390,7 @@ func TestPostgresCreateAndGetTaskLogs(t *testing.T) {
 	})
 	assert.NoError(t, err)
 
-	logs, err := ds.GetTaskLogParts(ctx, t1.ID, "", 1, 10)
+	logs, err := ds.GetTaskLogParts(ctx, t1.ID, "", "", 1, 10)
 	assert.NoError(t, err)
 	assert.Len(t, logs.Items, 1)
 	assert.Equal(t, "line 1", logs.Items[0].Contents)
@@ -1041,7 +1435,7 @@ func TestPostgresCreateAndGetTaskLogsMultiParts(t *testing.T) {
 
 	wg.Wait()
 
-	logs, err := ds.GetTaskLogParts(ctx, t1.ID, "", 1, 10)
+	logs, err := ds.GetTaskLogParts(ctx, t1.ID, "", "", 1, 10)
 	assert.NoError(t, err)
 	assert.Len(t, logs.Items, 10)
 	assert.Equal(t, "line 10", logs.Items[0].Contents)
@@ -1076,7 +1470,7 @@ func TestPostgresCreateAndGetTaskLogsLarge(t *testing.T) {
 		assert.NoError(t, err)
 	}
 
-	logs, err := ds.GetTaskLogParts(ctx, t1.ID, "", 1, 10)
+	logs, err := ds.GetTaskLogParts(ctx, t1.ID, "", "", 1, 10)
 	assert.NoError(t, err)
 	assert.Len(t, logs.Items, 10)
 	assert.Equal(t, "line 100", logs.Items[0].Contents)
@@ -1113,7 +1507,7 @@ func TestPostgresQueryTaskLogs(t *testing.T) {
 		assert.NoError(t, err)
 	}
 
-	logs, err := ds.GetTaskLogParts(ctx, t1.ID, "line 91", 1, 10)
+	logs, err := ds.GetTaskLogParts(ctx, t1.ID, "line 91", "", 1, 10)
 	assert.NoError(t, err)
 	assert.Len(t, logs.Items, 1)
 	assert.Equal(t, "line 91", logs.Items[0].Contents)
@@ -1151,7 +1545,7 @@ func TestPostgresCreateAndExpungeTaskLogs(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 0, n)
 
-	logs, err := ds.GetTaskLogParts(ctx, t1.ID, "", 1, 1)
+	logs, err := ds.GetTaskLogParts(ctx, t1.ID, "", "", 1, 1)
 	assert.NoError(t, err)
 	assert.Equal(t, 100, logs.TotalItems)
 
@@ -1162,7 +1556,7 @@ func TestPostgresCreateAndExpungeTaskLogs(t *testing.T) {
 	assert.NoError(t, err)
 	assert.GreaterOrEqual(t, n, 100)
 
-	logs, err = ds.GetTaskLogParts(ctx, t1.ID, "", 1, 1)
+	logs, err = ds.GetTaskLogParts(ctx, t1.ID, "", "", 1, 1)
 	assert.NoError(t, err)
 	assert.Equal(t, 0, logs.TotalItems)
 }
@@ -1219,7 +1613,7 @@ func Test_cleanup(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, time.Minute, *ds.cleanupInterval)
 
-	logs, err := ds.GetTaskLogParts(ctx, t1.ID, "", 1, 1)
+	logs, err := ds.GetTaskLogParts(ctx, t1.ID, "", "", 1, 1)
 	assert.NoError(t, err)
 	assert.Equal(t, 100, logs.TotalItems)
 
@@ -1230,7 +1624,7 @@ func Test_cleanup(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, time.Minute, *ds.cleanupInterval)
 
-	logs, err = ds.GetTaskLogParts(ctx, t1.ID, "", 1, 1)
+	logs, err = ds.GetTaskLogParts(ctx, t1.ID, "", "", 1, 1)
 	assert.NoError(t, err)
 	assert.Equal(t, 0, logs.TotalItems)
 
@@ -1241,6 +1635,120 @@ func Test_cleanup(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestPostgresGetTaskLogPartsCursor(t *testing.T) {
+	ctx := context.Background()
+	dsn := "host=localhost user=tork password=tork dbname=tork port=5432 sslmode=disable"
+	ds, err := NewPostgresDataStore(dsn)
+	assert.NoError(t, err)
+	now := time.Now().UTC()
+	j1 := tork.Job{
+		ID: uuid.NewUUID(),
+	}
+	err = ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	t1 := tork.Task{
+		ID:        uuid.NewUUID(),
+		CreatedAt: &now,
+		JobID:     j1.ID,
+	}
+	err = ds.CreateTask(ctx, &t1)
+	assert.NoError(t, err)
+	for i := 1; i <= 25; i++ {
+		err := ds.CreateTaskLogPart(ctx, &tork.TaskLogPart{
+			Number:   i,
+			TaskID:   t1.ID,
+			Contents: fmt.Sprintf("line %d", i),
+		})
+		assert.NoError(t, err)
+	}
+	numbers := make([]int, 0)
+	cursor := ""
+	for {
+		logs, err := ds.GetTaskLogParts(ctx, t1.ID, "", cursor, 1, 10)
+		assert.NoError(t, err)
+		for _, p := range logs.Items {
+			numbers = append(numbers, p.Number)
+		}
+		if logs.NextCursor == "" {
+			break
+		}
+		cursor = logs.NextCursor
+	}
+	assert.Len(t, numbers, 25)
+	assert.Equal(t, 25, numbers[0])
+	assert.Equal(t, 1, numbers[24])
+
+	// cursors are not interchangeable between listings
+	logs, err := ds.GetTaskLogParts(ctx, t1.ID, "", "", 1, 10)
+	assert.NoError(t, err)
+	_, err = ds.GetJobLogParts(ctx, j1.ID, "", logs.NextCursor, 1, 10)
+	assert.ErrorIs(t, err, datastore.ErrInvalidCursor)
+}
+
+func TestPostgresGetJobTasks(t *testing.T) {
+	ctx := context.Background()
+	dsn := "host=localhost user=tork password=tork dbname=tork port=5432 sslmode=disable"
+	ds, err := NewPostgresDataStore(dsn)
+	assert.NoError(t, err)
+	now := time.Now().UTC()
+	j1 := tork.Job{
+		ID: uuid.NewUUID(),
+	}
+	err = ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	parent := tork.Task{
+		ID:        uuid.NewUUID(),
+		JobID:     j1.ID,
+		Position:  1,
+		State:     tork.TaskStateRunning,
+		CreatedAt: &now,
+	}
+	err = ds.CreateTask(ctx, &parent)
+	assert.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		state := tork.TaskStateCompleted
+		if i%2 == 0 {
+			state = tork.TaskStateFailed
+		}
+		err := ds.CreateTask(ctx, &tork.Task{
+			ID:        uuid.NewUUID(),
+			JobID:     j1.ID,
+			ParentID:  parent.ID,
+			Position:  1,
+			State:     state,
+			CreatedAt: &now,
+		})
+		assert.NoError(t, err)
+	}
+
+	all, err := ds.GetJobTasks(ctx, j1.ID, datastore.TaskQuery{}, "", 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, all.TotalItems)
+	assert.Empty(t, all.NextCursor)
+
+	failed, err := ds.GetJobTasks(ctx, j1.ID, datastore.TaskQuery{State: string(tork.TaskStateFailed)}, "", 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, failed.TotalItems)
+
+	ids := make(map[string]bool)
+	cursor := ""
+	for {
+		p, err := ds.GetJobTasks(ctx, j1.ID, datastore.TaskQuery{ParentID: parent.ID}, cursor, 1, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, 5, p.TotalItems)
+		for _, item := range p.Items {
+			assert.Equal(t, parent.ID, item.ParentID)
+			assert.False(t, ids[item.ID])
+			ids[item.ID] = true
+		}
+		if p.NextCursor == "" {
+			break
+		}
+		cursor = p.NextCursor
+	}
+	assert.Len(t, ids, 5)
+}
+
 func TestPostgresGetJobLogParts(t *testing.T) {
 	ctx := context.Background()
 	dsn := "host=localhost user=tork password=tork dbname=tork port=5432 sslmode=disable"
@@ -1267,7 +1775,7 @@ func TestPostgresGetJobLogParts(t *testing.T) {
 	})
 	assert.NoError(t, err)
 
-	logs, err := ds.GetJobLogParts(ctx, j1.ID, "", 1, 10)
+	logs, err := ds.GetJobLogParts(ctx, j1.ID, "", "", 1, 10)
 	assert.NoError(t, err)
 	assert.Len(t, logs.Items, 1)
 	assert.Equal(t, "line 1", logs.Items[0].Contents)
@@ -1301,7 +1809,7 @@ func TestPostgresQueryJobLogParts(t *testing.T) {
 		assert.NoError(t, err)
 	}
 
-	logs, err := ds.GetJobLogParts(ctx, j1.ID, "line 91", 1, 10)
+	logs, err := ds.GetJobLogParts(ctx, j1.ID, "line 91", "", 1, 10)
 	assert.NoError(t, err)
 	assert.Len(t, logs.Items, 1)
 	assert.Equal(t, "line 91", logs.Items[0].Contents)
@@ -1330,7 +1838,7 @@ func TestPostgresCreateRole(t *testing.T) {
 	roles, err := ds.GetRoles(ctx)
 	assert.NoError(t, err)
 	assert.Greater(t, len(roles), 0)
-	assert.Equal(t, "Public", roles[0].Name)
+	assert.Equal(t, "Admin", roles[0].Name)
 
 	u := &tork.User{
 		ID:        uuid.NewUUID(),
@@ -1357,21 +1865,422 @@ func TestPostgresCreateRole(t *testing.T) {
 	assert.Len(t, uroles, 0)
 }
 
-func TestPostgresGetNextTask(t *testing.T) {
+func TestPostgresUpdateUser(t *testing.T) {
 	ctx := context.Background()
-	dsn := "host=localhost user=tork password=tork dbname=tork port=5432 sslmode=disable"
-	ds, err := NewPostgresDataStore(dsn)
+	ds, err := NewTestDatastore()
 	assert.NoError(t, err)
-
-	j1 := tork.Job{
-		ID:        uuid.NewUUID(),
-		CreatedAt: time.Now().UTC(),
+	u := &tork.User{
+		Username:     uuid.NewShortUUID(),
+		Name:         "Tester",
+		PasswordHash: "hash1",
 	}
-	err = ds.CreateJob(ctx, &j1)
+	err = ds.CreateUser(ctx, u)
 	assert.NoError(t, err)
 
-	now := time.Now().UTC()
-
+	err = ds.UpdateUser(ctx, u.ID, func(x *tork.User) error {
+		x.Name = "Other Tester"
+		x.PasswordHash = "hash2"
+		x.Disabled = true
+		return nil
+	})
+	assert.NoError(t, err)
+
+	u2, err := ds.GetUser(ctx, u.Username)
+	assert.NoError(t, err)
+	assert.Equal(t, "Other Tester", u2.Name)
+	assert.Equal(t, "hash2", u2.PasswordHash)
+	assert.True(t, u2.Disabled)
+
+	err = ds.UpdateUser(ctx, uuid.NewUUID(), func(x *tork.User) error { return nil })
+	assert.ErrorIs(t, err, datastore.ErrUserNotFound)
+	assert.NoError(t, ds.Close())
+}
+
+func TestPostgresDeleteUser(t *testing.T) {
+	ctx := context.Background()
+	ds, err := NewTestDatastore()
+	assert.NoError(t, err)
+	r := &tork.Role{Slug: "some-role", Name: "Some Role"}
+	err = ds.CreateRole(ctx, r)
+	assert.NoError(t, err)
+
+	u1 := &tork.User{Username: uuid.NewShortUUID(), Name: "Tester"}
+	err = ds.CreateUser(ctx, u1)
+	assert.NoError(t, err)
+	err = ds.AssignRole(ctx, u1.ID, r.ID)
+	assert.NoError(t, err)
+
+	err = ds.DeleteUser(ctx, u1.ID)
+	assert.NoError(t, err)
+	_, err = ds.GetUser(ctx, u1.ID)
+	assert.ErrorIs(t, err, datastore.ErrUserNotFound)
+
+	// users who own jobs can't be deleted
+	u2 := &tork.User{Username: uuid.NewShortUUID(), Name: "Tester"}
+	err = ds.CreateUser(ctx, u2)
+	assert.NoError(t, err)
+	err = ds.CreateJob(ctx, &tork.Job{
+		ID:        uuid.NewUUID(),
+		CreatedAt: time.Now().UTC(),
+		CreatedBy: u2,
+	})
+	assert.NoError(t, err)
+	err = ds.DeleteUser(ctx, u2.ID)
+	assert.ErrorIs(t, err, datastore.ErrUserInUse)
+
+	err = ds.DeleteUser(ctx, uuid.NewUUID())
+	assert.ErrorIs(t, err, datastore.ErrUserNotFound)
+	assert.NoError(t, ds.Close())
+}
+
+func TestPostgresUserIdentities(t *testing.T) {
+	ctx := context.Background()
+	ds, err := NewTestDatastore()
+	assert.NoError(t, err)
+	u := &tork.User{Username: uuid.NewShortUUID(), Name: "Tester"}
+	err = ds.CreateUser(ctx, u)
+	assert.NoError(t, err)
+
+	subject := uuid.NewUUID()
+	i := &tork.UserIdentity{UserID: u.ID, Issuer: "https://login.example.com", Subject: subject}
+	err = ds.CreateUserIdentity(ctx, i)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, i.ID)
+
+	// an identity belongs to one user
+	other := &tork.User{Username: uuid.NewShortUUID(), Name: "Other"}
+	err = ds.CreateUser(ctx, other)
+	assert.NoError(t, err)
+	err = ds.CreateUserIdentity(ctx, &tork.UserIdentity{UserID: other.ID, Issuer: i.Issuer, Subject: subject})
+	assert.Error(t, err)
+
+	u1, err := ds.GetUserByIdentity(ctx, i.Issuer, subject)
+	assert.NoError(t, err)
+	assert.Equal(t, u.ID, u1.ID)
+	_, err = ds.GetUserByIdentity(ctx, "https://other.example.com", subject)
+	assert.ErrorIs(t, err, datastore.ErrUserNotFound)
+
+	identities, err := ds.GetUserIdentities(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Len(t, identities, 1)
+	assert.Equal(t, subject, identities[0].Subject)
+
+	err = ds.DeleteUserIdentity(ctx, other.ID, i.ID)
+	assert.ErrorIs(t, err, datastore.ErrIdentityNotFound)
+	err = ds.DeleteUserIdentity(ctx, u.ID, i.ID)
+	assert.NoError(t, err)
+	_, err = ds.GetUserByIdentity(ctx, i.Issuer, subject)
+	assert.ErrorIs(t, err, datastore.ErrUserNotFound)
+
+	assert.NoError(t, ds.Close())
+}
+
+func TestPostgresUserTokens(t *testing.T) {
+	ctx := context.Background()
+	ds, err := NewTestDatastore()
+	assert.NoError(t, err)
+	u := &tork.User{Username: uuid.NewShortUUID(), Name: "Tester"}
+	err = ds.CreateUser(ctx, u)
+	assert.NoError(t, err)
+
+	exp := time.Now().UTC().Add(time.Hour)
+	t1 := &tork.UserToken{
+		UserID:    u.ID,
+		Name:      "ci",
+		TokenHash: hash.Token("tork_secret"),
+		Scopes:    []string{tork.TOKEN_SCOPE_READ},
+		ExpiresAt: &exp,
+	}
+	err = ds.CreateUserToken(ctx, t1)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, t1.ID)
+
+	t11, err := ds.GetUserTokenByHash(ctx, hash.Token("tork_secret"))
+	assert.NoError(t, err)
+	assert.Equal(t, t1.ID, t11.ID)
+	assert.Equal(t, u.ID, t11.UserID)
+	assert.Equal(t, []string{tork.TOKEN_SCOPE_READ}, t11.Scopes)
+	assert.Nil(t, t11.LastUsedAt)
+
+	now := time.Now().UTC()
+	err = ds.UpdateUserTokenLastUsed(ctx, t1.ID, now)
+	assert.NoError(t, err)
+
+	tokens, err := ds.GetUserTokens(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Len(t, tokens, 1)
+	assert.NotNil(t, tokens[0].LastUsedAt)
+
+	_, err = ds.GetUserTokenByHash(ctx, hash.Token("tork_other"))
+	assert.ErrorIs(t, err, datastore.ErrTokenNotFound)
+
+	err = ds.DeleteUserToken(ctx, uuid.NewUUID(), t1.ID)
+	assert.ErrorIs(t, err, datastore.ErrTokenNotFound)
+	err = ds.DeleteUserToken(ctx, u.ID, t1.ID)
+	assert.NoError(t, err)
+	tokens, err = ds.GetUserTokens(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Len(t, tokens, 0)
+	assert.NoError(t, ds.Close())
+}
+
+func TestPostgresPolicies(t *testing.T) {
+	ctx := context.Background()
+	ds, err := NewTestDatastore()
+	assert.NoError(t, err)
+
+	r := &tork.Role{Slug: "some-role", Name: "Some Role"}
+	err = ds.CreateRole(ctx, r)
+	assert.NoError(t, err)
+	u := &tork.User{Username: uuid.NewShortUUID(), Name: "Tester"}
+	err = ds.CreateUser(ctx, u)
+	assert.NoError(t, err)
+
+	// the public role's default policies apply to every user
+	ps, err := ds.GetUserPolicies(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, ps)
+	for _, p := range ps {
+		assert.Equal(t, tork.ROLE_PUBLIC, p.Role.Slug)
+		assert.NotEqual(t, tork.ACTION_USER_MANAGE, p.Action)
+	}
+	defaults := len(ps)
+
+	p := &tork.Policy{Role: r, Action: tork.ACTION_QUEUE_USE, Resource: "gpu-*"}
+	err = ds.CreatePolicy(ctx, p)
+	assert.NoError(t, err)
+
+	ps, err = ds.GetPolicies(ctx, r.ID)
+	assert.NoError(t, err)
+	assert.Len(t, ps, 1)
+	assert.Equal(t, "gpu-*", ps[0].Resource)
+	assert.Equal(t, "some-role", ps[0].Role.Slug)
+
+	ps, err = ds.GetUserPolicies(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Len(t, ps, defaults)
+
+	err = ds.AssignRole(ctx, u.ID, r.ID)
+	assert.NoError(t, err)
+	ps, err = ds.GetUserPolicies(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Len(t, ps, defaults+1)
+
+	err = ds.DeletePolicy(ctx, p.ID)
+	assert.NoError(t, err)
+	err = ds.DeletePolicy(ctx, p.ID)
+	assert.ErrorIs(t, err, datastore.ErrPolicyNotFound)
+	assert.NoError(t, ds.Close())
+}
+
+func TestPostgresNamespaces(t *testing.T) {
+	ctx := context.Background()
+	ds, err := NewTestDatastore()
+	assert.NoError(t, err)
+
+	def, err := ds.GetNamespace(ctx, tork.NAMESPACE_DEFAULT)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.NAMESPACE_DEFAULT, def.Name)
+
+	ns := &tork.Namespace{Name: "team-a", DefaultQueue: "team-a", Quota: &tork.NamespaceQuota{MaxActiveJobs: 2}}
+	err = ds.CreateNamespace(ctx, ns)
+	assert.NoError(t, err)
+
+	nss, err := ds.GetNamespaces(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, nss, 2)
+
+	err = ds.UpdateNamespace(ctx, "team-a", func(n *tork.Namespace) error {
+		n.Description = "Team A"
+		n.Quota = nil
+		return nil
+	})
+	assert.NoError(t, err)
+	ns2, err := ds.GetNamespace(ctx, "team-a")
+	assert.NoError(t, err)
+	assert.Equal(t, "Team A", ns2.Description)
+	assert.Equal(t, "team-a", ns2.DefaultQueue)
+	assert.Nil(t, ns2.Quota)
+
+	u1 := &tork.User{Username: uuid.NewShortUUID(), Name: "Tester"}
+	assert.NoError(t, ds.CreateUser(ctx, u1))
+	u2 := &tork.User{Username: uuid.NewShortUUID(), Name: "Tester"}
+	assert.NoError(t, ds.CreateUser(ctx, u2))
+	r := &tork.Role{Slug: uuid.NewShortUUID(), Name: "Team A"}
+	assert.NoError(t, ds.CreateRole(ctx, r))
+	assert.NoError(t, ds.AssignRole(ctx, u2.ID, r.ID))
+
+	member, err := ds.IsNamespaceMember(ctx, ns.ID, u1.ID)
+	assert.NoError(t, err)
+	assert.False(t, member)
+
+	assert.NoError(t, ds.AddNamespaceMember(ctx, ns.ID, &tork.NamespaceMember{User: u1}))
+	assert.NoError(t, ds.AddNamespaceMember(ctx, ns.ID, &tork.NamespaceMember{User: u1}))
+	assert.NoError(t, ds.AddNamespaceMember(ctx, ns.ID, &tork.NamespaceMember{Role: r}))
+
+	member, err = ds.IsNamespaceMember(ctx, ns.ID, u1.ID)
+	assert.NoError(t, err)
+	assert.True(t, member)
+	member, err = ds.IsNamespaceMember(ctx, ns.ID, u2.ID)
+	assert.NoError(t, err)
+	assert.True(t, member)
+
+	ns2, err = ds.GetNamespace(ctx, "team-a")
+	assert.NoError(t, err)
+	assert.Len(t, ns2.Members, 2)
+
+	assert.NoError(t, ds.RemoveNamespaceMember(ctx, ns.ID, &tork.NamespaceMember{Role: r}))
+	member, err = ds.IsNamespaceMember(ctx, ns.ID, u2.ID)
+	assert.NoError(t, err)
+	assert.False(t, member)
+
+	j := &tork.Job{ID: uuid.NewUUID(), Name: "some job", Namespace: "team-a", State: tork.JobStateRunning}
+	assert.NoError(t, ds.CreateJob(ctx, j))
+	j2 := &tork.Job{ID: uuid.NewUUID(), Name: "other job", State: tork.JobStatePending}
+	assert.NoError(t, ds.CreateJob(ctx, j2))
+	assert.Equal(t, tork.NAMESPACE_DEFAULT, j2.Namespace)
+
+	n, err := ds.CountActiveJobs(ctx, "team-a")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	p, err := ds.GetJobs(ctx, "", "team-a", nil, "", 1, 10)
+	assert.NoError(t, err)
+	assert.Len(t, p.Items, 1)
+	assert.Equal(t, "team-a", p.Items[0].Namespace)
+
+	m, err := ds.GetMetrics(ctx, "team-a")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, m.Jobs.Running)
+
+	err = ds.DeleteNamespace(ctx, "team-a")
+	assert.ErrorIs(t, err, datastore.ErrNamespaceInUse)
+
+	empty := &tork.Namespace{Name: "empty"}
+	assert.NoError(t, ds.CreateNamespace(ctx, empty))
+	assert.NoError(t, ds.AddNamespaceMember(ctx, empty.ID, &tork.NamespaceMember{User: u1}))
+	assert.NoError(t, ds.DeleteNamespace(ctx, "empty"))
+	_, err = ds.GetNamespace(ctx, "empty")
+	assert.ErrorIs(t, err, datastore.ErrNamespaceNotFound)
+	assert.NoError(t, ds.Close())
+}
+
+func TestPostgresMigrate(t *testing.T) {
+	ctx := context.Background()
+	ds, err := NewTestDatastore()
+	assert.NoError(t, err)
+
+	// a fresh schema already includes every migration
+	var versions []int
+	assert.NoError(t, ds.select_(&versions, `select version from schema_migrations order by version`))
+	assert.Len(t, versions, len(postgres.MIGRATIONS))
+	for i, m := range postgres.MIGRATIONS {
+		assert.Equal(t, i+1, m.Version)
+	}
+
+	// migrating again is a no-op
+	assert.NoError(t, ds.Migrate(ctx))
+
+	// and migration scripts are safe to re-run
+	_, err = ds.exec(`delete from schema_migrations`)
+	assert.NoError(t, err)
+	assert.NoError(t, ds.Migrate(ctx))
+	versions = nil
+	assert.NoError(t, ds.select_(&versions, `select version from schema_migrations order by version`))
+	assert.Len(t, versions, len(postgres.MIGRATIONS))
+	assert.NoError(t, ds.Close())
+}
+
+func TestPostgresAuditEvents(t *testing.T) {
+	ctx := context.Background()
+	ds, err := NewTestDatastore()
+	assert.NoError(t, err)
+
+	jobID := uuid.NewUUID()
+	past := time.Now().UTC().Add(-time.Hour)
+	events := []*tork.AuditEvent{
+		{Username: "alice", Action: "PUT /jobs/:id/cancel", TargetType: tork.AUDIT_TARGET_JOB, TargetID: jobID, Status: 200},
+		{Action: "STATE_CHANGE CANCELLED", TargetType: tork.AUDIT_TARGET_JOB, TargetID: jobID},
+		{Username: "bob", Action: "POST /jobs", TargetType: tork.AUDIT_TARGET_JOB, TargetID: uuid.NewUUID(), CreatedAt: &past},
+	}
+	for _, e := range events {
+		assert.NoError(t, ds.CreateAuditEvent(ctx, e))
+		assert.NotEmpty(t, e.ID)
+	}
+
+	p, err := ds.GetAuditEvents(ctx, datastore.AuditQuery{TargetID: jobID}, 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, p.TotalItems)
+
+	p, err = ds.GetAuditEvents(ctx, datastore.AuditQuery{Username: "alice"}, 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, p.TotalItems)
+	assert.Equal(t, "PUT /jobs/:id/cancel", p.Items[0].Action)
+
+	since := time.Now().UTC().Add(-time.Minute)
+	p, err = ds.GetAuditEvents(ctx, datastore.AuditQuery{Since: &since}, 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, p.TotalItems)
+
+	p, err = ds.GetAuditEvents(ctx, datastore.AuditQuery{}, 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, p.TotalItems)
+	assert.Equal(t, 3, p.TotalPages)
+	assert.Len(t, p.Items, 1)
+
+	retention := time.Minute * 30
+	ds.auditRetentionDuration = &retention
+	n, err := ds.expungeExpiredAuditEvents()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	assert.NoError(t, ds.Close())
+}
+
+func TestPostgresDeleteRole(t *testing.T) {
+	ctx := context.Background()
+	ds, err := NewTestDatastore()
+	assert.NoError(t, err)
+	r := &tork.Role{Slug: "some-role", Name: "Some Role"}
+	err = ds.CreateRole(ctx, r)
+	assert.NoError(t, err)
+
+	u := &tork.User{Username: uuid.NewShortUUID(), Name: "Tester"}
+	err = ds.CreateUser(ctx, u)
+	assert.NoError(t, err)
+	err = ds.AssignRole(ctx, u.ID, r.ID)
+	assert.NoError(t, err)
+
+	err = ds.DeleteRole(ctx, r.ID)
+	assert.NoError(t, err)
+
+	_, err = ds.GetRole(ctx, r.Slug)
+	assert.ErrorIs(t, err, datastore.ErrRoleNotFound)
+
+	uroles, err := ds.GetUserRoles(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Len(t, uroles, 0)
+
+	err = ds.DeleteRole(ctx, r.ID)
+	assert.ErrorIs(t, err, datastore.ErrRoleNotFound)
+	assert.NoError(t, ds.Close())
+}
+
+func TestPostgresGetNextTask(t *testing.T) {
+	ctx := context.Background()
+	dsn := "host=localhost user=tork password=tork dbname=tork port=5432 sslmode=disable"
+	ds, err := NewPostgresDataStore(dsn)
+	assert.NoError(t, err)
+
+	j1 := tork.Job{
+		ID:        uuid.NewUUID(),
+		CreatedAt: time.Now().UTC(),
+	}
+	err = ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+
 	parentTaskID := uuid.NewUUID()
 	childTaskID := uuid.NewUUID()
 
@@ -1465,7 +2374,7 @@ func TestPostgresGetScheduledJobs(t *testing.T) {
 		err := ds.CreateScheduledJob(ctx, &j1)
 		assert.NoError(t, err)
 	}
-	p1, err := ds.GetScheduledJobs(ctx, "", 1, 10)
+	p1, err := ds.GetScheduledJobs(ctx, "", "", "", 1, 10)
 	assert.NoError(t, err)
 	assert.Equal(t, 10, p1.Size)
 	assert.Equal(t, 101, p1.TotalItems)
@@ -1474,20 +2383,39 @@ func TestPostgresGetScheduledJobs(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, p1.Items[0].ID, sj.ID)
 
-	p2, err := ds.GetScheduledJobs(ctx, "", 2, 10)
+	p2, err := ds.GetScheduledJobs(ctx, "", "", "", 2, 10)
 	assert.NoError(t, err)
 	assert.Equal(t, 10, p2.Size)
 
-	p10, err := ds.GetScheduledJobs(ctx, "", 10, 10)
+	p10, err := ds.GetScheduledJobs(ctx, "", "", "", 10, 10)
 	assert.NoError(t, err)
 	assert.Equal(t, 10, p10.Size)
 
-	p11, err := ds.GetScheduledJobs(ctx, "", 11, 10)
+	p11, err := ds.GetScheduledJobs(ctx, "", "", "", 11, 10)
 	assert.NoError(t, err)
 	assert.Equal(t, 1, p11.Size)
 
 	assert.NotEqual(t, p2.Items[0].ID, p1.Items[9].ID)
 	assert.NotEqual(t, p2.Items[0].ID, p1.Items[9].ID)
+
+	seen := make(map[string]bool)
+	cursor := ""
+	for {
+		p, err := ds.GetScheduledJobs(ctx, "", "", cursor, 1, 10)
+		assert.NoError(t, err)
+		for _, item := range p.Items {
+			assert.False(t, seen[item.ID])
+			seen[item.ID] = true
+		}
+		if p.NextCursor == "" {
+			break
+		}
+		cursor = p.NextCursor
+	}
+	assert.Len(t, seen, 101)
+
+	_, err = ds.GetScheduledJobs(ctx, "", "", "bogus", 1, 10)
+	assert.ErrorIs(t, err, datastore.ErrInvalidCursor)
 }
 
 func TestPostgresGetActiveScheduledJobs(t *testing.T) {
@@ -1627,3 +2555,208 @@ func TestPostgresDeleteScheduledJob(t *testing.T) {
 	_, err = ds.GetScheduledJobByID(ctx, sj.ID)
 	assert.Error(t, err)
 }
+
+func TestPostgresSecrets(t *testing.T) {
+	ctx := context.Background()
+	ds, err := NewTestDatastore()
+	assert.NoError(t, err)
+
+	ns := uuid.NewShortUUID()
+	s := &tork.Secret{Name: "DB_PASSWORD", Namespace: ns, Ciphertext: "c1"}
+	assert.NoError(t, ds.CreateSecret(ctx, s))
+	assert.NotEmpty(t, s.ID)
+
+	// secret names are unique per namespace
+	err = ds.CreateSecret(ctx, &tork.Secret{Name: "DB_PASSWORD", Namespace: ns, Ciphertext: "c2"})
+	assert.Error(t, err)
+	assert.NoError(t, ds.CreateSecret(ctx, &tork.Secret{Name: "DB_PASSWORD", Ciphertext: "c3"}))
+
+	s2, err := ds.GetSecret(ctx, ns, "DB_PASSWORD")
+	assert.NoError(t, err)
+	assert.Equal(t, "c1", s2.Ciphertext)
+
+	secs, err := ds.GetSecrets(ctx, ns)
+	assert.NoError(t, err)
+	assert.Len(t, secs, 1)
+
+	err = ds.UpdateSecret(ctx, ns, "DB_PASSWORD", func(u *tork.Secret) error {
+		u.Ciphertext = "c4"
+		return nil
+	})
+	assert.NoError(t, err)
+	s2, err = ds.GetSecret(ctx, ns, "DB_PASSWORD")
+	assert.NoError(t, err)
+	assert.Equal(t, "c4", s2.Ciphertext)
+
+	assert.NoError(t, ds.DeleteSecret(ctx, ns, "DB_PASSWORD"))
+	_, err = ds.GetSecret(ctx, ns, "DB_PASSWORD")
+	assert.ErrorIs(t, err, datastore.ErrSecretNotFound)
+	assert.ErrorIs(t, ds.DeleteSecret(ctx, ns, "DB_PASSWORD"), datastore.ErrSecretNotFound)
+
+	assert.NoError(t, ds.Close())
+}
+
+func TestPostgresDeleteJob(t *testing.T) {
+	ctx := context.Background()
+	ds, err := NewTestDatastore()
+	assert.NoError(t, err)
+	now := time.Now().UTC()
+	j1 := &tork.Job{
+		ID:    uuid.NewUUID(),
+		State: tork.JobStateCompleted,
+		Tags:  []string{"a"},
+	}
+	assert.NoError(t, ds.CreateJob(ctx, j1))
+	t1 := &tork.Task{
+		ID:        uuid.NewUUID(),
+		JobID:     j1.ID,
+		CreatedAt: &now,
+	}
+	assert.NoError(t, ds.CreateTask(ctx, t1))
+	assert.NoError(t, ds.CreateTaskLogPart(ctx, &tork.TaskLogPart{Number: 1, TaskID: t1.ID, Contents: "line 1"}))
+
+	// tags are updated along with the rest of the job
+	assert.NoError(t, ds.UpdateJob(ctx, j1.ID, func(u *tork.Job) error {
+		u.Tags = []string{"b", "c"}
+		return nil
+	}))
+	j2, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "c"}, j2.Tags)
+
+	assert.NoError(t, ds.DeleteJob(ctx, j1.ID))
+	_, err = ds.GetJobByID(ctx, j1.ID)
+	assert.ErrorIs(t, err, datastore.ErrJobNotFound)
+	_, err = ds.GetTaskByID(ctx, t1.ID)
+	assert.ErrorIs(t, err, datastore.ErrTaskNotFound)
+	assert.ErrorIs(t, ds.DeleteJob(ctx, j1.ID), datastore.ErrJobNotFound)
+	assert.NoError(t, ds.Close())
+}
+
+func TestPostgresBulkOperations(t *testing.T) {
+	ctx := context.Background()
+	ds, err := NewTestDatastore()
+	assert.NoError(t, err)
+	op := &tork.BulkOperation{
+		Action:    tork.BulkActionCancel,
+		Query:     "state:RUNNING",
+		State:     tork.BulkOperationStateRunning,
+		Total:     2,
+		CreatedBy: "someone",
+	}
+	assert.NoError(t, ds.CreateBulkOperation(ctx, op))
+	assert.NotEmpty(t, op.ID)
+	assert.Equal(t, tork.NAMESPACE_DEFAULT, op.Namespace)
+
+	op2, err := ds.GetBulkOperationByID(ctx, op.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.BulkActionCancel, op2.Action)
+	assert.Equal(t, "state:RUNNING", op2.Query)
+	assert.Equal(t, 2, op2.Total)
+	assert.Empty(t, op2.Results)
+
+	err = ds.UpdateBulkOperation(ctx, op.ID, func(u *tork.BulkOperation) error {
+		u.AddResult(&tork.BulkResult{JobID: "1", Outcome: tork.BulkOutcomeOK})
+		u.AddResult(&tork.BulkResult{JobID: "2", Outcome: tork.BulkOutcomeSkipped, Error: "job is not running"})
+		now := time.Now().UTC()
+		u.CompletedAt = &now
+		u.State = tork.BulkOperationStateCompleted
+		return nil
+	})
+	assert.NoError(t, err)
+	op2, err = ds.GetBulkOperationByID(ctx, op.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.BulkOperationStateCompleted, op2.State)
+	assert.Equal(t, 1, op2.Succeeded)
+	assert.Equal(t, 1, op2.Skipped)
+	assert.Len(t, op2.Results, 2)
+	assert.Equal(t, "job is not running", op2.Results[1].Error)
+	assert.NotNil(t, op2.CompletedAt)
+
+	_, err = ds.GetBulkOperationByID(ctx, uuid.NewUUID())
+	assert.ErrorIs(t, err, datastore.ErrBulkOperationNotFound)
+	assert.NoError(t, ds.Close())
+}
+
+func TestPostgresEncryption(t *testing.T) {
+	ctx := context.Background()
+	ds, err := NewTestDatastore()
+	assert.NoError(t, err)
+
+	// rows created before the encryption key was configured
+	j1 := &tork.Job{
+		ID:       uuid.NewUUID(),
+		Secrets:  map[string]string{"password": "secret"},
+		Webhooks: []*tork.Webhook{{URL: "http://example.com", Headers: map[string]string{"Authorization": "token"}}},
+	}
+	assert.NoError(t, ds.CreateJob(ctx, j1))
+	t1 := &tork.Task{
+		ID:       uuid.NewUUID(),
+		JobID:    j1.ID,
+		Env:      map[string]string{"PASSWORD": "secret"},
+		Registry: &tork.Registry{Username: "user", Password: "secret"},
+	}
+	assert.NoError(t, ds.CreateTask(ctx, t1))
+
+	oldKey := make([]byte, 32)
+	_, err = crand.Read(oldKey)
+	assert.NoError(t, err)
+	ds.keyring, err = secrets.NewKeyring(oldKey)
+	assert.NoError(t, err)
+
+	j2 := &tork.Job{
+		ID:      uuid.NewUUID(),
+		Secrets: map[string]string{"password": "secret"},
+	}
+	assert.NoError(t, ds.CreateJob(ctx, j2))
+
+	var raw string
+	assert.NoError(t, ds.get(&raw, `SELECT secrets::text FROM jobs where id = $1`, j2.ID))
+	assert.NotContains(t, raw, "secret\"")
+
+	// plaintext and encrypted values are both readable
+	j, err := ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"password": "secret"}, j.Secrets)
+	j, err = ds.GetJobByID(ctx, j2.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"password": "secret"}, j.Secrets)
+
+	// rotate the key
+	currentKey := make([]byte, 32)
+	_, err = crand.Read(currentKey)
+	assert.NoError(t, err)
+	ds.keyring, err = secrets.NewKeyring(currentKey, oldKey)
+	assert.NoError(t, err)
+
+	n, err := ds.Rekey(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	n, err = ds.Rekey(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	ds.keyring, err = secrets.NewKeyring(currentKey)
+	assert.NoError(t, err)
+
+	assert.NoError(t, ds.get(&raw, `SELECT env::text FROM tasks where id = $1`, t1.ID))
+	assert.NotContains(t, raw, "secret")
+	tk, err := ds.GetTaskByID(ctx, t1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"PASSWORD": "secret"}, tk.Env)
+	assert.Equal(t, "secret", tk.Registry.Password)
+
+	j, err = ds.GetJobByID(ctx, j1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "token", j.Webhooks[0].Headers["Authorization"])
+	j, err = ds.GetJobByID(ctx, j2.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"password": "secret"}, j.Secrets)
+
+	// encrypted values can't be read without the key
+	ds.keyring = nil
+	_, err = ds.GetJobByID(ctx, j2.ID)
+	assert.Error(t, err)
+
+	assert.NoError(t, ds.Close())
+}
@@ -7,50 +7,54 @@ import (
 	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"github.com/runabol/tork"
+	"github.com/runabol/tork/internal/secrets"
 )
 
 type taskRecord struct {
-	ID          string         `db:"id"`
-	JobID       string         `db:"job_id"`
-	Position    int            `db:"position"`
-	Name        string         `db:"name"`
-	Description string         `db:"description"`
-	State       string         `db:"state"`
-	CreatedAt   time.Time      `db:"created_at"`
-	ScheduledAt *time.Time     `db:"scheduled_at"`
-	StartedAt   *time.Time     `db:"started_at"`
-	CompletedAt *time.Time     `db:"completed_at"`
-	FailedAt    *time.Time     `db:"failed_at"`
-	CMD         pq.StringArray `db:"cmd"`
-	Entrypoint  pq.StringArray `db:"entrypoint"`
-	Run         string         `db:"run_script"`
-	Image       string         `db:"image"`
-	Registry    []byte         `db:"registry"`
-	Env         []byte         `db:"env"`
-	Files       []byte         `db:"files_"`
-	Queue       string         `db:"queue"`
-	Error       string         `db:"error_"`
-	Pre         []byte         `db:"pre_tasks"`
-	Post        []byte         `db:"post_tasks"`
-	Mounts      []byte         `db:"mounts"`
-	Networks    pq.StringArray `db:"networks"`
-	NodeID      string         `db:"node_id"`
-	Retry       []byte         `db:"retry"`
-	Limits      []byte         `db:"limits"`
-	Timeout     string         `db:"timeout"`
-	Var         string         `db:"var"`
-	Result      string         `db:"result"`
-	Parallel    []byte         `db:"parallel"`
-	ParentID    string         `db:"parent_id"`
-	Each        []byte         `db:"each_"`
-	SubJob      []byte         `db:"subjob"`
-	SubJobID    string         `db:"subjob_id"`
-	GPUs        string         `db:"gpus"`
-	IF          string         `db:"if_"`
-	Tags        pq.StringArray `db:"tags"`
-	Priority    int            `db:"priority"`
-	Workdir     string         `db:"workdir"`
-	Progress    float64        `db:"progress"`
+	ID           string         `db:"id"`
+	JobID        string         `db:"job_id"`
+	Position     int            `db:"position"`
+	Name         string         `db:"name"`
+	Description  string         `db:"description"`
+	State        string         `db:"state"`
+	CreatedAt    time.Time      `db:"created_at"`
+	ScheduledAt  *time.Time     `db:"scheduled_at"`
+	StartedAt    *time.Time     `db:"started_at"`
+	CompletedAt  *time.Time     `db:"completed_at"`
+	FailedAt     *time.Time     `db:"failed_at"`
+	CMD          pq.StringArray `db:"cmd"`
+	Entrypoint   pq.StringArray `db:"entrypoint"`
+	Run          string         `db:"run_script"`
+	Image        string         `db:"image"`
+	Registry     []byte         `db:"registry"`
+	Env          []byte         `db:"env"`
+	Files        []byte         `db:"files_"`
+	Queue        string         `db:"queue"`
+	Error        string         `db:"error_"`
+	Pre          []byte         `db:"pre_tasks"`
+	Post         []byte         `db:"post_tasks"`
+	Mounts       []byte         `db:"mounts"`
+	Networks     pq.StringArray `db:"networks"`
+	NodeID       string         `db:"node_id"`
+	Retry        []byte         `db:"retry"`
+	Limits       []byte         `db:"limits"`
+	Timeout      string         `db:"timeout"`
+	Var          string         `db:"var"`
+	Result       string         `db:"result"`
+	Parallel     []byte         `db:"parallel"`
+	ParentID     string         `db:"parent_id"`
+	Each         []byte         `db:"each_"`
+	SubJob       []byte         `db:"subjob"`
+	SubJobID     string         `db:"subjob_id"`
+	GPUs         string         `db:"gpus"`
+	IF           string         `db:"if_"`
+	Tags         pq.StringArray `db:"tags"`
+	Priority     int            `db:"priority"`
+	Workdir      string         `db:"workdir"`
+	Progress     float64        `db:"progress"`
+	NodeSelector []byte         `db:"node_selector"`
+	Resources    []byte         `db:"resources"`
+	Usage        []byte         `db:"usage_"`
 }
 
 type jobRecord struct {
@@ -81,6 +85,7 @@ type jobRecord struct {
 	Secrets        []byte         `db:"secrets"`
 	Progress       float64        `db:"progress"`
 	ScheduledJobID *string        `db:"scheduled_job_id"`
+	Namespace      string         `db:"namespace"`
 }
 
 type scheduledJobRecord struct {
@@ -99,6 +104,7 @@ type scheduledJobRecord struct {
 	Webhooks    []byte         `db:"webhooks"`
 	AutoDelete  []byte         `db:"auto_delete"`
 	Secrets     []byte         `db:"secrets"`
+	Namespace   string         `db:"namespace"`
 }
 
 type jobPermRecord struct {
@@ -118,17 +124,38 @@ type scheduledPermRecord struct {
 }
 
 type nodeRecord struct {
-	ID              string    `db:"id"`
-	Name            string    `db:"name"`
-	StartedAt       time.Time `db:"started_at"`
-	LastHeartbeatAt time.Time `db:"last_heartbeat_at"`
-	CPUPercent      float64   `db:"cpu_percent"`
-	Queue           string    `db:"queue"`
-	Status          string    `db:"status"`
-	Hostname        string    `db:"hostname"`
-	Port            int       `db:"port"`
-	TaskCount       int       `db:"task_count"`
-	Version         string    `db:"version_"`
+	ID              string          `db:"id"`
+	Name            string          `db:"name"`
+	StartedAt       time.Time       `db:"started_at"`
+	LastHeartbeatAt time.Time       `db:"last_heartbeat_at"`
+	CPUPercent      float64         `db:"cpu_percent"`
+	Queue           string          `db:"queue"`
+	Status          string          `db:"status"`
+	Hostname        string          `db:"hostname"`
+	Port            int             `db:"port"`
+	TaskCount       int             `db:"task_count"`
+	Version         string          `db:"version_"`
+	Labels          []byte          `db:"labels"`
+	Capacity        []byte          `db:"capacity"`
+	Allocated       []byte          `db:"allocated"`
+	Leader          bool            `db:"leader"`
+	MemoryUsed      int64           `db:"memory_used"`
+	MemoryTotal     int64           `db:"memory_total"`
+	DiskFree        int64           `db:"disk_free"`
+	LoadAverage     pq.Float64Array `db:"load_average"`
+	Runtime         []byte          `db:"runtime"`
+}
+
+type nodeSampleRecord struct {
+	ID          string    `db:"id"`
+	NodeID      string    `db:"node_id"`
+	CreatedAt   time.Time `db:"created_at"`
+	CPUPercent  float64   `db:"cpu_percent"`
+	MemoryUsed  int64     `db:"memory_used"`
+	DiskFree    int64     `db:"disk_free"`
+	LoadAverage float64   `db:"load_average"`
+	TaskCount   int       `db:"task_count"`
+	Containers  int       `db:"containers"`
 }
 
 type taskLogPartRecord struct {
@@ -140,6 +167,14 @@ type taskLogPartRecord struct {
 	TS       string    `db:"ts"`
 }
 
+// jobLogPartRecord is a log part along with the
+// columns of its task the job's log is sorted by.
+type jobLogPartRecord struct {
+	taskLogPartRecord
+	TaskPosition  int       `db:"task_position"`
+	TaskCreatedAt time.Time `db:"task_created_at"`
+}
+
 type userRecord struct {
 	ID        string    `db:"id"`
 	Name      string    `db:"name"`
@@ -149,6 +184,92 @@ type userRecord struct {
 	Disabled  bool      `db:"is_disabled"`
 }
 
+type userTokenRecord struct {
+	ID         string         `db:"id"`
+	UserID     string         `db:"user_id"`
+	Name       string         `db:"name"`
+	TokenHash  string         `db:"token_hash"`
+	Scopes     pq.StringArray `db:"scopes"`
+	CreatedAt  time.Time      `db:"created_at"`
+	ExpiresAt  *time.Time     `db:"expires_at"`
+	LastUsedAt *time.Time     `db:"last_used_at"`
+}
+
+type userIdentityRecord struct {
+	ID        string    `db:"id"`
+	UserID    string    `db:"user_id"`
+	Issuer    string    `db:"issuer"`
+	Subject   string    `db:"subject"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type policyRecord struct {
+	ID        string    `db:"id"`
+	RoleID    string    `db:"role_id"`
+	RoleSlug  string    `db:"role_slug"`
+	RoleName  string    `db:"role_name"`
+	Action    string    `db:"action"`
+	Resource  string    `db:"resource"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type auditEventRecord struct {
+	ID         string    `db:"id"`
+	Username   string    `db:"username_"`
+	Action     string    `db:"action"`
+	TargetType string    `db:"target_type"`
+	TargetID   string    `db:"target_id"`
+	RemoteIP   string    `db:"remote_ip"`
+	Status     int       `db:"status"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+type namespaceRecord struct {
+	ID            string    `db:"id"`
+	Name          string    `db:"name"`
+	Description   string    `db:"description"`
+	DefaultQueue  string    `db:"default_queue"`
+	MaxActiveJobs int       `db:"max_active_jobs"`
+	CreatedAt     time.Time `db:"created_at"`
+}
+
+type secretRecord struct {
+	ID         string    `db:"id"`
+	Name       string    `db:"name"`
+	Namespace  string    `db:"namespace"`
+	Ciphertext string    `db:"ciphertext"`
+	CreatedAt  time.Time `db:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at"`
+}
+
+type statsRecord struct {
+	Group       string  `db:"group_"`
+	Count       int     `db:"count_"`
+	Completed   int     `db:"completed"`
+	Failed      int     `db:"failed"`
+	Cancelled   int     `db:"cancelled"`
+	P50Duration float64 `db:"p50_duration"`
+	P95Duration float64 `db:"p95_duration"`
+}
+
+type bulkOperationRecord struct {
+	ID          string         `db:"id"`
+	Action      string         `db:"action"`
+	Namespace   string         `db:"namespace"`
+	Query       string         `db:"query"`
+	Tags        pq.StringArray `db:"tags"`
+	State       string         `db:"state"`
+	Total       int            `db:"total"`
+	Succeeded   int            `db:"succeeded"`
+	Skipped     int            `db:"skipped"`
+	Failed      int            `db:"failed"`
+	Error       string         `db:"error_"`
+	Results     []byte         `db:"results"`
+	CreatedBy   string         `db:"created_by"`
+	CreatedAt   time.Time      `db:"created_at"`
+	CompletedAt *time.Time     `db:"completed_at"`
+}
+
 type roleRecord struct {
 	ID        string    `db:"id"`
 	Slug      string    `db:"slug"`
@@ -156,10 +277,52 @@ type roleRecord struct {
 	CreatedAt time.Time `db:"created_at"`
 }
 
-func (r taskRecord) toTask() (*tork.Task, error) {
+// sealJSON serializes the value of a sensitive column, sealing it
+// into a JSON string envelope when an encryption key is configured.
+func (ds *PostgresDatastore) sealJSON(v any) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil || ds.keyring == nil {
+		return b, err
+	}
+	sealed, err := ds.keyring.Seal(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error encrypting value")
+	}
+	return json.Marshal(sealed)
+}
+
+// openJSON returns the plaintext JSON of a column value which may
+// have been sealed by sealJSON. Plaintext values are returned as-is.
+func openJSON(kr *secrets.Keyring, b []byte) ([]byte, error) {
+	if len(b) == 0 || b[0] != '"' {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil || !secrets.IsEnvelope(s) {
+		return b, nil
+	}
+	if kr == nil {
+		return nil, errors.New("value is encrypted but no encryption key is configured")
+	}
+	pt, err := kr.Open(s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error decrypting value")
+	}
+	return pt, nil
+}
+
+func unmarshalSealed(kr *secrets.Keyring, b []byte, v any) error {
+	pt, err := openJSON(kr, b)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(pt, v)
+}
+
+func (r taskRecord) toTask(kr *secrets.Keyring) (*tork.Task, error) {
 	var env map[string]string
 	if r.Env != nil {
-		if err := json.Unmarshal(r.Env, &env); err != nil {
+		if err := unmarshalSealed(kr, r.Env, &env); err != nil {
 			return nil, errors.Wrapf(err, "error deserializing task.env")
 		}
 	}
@@ -171,13 +334,13 @@ func (r taskRecord) toTask() (*tork.Task, error) {
 	}
 	var pre []*tork.Task
 	if r.Pre != nil {
-		if err := json.Unmarshal(r.Pre, &pre); err != nil {
+		if err := unmarshalSealed(kr, r.Pre, &pre); err != nil {
 			return nil, errors.Wrapf(err, "error deserializing task.pre")
 		}
 	}
 	var post []*tork.Task
 	if r.Post != nil {
-		if err := json.Unmarshal(r.Post, &post); err != nil {
+		if err := unmarshalSealed(kr, r.Post, &post); err != nil {
 			return nil, errors.Wrapf(err, "error deserializing task.post")
 		}
 	}
@@ -198,28 +361,28 @@ func (r taskRecord) toTask() (*tork.Task, error) {
 	var parallel *tork.ParallelTask
 	if r.Parallel != nil {
 		parallel = &tork.ParallelTask{}
-		if err := json.Unmarshal(r.Parallel, parallel); err != nil {
+		if err := unmarshalSealed(kr, r.Parallel, parallel); err != nil {
 			return nil, errors.Wrapf(err, "error deserializing task.parallel")
 		}
 	}
 	var each *tork.EachTask
 	if r.Each != nil {
 		each = &tork.EachTask{}
-		if err := json.Unmarshal(r.Each, each); err != nil {
+		if err := unmarshalSealed(kr, r.Each, each); err != nil {
 			return nil, errors.Wrapf(err, "error deserializing task.each")
 		}
 	}
 	var subjob *tork.SubJobTask
 	if r.SubJob != nil {
 		subjob = &tork.SubJobTask{}
-		if err := json.Unmarshal(r.SubJob, subjob); err != nil {
+		if err := unmarshalSealed(kr, r.SubJob, subjob); err != nil {
 			return nil, errors.Wrapf(err, "error deserializing task.subjob")
 		}
 	}
 	var registry *tork.Registry
 	if r.Registry != nil {
 		registry = &tork.Registry{}
-		if err := json.Unmarshal(r.Registry, registry); err != nil {
+		if err := unmarshalSealed(kr, r.Registry, registry); err != nil {
 			return nil, errors.Wrapf(err, "error deserializing task.registry")
 		}
 	}
@@ -229,51 +392,101 @@ func (r taskRecord) toTask() (*tork.Task, error) {
 			return nil, errors.Wrapf(err, "error deserializing task.registry")
 		}
 	}
+	var nodeSelector map[string]string
+	if r.NodeSelector != nil {
+		if err := json.Unmarshal(r.NodeSelector, &nodeSelector); err != nil {
+			return nil, errors.Wrapf(err, "error deserializing task.nodeSelector")
+		}
+	}
+	var resources *tork.TaskResources
+	if r.Resources != nil {
+		resources = &tork.TaskResources{}
+		if err := json.Unmarshal(r.Resources, resources); err != nil {
+			return nil, errors.Wrapf(err, "error deserializing task.resources")
+		}
+	}
+	var usage *tork.TaskUsage
+	if r.Usage != nil {
+		usage = &tork.TaskUsage{}
+		if err := json.Unmarshal(r.Usage, usage); err != nil {
+			return nil, errors.Wrapf(err, "error deserializing task.usage")
+		}
+	}
 	return &tork.Task{
-		ID:          r.ID,
-		JobID:       r.JobID,
-		Position:    r.Position,
-		Name:        r.Name,
-		State:       tork.TaskState(r.State),
-		CreatedAt:   &r.CreatedAt,
-		ScheduledAt: r.ScheduledAt,
-		StartedAt:   r.StartedAt,
-		CompletedAt: r.CompletedAt,
-		FailedAt:    r.FailedAt,
-		CMD:         r.CMD,
-		Entrypoint:  r.Entrypoint,
-		Run:         r.Run,
-		Image:       r.Image,
-		Registry:    registry,
-		Env:         env,
-		Files:       files,
-		Queue:       r.Queue,
-		Error:       r.Error,
-		Pre:         pre,
-		Post:        post,
-		Mounts:      mounts,
-		Networks:    r.Networks,
-		NodeID:      r.NodeID,
-		Retry:       retry,
-		Limits:      limits,
-		Timeout:     r.Timeout,
-		Var:         r.Var,
-		Result:      r.Result,
-		Parallel:    parallel,
-		ParentID:    r.ParentID,
-		Each:        each,
-		Description: r.Description,
-		SubJob:      subjob,
-		GPUs:        r.GPUs,
-		If:          r.IF,
-		Tags:        r.Tags,
-		Priority:    r.Priority,
-		Workdir:     r.Workdir,
-		Progress:    r.Progress,
+		ID:           r.ID,
+		JobID:        r.JobID,
+		Position:     r.Position,
+		Name:         r.Name,
+		State:        tork.TaskState(r.State),
+		CreatedAt:    &r.CreatedAt,
+		ScheduledAt:  r.ScheduledAt,
+		StartedAt:    r.StartedAt,
+		CompletedAt:  r.CompletedAt,
+		FailedAt:     r.FailedAt,
+		CMD:          r.CMD,
+		Entrypoint:   r.Entrypoint,
+		Run:          r.Run,
+		Image:        r.Image,
+		Registry:     registry,
+		Env:          env,
+		Files:        files,
+		Queue:        r.Queue,
+		Error:        r.Error,
+		Pre:          pre,
+		Post:         post,
+		Mounts:       mounts,
+		Networks:     r.Networks,
+		NodeID:       r.NodeID,
+		Retry:        retry,
+		Limits:       limits,
+		Timeout:      r.Timeout,
+		Var:          r.Var,
+		Result:       r.Result,
+		Parallel:     parallel,
+		ParentID:     r.ParentID,
+		Each:         each,
+		Description:  r.Description,
+		SubJob:       subjob,
+		GPUs:         r.GPUs,
+		If:           r.IF,
+		Tags:         r.Tags,
+		Priority:     r.Priority,
+		Workdir:      r.Workdir,
+		Progress:     r.Progress,
+		NodeSelector: nodeSelector,
+		Resources:    resources,
+		Usage:        usage,
 	}, nil
 }
 
-func (r nodeRecord) toNode() *tork.Node {
+func (r nodeRecord) toNode() (*tork.Node, error) {
+	var labels map[string]string
+	if r.Labels != nil {
+		if err := json.Unmarshal(r.Labels, &labels); err != nil {
+			return nil, errors.Wrapf(err, "error deserializing node.labels")
+		}
+	}
+	var capacity *tork.NodeResources
+	if r.Capacity != nil {
+		capacity = &tork.NodeResources{}
+		if err := json.Unmarshal(r.Capacity, capacity); err != nil {
+			return nil, errors.Wrapf(err, "error deserializing node.capacity")
+		}
+	}
+	var allocated *tork.NodeResources
+	if r.Allocated != nil {
+		allocated = &tork.NodeResources{}
+		if err := json.Unmarshal(r.Allocated, allocated); err != nil {
+			return nil, errors.Wrapf(err, "error deserializing node.allocated")
+		}
+	}
+	var rt *tork.NodeRuntime
+	if r.Runtime != nil {
+		rt = &tork.NodeRuntime{}
+		if err := json.Unmarshal(r.Runtime, rt); err != nil {
+			return nil, errors.Wrapf(err, "error deserializing node.runtime")
+		}
+	}
 	n := tork.Node{
 		ID:              r.ID,
 		Name:            r.Name,
@@ -286,13 +499,36 @@ func (r nodeRecord) toNode() *tork.Node {
 		Port:            r.Port,
 		TaskCount:       r.TaskCount,
 		Version:         r.Version,
+		Labels:          labels,
+		Capacity:        capacity,
+		Allocated:       allocated,
+		Leader:          r.Leader,
+		MemoryUsed:      r.MemoryUsed,
+		MemoryTotal:     r.MemoryTotal,
+		DiskFree:        r.DiskFree,
+		LoadAverage:     r.LoadAverage,
+		Runtime:         rt,
 	}
 	// if we hadn't seen an heartbeat for two or more
 	// consecutive periods we consider the node as offline
-	if n.LastHeartbeatAt.Before(time.Now().UTC().Add(-tork.HEARTBEAT_RATE*2)) && n.Status == tork.NodeStatusUP {
+	if n.LastHeartbeatAt.Before(time.Now().UTC().Add(-tork.HEARTBEAT_RATE*2)) &&
+		(n.Status == tork.NodeStatusUP || n.Status == tork.NodeStatusDraining) {
 		n.Status = tork.NodeStatusOffline
+		n.Leader = false
+	}
+	return &n, nil
+}
+
+func (r nodeSampleRecord) toNodeSample() *tork.NodeSample {
+	return &tork.NodeSample{
+		Time:        r.CreatedAt,
+		CPUPercent:  r.CPUPercent,
+		MemoryUsed:  r.MemoryUsed,
+		DiskFree:    r.DiskFree,
+		LoadAverage: r.LoadAverage,
+		TaskCount:   r.TaskCount,
+		Containers:  r.Containers,
 	}
-	return &n
 }
 
 func (r taskLogPartRecord) toTaskLogPart() *tork.TaskLogPart {
@@ -305,9 +541,9 @@ func (r taskLogPartRecord) toTaskLogPart() *tork.TaskLogPart {
 	}
 }
 
-func (r jobRecord) toJob(tasks, execution []*tork.Task, createdBy *tork.User, perms []*tork.Permission) (*tork.Job, error) {
+func (r jobRecord) toJob(kr *secrets.Keyring, tasks, execution []*tork.Task, createdBy *tork.User, perms []*tork.Permission) (*tork.Job, error) {
 	var c tork.JobContext
-	if err := json.Unmarshal(r.Context, &c); err != nil {
+	if err := unmarshalSealed(kr, r.Context, &c); err != nil {
 		return nil, errors.Wrapf(err, "error deserializing job.context")
 	}
 	var inputs map[string]string
@@ -329,12 +565,12 @@ func (r jobRecord) toJob(tasks, execution []*tork.Task, createdBy *tork.User, pe
 		}
 	}
 	var webhooks []*tork.Webhook
-	if err := json.Unmarshal(r.Webhooks, &webhooks); err != nil {
+	if err := unmarshalSealed(kr, r.Webhooks, &webhooks); err != nil {
 		return nil, errors.Wrapf(err, "error deserializing job.webhook")
 	}
 	var secrets map[string]string
 	if r.Secrets != nil {
-		if err := json.Unmarshal(r.Secrets, &secrets); err != nil {
+		if err := unmarshalSealed(kr, r.Secrets, &secrets); err != nil {
 			return nil, errors.Wrapf(err, "error deserializing job.secrets")
 		}
 	}
@@ -347,6 +583,7 @@ func (r jobRecord) toJob(tasks, execution []*tork.Task, createdBy *tork.User, pe
 	return &tork.Job{
 		ID:          r.ID,
 		Name:        r.Name,
+		Namespace:   r.Namespace,
 		Tags:        r.Tags,
 		State:       tork.JobState(r.State),
 		CreatedAt:   r.CreatedAt,
@@ -373,10 +610,11 @@ func (r jobRecord) toJob(tasks, execution []*tork.Task, createdBy *tork.User, pe
 		Secrets:     secrets,
 		Progress:    r.Progress,
 		Schedule:    schedule,
+		Usage:       tork.TotalUsage(execution),
 	}, nil
 }
 
-func (r scheduledJobRecord) toScheduledJob(tasks []*tork.Task, createdBy *tork.User, perms []*tork.Permission) (*tork.ScheduledJob, error) {
+func (r scheduledJobRecord) toScheduledJob(kr *secrets.Keyring, tasks []*tork.Task, createdBy *tork.User, perms []*tork.Permission) (*tork.ScheduledJob, error) {
 	var inputs map[string]string
 	if err := json.Unmarshal(r.Inputs, &inputs); err != nil {
 		return nil, errors.Wrapf(err, "error deserializing job.inputs")
@@ -396,12 +634,12 @@ func (r scheduledJobRecord) toScheduledJob(tasks []*tork.Task, createdBy *tork.U
 		}
 	}
 	var webhooks []*tork.Webhook
-	if err := json.Unmarshal(r.Webhooks, &webhooks); err != nil {
+	if err := unmarshalSealed(kr, r.Webhooks, &webhooks); err != nil {
 		return nil, errors.Wrapf(err, "error deserializing job.webhook")
 	}
 	var secrets map[string]string
 	if r.Secrets != nil {
-		if err := json.Unmarshal(r.Secrets, &secrets); err != nil {
+		if err := unmarshalSealed(kr, r.Secrets, &secrets); err != nil {
 			return nil, errors.Wrapf(err, "error deserializing job.secrets")
 		}
 	}
@@ -409,6 +647,7 @@ func (r scheduledJobRecord) toScheduledJob(tasks []*tork.Task, createdBy *tork.U
 		ID:          r.ID,
 		Cron:        r.Cron,
 		Name:        r.Name,
+		Namespace:   r.Namespace,
 		Tags:        r.Tags,
 		State:       tork.ScheduledJobState(r.State),
 		CreatedAt:   r.CreatedAt,
@@ -437,6 +676,56 @@ func (r userRecord) toUser() *tork.User {
 	return &n
 }
 
+func (r userTokenRecord) toUserToken() *tork.UserToken {
+	return &tork.UserToken{
+		ID:         r.ID,
+		UserID:     r.UserID,
+		Name:       r.Name,
+		TokenHash:  r.TokenHash,
+		Scopes:     r.Scopes,
+		CreatedAt:  &r.CreatedAt,
+		ExpiresAt:  r.ExpiresAt,
+		LastUsedAt: r.LastUsedAt,
+	}
+}
+
+func (r userIdentityRecord) toUserIdentity() *tork.UserIdentity {
+	return &tork.UserIdentity{
+		ID:        r.ID,
+		UserID:    r.UserID,
+		Issuer:    r.Issuer,
+		Subject:   r.Subject,
+		CreatedAt: &r.CreatedAt,
+	}
+}
+
+func (r policyRecord) toPolicy() *tork.Policy {
+	return &tork.Policy{
+		ID: r.ID,
+		Role: &tork.Role{
+			ID:   r.RoleID,
+			Slug: r.RoleSlug,
+			Name: r.RoleName,
+		},
+		Action:    r.Action,
+		Resource:  r.Resource,
+		CreatedAt: &r.CreatedAt,
+	}
+}
+
+func (r auditEventRecord) toAuditEvent() *tork.AuditEvent {
+	return &tork.AuditEvent{
+		ID:         r.ID,
+		Username:   r.Username,
+		Action:     r.Action,
+		TargetType: r.TargetType,
+		TargetID:   r.TargetID,
+		RemoteIP:   r.RemoteIP,
+		Status:     r.Status,
+		CreatedAt:  &r.CreatedAt,
+	}
+}
+
 func (r roleRecord) toRole() *tork.Role {
 	n := tork.Role{
 		ID:        r.ID,
@@ -446,3 +735,68 @@ func (r roleRecord) toRole() *tork.Role {
 	}
 	return &n
 }
+
+func (r namespaceRecord) toNamespace() *tork.Namespace {
+	n := tork.Namespace{
+		ID:           r.ID,
+		Name:         r.Name,
+		Description:  r.Description,
+		DefaultQueue: r.DefaultQueue,
+		CreatedAt:    &r.CreatedAt,
+	}
+	if r.MaxActiveJobs > 0 {
+		n.Quota = &tork.NamespaceQuota{MaxActiveJobs: r.MaxActiveJobs}
+	}
+	return &n
+}
+
+func (r bulkOperationRecord) toBulkOperation() (*tork.BulkOperation, error) {
+	results := make([]*tork.BulkResult, 0)
+	if err := json.Unmarshal(r.Results, &results); err != nil {
+		return nil, errors.Wrapf(err, "error deserializing bulk operation results")
+	}
+	return &tork.BulkOperation{
+		ID:          r.ID,
+		Action:      tork.BulkAction(r.Action),
+		Namespace:   r.Namespace,
+		Query:       r.Query,
+		Tags:        r.Tags,
+		State:       tork.BulkOperationState(r.State),
+		Total:       r.Total,
+		Succeeded:   r.Succeeded,
+		Skipped:     r.Skipped,
+		Failed:      r.Failed,
+		Error:       r.Error,
+		Results:     results,
+		CreatedBy:   r.CreatedBy,
+		CreatedAt:   &r.CreatedAt,
+		CompletedAt: r.CompletedAt,
+	}, nil
+}
+
+func (r secretRecord) toSecret() *tork.Secret {
+	return &tork.Secret{
+		ID:         r.ID,
+		Name:       r.Name,
+		Namespace:  r.Namespace,
+		Ciphertext: r.Ciphertext,
+		CreatedAt:  &r.CreatedAt,
+		UpdatedAt:  &r.UpdatedAt,
+	}
+}
+
+func (r statsRecord) toStats() *tork.Stats {
+	s := &tork.Stats{
+		Group:       r.Group,
+		Count:       r.Count,
+		Completed:   r.Completed,
+		Failed:      r.Failed,
+		Cancelled:   r.Cancelled,
+		P50Duration: r.P50Duration,
+		P95Duration: r.P95Duration,
+	}
+	if r.Count > 0 {
+		s.SuccessRate = float64(r.Completed) / float64(r.Count)
+	}
+	return s
+}
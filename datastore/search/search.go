@@ -0,0 +1,396 @@
+// Package search parses the query language of the job search, e.g.:
+//
+//	state:FAILED created:>2026-01-01 (user:alice OR user:bob) NOT tag:nightly sort:-created
+//
+// Terms are combined with AND unless joined by OR, and may be negated
+// with NOT or a leading '-'. Terms without a field are matched against
+// the full text of jobs. Values may be quoted and, for names and
+// inputs, may contain '*' wildcards.
+package search
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+type Op string
+
+const (
+	OpEq  Op = ":"
+	OpGt  Op = ">"
+	OpGte Op = ">="
+	OpLt  Op = "<"
+	OpLte Op = "<="
+)
+
+const (
+	FieldState     = "state"
+	FieldCreated   = "created"
+	FieldStarted   = "started"
+	FieldCompleted = "completed"
+	FieldUser      = "user"
+	FieldName      = "name"
+	FieldTag       = "tag"
+	FieldParent    = "parent"
+	// FieldInput prefixes the name of an input of the job,
+	// e.g. input.region
+	FieldInput = "input."
+)
+
+const (
+	SortCreated = "created"
+	SortName    = "name"
+	SortState   = "state"
+)
+
+var DefaultSort = Sort{Field: SortCreated, Desc: true}
+
+// Expr is a node of the AST of a query: one of
+// *And, *Or, *Not, *Text or *Filter.
+type Expr interface {
+	isExpr()
+}
+
+type And struct {
+	Exprs []Expr
+}
+
+type Or struct {
+	Exprs []Expr
+}
+
+type Not struct {
+	Expr Expr
+}
+
+// Text matches the full text of jobs.
+type Text struct {
+	Value string
+}
+
+// Filter matches a field of jobs.
+type Filter struct {
+	Field string
+	Op    Op
+	Value string
+}
+
+func (*And) isExpr()    {}
+func (*Or) isExpr()     {}
+func (*Not) isExpr()    {}
+func (*Text) isExpr()   {}
+func (*Filter) isExpr() {}
+
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+type Query struct {
+	// Expr is nil when the query matches all jobs.
+	Expr Expr
+	Sort Sort
+}
+
+// Wildcard reports whether the value of the filter contains '*'
+// wildcards, which match any sequence of characters.
+func (f *Filter) Wildcard() bool {
+	return strings.Contains(f.Value, "*")
+}
+
+// Time parses the value of a filter of a timestamp field, reporting
+// whether the value is a date, which stands for the whole day.
+func (f *Filter) Time() (time.Time, bool, error) {
+	if t, err := time.Parse(time.DateOnly, f.Value); err == nil {
+		return t, true, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if t, err := time.Parse(layout, f.Value); err == nil {
+			return t.UTC(), false, nil
+		}
+	}
+	return time.Time{}, false, errors.Errorf("invalid %s time: %s", f.Field, f.Value)
+}
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind   tokenKind
+	field  string
+	op     Op
+	text   string
+	quoted bool
+}
+
+var fieldPattern = regexp.MustCompile(`^[a-z][a-zA-Z0-9_.-]*$`)
+
+func lex(q string) ([]token, error) {
+	toks := make([]token, 0)
+	rs := []rune(q)
+	i := 0
+	for i < len(rs) {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			toks = append(toks, token{kind: tokLParen})
+			i++
+		case r == ')':
+			toks = append(toks, token{kind: tokRParen})
+			i++
+		case r == '-' && i+1 < len(rs) && !unicode.IsSpace(rs[i+1]) && rs[i+1] != '(' && rs[i+1] != ')':
+			toks = append(toks, token{kind: tokNot})
+			i++
+		default:
+			t := token{kind: tokWord}
+			var b strings.Builder
+			for i < len(rs) && !unicode.IsSpace(rs[i]) && rs[i] != '(' && rs[i] != ')' {
+				switch {
+				case rs[i] == '"':
+					i++
+					closed := false
+					for i < len(rs) {
+						if rs[i] == '\\' && i+1 < len(rs) {
+							b.WriteRune(rs[i+1])
+							i = i + 2
+							continue
+						}
+						if rs[i] == '"' {
+							closed = true
+							i++
+							break
+						}
+						b.WriteRune(rs[i])
+						i++
+					}
+					if !closed {
+						return nil, errors.New("unterminated quoted string")
+					}
+					t.quoted = true
+				case rs[i] == ':' && t.field == "" && !t.quoted && fieldPattern.MatchString(b.String()):
+					t.field = b.String()
+					b.Reset()
+					i++
+					t.op = OpEq
+					for _, op := range []Op{OpGte, OpLte, OpGt, OpLt} {
+						if strings.HasPrefix(string(rs[i:]), string(op)) {
+							t.op = op
+							i = i + len(op)
+							break
+						}
+					}
+				default:
+					b.WriteRune(rs[i])
+					i++
+				}
+			}
+			t.text = b.String()
+			toks = append(toks, t)
+		}
+	}
+	return toks, nil
+}
+
+type parser struct {
+	toks []token
+	pos  int
+	sort *Sort
+}
+
+// Parse parses a search query. An empty query matches all jobs.
+func Parse(q string) (*Query, error) {
+	toks, err := lex(q)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, errors.New("unexpected ')'")
+	}
+	query := &Query{Expr: e, Sort: DefaultSort}
+	if p.sort != nil {
+		query.Sort = *p.sort
+	}
+	return query, nil
+}
+
+func (p *parser) peek() *token {
+	if p.pos >= len(p.toks) {
+		return nil
+	}
+	return &p.toks[p.pos]
+}
+
+func isKeyword(t *token, kw string) bool {
+	return t != nil && t.kind == tokWord && t.field == "" && !t.quoted && t.text == kw
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	exprs := make([]Expr, 0)
+	for {
+		e, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if !isKeyword(p.peek(), "OR") {
+			if e != nil {
+				exprs = append(exprs, e)
+			} else if len(exprs) > 0 {
+				return nil, errors.New("expected an expression after OR")
+			}
+			break
+		}
+		if e == nil {
+			return nil, errors.New("expected an expression before OR")
+		}
+		exprs = append(exprs, e)
+		p.pos++
+	}
+	switch len(exprs) {
+	case 0:
+		return nil, nil
+	case 1:
+		return exprs[0], nil
+	default:
+		return &Or{Exprs: exprs}, nil
+	}
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	exprs := make([]Expr, 0)
+	for {
+		t := p.peek()
+		if t == nil || t.kind == tokRParen || isKeyword(t, "OR") {
+			break
+		}
+		if isKeyword(t, "AND") {
+			if len(exprs) == 0 {
+				return nil, errors.New("expected an expression before AND")
+			}
+			p.pos++
+			if n := p.peek(); n == nil || n.kind == tokRParen || isKeyword(n, "OR") || isKeyword(n, "AND") {
+				return nil, errors.New("expected an expression after AND")
+			}
+			continue
+		}
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if e != nil {
+			exprs = append(exprs, e)
+		}
+	}
+	switch len(exprs) {
+	case 0:
+		return nil, nil
+	case 1:
+		return exprs[0], nil
+	default:
+		return &And{Exprs: exprs}, nil
+	}
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	t := p.peek()
+	p.pos++
+	switch {
+	case t.kind == tokNot || isKeyword(t, "NOT"):
+		if n := p.peek(); n == nil || n.kind == tokRParen || isKeyword(n, "OR") || isKeyword(n, "AND") {
+			return nil, errors.New("expected an expression after NOT")
+		}
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			return nil, errors.New("sort can not be negated")
+		}
+		return &Not{Expr: e}, nil
+	case t.kind == tokLParen:
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if n := p.peek(); n == nil || n.kind != tokRParen {
+			return nil, errors.New("missing ')'")
+		}
+		p.pos++
+		if e == nil {
+			return nil, errors.New("empty group")
+		}
+		return e, nil
+	default:
+		return p.parseTerm(t)
+	}
+}
+
+func (p *parser) parseTerm(t *token) (Expr, error) {
+	if t.field == "" {
+		return &Text{Value: t.text}, nil
+	}
+	if t.text == "" {
+		return nil, errors.Errorf("missing value for %s", t.field)
+	}
+	f := &Filter{Field: t.field, Op: t.op, Value: t.text}
+	switch {
+	case t.field == "sort":
+		if p.sort != nil {
+			return nil, errors.New("only one sort is allowed")
+		}
+		s := Sort{Field: strings.TrimPrefix(t.text, "-"), Desc: strings.HasPrefix(t.text, "-")}
+		if s.Field != SortCreated && s.Field != SortName && s.Field != SortState {
+			return nil, errors.Errorf("can't sort by %s", s.Field)
+		}
+		p.sort = &s
+		return nil, nil
+	case t.field == FieldCreated || t.field == FieldStarted || t.field == FieldCompleted:
+		if _, _, err := f.Time(); err != nil {
+			return nil, err
+		}
+		return f, nil
+	case t.op != OpEq:
+		return nil, errors.Errorf("operator %s is not supported for %s", t.op, t.field)
+	case t.field == FieldState:
+		f.Value = strings.ToUpper(f.Value)
+		return f, nil
+	case t.field == FieldUser || t.field == FieldName || t.field == FieldTag || t.field == FieldParent:
+		return f, nil
+	case t.field == "tags":
+		// tags:a,b matches jobs tagged with any of the tags
+		or := &Or{}
+		for _, tag := range strings.Split(t.text, ",") {
+			if tag != "" {
+				or.Exprs = append(or.Exprs, &Filter{Field: FieldTag, Op: OpEq, Value: tag})
+			}
+		}
+		switch len(or.Exprs) {
+		case 0:
+			return nil, errors.New("missing value for tags")
+		case 1:
+			return or.Exprs[0], nil
+		default:
+			return or, nil
+		}
+	case strings.HasPrefix(t.field, FieldInput) && len(t.field) > len(FieldInput):
+		return f, nil
+	default:
+		return nil, errors.Errorf("unknown search field: %s", t.field)
+	}
+}
@@ -0,0 +1,125 @@
+package search_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/runabol/tork/datastore/search"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEmpty(t *testing.T) {
+	q, err := search.Parse("  ")
+	assert.NoError(t, err)
+	assert.Nil(t, q.Expr)
+	assert.Equal(t, search.DefaultSort, q.Sort)
+}
+
+func TestParseText(t *testing.T) {
+	q, err := search.Parse(`hello "big world"`)
+	assert.NoError(t, err)
+	assert.Equal(t, &search.And{Exprs: []search.Expr{
+		&search.Text{Value: "hello"},
+		&search.Text{Value: "big world"},
+	}}, q.Expr)
+}
+
+func TestParseFilters(t *testing.T) {
+	q, err := search.Parse(`state:failed created:>2026-01-01 user:alice name:"etl *" input.region:eu parent:1234 tag:a`)
+	assert.NoError(t, err)
+	assert.Equal(t, &search.And{Exprs: []search.Expr{
+		&search.Filter{Field: search.FieldState, Op: search.OpEq, Value: "FAILED"},
+		&search.Filter{Field: search.FieldCreated, Op: search.OpGt, Value: "2026-01-01"},
+		&search.Filter{Field: search.FieldUser, Op: search.OpEq, Value: "alice"},
+		&search.Filter{Field: search.FieldName, Op: search.OpEq, Value: "etl *"},
+		&search.Filter{Field: "input.region", Op: search.OpEq, Value: "eu"},
+		&search.Filter{Field: search.FieldParent, Op: search.OpEq, Value: "1234"},
+		&search.Filter{Field: search.FieldTag, Op: search.OpEq, Value: "a"},
+	}}, q.Expr)
+}
+
+func TestParseBoolean(t *testing.T) {
+	q, err := search.Parse(`state:FAILED AND (user:alice OR user:bob) NOT tag:nightly -tag:test`)
+	assert.NoError(t, err)
+	assert.Equal(t, &search.And{Exprs: []search.Expr{
+		&search.Filter{Field: search.FieldState, Op: search.OpEq, Value: "FAILED"},
+		&search.Or{Exprs: []search.Expr{
+			&search.Filter{Field: search.FieldUser, Op: search.OpEq, Value: "alice"},
+			&search.Filter{Field: search.FieldUser, Op: search.OpEq, Value: "bob"},
+		}},
+		&search.Not{Expr: &search.Filter{Field: search.FieldTag, Op: search.OpEq, Value: "nightly"}},
+		&search.Not{Expr: &search.Filter{Field: search.FieldTag, Op: search.OpEq, Value: "test"}},
+	}}, q.Expr)
+
+	// AND binds tighter than OR
+	q, err = search.Parse(`state:FAILED user:alice OR state:RUNNING`)
+	assert.NoError(t, err)
+	assert.Equal(t, &search.Or{Exprs: []search.Expr{
+		&search.And{Exprs: []search.Expr{
+			&search.Filter{Field: search.FieldState, Op: search.OpEq, Value: "FAILED"},
+			&search.Filter{Field: search.FieldUser, Op: search.OpEq, Value: "alice"},
+		}},
+		&search.Filter{Field: search.FieldState, Op: search.OpEq, Value: "RUNNING"},
+	}}, q.Expr)
+}
+
+func TestParseTags(t *testing.T) {
+	q, err := search.Parse(`tags:a,b`)
+	assert.NoError(t, err)
+	assert.Equal(t, &search.Or{Exprs: []search.Expr{
+		&search.Filter{Field: search.FieldTag, Op: search.OpEq, Value: "a"},
+		&search.Filter{Field: search.FieldTag, Op: search.OpEq, Value: "b"},
+	}}, q.Expr)
+}
+
+func TestParseSort(t *testing.T) {
+	q, err := search.Parse(`state:FAILED sort:name`)
+	assert.NoError(t, err)
+	assert.Equal(t, search.Sort{Field: search.SortName}, q.Sort)
+	assert.Equal(t, &search.Filter{Field: search.FieldState, Op: search.OpEq, Value: "FAILED"}, q.Expr)
+
+	q, err = search.Parse(`sort:-state`)
+	assert.NoError(t, err)
+	assert.Nil(t, q.Expr)
+	assert.Equal(t, search.Sort{Field: search.SortState, Desc: true}, q.Sort)
+
+	_, err = search.Parse(`sort:inputs`)
+	assert.Error(t, err)
+	_, err = search.Parse(`sort:name sort:state`)
+	assert.Error(t, err)
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, q := range []string{
+		`state:`,
+		`bogus:value`,
+		`user:>alice`,
+		`created:yesterday`,
+		`(state:FAILED`,
+		`state:FAILED)`,
+		`()`,
+		`OR state:FAILED`,
+		`state:FAILED OR`,
+		`state:FAILED AND`,
+		`NOT`,
+		`name:"etl`,
+		`tags:,`,
+	} {
+		_, err := search.Parse(q)
+		assert.Error(t, err, q)
+	}
+}
+
+func TestFilterTime(t *testing.T) {
+	f := &search.Filter{Field: search.FieldCreated, Value: "2026-01-02"}
+	tm, day, err := f.Time()
+	assert.NoError(t, err)
+	assert.True(t, day)
+	assert.Equal(t, time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), tm)
+
+	f = &search.Filter{Field: search.FieldCreated, Value: "2026-01-02T10:00:00+02:00"}
+	tm, day, err = f.Time()
+	assert.NoError(t, err)
+	assert.False(t, day)
+	assert.Equal(t, time.Date(2026, 1, 2, 8, 0, 0, 0, time.UTC), tm)
+}
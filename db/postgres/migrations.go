@@ -0,0 +1,274 @@
+package postgres
+
+// Migration upgrades the schema of an existing database
+// by one version. Scripts must be safe to re-run.
+type Migration struct {
+	Version     int
+	Description string
+	Script      string
+}
+
+// MIGRATIONS lists the schema changes made since the initial
+// release of SCHEMA, ordered by version. A freshly created
+// database already includes all of them. Every change to SCHEMA
+// comes with a migration of its own, and migrations are never
+// changed once released.
+var MIGRATIONS = []Migration{
+	{
+		Version:     1,
+		Description: "node placement",
+		Script: `
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS labels jsonb;
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS capacity jsonb;
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS allocated jsonb;
+
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS node_selector jsonb;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS resources jsonb;
+`,
+	},
+	{
+		Version:     2,
+		Description: "coordinator leader",
+		Script: `
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS leader boolean not null default false;
+`,
+	},
+	{
+		Version:     3,
+		Description: "user tokens",
+		Script: `
+CREATE TABLE IF NOT EXISTS users_tokens (
+    id           varchar(32)  not null primary key,
+    user_id      varchar(32)  not null references users(id),
+    name         varchar(64)  not null,
+    token_hash   varchar(64)  not null unique,
+    scopes       text[]       not null default '{}',
+    created_at   timestamp    not null,
+    expires_at   timestamp,
+    last_used_at timestamp
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_tokens_user_id ON users_tokens (user_id);
+`,
+	},
+	{
+		Version:     4,
+		Description: "role policies",
+		Script: `
+CREATE TABLE IF NOT EXISTS roles_policies (
+    id         varchar(32)  not null primary key,
+    role_id    varchar(32)  not null references roles(id),
+    action     varchar(64)  not null,
+    resource   varchar(256) not null default '*',
+    created_at timestamp    not null
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_roles_policies_uniq ON roles_policies (role_id,action,resource);
+
+insert into roles_policies (id,role_id,action,resource,created_at) (
+  SELECT REPLACE(gen_random_uuid()::text, '-', ''),r.id,a.action,'*',current_timestamp
+  FROM roles r, (VALUES ('job:submit'),('job:cancel'),('job:restart'),('job:logs'),('scheduled-job:manage'),('queue:use'),('queue:manage'),('node:manage')) AS a(action)
+  WHERE r.slug = 'public'
+) ON CONFLICT DO NOTHING;
+`,
+	},
+	{
+		Version:     5,
+		Description: "audit events",
+		Script: `
+CREATE TABLE IF NOT EXISTS audit_events (
+    id          varchar(32)  not null primary key,
+    username_   varchar(64)  not null,
+    action      varchar(256) not null,
+    target_type varchar(32)  not null,
+    target_id   varchar(64)  not null,
+    remote_ip   varchar(64)  not null,
+    status      int          not null,
+    created_at  timestamp    not null
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target_id ON audit_events (target_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_username ON audit_events (username_);
+`,
+	},
+	{
+		Version:     6,
+		Description: "namespaces",
+		Script: `
+CREATE TABLE IF NOT EXISTS namespaces (
+    id              varchar(32)  not null primary key,
+    name            varchar(64)  not null unique,
+    description     text         not null default '',
+    default_queue   varchar(64)  not null default '',
+    max_active_jobs int          not null default 0,
+    created_at      timestamp    not null
+);
+
+insert into namespaces (id,name,description,created_at) (SELECT REPLACE(gen_random_uuid()::text, '-', ''),'default','The default namespace',current_timestamp) ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS namespaces_members (
+    id           varchar(32) not null primary key,
+    namespace_id varchar(32) not null references namespaces(id),
+    user_id      varchar(32)          references users(id),
+    role_id      varchar(32)          references roles(id),
+    created_at   timestamp   not null
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_namespaces_members_user ON namespaces_members (namespace_id,user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_namespaces_members_role ON namespaces_members (namespace_id,role_id);
+
+ALTER TABLE scheduled_jobs ADD COLUMN IF NOT EXISTS namespace varchar(64) not null default 'default';
+CREATE INDEX IF NOT EXISTS idx_scheduled_jobs_namespace ON scheduled_jobs (namespace);
+
+ALTER TABLE jobs ADD COLUMN IF NOT EXISTS namespace varchar(64) not null default 'default';
+CREATE INDEX IF NOT EXISTS idx_jobs_namespace ON jobs (namespace,state);
+`,
+	},
+	{
+		Version:     7,
+		Description: "secrets",
+		Script: `
+CREATE TABLE IF NOT EXISTS secrets (
+    id          varchar(32)  not null primary key,
+    name        varchar(64)  not null,
+    namespace   varchar(64)  not null default 'default',
+    ciphertext  text         not null,
+    created_at  timestamp    not null,
+    updated_at  timestamp    not null
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_secrets_namespace_name ON secrets (namespace,name);
+`,
+	},
+	{
+		Version:     8,
+		Description: "job search indexes",
+		Script: `
+CREATE INDEX IF NOT EXISTS idx_jobs_created_at_id ON jobs (created_at,id);
+CREATE INDEX IF NOT EXISTS idx_jobs_parent_id ON jobs (parent_id);
+`,
+	},
+	{
+		Version:     9,
+		Description: "pagination indexes",
+		Script: `
+CREATE INDEX IF NOT EXISTS idx_scheduled_jobs_created_at_id ON scheduled_jobs (created_at,id);
+CREATE INDEX IF NOT EXISTS idx_tasks_job_id_position ON tasks (job_id,position,created_at,id);
+CREATE INDEX IF NOT EXISTS idx_tasks_log_parts_task_id_number ON tasks_log_parts (task_id,number_,id);
+`,
+	},
+	{
+		Version:     10,
+		Description: "bulk operations",
+		Script: `
+CREATE TABLE IF NOT EXISTS bulk_operations (
+    id           varchar(32)  not null primary key,
+    action       varchar(16)  not null,
+    namespace    varchar(64)  not null default 'default',
+    query        text,
+    tags         text[]       not null default '{}',
+    state        varchar(10)  not null,
+    total        int          not null default 0,
+    succeeded    int          not null default 0,
+    skipped      int          not null default 0,
+    failed       int          not null default 0,
+    error_       text,
+    results      jsonb        not null default '[]',
+    created_by   varchar(64),
+    created_at   timestamp    not null,
+    completed_at timestamp
+);
+
+CREATE INDEX IF NOT EXISTS idx_bulk_operations_created_at ON bulk_operations (created_at);
+`,
+	},
+	{
+		Version:     11,
+		Description: "stats indexes",
+		Script: `
+CREATE INDEX IF NOT EXISTS idx_jobs_created_at_state ON jobs (created_at,state);
+CREATE INDEX IF NOT EXISTS idx_tasks_created_at_state ON tasks (created_at,state);
+`,
+	},
+	{
+		Version:     12,
+		Description: "node telemetry",
+		Script: `
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS memory_used bigint not null default 0;
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS memory_total bigint not null default 0;
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS disk_free bigint not null default 0;
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS load_average float[];
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS runtime jsonb;
+
+CREATE TABLE IF NOT EXISTS nodes_samples (
+    id           varchar(32) not null primary key,
+    node_id      varchar(32) not null,
+    created_at   timestamp   not null,
+    cpu_percent  float       not null,
+    memory_used  bigint      not null,
+    disk_free    bigint      not null,
+    load_average float       not null,
+    task_count   int         not null,
+    containers   int         not null
+);
+
+CREATE INDEX IF NOT EXISTS idx_nodes_samples_node_id_created_at ON nodes_samples (node_id,created_at);
+CREATE INDEX IF NOT EXISTS idx_nodes_samples_created_at ON nodes_samples (created_at);
+`,
+	},
+	{
+		Version:     13,
+		Description: "task usage",
+		Script: `
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS usage_ jsonb;
+`,
+	},
+	{
+		Version:     14,
+		Description: "admin role",
+		Script: `
+insert into roles (id,name,slug,created_at) (SELECT REPLACE(gen_random_uuid()::text, '-', ''),'Admin','admin',current_timestamp) ON CONFLICT DO NOTHING;
+`,
+	},
+	{
+		Version:     15,
+		Description: "user identities",
+		Script: `
+CREATE TABLE IF NOT EXISTS users_identities (
+    id         varchar(32)  not null primary key,
+    user_id    varchar(32)  not null references users(id),
+    issuer     varchar(256) not null,
+    subject    varchar(256) not null,
+    created_at timestamp    not null
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_identities_uniq ON users_identities (issuer,subject);
+CREATE INDEX IF NOT EXISTS idx_users_identities_user_id ON users_identities (user_id);
+`,
+	},
+	{
+		Version:     16,
+		Description: "public role policies",
+		Script: `
+delete from roles_policies where action in ('queue:manage','node:manage') and role_id = (SELECT id FROM roles WHERE slug = 'public');
+
+insert into roles_policies (id,role_id,action,resource,created_at) (
+  SELECT REPLACE(gen_random_uuid()::text, '-', ''),r.id,'stats:read','*',current_timestamp
+  FROM roles r
+  WHERE r.slug = 'public'
+) ON CONFLICT DO NOTHING;
+`,
+	},
+	{
+		Version:     17,
+		Description: "public role read policies",
+		Script: `
+insert into roles_policies (id,role_id,action,resource,created_at) (
+  SELECT REPLACE(gen_random_uuid()::text, '-', ''),r.id,a.action,'*',current_timestamp
+  FROM roles r, (VALUES ('queue:read'),('node:read')) AS a(action)
+  WHERE r.slug = 'public'
+) ON CONFLICT DO NOTHING;
+`,
+	},
+}
@@ -12,11 +12,35 @@ CREATE TABLE nodes (
     hostname           varchar(128) not null,
     port               int          not null,
     task_count         int          not null,
-    version_           varchar(32)  not null
+    version_           varchar(32)  not null,
+    labels             jsonb,
+    capacity           jsonb,
+    allocated          jsonb,
+    leader             boolean      not null default false,
+    memory_used        bigint       not null default 0,
+    memory_total       bigint       not null default 0,
+    disk_free          bigint       not null default 0,
+    load_average       float[],
+    runtime            jsonb
 );
 
 CREATE INDEX idx_nodes_heartbeat ON nodes (last_heartbeat_at);
 
+CREATE TABLE nodes_samples (
+    id           varchar(32) not null primary key,
+    node_id      varchar(32) not null,
+    created_at   timestamp   not null,
+    cpu_percent  float       not null,
+    memory_used  bigint      not null,
+    disk_free    bigint      not null,
+    load_average float       not null,
+    task_count   int         not null,
+    containers   int         not null
+);
+
+CREATE INDEX idx_nodes_samples_node_id_created_at ON nodes_samples (node_id,created_at);
+CREATE INDEX idx_nodes_samples_created_at ON nodes_samples (created_at);
+
 CREATE TABLE users (
     id          varchar(32)  not null primary key,
     name        varchar(64)  not null,
@@ -38,6 +62,7 @@ CREATE TABLE roles (
 CREATE UNIQUE INDEX idx_roles_slug ON roles (slug);
 
 insert into roles (id,name,slug,created_at) (SELECT REPLACE(gen_random_uuid()::text, '-', ''),'Public','public',current_timestamp);
+insert into roles (id,name,slug,created_at) (SELECT REPLACE(gen_random_uuid()::text, '-', ''),'Admin','admin',current_timestamp);
 
 CREATE TABLE users_roles (
     id         varchar(32) not null primary key,
@@ -48,6 +73,114 @@ CREATE TABLE users_roles (
 
 CREATE UNIQUE INDEX idx_users_roles_uniq ON users_roles (user_id,role_id);
 
+CREATE TABLE roles_policies (
+    id         varchar(32)  not null primary key,
+    role_id    varchar(32)  not null references roles(id),
+    action     varchar(64)  not null,
+    resource   varchar(256) not null default '*',
+    created_at timestamp    not null
+);
+
+CREATE UNIQUE INDEX idx_roles_policies_uniq ON roles_policies (role_id,action,resource);
+
+insert into roles_policies (id,role_id,action,resource,created_at) (
+  SELECT REPLACE(gen_random_uuid()::text, '-', ''),r.id,a.action,'*',current_timestamp
+  FROM roles r, (VALUES ('job:submit'),('job:cancel'),('job:restart'),('job:logs'),('scheduled-job:manage'),('queue:use'),('queue:read'),('node:read'),('stats:read')) AS a(action)
+  WHERE r.slug = 'public'
+);
+
+CREATE TABLE audit_events (
+    id          varchar(32)  not null primary key,
+    username_   varchar(64)  not null,
+    action      varchar(256) not null,
+    target_type varchar(32)  not null,
+    target_id   varchar(64)  not null,
+    remote_ip   varchar(64)  not null,
+    status      int          not null,
+    created_at  timestamp    not null
+);
+
+CREATE INDEX idx_audit_events_created_at ON audit_events (created_at);
+CREATE INDEX idx_audit_events_target_id ON audit_events (target_id);
+CREATE INDEX idx_audit_events_username ON audit_events (username_);
+
+CREATE TABLE users_tokens (
+    id           varchar(32)  not null primary key,
+    user_id      varchar(32)  not null references users(id),
+    name         varchar(64)  not null,
+    token_hash   varchar(64)  not null unique,
+    scopes       text[]       not null default '{}',
+    created_at   timestamp    not null,
+    expires_at   timestamp,
+    last_used_at timestamp
+);
+
+CREATE INDEX idx_users_tokens_user_id ON users_tokens (user_id);
+
+CREATE TABLE users_identities (
+    id         varchar(32)  not null primary key,
+    user_id    varchar(32)  not null references users(id),
+    issuer     varchar(256) not null,
+    subject    varchar(256) not null,
+    created_at timestamp    not null
+);
+
+CREATE UNIQUE INDEX idx_users_identities_uniq ON users_identities (issuer,subject);
+CREATE INDEX idx_users_identities_user_id ON users_identities (user_id);
+
+CREATE TABLE namespaces (
+    id              varchar(32)  not null primary key,
+    name            varchar(64)  not null unique,
+    description     text         not null default '',
+    default_queue   varchar(64)  not null default '',
+    max_active_jobs int          not null default 0,
+    created_at      timestamp    not null
+);
+
+insert into namespaces (id,name,description,created_at) (SELECT REPLACE(gen_random_uuid()::text, '-', ''),'default','The default namespace',current_timestamp);
+
+CREATE TABLE namespaces_members (
+    id           varchar(32) not null primary key,
+    namespace_id varchar(32) not null references namespaces(id),
+    user_id      varchar(32)          references users(id),
+    role_id      varchar(32)          references roles(id),
+    created_at   timestamp   not null
+);
+
+CREATE UNIQUE INDEX idx_namespaces_members_user ON namespaces_members (namespace_id,user_id);
+CREATE UNIQUE INDEX idx_namespaces_members_role ON namespaces_members (namespace_id,role_id);
+
+CREATE TABLE secrets (
+    id          varchar(32)  not null primary key,
+    name        varchar(64)  not null,
+    namespace   varchar(64)  not null default 'default',
+    ciphertext  text         not null,
+    created_at  timestamp    not null,
+    updated_at  timestamp    not null
+);
+
+CREATE UNIQUE INDEX idx_secrets_namespace_name ON secrets (namespace,name);
+
+CREATE TABLE bulk_operations (
+    id           varchar(32)  not null primary key,
+    action       varchar(16)  not null,
+    namespace    varchar(64)  not null default 'default',
+    query        text,
+    tags         text[]       not null default '{}',
+    state        varchar(10)  not null,
+    total        int          not null default 0,
+    succeeded    int          not null default 0,
+    skipped      int          not null default 0,
+    failed       int          not null default 0,
+    error_       text,
+    results      jsonb        not null default '[]',
+    created_by   varchar(64),
+    created_at   timestamp    not null,
+    completed_at timestamp
+);
+
+CREATE INDEX idx_bulk_operations_created_at ON bulk_operations (created_at);
+
 CREATE TABLE scheduled_jobs (
   id             varchar(32) not null primary key,
   name           varchar(64) not null,
@@ -63,9 +196,13 @@ CREATE TABLE scheduled_jobs (
   secrets        jsonb,
   created_at     timestamp   not null,
   created_by     varchar(32) not null references users(id),
-  state          varchar(10) not null
+  state          varchar(10) not null,
+  namespace      varchar(64) not null default 'default'
 );
 
+CREATE INDEX idx_scheduled_jobs_namespace ON scheduled_jobs (namespace);
+CREATE INDEX idx_scheduled_jobs_created_at_id ON scheduled_jobs (created_at,id);
+
 CREATE TABLE scheduled_jobs_perms (
     id               varchar(32) not null primary key,
     scheduled_job_id varchar(32) not null references scheduled_jobs(id),
@@ -99,12 +236,17 @@ CREATE TABLE jobs (
     auto_delete      jsonb,
     secrets          jsonb,
     progress         numeric(5,2) default 0,
-    scheduled_job_id varchar(32) references scheduled_jobs(id)
+    scheduled_job_id varchar(32) references scheduled_jobs(id),
+    namespace        varchar(64) not null default 'default'
 );
 
 CREATE INDEX idx_jobs_state ON jobs (state);
 CREATE INDEX idx_jobs_delete_at ON jobs (delete_at);
 CREATE INDEX idx_jobs_created_at ON jobs (created_at);
+CREATE INDEX idx_jobs_created_at_id ON jobs (created_at,id);
+CREATE INDEX idx_jobs_parent_id ON jobs (parent_id);
+CREATE INDEX idx_jobs_namespace ON jobs (namespace,state);
+CREATE INDEX idx_jobs_created_at_state ON jobs (created_at,state);
 
 ALTER TABLE jobs ADD COLUMN ts tsvector NOT NULL
     GENERATED ALWAYS AS (
@@ -167,12 +309,17 @@ CREATE TABLE tasks (
     tags          text[],
     priority      int,
     workdir       varchar(256),
-    progress      numeric(5,2) default 0
+    progress      numeric(5,2) default 0,
+    node_selector jsonb,
+    resources     jsonb,
+    usage_        jsonb
 );
 
 CREATE INDEX idx_tasks_state ON tasks (state);
 CREATE INDEX idx_tasks_job_id ON tasks (job_id);
 CREATE INDEX idx_tasks_parent_and_state ON tasks (parent_id,state);
+CREATE INDEX idx_tasks_job_id_position ON tasks (job_id,position,created_at,id);
+CREATE INDEX idx_tasks_created_at_state ON tasks (created_at,state);
 
 CREATE TABLE tasks_log_parts (
     id         varchar(32) not null primary key,
@@ -191,4 +338,5 @@ ALTER TABLE tasks_log_parts ADD COLUMN ts tsvector NOT NULL
 CREATE INDEX tasks_log_parts_ts_idx ON tasks_log_parts USING GIN (ts);
 CREATE INDEX idx_tasks_log_parts_task_id ON tasks_log_parts (task_id);
 CREATE INDEX idx_tasks_log_parts_created_at ON tasks_log_parts (created_at);
+CREATE INDEX idx_tasks_log_parts_task_id_number ON tasks_log_parts (task_id,number_,id);
 `
@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/conf"
+	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/internal/hash"
+	"github.com/runabol/tork/internal/jwt"
+)
+
+// tokenLastUsedPrecision bounds how often the last-used
+// timestamp of a personal access token is written back.
+const tokenLastUsedPrecision = time.Minute
+
+type authConfig struct {
+	basic    bool
+	tokens   bool
+	jwks     *jwt.KeySet
+	jwtClaim string
+	jwtOpts  []jwt.VerifyOption
+	oidc     *oidcProvider
+}
+
+func basicAuth(ds datastore.Datastore) echo.MiddlewareFunc {
+	return authenticate(ds, authConfig{basic: true})
+}
+
+// authenticate resolves the user behind the request's Authorization
+// header -- username and password, personal access token, JWT or
+// OIDC ID token, depending on which schemes are enabled -- and
+// stores the username in the request context.
+func authenticate(ds datastore.Datastore, cfg authConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			scheme, cred, _ := strings.Cut(c.Request().Header.Get(echo.HeaderAuthorization), " ")
+			var username string
+			var err error
+			switch {
+			case cfg.basic && strings.EqualFold(scheme, "basic"):
+				username, err = cfg.authBasic(c, ds)
+			case cfg.tokens && strings.EqualFold(scheme, "bearer") && strings.HasPrefix(cred, tork.TOKEN_PREFIX):
+				username, err = cfg.authToken(c, ds, cred)
+			case cfg.jwks != nil && strings.EqualFold(scheme, "bearer"):
+				username, err = cfg.authJWT(c, ds, cred)
+				if err != nil && cfg.oidc != nil {
+					username, err = cfg.authOIDC(c, ds, cred)
+				}
+			case cfg.oidc != nil && strings.EqualFold(scheme, "bearer"):
+				username, err = cfg.authOIDC(c, ds, cred)
+			default:
+				err = echo.ErrUnauthorized
+			}
+			if err != nil {
+				if cfg.basic {
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, "basic realm=Restricted")
+				}
+				return err
+			}
+			ctx := context.WithValue(c.Request().Context(), tork.USERNAME, username)
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}
+}
+
+func (cfg authConfig) authBasic(c echo.Context, ds datastore.Datastore) (string, error) {
+	user, pass, ok := c.Request().BasicAuth()
+	if !ok {
+		return "", echo.ErrUnauthorized
+	}
+	u, err := ds.GetUser(c.Request().Context(), user)
+	if err != nil || u.Disabled {
+		return "", echo.ErrUnauthorized
+	}
+	if subtle.ConstantTimeCompare([]byte(user), []byte(u.Username)) != 1 ||
+		!hash.CheckPasswordHash(pass, u.PasswordHash) {
+		return "", echo.ErrUnauthorized
+	}
+	return u.Username, nil
+}
+
+func (cfg authConfig) authToken(c echo.Context, ds datastore.Datastore, token string) (string, error) {
+	ctx := c.Request().Context()
+	t, err := ds.GetUserTokenByHash(ctx, hash.Token(token))
+	if err != nil || t.IsExpired() {
+		return "", echo.ErrUnauthorized
+	}
+	u, err := ds.GetUser(ctx, t.UserID)
+	if err != nil || u.Disabled {
+		return "", echo.ErrUnauthorized
+	}
+	if !t.Permits(c.Request().Method) {
+		return "", echo.NewHTTPError(http.StatusForbidden, "token scopes do not permit this request")
+	}
+	now := time.Now().UTC()
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) > tokenLastUsedPrecision {
+		if err := ds.UpdateUserTokenLastUsed(ctx, t.ID, now); err != nil {
+			log.Error().Err(err).Msgf("error updating last use of token %s", t.ID)
+		}
+	}
+	return u.Username, nil
+}
+
+func (cfg authConfig) authJWT(c echo.Context, ds datastore.Datastore, token string) (string, error) {
+	claims, err := cfg.jwks.Verify(token, cfg.jwtOpts...)
+	if err != nil {
+		log.Debug().Err(err).Msg("rejected JWT")
+		return "", echo.ErrUnauthorized
+	}
+	username := claims.String(cfg.jwtClaim)
+	if username == "" {
+		return "", echo.ErrUnauthorized
+	}
+	u, err := ds.GetUser(c.Request().Context(), username)
+	if err != nil || u.Disabled {
+		return "", echo.ErrUnauthorized
+	}
+	return u.Username, nil
+}
+
+func (cfg authConfig) authOIDC(c echo.Context, ds datastore.Datastore, token string) (string, error) {
+	claims, err := cfg.oidc.verify(token)
+	if err != nil {
+		log.Debug().Err(err).Msg("rejected OIDC token")
+		return "", echo.ErrUnauthorized
+	}
+	u, err := cfg.oidc.login(c.Request().Context(), ds, claims)
+	if err != nil {
+		log.Debug().Err(err).Msg("rejected OIDC login")
+		return "", echo.ErrUnauthorized
+	}
+	return u.Username, nil
+}
+
+// initAdmin creates the admin user configured under [coordinator.admin],
+// if it doesn't exist yet, and makes sure it holds the admin role. The
+// password of an existing user is left as it is.
+func (e *Engine) initAdmin() error {
+	username := conf.String("coordinator.admin.username")
+	if username == "" {
+		return nil
+	}
+	return bootstrapAdmin(context.Background(), e.datastoreRef, username, conf.String("coordinator.admin.password"))
+}
+
+func bootstrapAdmin(ctx context.Context, ds datastore.Datastore, username, password string) error {
+	role, err := ds.GetRole(ctx, tork.ROLE_ADMIN)
+	if err != nil {
+		return errors.Wrapf(err, "error getting the admin role")
+	}
+	u, err := ds.GetUser(ctx, username)
+	if errors.Is(err, datastore.ErrUserNotFound) {
+		if password == "" {
+			return errors.Errorf("coordinator.admin.password is required to create the admin user %s", username)
+		}
+		passwordHash, err := hash.Password(password)
+		if err != nil {
+			return errors.Wrapf(err, "error hashing the admin password")
+		}
+		u = &tork.User{Name: username, Username: username, PasswordHash: passwordHash}
+		if err := ds.CreateUser(ctx, u); err != nil {
+			return errors.Wrapf(err, "error creating the admin user")
+		}
+		log.Info().Msgf("created the admin user %s", username)
+	} else if err != nil {
+		return errors.Wrapf(err, "error getting the admin user")
+	}
+	roles, err := ds.GetUserRoles(ctx, u.ID)
+	if err != nil {
+		return errors.Wrapf(err, "error getting the roles of the admin user")
+	}
+	for _, r := range roles {
+		if r.ID == role.ID {
+			return nil
+		}
+	}
+	if err := ds.AssignRole(ctx, u.ID, role.ID); err != nil {
+		return errors.Wrapf(err, "error assigning the admin role to %s", username)
+	}
+	return nil
+}
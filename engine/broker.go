@@ -27,6 +27,13 @@ func (b *brokerProxy) SubscribeForTasks(qname string, handler func(t *tork.Task)
 	return b.broker.SubscribeForTasks(qname, handler)
 }
 
+func (b *brokerProxy) UnsubscribeForTasks(qname string) error {
+	if err := b.checkInit(); err != nil {
+		return err
+	}
+	return b.broker.UnsubscribeForTasks(qname)
+}
+
 func (b *brokerProxy) PublishTaskProgress(ctx context.Context, t *tork.Task) error {
 	if err := b.checkInit(); err != nil {
 		return err
@@ -104,6 +111,27 @@ func (b *brokerProxy) Queues(ctx context.Context) ([]broker.QueueInfo, error) {
 	return b.broker.Queues(ctx)
 }
 
+func (b *brokerProxy) PauseQueue(ctx context.Context, qname string) error {
+	if err := b.checkInit(); err != nil {
+		return err
+	}
+	return b.broker.PauseQueue(ctx, qname)
+}
+
+func (b *brokerProxy) ResumeQueue(ctx context.Context, qname string) error {
+	if err := b.checkInit(); err != nil {
+		return err
+	}
+	return b.broker.ResumeQueue(ctx, qname)
+}
+
+func (b *brokerProxy) PurgeQueue(ctx context.Context, qname string) (int, error) {
+	if err := b.checkInit(); err != nil {
+		return 0, err
+	}
+	return b.broker.PurgeQueue(ctx, qname)
+}
+
 func (b *brokerProxy) HealthCheck(ctx context.Context) error {
 	if err := b.checkInit(); err != nil {
 		return err
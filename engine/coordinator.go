@@ -1,10 +1,9 @@
 package engine
 
 import (
-	"context"
-	"crypto/subtle"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -15,8 +14,10 @@ import (
 	"github.com/runabol/tork/conf"
 	"github.com/runabol/tork/datastore"
 	"github.com/runabol/tork/internal/coordinator"
-	"github.com/runabol/tork/internal/hash"
+	"github.com/runabol/tork/internal/coordinator/reaper"
+	"github.com/runabol/tork/internal/jwt"
 	"github.com/runabol/tork/internal/redact"
+	"github.com/runabol/tork/internal/secrets"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/runabol/tork/internal/wildcard"
 	"github.com/runabol/tork/middleware/job"
@@ -27,11 +28,17 @@ import (
 func (e *Engine) initCoordinator() error {
 	queues := conf.IntMap("coordinator.queues")
 
+	echoMW, err := echoMiddleware(e.datastoreRef)
+	if err != nil {
+		return err
+	}
+
 	cfg := coordinator.Config{
 		Name:      conf.StringDefault("coordinator.name", "Coordinator"),
 		Broker:    e.brokerRef,
 		DataStore: e.datastoreRef,
 		Locker:    e.locker,
+		Elector:   e.elector,
 		Queues:    queues,
 		Address:   conf.String("coordinator.address"),
 		Middleware: coordinator.Middleware{
@@ -39,11 +46,21 @@ func (e *Engine) initCoordinator() error {
 			Task: e.cfg.Middleware.Task,
 			Job:  e.cfg.Middleware.Job,
 			Node: e.cfg.Middleware.Node,
-			Echo: echoMiddleware(e.datastoreRef),
+			Echo: echoMW,
 		},
-		Endpoints: e.cfg.Endpoints,
-		Enabled:   conf.BoolMap("coordinator.api.endpoints"),
+		Endpoints:      e.cfg.Endpoints,
+		Enabled:        conf.BoolMap("coordinator.api.endpoints"),
+		ReaperInterval: conf.DurationDefault("coordinator.reaper.interval", reaper.DefaultInterval),
+		TrustedProxies: conf.Strings("coordinator.api.trustedproxies"),
+	}
+
+	// secrets
+	store, resolver, err := e.initSecrets()
+	if err != nil {
+		return err
 	}
+	cfg.Secrets = store
+	cfg.SecretResolver = resolver
 
 	// redact
 	redactJobEnabled := conf.BoolDefault("middleware.job.redact.enabled", true)
@@ -54,10 +71,21 @@ func (e *Engine) initCoordinator() error {
 			matchers[i] = redact.Wildcard(pattern)
 		}
 		redacter := redact.NewRedacter(e.datastoreRef, matchers...)
+		if resolver != nil {
+			redacter.WithSecrets(resolver)
+		}
 		cfg.Middleware.Job = append(cfg.Middleware.Job, job.Redact(redacter))
 		cfg.Middleware.Task = append(cfg.Middleware.Task, task.Redact(redacter))
 	}
 
+	// audit
+	if conf.BoolDefault("middleware.job.audit.enabled", true) {
+		cfg.Middleware.Job = append(cfg.Middleware.Job, job.Audit(e.datastoreRef))
+	}
+	if conf.BoolDefault("middleware.task.audit.enabled", true) {
+		cfg.Middleware.Task = append(cfg.Middleware.Task, task.Audit(e.datastoreRef))
+	}
+
 	// webhook middleware
 	cfg.Middleware.Job = append(cfg.Middleware.Job, job.Webhook)
 	cfg.Middleware.Task = append(cfg.Middleware.Task, task.Webhook(e.datastoreRef))
@@ -76,17 +104,87 @@ func (e *Engine) initCoordinator() error {
 	return nil
 }
 
-func echoMiddleware(ds datastore.Datastore) []echo.MiddlewareFunc {
+// initSecrets creates the secrets store, if a key is configured,
+// and the resolver of the secrets referenced by jobs: those of
+// the store and of the registered and configured secret providers.
+func (e *Engine) initSecrets() (*secrets.Store, *secrets.Resolver, error) {
+	var store *secrets.Store
+	if k := conf.String("coordinator.secrets.key"); k != "" {
+		key, err := secrets.ParseKey(k)
+		if err != nil {
+			return nil, nil, err
+		}
+		store, err = secrets.NewStore(e.datastoreRef, key)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	providers := make(map[string]tork.SecretProvider)
+	if addr := conf.String("coordinator.secrets.vault.addr"); addr != "" {
+		providers["vault"] = secrets.NewVaultProvider(addr, conf.String("coordinator.secrets.vault.token"))
+	}
+	if dir := conf.String("coordinator.secrets.file.dir"); dir != "" {
+		providers["file"] = secrets.NewFileProvider(dir)
+	}
+	if conf.Bool("coordinator.secrets.env.enabled") {
+		providers["env"] = secrets.NewEnvProvider(conf.StringDefault("coordinator.secrets.env.prefix", "TORK_SECRET_"))
+	}
+	// registered providers take precedence over configured ones
+	for scheme, p := range e.secretProviders {
+		providers[scheme] = p
+	}
+	if store == nil && len(providers) == 0 {
+		return nil, nil, nil
+	}
+	var lookup secrets.Lookup
+	if store != nil {
+		lookup = store
+	}
+	return store, secrets.NewResolver(lookup, providers), nil
+}
+
+func echoMiddleware(ds datastore.Datastore) ([]echo.MiddlewareFunc, error) {
 	mw := make([]echo.MiddlewareFunc, 0)
 	// cors
 	corsEnabled := conf.Bool("middleware.web.cors.enabled")
 	if corsEnabled {
 		mw = append(mw, cors())
 	}
-	// basic auth
-	basicAuthEnabled := conf.Bool("middleware.web.basicauth.enabled")
-	if basicAuthEnabled {
-		mw = append(mw, basicAuth(ds))
+	// basic, personal access token, JWT and OIDC auth
+	auth := authConfig{
+		basic:  conf.Bool("middleware.web.basicauth.enabled"),
+		tokens: conf.Bool("middleware.web.tokenauth.enabled"),
+	}
+	if conf.Bool("middleware.web.jwt.enabled") {
+		jwks, err := jwt.LoadKeySet(conf.String("middleware.web.jwt.jwks"))
+		if err != nil {
+			return nil, err
+		}
+		auth.jwks = jwks
+		auth.jwtClaim = conf.StringDefault("middleware.web.jwt.claim", "sub")
+		if iss := conf.String("middleware.web.jwt.issuer"); iss != "" {
+			auth.jwtOpts = append(auth.jwtOpts, jwt.WithIssuer(iss))
+		}
+		if aud := conf.String("middleware.web.jwt.audience"); aud != "" {
+			auth.jwtOpts = append(auth.jwtOpts, jwt.WithAudience(aud))
+		}
+		auth.jwtOpts = append(auth.jwtOpts, jwt.WithLeeway(conf.DurationDefault("middleware.web.jwt.leeway", time.Minute)))
+	}
+	if conf.Bool("middleware.web.oidc.enabled") {
+		p, err := newOIDCProvider(oidcConfig{
+			issuer:        conf.String("middleware.web.oidc.issuer"),
+			clientID:      conf.String("middleware.web.oidc.clientid"),
+			usernameClaim: conf.StringDefault("middleware.web.oidc.claim", "preferred_username"),
+			groupsClaim:   conf.String("middleware.web.oidc.groups.claim"),
+			groupRoles:    conf.StringMap("middleware.web.oidc.groups.roles"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		auth.oidc = p
+	}
+	if auth.basic || auth.tokens || auth.jwks != nil || auth.oidc != nil {
+		mw = append(mw, authenticate(ds, auth))
 	}
 
 	// key auth
@@ -112,28 +210,13 @@ func echoMiddleware(ds datastore.Datastore) []echo.MiddlewareFunc {
 		mw = append(mw, logger())
 	}
 
-	return mw
+	return mw, nil
 }
 
 func rateLimit(rps int) echo.MiddlewareFunc {
 	return middleware.RateLimiter(middleware.NewRateLimiterMemoryStore(rate.Limit(rps)))
 }
 
-func basicAuth(ds datastore.Datastore) echo.MiddlewareFunc {
-	return middleware.BasicAuth(func(user, pass string, ctx echo.Context) (bool, error) {
-		u, err := ds.GetUser(ctx.Request().Context(), user)
-		if err != nil {
-			return false, nil
-		}
-		if subtle.ConstantTimeCompare([]byte(user), []byte(u.Username)) == 1 &&
-			hash.CheckPasswordHash(pass, u.PasswordHash) {
-			ctx.SetRequest(ctx.Request().WithContext(context.WithValue(ctx.Request().Context(), tork.USERNAME, user)))
-			return true, nil
-		}
-		return false, nil
-	})
-}
-
 func keyAuth(key string) echo.MiddlewareFunc {
 	if key == "" {
 		key = uuid.NewUUID()
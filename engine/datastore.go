@@ -2,12 +2,20 @@ package engine
 
 import (
 	"context"
+	"os"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/runabol/tork"
 	"github.com/runabol/tork/conf"
 	"github.com/runabol/tork/datastore"
 	"github.com/runabol/tork/datastore/postgres"
+	"github.com/runabol/tork/datastore/search"
+	"github.com/runabol/tork/internal/archive"
+	"github.com/runabol/tork/internal/metrics"
+	"github.com/runabol/tork/internal/redact"
+	"github.com/runabol/tork/internal/secrets"
 )
 
 type datastoreProxy struct {
@@ -18,6 +26,7 @@ func (ds *datastoreProxy) CreateTask(ctx context.Context, t *tork.Task) error {
 	if err := ds.checkInit(); err != nil {
 		return err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("CreateTask")).ObserveDuration()
 	return ds.ds.CreateTask(ctx, t)
 }
 
@@ -25,6 +34,7 @@ func (ds *datastoreProxy) UpdateTask(ctx context.Context, id string, modify func
 	if err := ds.checkInit(); err != nil {
 		return err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("UpdateTask")).ObserveDuration()
 	return ds.ds.UpdateTask(ctx, id, modify)
 }
 
@@ -32,6 +42,7 @@ func (ds *datastoreProxy) GetTaskByID(ctx context.Context, id string) (*tork.Tas
 	if err := ds.checkInit(); err != nil {
 		return nil, err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetTaskByID")).ObserveDuration()
 	return ds.ds.GetTaskByID(ctx, id)
 }
 
@@ -39,13 +50,23 @@ func (ds *datastoreProxy) GetActiveTasks(ctx context.Context, jobID string) ([]*
 	if err := ds.checkInit(); err != nil {
 		return nil, err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetActiveTasks")).ObserveDuration()
 	return ds.ds.GetActiveTasks(ctx, jobID)
 }
 
+func (ds *datastoreProxy) GetActiveTasksByNodeID(ctx context.Context, nodeID string) ([]*tork.Task, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetActiveTasksByNodeID")).ObserveDuration()
+	return ds.ds.GetActiveTasksByNodeID(ctx, nodeID)
+}
+
 func (ds *datastoreProxy) GetNextTask(ctx context.Context, parentTaskID string) (*tork.Task, error) {
 	if err := ds.checkInit(); err != nil {
 		return nil, err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetNextTask")).ObserveDuration()
 	return ds.ds.GetNextTask(ctx, parentTaskID)
 }
 
@@ -53,20 +74,23 @@ func (ds *datastoreProxy) CreateTaskLogPart(ctx context.Context, p *tork.TaskLog
 	if err := ds.checkInit(); err != nil {
 		return err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("CreateTaskLogPart")).ObserveDuration()
 	return ds.ds.CreateTaskLogPart(ctx, p)
 }
 
-func (ds *datastoreProxy) GetTaskLogParts(ctx context.Context, taskID, q string, page, size int) (*datastore.Page[*tork.TaskLogPart], error) {
+func (ds *datastoreProxy) GetTaskLogParts(ctx context.Context, taskID, q, cursor string, page, size int) (*datastore.Page[*tork.TaskLogPart], error) {
 	if err := ds.checkInit(); err != nil {
 		return nil, err
 	}
-	return ds.ds.GetTaskLogParts(ctx, taskID, q, page, size)
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetTaskLogParts")).ObserveDuration()
+	return ds.ds.GetTaskLogParts(ctx, taskID, q, cursor, page, size)
 }
 
 func (ds *datastoreProxy) CreateNode(ctx context.Context, n *tork.Node) error {
 	if err := ds.checkInit(); err != nil {
 		return err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("CreateNode")).ObserveDuration()
 	return ds.ds.CreateNode(ctx, n)
 }
 
@@ -74,6 +98,7 @@ func (ds *datastoreProxy) UpdateNode(ctx context.Context, id string, modify func
 	if err := ds.checkInit(); err != nil {
 		return err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("UpdateNode")).ObserveDuration()
 	return ds.ds.UpdateNode(ctx, id, modify)
 }
 
@@ -81,6 +106,7 @@ func (ds *datastoreProxy) GetNodeByID(ctx context.Context, id string) (*tork.Nod
 	if err := ds.checkInit(); err != nil {
 		return nil, err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetNodeByID")).ObserveDuration()
 	return ds.ds.GetNodeByID(ctx, id)
 }
 
@@ -88,13 +114,39 @@ func (ds *datastoreProxy) GetActiveNodes(ctx context.Context) ([]*tork.Node, err
 	if err := ds.checkInit(); err != nil {
 		return nil, err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetActiveNodes")).ObserveDuration()
 	return ds.ds.GetActiveNodes(ctx)
 }
 
+func (ds *datastoreProxy) GetStaleNodes(ctx context.Context, lastHeartbeatBefore time.Time) ([]*tork.Node, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetStaleNodes")).ObserveDuration()
+	return ds.ds.GetStaleNodes(ctx, lastHeartbeatBefore)
+}
+
+func (ds *datastoreProxy) CreateNodeSample(ctx context.Context, nodeID string, s *tork.NodeSample) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("CreateNodeSample")).ObserveDuration()
+	return ds.ds.CreateNodeSample(ctx, nodeID, s)
+}
+
+func (ds *datastoreProxy) GetNodeSamples(ctx context.Context, nodeID string, since time.Time) ([]*tork.NodeSample, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetNodeSamples")).ObserveDuration()
+	return ds.ds.GetNodeSamples(ctx, nodeID, since)
+}
+
 func (ds *datastoreProxy) CreateJob(ctx context.Context, j *tork.Job) error {
 	if err := ds.checkInit(); err != nil {
 		return err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("CreateJob")).ObserveDuration()
 	return ds.ds.CreateJob(ctx, j)
 }
 
@@ -102,6 +154,7 @@ func (ds *datastoreProxy) UpdateJob(ctx context.Context, id string, modify func(
 	if err := ds.checkInit(); err != nil {
 		return err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("UpdateJob")).ObserveDuration()
 	return ds.ds.UpdateJob(ctx, id, modify)
 }
 
@@ -109,27 +162,79 @@ func (ds *datastoreProxy) GetJobByID(ctx context.Context, id string) (*tork.Job,
 	if err := ds.checkInit(); err != nil {
 		return nil, err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetJobByID")).ObserveDuration()
 	return ds.ds.GetJobByID(ctx, id)
 }
 
-func (ds *datastoreProxy) GetJobLogParts(ctx context.Context, jobID, q string, page, size int) (*datastore.Page[*tork.TaskLogPart], error) {
+func (ds *datastoreProxy) GetJobNamespace(ctx context.Context, id string) (string, error) {
+	if err := ds.checkInit(); err != nil {
+		return "", err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetJobNamespace")).ObserveDuration()
+	return ds.ds.GetJobNamespace(ctx, id)
+}
+
+func (ds *datastoreProxy) GetJobLogParts(ctx context.Context, jobID, q, cursor string, page, size int) (*datastore.Page[*tork.TaskLogPart], error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetJobLogParts")).ObserveDuration()
+	return ds.ds.GetJobLogParts(ctx, jobID, q, cursor, page, size)
+}
+
+func (ds *datastoreProxy) GetJobTasks(ctx context.Context, jobID string, q datastore.TaskQuery, cursor string, page, size int) (*datastore.Page[*tork.TaskSummary], error) {
 	if err := ds.checkInit(); err != nil {
 		return nil, err
 	}
-	return ds.ds.GetJobLogParts(ctx, jobID, q, page, size)
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetJobTasks")).ObserveDuration()
+	return ds.ds.GetJobTasks(ctx, jobID, q, cursor, page, size)
+}
+
+func (ds *datastoreProxy) GetJobs(ctx context.Context, currentUser, namespace string, q *search.Query, cursor string, page, size int) (*datastore.Page[*tork.JobSummary], error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetJobs")).ObserveDuration()
+	return ds.ds.GetJobs(ctx, currentUser, namespace, q, cursor, page, size)
+}
+
+func (ds *datastoreProxy) DeleteJob(ctx context.Context, id string) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("DeleteJob")).ObserveDuration()
+	return ds.ds.DeleteJob(ctx, id)
+}
+
+func (ds *datastoreProxy) CreateBulkOperation(ctx context.Context, o *tork.BulkOperation) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("CreateBulkOperation")).ObserveDuration()
+	return ds.ds.CreateBulkOperation(ctx, o)
+}
+
+func (ds *datastoreProxy) UpdateBulkOperation(ctx context.Context, id string, modify func(u *tork.BulkOperation) error) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("UpdateBulkOperation")).ObserveDuration()
+	return ds.ds.UpdateBulkOperation(ctx, id, modify)
 }
 
-func (ds *datastoreProxy) GetJobs(ctx context.Context, currentUser, q string, page, size int) (*datastore.Page[*tork.JobSummary], error) {
+func (ds *datastoreProxy) GetBulkOperationByID(ctx context.Context, id string) (*tork.BulkOperation, error) {
 	if err := ds.checkInit(); err != nil {
 		return nil, err
 	}
-	return ds.ds.GetJobs(ctx, currentUser, q, page, size)
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetBulkOperationByID")).ObserveDuration()
+	return ds.ds.GetBulkOperationByID(ctx, id)
 }
 
 func (ds *datastoreProxy) CreateScheduledJob(ctx context.Context, s *tork.ScheduledJob) error {
 	if err := ds.checkInit(); err != nil {
 		return err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("CreateScheduledJob")).ObserveDuration()
 	return ds.ds.CreateScheduledJob(ctx, s)
 }
 
@@ -137,20 +242,23 @@ func (ds *datastoreProxy) GetActiveScheduledJobs(ctx context.Context) ([]*tork.S
 	if err := ds.checkInit(); err != nil {
 		return nil, err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetActiveScheduledJobs")).ObserveDuration()
 	return ds.ds.GetActiveScheduledJobs(ctx)
 }
 
-func (ds *datastoreProxy) GetScheduledJobs(ctx context.Context, currentUser string, page, size int) (*datastore.Page[*tork.ScheduledJobSummary], error) {
+func (ds *datastoreProxy) GetScheduledJobs(ctx context.Context, currentUser, namespace, cursor string, page, size int) (*datastore.Page[*tork.ScheduledJobSummary], error) {
 	if err := ds.checkInit(); err != nil {
 		return nil, err
 	}
-	return ds.ds.GetScheduledJobs(ctx, currentUser, page, size)
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetScheduledJobs")).ObserveDuration()
+	return ds.ds.GetScheduledJobs(ctx, currentUser, namespace, cursor, page, size)
 }
 
 func (ds *datastoreProxy) GetScheduledJobByID(ctx context.Context, id string) (*tork.ScheduledJob, error) {
 	if err := ds.checkInit(); err != nil {
 		return nil, err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetScheduledJobByID")).ObserveDuration()
 	return ds.ds.GetScheduledJobByID(ctx, id)
 }
 
@@ -158,6 +266,7 @@ func (ds *datastoreProxy) UpdateScheduledJob(ctx context.Context, id string, mod
 	if err := ds.checkInit(); err != nil {
 		return err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("UpdateScheduledJob")).ObserveDuration()
 	return ds.ds.UpdateScheduledJob(ctx, id, modify)
 }
 
@@ -165,6 +274,7 @@ func (ds *datastoreProxy) DeleteScheduledJob(ctx context.Context, id string) err
 	if err := ds.checkInit(); err != nil {
 		return err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("DeleteScheduledJob")).ObserveDuration()
 	return ds.ds.DeleteScheduledJob(ctx, id)
 }
 
@@ -172,6 +282,7 @@ func (ds *datastoreProxy) CreateUser(ctx context.Context, u *tork.User) error {
 	if err := ds.checkInit(); err != nil {
 		return err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("CreateUser")).ObserveDuration()
 	return ds.ds.CreateUser(ctx, u)
 }
 
@@ -179,13 +290,103 @@ func (ds *datastoreProxy) GetUser(ctx context.Context, username string) (*tork.U
 	if err := ds.checkInit(); err != nil {
 		return nil, err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetUser")).ObserveDuration()
 	return ds.ds.GetUser(ctx, username)
 }
 
+func (ds *datastoreProxy) UpdateUser(ctx context.Context, id string, modify func(u *tork.User) error) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("UpdateUser")).ObserveDuration()
+	return ds.ds.UpdateUser(ctx, id, modify)
+}
+
+func (ds *datastoreProxy) DeleteUser(ctx context.Context, id string) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("DeleteUser")).ObserveDuration()
+	return ds.ds.DeleteUser(ctx, id)
+}
+
+func (ds *datastoreProxy) CreateUserToken(ctx context.Context, t *tork.UserToken) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("CreateUserToken")).ObserveDuration()
+	return ds.ds.CreateUserToken(ctx, t)
+}
+
+func (ds *datastoreProxy) GetUserTokens(ctx context.Context, userID string) ([]*tork.UserToken, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetUserTokens")).ObserveDuration()
+	return ds.ds.GetUserTokens(ctx, userID)
+}
+
+func (ds *datastoreProxy) GetUserTokenByHash(ctx context.Context, tokenHash string) (*tork.UserToken, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetUserTokenByHash")).ObserveDuration()
+	return ds.ds.GetUserTokenByHash(ctx, tokenHash)
+}
+
+func (ds *datastoreProxy) UpdateUserTokenLastUsed(ctx context.Context, id string, lastUsedAt time.Time) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("UpdateUserTokenLastUsed")).ObserveDuration()
+	return ds.ds.UpdateUserTokenLastUsed(ctx, id, lastUsedAt)
+}
+
+func (ds *datastoreProxy) DeleteUserToken(ctx context.Context, userID, id string) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("DeleteUserToken")).ObserveDuration()
+	return ds.ds.DeleteUserToken(ctx, userID, id)
+}
+
+func (ds *datastoreProxy) CreateUserIdentity(ctx context.Context, i *tork.UserIdentity) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("CreateUserIdentity")).ObserveDuration()
+	return ds.ds.CreateUserIdentity(ctx, i)
+}
+
+func (ds *datastoreProxy) GetUserIdentities(ctx context.Context, userID string) ([]*tork.UserIdentity, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetUserIdentities")).ObserveDuration()
+	return ds.ds.GetUserIdentities(ctx, userID)
+}
+
+func (ds *datastoreProxy) GetUserByIdentity(ctx context.Context, issuer, subject string) (*tork.User, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetUserByIdentity")).ObserveDuration()
+	return ds.ds.GetUserByIdentity(ctx, issuer, subject)
+}
+
+func (ds *datastoreProxy) DeleteUserIdentity(ctx context.Context, userID, id string) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("DeleteUserIdentity")).ObserveDuration()
+	return ds.ds.DeleteUserIdentity(ctx, userID, id)
+}
+
 func (ds *datastoreProxy) CreateRole(ctx context.Context, r *tork.Role) error {
 	if err := ds.checkInit(); err != nil {
 		return err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("CreateRole")).ObserveDuration()
 	return ds.ds.CreateRole(ctx, r)
 }
 
@@ -193,6 +394,7 @@ func (ds *datastoreProxy) GetRole(ctx context.Context, id string) (*tork.Role, e
 	if err := ds.checkInit(); err != nil {
 		return nil, err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetRole")).ObserveDuration()
 	return ds.ds.GetRole(ctx, id)
 }
 
@@ -200,13 +402,23 @@ func (ds *datastoreProxy) GetRoles(ctx context.Context) ([]*tork.Role, error) {
 	if err := ds.checkInit(); err != nil {
 		return nil, err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetRoles")).ObserveDuration()
 	return ds.ds.GetRoles(ctx)
 }
 
+func (ds *datastoreProxy) DeleteRole(ctx context.Context, id string) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("DeleteRole")).ObserveDuration()
+	return ds.ds.DeleteRole(ctx, id)
+}
+
 func (ds *datastoreProxy) GetUserRoles(ctx context.Context, userID string) ([]*tork.Role, error) {
 	if err := ds.checkInit(); err != nil {
 		return nil, err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetUserRoles")).ObserveDuration()
 	return ds.ds.GetUserRoles(ctx, userID)
 }
 
@@ -214,6 +426,7 @@ func (ds *datastoreProxy) AssignRole(ctx context.Context, userID, roleID string)
 	if err := ds.checkInit(); err != nil {
 		return err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("AssignRole")).ObserveDuration()
 	return ds.ds.AssignRole(ctx, userID, roleID)
 }
 
@@ -221,20 +434,199 @@ func (ds *datastoreProxy) UnassignRole(ctx context.Context, userID, roleID strin
 	if err := ds.checkInit(); err != nil {
 		return err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("UnassignRole")).ObserveDuration()
 	return ds.ds.UnassignRole(ctx, userID, roleID)
 }
 
-func (ds *datastoreProxy) GetMetrics(ctx context.Context) (*tork.Metrics, error) {
+func (ds *datastoreProxy) CreatePolicy(ctx context.Context, p *tork.Policy) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("CreatePolicy")).ObserveDuration()
+	return ds.ds.CreatePolicy(ctx, p)
+}
+
+func (ds *datastoreProxy) GetPolicies(ctx context.Context, roleID string) ([]*tork.Policy, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetPolicies")).ObserveDuration()
+	return ds.ds.GetPolicies(ctx, roleID)
+}
+
+func (ds *datastoreProxy) GetUserPolicies(ctx context.Context, userID string) ([]*tork.Policy, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetUserPolicies")).ObserveDuration()
+	return ds.ds.GetUserPolicies(ctx, userID)
+}
+
+func (ds *datastoreProxy) DeletePolicy(ctx context.Context, id string) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("DeletePolicy")).ObserveDuration()
+	return ds.ds.DeletePolicy(ctx, id)
+}
+
+func (ds *datastoreProxy) CreateAuditEvent(ctx context.Context, e *tork.AuditEvent) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("CreateAuditEvent")).ObserveDuration()
+	return ds.ds.CreateAuditEvent(ctx, e)
+}
+
+func (ds *datastoreProxy) GetAuditEvents(ctx context.Context, q datastore.AuditQuery, page, size int) (*datastore.Page[*tork.AuditEvent], error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetAuditEvents")).ObserveDuration()
+	return ds.ds.GetAuditEvents(ctx, q, page, size)
+}
+
+func (ds *datastoreProxy) CreateNamespace(ctx context.Context, n *tork.Namespace) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("CreateNamespace")).ObserveDuration()
+	return ds.ds.CreateNamespace(ctx, n)
+}
+
+func (ds *datastoreProxy) GetNamespace(ctx context.Context, name string) (*tork.Namespace, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetNamespace")).ObserveDuration()
+	return ds.ds.GetNamespace(ctx, name)
+}
+
+func (ds *datastoreProxy) GetNamespaces(ctx context.Context) ([]*tork.Namespace, error) {
 	if err := ds.checkInit(); err != nil {
 		return nil, err
 	}
-	return ds.ds.GetMetrics(ctx)
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetNamespaces")).ObserveDuration()
+	return ds.ds.GetNamespaces(ctx)
+}
+
+func (ds *datastoreProxy) UpdateNamespace(ctx context.Context, name string, modify func(n *tork.Namespace) error) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("UpdateNamespace")).ObserveDuration()
+	return ds.ds.UpdateNamespace(ctx, name, modify)
+}
+
+func (ds *datastoreProxy) DeleteNamespace(ctx context.Context, name string) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("DeleteNamespace")).ObserveDuration()
+	return ds.ds.DeleteNamespace(ctx, name)
+}
+
+func (ds *datastoreProxy) AddNamespaceMember(ctx context.Context, namespaceID string, m *tork.NamespaceMember) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("AddNamespaceMember")).ObserveDuration()
+	return ds.ds.AddNamespaceMember(ctx, namespaceID, m)
+}
+
+func (ds *datastoreProxy) RemoveNamespaceMember(ctx context.Context, namespaceID string, m *tork.NamespaceMember) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("RemoveNamespaceMember")).ObserveDuration()
+	return ds.ds.RemoveNamespaceMember(ctx, namespaceID, m)
+}
+
+func (ds *datastoreProxy) IsNamespaceMember(ctx context.Context, namespaceID, userID string) (bool, error) {
+	if err := ds.checkInit(); err != nil {
+		return false, err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("IsNamespaceMember")).ObserveDuration()
+	return ds.ds.IsNamespaceMember(ctx, namespaceID, userID)
+}
+
+func (ds *datastoreProxy) CountActiveJobs(ctx context.Context, namespace string) (int, error) {
+	if err := ds.checkInit(); err != nil {
+		return 0, err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("CountActiveJobs")).ObserveDuration()
+	return ds.ds.CountActiveJobs(ctx, namespace)
+}
+
+func (ds *datastoreProxy) CreateSecret(ctx context.Context, s *tork.Secret) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("CreateSecret")).ObserveDuration()
+	return ds.ds.CreateSecret(ctx, s)
+}
+
+func (ds *datastoreProxy) GetSecret(ctx context.Context, namespace, name string) (*tork.Secret, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetSecret")).ObserveDuration()
+	return ds.ds.GetSecret(ctx, namespace, name)
+}
+
+func (ds *datastoreProxy) GetSecrets(ctx context.Context, namespace string) ([]*tork.Secret, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetSecrets")).ObserveDuration()
+	return ds.ds.GetSecrets(ctx, namespace)
+}
+
+func (ds *datastoreProxy) UpdateSecret(ctx context.Context, namespace, name string, modify func(s *tork.Secret) error) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("UpdateSecret")).ObserveDuration()
+	return ds.ds.UpdateSecret(ctx, namespace, name, modify)
+}
+
+func (ds *datastoreProxy) DeleteSecret(ctx context.Context, namespace, name string) error {
+	if err := ds.checkInit(); err != nil {
+		return err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("DeleteSecret")).ObserveDuration()
+	return ds.ds.DeleteSecret(ctx, namespace, name)
+}
+
+func (ds *datastoreProxy) GetMetrics(ctx context.Context, namespace string) (*tork.Metrics, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetMetrics")).ObserveDuration()
+	return ds.ds.GetMetrics(ctx, namespace)
+}
+
+func (ds *datastoreProxy) GetJobStats(ctx context.Context, currentUser, namespace string, q datastore.StatsQuery) ([]*tork.Stats, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetJobStats")).ObserveDuration()
+	return ds.ds.GetJobStats(ctx, currentUser, namespace, q)
+}
+
+func (ds *datastoreProxy) GetTaskStats(ctx context.Context, currentUser, namespace string, q datastore.StatsQuery) ([]*tork.Stats, error) {
+	if err := ds.checkInit(); err != nil {
+		return nil, err
+	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("GetTaskStats")).ObserveDuration()
+	return ds.ds.GetTaskStats(ctx, currentUser, namespace, q)
 }
 
 func (ds *datastoreProxy) HealthCheck(ctx context.Context) error {
 	if err := ds.checkInit(); err != nil {
 		return err
 	}
+	defer prometheus.NewTimer(metrics.DatastoreQueryDuration.WithLabelValues("HealthCheck")).ObserveDuration()
 	return ds.ds.HealthCheck(ctx)
 }
 
@@ -242,7 +634,10 @@ func (ds *datastoreProxy) WithTx(ctx context.Context, f func(tx datastore.Datast
 	if err := ds.checkInit(); err != nil {
 		return err
 	}
-	return ds.ds.WithTx(ctx, f)
+	// the operations of the transaction are timed too
+	return ds.ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		return f(&datastoreProxy{ds: tx})
+	})
 }
 
 func (ds *datastoreProxy) checkInit() error {
@@ -273,11 +668,64 @@ func (e *Engine) createDatastore(dstype string) (datastore.Datastore, error) {
 			"datastore.postgres.dsn",
 			"host=localhost user=tork password=tork dbname=tork port=5432 sslmode=disable",
 		)
-		return postgres.NewPostgresDataStore(dsn,
+		opts := []postgres.Option{
 			postgres.WithLogsRetentionDuration(conf.DurationDefault("datastore.retention.logs.duration", postgres.DefaultLogsRetentionDuration)),
 			postgres.WithJobsRetentionDuration(conf.DurationDefault("datastore.retention.jobs.duration", postgres.DefaultJobsRetentionDuration)),
-		)
+			postgres.WithAuditRetentionDuration(conf.DurationDefault("datastore.retention.audit.duration", postgres.DefaultAuditRetentionDuration)),
+			postgres.WithElector(e.elector),
+		}
+		if k := conf.String("datastore.encryption.key"); k != "" {
+			kr, err := secrets.ParseKeyring(k, conf.Strings("datastore.encryption.previous")...)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid datastore encryption key")
+			}
+			opts = append(opts, postgres.WithKeyring(kr))
+		}
+		a, err := createArchiver()
+		if err != nil {
+			return nil, err
+		}
+		if a != nil {
+			opts = append(opts, postgres.WithArchiver(a))
+		}
+		return postgres.NewPostgresDataStore(dsn, opts...)
 	default:
 		return nil, errors.Errorf("unknown datastore type: %s", dstype)
 	}
 }
+
+// createArchiver creates the archiver which exports expired jobs
+// and logs to either a directory or an S3 bucket, if configured.
+func createArchiver() (*archive.Archiver, error) {
+	dir := conf.String("datastore.archive.dir")
+	bucket := conf.String("datastore.archive.s3.bucket")
+	var store archive.Store
+	switch {
+	case dir != "" && bucket != "":
+		return nil, errors.New("can't archive to both a directory and an S3 bucket")
+	case dir != "":
+		store = archive.NewDirStore(dir)
+	case bucket != "":
+		s3, err := archive.NewS3Store(archive.S3Config{
+			Endpoint:        conf.String("datastore.archive.s3.endpoint"),
+			Region:          conf.StringDefault("datastore.archive.s3.region", os.Getenv("AWS_REGION")),
+			Bucket:          bucket,
+			Prefix:          conf.String("datastore.archive.s3.prefix"),
+			AccessKeyID:     conf.StringDefault("datastore.archive.s3.access_key_id", os.Getenv("AWS_ACCESS_KEY_ID")),
+			SecretAccessKey: conf.StringDefault("datastore.archive.s3.secret_access_key", os.Getenv("AWS_SECRET_ACCESS_KEY")),
+			SessionToken:    conf.StringDefault("datastore.archive.s3.session_token", os.Getenv("AWS_SESSION_TOKEN")),
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid datastore archive config")
+		}
+		store = s3
+	default:
+		return nil, nil
+	}
+	patterns := conf.Strings("middleware.job.redact.patterns")
+	matchers := make([]redact.Matcher, len(patterns))
+	for i, pattern := range patterns {
+		matchers[i] = redact.Wildcard(pattern)
+	}
+	return archive.NewArchiver(store, redact.NewRedacter(nil, matchers...)), nil
+}
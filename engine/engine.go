@@ -41,21 +41,24 @@ const (
 )
 
 type Engine struct {
-	quit         chan os.Signal
-	terminate    chan any
-	terminated   chan any
-	cfg          Config
-	state        string
-	mu           sync.Mutex
-	brokerRef    *brokerProxy
-	datastoreRef *datastoreProxy
-	locker       locker.Locker
-	mounters     map[string]*runtime.MultiMounter
-	runtime      runtime.Runtime
-	coordinator  *coordinator.Coordinator
-	worker       *worker.Worker
-	dsProviders  map[string]datastore.Provider
-	mqProviders  map[string]broker.Provider
+	quit            chan os.Signal
+	terminate       chan any
+	terminated      chan any
+	cfg             Config
+	state           string
+	mu              sync.Mutex
+	brokerRef       *brokerProxy
+	datastoreRef    *datastoreProxy
+	locker          locker.Locker
+	elector         *locker.LeaderElector
+	mounters        map[string]*runtime.MultiMounter
+	runtime         runtime.Runtime
+	coordinator     *coordinator.Coordinator
+	worker          *worker.Worker
+	dsProviders     map[string]datastore.Provider
+	mqProviders     map[string]broker.Provider
+	secretProviders map[string]tork.SecretProvider
+	stopTracing     func(context.Context) error
 }
 
 type Config struct {
@@ -78,16 +81,17 @@ func New(cfg Config) *Engine {
 		cfg.Endpoints = make(map[string]web.HandlerFunc)
 	}
 	return &Engine{
-		quit:         make(chan os.Signal, 1),
-		terminate:    make(chan any),
-		terminated:   make(chan any),
-		cfg:          cfg,
-		state:        StateIdle,
-		mounters:     make(map[string]*runtime.MultiMounter),
-		dsProviders:  make(map[string]datastore.Provider),
-		mqProviders:  make(map[string]broker.Provider),
-		datastoreRef: &datastoreProxy{},
-		brokerRef:    &brokerProxy{},
+		quit:            make(chan os.Signal, 1),
+		terminate:       make(chan any),
+		terminated:      make(chan any),
+		cfg:             cfg,
+		state:           StateIdle,
+		mounters:        make(map[string]*runtime.MultiMounter),
+		dsProviders:     make(map[string]datastore.Provider),
+		mqProviders:     make(map[string]broker.Provider),
+		secretProviders: make(map[string]tork.SecretProvider),
+		datastoreRef:    &datastoreProxy{},
+		brokerRef:       &brokerProxy{},
 	}
 }
 
@@ -146,15 +150,23 @@ func (e *Engine) SetMode(mode Mode) {
 }
 
 func (e *Engine) runCoordinator() error {
+	if err := e.initTracing(); err != nil {
+		return err
+	}
+
 	if err := e.initBroker(); err != nil {
 		return err
 	}
 
+	if err := e.initLocker(); err != nil {
+		return err
+	}
+
 	if err := e.initDatastore(); err != nil {
 		return err
 	}
 
-	if err := e.initLocker(); err != nil {
+	if err := e.initAdmin(); err != nil {
 		return err
 	}
 
@@ -171,6 +183,7 @@ func (e *Engine) runCoordinator() error {
 				log.Error().Err(err).Msg("error stopping coordinator")
 			}
 		}
+		e.shutdownTracing()
 		close(e.terminated)
 	}()
 
@@ -178,6 +191,10 @@ func (e *Engine) runCoordinator() error {
 }
 
 func (e *Engine) runWorker() error {
+	if err := e.initTracing(); err != nil {
+		return err
+	}
+
 	if err := e.initBroker(); err != nil {
 		return err
 	}
@@ -191,10 +208,14 @@ func (e *Engine) runWorker() error {
 
 		log.Debug().Msg("shutting down")
 		if e.worker != nil {
+			if err := e.worker.Drain(); err != nil {
+				log.Error().Err(err).Msg("error draining worker")
+			}
 			if err := e.worker.Stop(); err != nil {
 				log.Error().Err(err).Msg("error stopping worker")
 			}
 		}
+		e.shutdownTracing()
 		close(e.terminated)
 	}()
 
@@ -202,15 +223,23 @@ func (e *Engine) runWorker() error {
 }
 
 func (e *Engine) runStandalone() error {
+	if err := e.initTracing(); err != nil {
+		return err
+	}
+
 	if err := e.initBroker(); err != nil {
 		return err
 	}
 
+	if err := e.initLocker(); err != nil {
+		return err
+	}
+
 	if err := e.initDatastore(); err != nil {
 		return err
 	}
 
-	if err := e.initLocker(); err != nil {
+	if err := e.initAdmin(); err != nil {
 		return err
 	}
 
@@ -227,6 +256,9 @@ func (e *Engine) runStandalone() error {
 
 		log.Debug().Msg("shutting down")
 		if e.worker != nil {
+			if err := e.worker.Drain(); err != nil {
+				log.Error().Err(err).Msg("error draining worker")
+			}
 			if err := e.worker.Stop(); err != nil {
 				log.Error().Err(err).Msg("error stopping worker")
 			}
@@ -236,6 +268,7 @@ func (e *Engine) runStandalone() error {
 				log.Error().Err(err).Msg("error stopping coordinator")
 			}
 		}
+		e.shutdownTracing()
 		close(e.terminated)
 	}()
 
@@ -325,6 +358,18 @@ func (e *Engine) RegisterBrokerProvider(name string, provider broker.Provider) {
 	e.mqProviders[name] = provider
 }
 
+// RegisterSecretProvider registers a provider of the secrets
+// which jobs reference as {{ secret("<scheme>:<path>") }}.
+func (e *Engine) RegisterSecretProvider(scheme string, provider tork.SecretProvider) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.mustState(StateIdle)
+	if _, ok := e.secretProviders[scheme]; ok {
+		panic("engine: RegisterSecretProvider called twice for scheme " + scheme)
+	}
+	e.secretProviders[scheme] = provider
+}
+
 func (e *Engine) SubmitJob(ctx context.Context, ij *input.Job, listeners ...JobListener) (*tork.Job, error) {
 	e.mustState(StateRunning)
 	if e.cfg.Mode != ModeStandalone && e.cfg.Mode != ModeCoordinator {
@@ -364,8 +409,15 @@ func (e *Engine) Datastore() datastore.Datastore {
 
 func (e *Engine) awaitTerm() {
 	signal.Notify(e.quit, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	// a worker may also be drained remotely, in
+	// which case it should exit once it's done
+	var drained <-chan any
+	if e.worker != nil {
+		drained = e.worker.Drained()
+	}
 	select {
 	case <-e.quit:
 	case <-e.terminate:
+	case <-drained:
 	}
 }
@@ -13,6 +13,7 @@ import (
 	"github.com/runabol/tork/datastore/postgres"
 	"github.com/runabol/tork/input"
 	"github.com/runabol/tork/internal/hash"
+	"github.com/runabol/tork/internal/secrets"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/runabol/tork/runtime/docker"
 	"github.com/runabol/tork/runtime/shell"
@@ -163,6 +164,86 @@ func Test_basicCorrectPassword(t *testing.T) {
 	assert.NoError(t, ds.Close())
 }
 
+func Test_tokenAuth(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	u := &tork.User{
+		Username: uuid.NewShortUUID(),
+		Name:     "Tester",
+	}
+	err = ds.CreateUser(ctx, u)
+	assert.NoError(t, err)
+	token := tork.TOKEN_PREFIX + uuid.NewUUID()
+	err = ds.CreateUserToken(ctx, &tork.UserToken{
+		UserID:    u.ID,
+		Name:      "ci",
+		TokenHash: hash.Token(token),
+		Scopes:    []string{tork.TOKEN_SCOPE_READ},
+	})
+	assert.NoError(t, err)
+
+	mw := authenticate(ds, authConfig{tokens: true})
+	call := func(method, token string) (string, error) {
+		req, err := http.NewRequest(method, "/jobs", nil)
+		assert.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		ctx := echo.New().NewContext(req, httptest.NewRecorder())
+		var username string
+		err = mw(func(c echo.Context) error {
+			username, _ = c.Request().Context().Value(tork.USERNAME).(string)
+			return nil
+		})(ctx)
+		return username, err
+	}
+
+	username, err := call("GET", token)
+	assert.NoError(t, err)
+	assert.Equal(t, u.Username, username)
+
+	// read-only tokens can't submit jobs
+	_, err = call("POST", token)
+	var herr *echo.HTTPError
+	assert.ErrorAs(t, err, &herr)
+	assert.Equal(t, http.StatusForbidden, herr.Code)
+
+	_, err = call("GET", tork.TOKEN_PREFIX+"bogus")
+	assert.ErrorIs(t, err, echo.ErrUnauthorized)
+
+	assert.NoError(t, ds.Close())
+}
+
+func Test_bootstrapAdmin(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	username := uuid.NewShortUUID()
+
+	// a new user needs a password
+	err = bootstrapAdmin(ctx, ds, username, "")
+	assert.Error(t, err)
+
+	assert.NoError(t, bootstrapAdmin(ctx, ds, username, "secret"))
+	u, err := ds.GetUser(ctx, username)
+	assert.NoError(t, err)
+	assert.True(t, hash.CheckPasswordHash("secret", u.PasswordHash))
+	roles, err := ds.GetUserRoles(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Len(t, roles, 1)
+	assert.Equal(t, tork.ROLE_ADMIN, roles[0].Slug)
+
+	// re-running keeps the user and its password as they are
+	assert.NoError(t, bootstrapAdmin(ctx, ds, username, "changed"))
+	u, err = ds.GetUser(ctx, username)
+	assert.NoError(t, err)
+	assert.True(t, hash.CheckPasswordHash("secret", u.PasswordHash))
+	roles, err = ds.GetUserRoles(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Len(t, roles, 1)
+
+	assert.NoError(t, ds.Close())
+}
+
 func Test_rateLimit(t *testing.T) {
 	mw := rateLimit(20)
 	req, err := http.NewRequest("GET", "/health", nil)
@@ -325,6 +406,20 @@ func TestRegisterRuntime(t *testing.T) {
 	assert.NoError(t, ds.Close())
 }
 
+func TestRegisterSecretProvider(t *testing.T) {
+	eng := New(Config{Mode: ModeStandalone})
+	p := secrets.NewEnvProvider("TORK_SECRET_")
+	eng.RegisterSecretProvider("env", p)
+	assert.Panics(t, func() {
+		eng.RegisterSecretProvider("env", p)
+	})
+
+	_, resolver, err := eng.initSecrets()
+	assert.NoError(t, err)
+	assert.True(t, resolver.HasProvider("env"))
+	assert.False(t, resolver.HasProvider("vault"))
+}
+
 func TestOnBrokerInit(t *testing.T) {
 	eng := New(Config{Mode: ModeStandalone})
 	assert.Equal(t, StateIdle, eng.state)
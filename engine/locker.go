@@ -8,11 +8,14 @@ import (
 
 func (e *Engine) initLocker() error {
 	ltype := conf.StringDefault("locker.type", conf.StringDefault("datastore.type", locker.LOCKER_INMEMORY))
-	locker, err := e.createLocker(ltype)
+	l, err := e.createLocker(ltype)
 	if err != nil {
 		return err
 	}
-	e.locker = locker
+	e.locker = l
+	e.elector = locker.NewLeaderElector(l,
+		locker.WithLeaseRenewInterval(conf.DurationDefault("locker.leader.renew", locker.DefaultLeaseRenewInterval)),
+	)
 	return nil
 }
 
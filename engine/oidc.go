@@ -0,0 +1,253 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/internal/jwt"
+)
+
+const (
+	// oidcKeysTTL is how long the issuer's signing keys
+	// are cached before they're fetched again.
+	oidcKeysTTL = time.Hour
+	// oidcKeysMinRefresh throttles refetching the keys when
+	// a token is signed by a key we don't know about yet.
+	oidcKeysMinRefresh = time.Minute
+)
+
+type oidcConfig struct {
+	issuer        string
+	clientID      string
+	usernameClaim string
+	groupsClaim   string
+	// groupRoles maps a group name to a role slug. Roles
+	// are only synced from groups when it's configured.
+	groupRoles map[string]string
+}
+
+// oidcProvider validates ID tokens issued by an OpenID Connect
+// provider and provisions the users they identify.
+type oidcProvider struct {
+	cfg       oidcConfig
+	client    *http.Client
+	jwksURI   string
+	mu        sync.Mutex
+	keys      *jwt.KeySet
+	fetchedAt time.Time
+}
+
+func newOIDCProvider(cfg oidcConfig) (*oidcProvider, error) {
+	if cfg.issuer == "" {
+		return nil, errors.New("must provide OIDC issuer")
+	}
+	if cfg.usernameClaim == "" {
+		cfg.usernameClaim = "sub"
+	}
+	p := &oidcProvider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: time.Second * 10},
+	}
+	discovery := struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}{}
+	url := strings.TrimSuffix(cfg.issuer, "/") + "/.well-known/openid-configuration"
+	body, err := p.get(url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error discovering OIDC provider %s", cfg.issuer)
+	}
+	if err := json.Unmarshal(body, &discovery); err != nil {
+		return nil, errors.Wrapf(err, "error discovering OIDC provider %s", cfg.issuer)
+	}
+	if discovery.Issuer != cfg.issuer {
+		return nil, errors.Errorf("OIDC provider reported issuer %s, expected %s", discovery.Issuer, cfg.issuer)
+	}
+	if discovery.JWKSURI == "" {
+		return nil, errors.Errorf("OIDC provider %s has no jwks_uri", cfg.issuer)
+	}
+	p.jwksURI = discovery.JWKSURI
+	if _, err := p.keySet(false); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *oidcProvider) get(url string) ([]byte, error) {
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("GET %s returned %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (p *oidcProvider) keySet(refresh bool) (*jwt.KeySet, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	age := time.Since(p.fetchedAt)
+	if p.keys != nil && age < oidcKeysTTL && (!refresh || age < oidcKeysMinRefresh) {
+		return p.keys, nil
+	}
+	body, err := p.get(p.jwksURI)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error fetching OIDC keys")
+	}
+	keys, err := jwt.ParseKeySet(body)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.fetchedAt = time.Now()
+	return keys, nil
+}
+
+// verify validates the ID token and returns its claims.
+func (p *oidcProvider) verify(token string) (jwt.Claims, error) {
+	opts := []jwt.VerifyOption{
+		jwt.WithIssuer(p.cfg.issuer),
+		jwt.WithLeeway(time.Minute),
+	}
+	if p.cfg.clientID != "" {
+		opts = append(opts, jwt.WithAudience(p.cfg.clientID))
+	}
+	keys, err := p.keySet(false)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := keys.Verify(token, opts...)
+	if errors.Is(err, jwt.ErrInvalidSignature) {
+		// the provider may have rotated its keys
+		if keys, err = p.keySet(true); err != nil {
+			return nil, err
+		}
+		claims, err = keys.Verify(token, opts...)
+	}
+	return claims, err
+}
+
+// login returns the user linked to the token's issuer and subject,
+// creating it on first login and syncing its roles with the groups
+// it belongs to. An existing user is never taken over by username:
+// unless an admin linked it to the identity, the login is refused.
+func (p *oidcProvider) login(ctx context.Context, ds datastore.Datastore, claims jwt.Claims) (*tork.User, error) {
+	subject := claims.String("sub")
+	if subject == "" {
+		return nil, errors.New("token is missing the sub claim")
+	}
+	u, err := ds.GetUserByIdentity(ctx, p.cfg.issuer, subject)
+	if errors.Is(err, datastore.ErrUserNotFound) {
+		if u, err = p.provision(ctx, ds, subject, claims); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	if u.Disabled {
+		return nil, errors.Errorf("user %s is disabled", u.Username)
+	}
+	if p.cfg.groupsClaim != "" && len(p.cfg.groupRoles) > 0 {
+		if err := p.syncRoles(ctx, ds, u, claims.Strings(p.cfg.groupsClaim)); err != nil {
+			return nil, errors.Wrapf(err, "error syncing roles of user %s", u.Username)
+		}
+	}
+	return u, nil
+}
+
+// provision creates the user for an identity seen for the first time.
+func (p *oidcProvider) provision(ctx context.Context, ds datastore.Datastore, subject string, claims jwt.Claims) (*tork.User, error) {
+	username := claims.String(p.cfg.usernameClaim)
+	if username == "" {
+		return nil, errors.Errorf("token is missing the %s claim", p.cfg.usernameClaim)
+	}
+	if _, err := ds.GetUser(ctx, username); err == nil {
+		return nil, errors.Errorf("user %s already exists and is not linked to %s", username, p.cfg.issuer)
+	} else if !errors.Is(err, datastore.ErrUserNotFound) {
+		return nil, err
+	}
+	name := claims.String("name")
+	if name == "" {
+		name = username
+	}
+	u := &tork.User{
+		Username: username,
+		Name:     name,
+	}
+	if err := ds.WithTx(ctx, func(tx datastore.Datastore) error {
+		if err := tx.CreateUser(ctx, u); err != nil {
+			return err
+		}
+		return tx.CreateUserIdentity(ctx, &tork.UserIdentity{
+			UserID:  u.ID,
+			Issuer:  p.cfg.issuer,
+			Subject: subject,
+		})
+	}); err != nil {
+		return nil, err
+	}
+	log.Info().Msgf("provisioned user %s from %s", username, p.cfg.issuer)
+	return u, nil
+}
+
+// syncRoles assigns the roles which the configured mapping maps the
+// user's groups to, and takes away the mapped roles the user no longer
+// qualifies for. Roles the mapping doesn't mention are left untouched.
+func (p *oidcProvider) syncRoles(ctx context.Context, ds datastore.Datastore, u *tork.User, groups []string) error {
+	wanted := make(map[string]bool)
+	for _, g := range groups {
+		if slug, ok := p.cfg.groupRoles[g]; ok {
+			wanted[slug] = true
+		}
+	}
+	current, err := ds.GetUserRoles(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	has := make(map[string]bool)
+	for _, r := range current {
+		has[r.Slug] = true
+		if wanted[r.Slug] || !p.mapsTo(r.Slug) {
+			continue
+		}
+		if err := ds.UnassignRole(ctx, u.ID, r.ID); err != nil {
+			return err
+		}
+	}
+	for slug := range wanted {
+		if has[slug] {
+			continue
+		}
+		r, err := ds.GetRole(ctx, slug)
+		if errors.Is(err, datastore.ErrRoleNotFound) {
+			log.Debug().Msgf("role %s mapped from the groups of user %s does not exist", slug, u.Username)
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := ds.AssignRole(ctx, u.ID, r.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *oidcProvider) mapsTo(slug string) bool {
+	for _, s := range p.cfg.groupRoles {
+		if s == slug {
+			return true
+		}
+	}
+	return false
+}
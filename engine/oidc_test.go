@@ -0,0 +1,214 @@
+package engine
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore/postgres"
+	"github.com/runabol/tork/internal/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockIssuer is a minimal OpenID Connect provider which
+// publishes its discovery document and signing key.
+type mockIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	m := &mockIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   m.URL,
+			"jwks_uri": m.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"keys":[{"kty":"RSA","kid":"k1","use":"sig","n":"%s","e":"%s"}]}`,
+			base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()))
+	})
+	m.Server = httptest.NewServer(mux)
+	return m
+}
+
+func (m *mockIssuer) idToken(t *testing.T, claims map[string]any) string {
+	enc := func(v any) string {
+		b, err := json.Marshal(v)
+		assert.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := enc(map[string]string{"alg": "RS256", "kid": "k1"}) + "." + enc(claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, digest[:])
+	assert.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func Test_oidcVerify(t *testing.T) {
+	m := newMockIssuer(t)
+	defer m.Close()
+
+	p, err := newOIDCProvider(oidcConfig{issuer: m.URL, clientID: "tork"})
+	assert.NoError(t, err)
+
+	claims, err := p.verify(m.idToken(t, map[string]any{
+		"iss": m.URL,
+		"aud": "tork",
+		"sub": "jdoe",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "jdoe", claims.String("sub"))
+
+	_, err = p.verify(m.idToken(t, map[string]any{
+		"iss": m.URL,
+		"aud": "other-client",
+		"sub": "jdoe",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}))
+	assert.Error(t, err)
+
+	_, err = newOIDCProvider(oidcConfig{issuer: m.URL + "/other"})
+	assert.Error(t, err)
+}
+
+func Test_oidcLogin(t *testing.T) {
+	ctx := context.Background()
+	m := newMockIssuer(t)
+	defer m.Close()
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	devs := &tork.Role{Slug: "developers", Name: "Developers"}
+	assert.NoError(t, ds.CreateRole(ctx, devs))
+
+	p, err := newOIDCProvider(oidcConfig{
+		issuer:        m.URL,
+		usernameClaim: "preferred_username",
+		groupsClaim:   "groups",
+		groupRoles:    map[string]string{"eng": "developers"},
+	})
+	assert.NoError(t, err)
+
+	username := uuid.NewShortUUID()
+	subject := uuid.NewUUID()
+	u, err := p.login(ctx, ds, map[string]any{
+		"sub":                subject,
+		"preferred_username": username,
+		"name":               "John Doe",
+		"groups":             []any{"eng", "sales"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "John Doe", u.Name)
+	roles, err := ds.GetUserRoles(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Len(t, roles, 1)
+	assert.Equal(t, "developers", roles[0].Slug)
+
+	// leaving the group revokes the role
+	u2, err := p.login(ctx, ds, map[string]any{
+		"sub":                subject,
+		"preferred_username": username,
+		"groups":             []any{"sales"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, u.ID, u2.ID)
+	roles, err = ds.GetUserRoles(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Len(t, roles, 0)
+
+	assert.NoError(t, ds.Close())
+}
+
+func Test_oidcLoginExistingUser(t *testing.T) {
+	ctx := context.Background()
+	m := newMockIssuer(t)
+	defer m.Close()
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	p, err := newOIDCProvider(oidcConfig{issuer: m.URL, usernameClaim: "preferred_username"})
+	assert.NoError(t, err)
+
+	existing := &tork.User{Username: uuid.NewShortUUID(), Name: "Jane Doe"}
+	assert.NoError(t, ds.CreateUser(ctx, existing))
+
+	// an identity bearing the username of an existing user can't take it over
+	subject := uuid.NewUUID()
+	claims := map[string]any{
+		"sub":                subject,
+		"preferred_username": existing.Username,
+	}
+	_, err = p.login(ctx, ds, claims)
+	assert.Error(t, err)
+
+	// until an admin links it to the user
+	assert.NoError(t, ds.CreateUserIdentity(ctx, &tork.UserIdentity{
+		UserID:  existing.ID,
+		Issuer:  m.URL,
+		Subject: subject,
+	}))
+	u, err := p.login(ctx, ds, claims)
+	assert.NoError(t, err)
+	assert.Equal(t, existing.ID, u.ID)
+
+	// the username claim doesn't matter once linked
+	u, err = p.login(ctx, ds, map[string]any{
+		"sub":                subject,
+		"preferred_username": "renamed-" + existing.Username,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, existing.ID, u.ID)
+
+	_, err = p.login(ctx, ds, map[string]any{"preferred_username": existing.Username})
+	assert.Error(t, err)
+
+	assert.NoError(t, ds.Close())
+}
+
+func Test_oidcLoginNoGroupMapping(t *testing.T) {
+	ctx := context.Background()
+	m := newMockIssuer(t)
+	defer m.Close()
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	p, err := newOIDCProvider(oidcConfig{
+		issuer:        m.URL,
+		usernameClaim: "preferred_username",
+		groupsClaim:   "groups",
+	})
+	assert.NoError(t, err)
+
+	// groups named after roles grant nothing without a mapping
+	u, err := p.login(ctx, ds, map[string]any{
+		"sub":                uuid.NewUUID(),
+		"preferred_username": uuid.NewShortUUID(),
+		"groups":             []any{tork.ROLE_ADMIN},
+	})
+	assert.NoError(t, err)
+	roles, err := ds.GetUserRoles(ctx, u.ID)
+	assert.NoError(t, err)
+	assert.Len(t, roles, 0)
+
+	assert.NoError(t, ds.Close())
+}
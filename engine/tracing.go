@@ -0,0 +1,42 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/runabol/tork/conf"
+	"github.com/runabol/tork/internal/tracing"
+)
+
+// initTracing sets up the export of the spans of the engine, if enabled.
+func (e *Engine) initTracing() error {
+	if !conf.Bool("tracing.enabled") {
+		return nil
+	}
+	shutdown, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    conf.StringDefault("tracing.exporter", tracing.ExporterOTLP),
+		Endpoint:    conf.String("tracing.otlp.endpoint"),
+		ServiceName: conf.StringDefault("tracing.service.name", fmt.Sprintf("tork-%s", e.cfg.Mode)),
+		SampleRatio: conf.Float64Default("tracing.sample.ratio", 1),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error setting up tracing")
+	}
+	e.stopTracing = shutdown
+	return nil
+}
+
+// shutdownTracing exports the spans which are yet to be exported.
+func (e *Engine) shutdownTracing() {
+	if e.stopTracing == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.stopTracing(ctx); err != nil {
+		log.Error().Err(err).Msg("error shutting down tracing")
+	}
+}
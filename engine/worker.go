@@ -2,6 +2,7 @@ package engine
 
 import (
 	"github.com/pkg/errors"
+	"github.com/runabol/tork"
 	"github.com/runabol/tork/conf"
 	"github.com/runabol/tork/internal/worker"
 	"github.com/runabol/tork/middleware/task"
@@ -24,6 +25,14 @@ func (e *Engine) initWorker() error {
 		return err
 	}
 	e.cfg.Middleware.Task = append(e.cfg.Middleware.Task, hostenv.Execute)
+	capacity, err := (&tork.TaskResources{
+		CPUs:   conf.String("worker.capacity.cpus"),
+		Memory: conf.String("worker.capacity.memory"),
+		GPUs:   conf.IntDefault("worker.capacity.gpus", 0),
+	}).Parse()
+	if err != nil {
+		return errors.Wrapf(err, "invalid worker capacity")
+	}
 	w, err := worker.NewWorker(worker.Config{
 		Name:    conf.StringDefault("worker.name", "Worker"),
 		Broker:  e.brokerRef,
@@ -34,8 +43,11 @@ func (e *Engine) initWorker() error {
 			DefaultMemoryLimit: conf.String("worker.limits.memory"),
 			DefaultTimeout:     conf.String("worker.limits.timeout"),
 		},
-		Address:    conf.String("worker.address"),
-		Middleware: e.cfg.Middleware.Task,
+		Address:      conf.String("worker.address"),
+		Middleware:   e.cfg.Middleware.Task,
+		DrainTimeout: conf.DurationDefault("worker.drain.timeout", worker.DefaultDrainTimeout),
+		Labels:       conf.StringMap("worker.labels"),
+		Capacity:     capacity,
 	})
 	if err != nil {
 		return errors.Wrapf(err, "error creating worker")
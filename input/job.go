@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/runabol/tork"
+	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/internal/uuid"
 	"golang.org/x/exp/maps"
 )
@@ -11,6 +12,7 @@ import (
 type Job struct {
 	id          string
 	Name        string            `json:"name,omitempty" yaml:"name,omitempty" validate:"required"`
+	Namespace   string            `json:"namespace,omitempty" yaml:"namespace,omitempty"`
 	Description string            `json:"description,omitempty" yaml:"description,omitempty"`
 	Tags        []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
 	Tasks       []Task            `json:"tasks,omitempty" yaml:"tasks,omitempty" validate:"required,min=1,dive"`
@@ -31,6 +33,7 @@ type Wait struct {
 type ScheduledJob struct {
 	id          string
 	Name        string            `json:"name,omitempty" yaml:"name,omitempty" validate:"required"`
+	Namespace   string            `json:"namespace,omitempty" yaml:"namespace,omitempty"`
 	Description string            `json:"description,omitempty" yaml:"description,omitempty"`
 	Tags        []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
 	Tasks       []Task            `json:"tasks,omitempty" yaml:"tasks,omitempty" validate:"required,min=1,dive"`
@@ -86,6 +89,49 @@ func (ji *ScheduledJob) ID() string {
 	return ji.id
 }
 
+// Queues returns the distinct queues the job's tasks would run on.
+func (ji *Job) Queues() []string {
+	return queues(ji.Tasks, ji.Defaults)
+}
+
+// Queues returns the distinct queues the scheduled
+// job's tasks would run on.
+func (ji *ScheduledJob) Queues() []string {
+	return queues(ji.Tasks, ji.Defaults)
+}
+
+func queues(tasks []Task, defaults *Defaults) []string {
+	seen := make(map[string]bool)
+	result := make([]string, 0)
+	var visit func(tasks []Task)
+	visit = func(tasks []Task) {
+		for _, t := range tasks {
+			switch {
+			case t.Parallel != nil:
+				visit(t.Parallel.Tasks)
+			case t.Each != nil:
+				visit([]Task{t.Each.Task})
+			case t.SubJob != nil:
+				visit(t.SubJob.Tasks)
+			default:
+				q := t.Queue
+				if q == "" && defaults != nil {
+					q = defaults.Queue
+				}
+				if q == "" {
+					q = broker.QUEUE_DEFAULT
+				}
+				if !seen[q] {
+					seen[q] = true
+					result = append(result, q)
+				}
+			}
+		}
+	}
+	visit(tasks)
+	return result
+}
+
 func (ji *Job) ToJob() *tork.Job {
 	n := time.Now().UTC()
 	j := &tork.Job{}
@@ -95,6 +141,7 @@ func (ji *Job) ToJob() *tork.Job {
 	j.Secrets = ji.Secrets
 	j.Tags = ji.Tags
 	j.Name = ji.Name
+	j.Namespace = ji.Namespace
 	tasks := make([]*tork.Task, len(ji.Tasks))
 	for i, ti := range ji.Tasks {
 		tasks[i] = ti.toTask()
@@ -141,6 +188,7 @@ func (ji *ScheduledJob) ToScheduledJob() *tork.ScheduledJob {
 	j.Secrets = ji.Secrets
 	j.Tags = ji.Tags
 	j.Name = ji.Name
+	j.Namespace = ji.Namespace
 	tasks := make([]*tork.Task, len(ji.Tasks))
 	for i, ti := range ji.Tasks {
 		tasks[i] = ti.toTask()
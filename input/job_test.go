@@ -0,0 +1,31 @@
+package input
+
+import (
+	"testing"
+
+	"github.com/runabol/tork/broker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobQueues(t *testing.T) {
+	j := Job{
+		Tasks: []Task{
+			{Name: "a"},
+			{Name: "b", Queue: "gpu"},
+			{
+				Name: "c",
+				Parallel: &Parallel{
+					Tasks: []Task{{Name: "c1", Queue: "gpu"}, {Name: "c2", Queue: "io"}},
+				},
+			},
+			{
+				Name: "d",
+				Each: &Each{Task: Task{Name: "d1", Queue: "batch"}},
+			},
+		},
+	}
+	assert.Equal(t, []string{broker.QUEUE_DEFAULT, "gpu", "io", "batch"}, j.Queues())
+
+	j.Defaults = &Defaults{Queue: "fallback"}
+	assert.Equal(t, []string{"fallback", "gpu", "io", "batch"}, j.Queues())
+}
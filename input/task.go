@@ -6,32 +6,34 @@ import (
 )
 
 type Task struct {
-	Name        string            `json:"name,omitempty" yaml:"name,omitempty" validate:"required"`
-	Description string            `json:"description,omitempty" yaml:"description,omitempty"`
-	CMD         []string          `json:"cmd,omitempty" yaml:"cmd,omitempty"`
-	Entrypoint  []string          `json:"entrypoint,omitempty" yaml:"entrypoint,omitempty"`
-	Run         string            `json:"run,omitempty" yaml:"run,omitempty"`
-	Image       string            `json:"image,omitempty" yaml:"image,omitempty"`
-	Registry    *Registry         `json:"registry,omitempty" yaml:"registry,omitempty"`
-	Env         map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
-	Files       map[string]string `json:"files,omitempty" yaml:"files,omitempty"`
-	Queue       string            `json:"queue,omitempty" yaml:"queue,omitempty" validate:"queue"`
-	Pre         []AuxTask         `json:"pre,omitempty" yaml:"pre,omitempty" validate:"dive"`
-	Post        []AuxTask         `json:"post,omitempty" yaml:"post,omitempty" validate:"dive"`
-	Mounts      []Mount           `json:"mounts,omitempty" yaml:"mounts,omitempty" validate:"dive"`
-	Networks    []string          `json:"networks,omitempty" yaml:"networks,omitempty"`
-	Retry       *Retry            `json:"retry,omitempty" yaml:"retry,omitempty"`
-	Limits      *Limits           `json:"limits,omitempty" yaml:"limits,omitempty"`
-	Timeout     string            `json:"timeout,omitempty" yaml:"timeout,omitempty" validate:"duration"`
-	Var         string            `json:"var,omitempty" yaml:"var,omitempty" validate:"max=64"`
-	If          string            `json:"if,omitempty" yaml:"if,omitempty" validate:"expr"`
-	Parallel    *Parallel         `json:"parallel,omitempty" yaml:"parallel,omitempty"`
-	Each        *Each             `json:"each,omitempty" yaml:"each,omitempty"`
-	SubJob      *SubJob           `json:"subjob,omitempty" yaml:"subjob,omitempty"`
-	GPUs        string            `json:"gpus,omitempty" yaml:"gpus,omitempty"`
-	Tags        []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
-	Workdir     string            `json:"workdir,omitempty" yaml:"workdir,omitempty" validate:"max=256"`
-	Priority    int               `json:"priority,omitempty" yaml:"priority,omitempty" validate:"min=0,max=9"`
+	Name         string            `json:"name,omitempty" yaml:"name,omitempty" validate:"required"`
+	Description  string            `json:"description,omitempty" yaml:"description,omitempty"`
+	CMD          []string          `json:"cmd,omitempty" yaml:"cmd,omitempty"`
+	Entrypoint   []string          `json:"entrypoint,omitempty" yaml:"entrypoint,omitempty"`
+	Run          string            `json:"run,omitempty" yaml:"run,omitempty"`
+	Image        string            `json:"image,omitempty" yaml:"image,omitempty"`
+	Registry     *Registry         `json:"registry,omitempty" yaml:"registry,omitempty"`
+	Env          map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+	Files        map[string]string `json:"files,omitempty" yaml:"files,omitempty"`
+	Queue        string            `json:"queue,omitempty" yaml:"queue,omitempty" validate:"queue"`
+	Pre          []AuxTask         `json:"pre,omitempty" yaml:"pre,omitempty" validate:"dive"`
+	Post         []AuxTask         `json:"post,omitempty" yaml:"post,omitempty" validate:"dive"`
+	Mounts       []Mount           `json:"mounts,omitempty" yaml:"mounts,omitempty" validate:"dive"`
+	Networks     []string          `json:"networks,omitempty" yaml:"networks,omitempty"`
+	Retry        *Retry            `json:"retry,omitempty" yaml:"retry,omitempty"`
+	Limits       *Limits           `json:"limits,omitempty" yaml:"limits,omitempty"`
+	Timeout      string            `json:"timeout,omitempty" yaml:"timeout,omitempty" validate:"duration"`
+	Var          string            `json:"var,omitempty" yaml:"var,omitempty" validate:"max=64"`
+	If           string            `json:"if,omitempty" yaml:"if,omitempty" validate:"expr"`
+	Parallel     *Parallel         `json:"parallel,omitempty" yaml:"parallel,omitempty"`
+	Each         *Each             `json:"each,omitempty" yaml:"each,omitempty"`
+	SubJob       *SubJob           `json:"subjob,omitempty" yaml:"subjob,omitempty"`
+	GPUs         string            `json:"gpus,omitempty" yaml:"gpus,omitempty"`
+	Tags         []string          `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Workdir      string            `json:"workdir,omitempty" yaml:"workdir,omitempty" validate:"max=256"`
+	Priority     int               `json:"priority,omitempty" yaml:"priority,omitempty" validate:"min=0,max=9"`
+	NodeSelector map[string]string `json:"nodeSelector,omitempty" yaml:"nodeSelector,omitempty"`
+	Resources    *Resources        `json:"resources,omitempty" yaml:"resources,omitempty"`
 }
 
 type SubJob struct {
@@ -67,6 +69,12 @@ type Limits struct {
 	Memory string `json:"memory,omitempty" yaml:"memory,omitempty"`
 }
 
+type Resources struct {
+	CPUs   string `json:"cpus,omitempty" yaml:"cpus,omitempty" validate:"cpus"`
+	Memory string `json:"memory,omitempty" yaml:"memory,omitempty" validate:"memory"`
+	GPUs   int    `json:"gpus,omitempty" yaml:"gpus,omitempty" validate:"min=0"`
+}
+
 type Registry struct {
 	Username string `json:"username,omitempty" yaml:"username,omitempty"`
 	Password string `json:"password,omitempty" yaml:"password,omitempty"`
@@ -132,6 +140,10 @@ func (i Task) toTask() *tork.Task {
 	if i.Limits != nil {
 		limits = i.Limits.toTaskLimits()
 	}
+	var resources *tork.TaskResources
+	if i.Resources != nil {
+		resources = i.Resources.toTaskResources()
+	}
 	var each *tork.EachTask
 	if i.Each != nil {
 		each = &tork.EachTask{
@@ -177,32 +189,34 @@ func (i Task) toTask() *tork.Task {
 		}
 	}
 	return &tork.Task{
-		Name:        i.Name,
-		Description: i.Description,
-		CMD:         i.CMD,
-		Entrypoint:  i.Entrypoint,
-		Run:         i.Run,
-		Image:       i.Image,
-		Registry:    registry,
-		Env:         i.Env,
-		Files:       i.Files,
-		Queue:       i.Queue,
-		Pre:         pre,
-		Post:        post,
-		Mounts:      toMounts(i.Mounts),
-		Networks:    i.Networks,
-		Retry:       retry,
-		Limits:      limits,
-		Timeout:     i.Timeout,
-		Var:         i.Var,
-		If:          i.If,
-		Parallel:    parallel,
-		Each:        each,
-		SubJob:      subjob,
-		GPUs:        i.GPUs,
-		Tags:        i.Tags,
-		Workdir:     i.Workdir,
-		Priority:    i.Priority,
+		Name:         i.Name,
+		Description:  i.Description,
+		CMD:          i.CMD,
+		Entrypoint:   i.Entrypoint,
+		Run:          i.Run,
+		Image:        i.Image,
+		Registry:     registry,
+		Env:          i.Env,
+		Files:        i.Files,
+		Queue:        i.Queue,
+		Pre:          pre,
+		Post:         post,
+		Mounts:       toMounts(i.Mounts),
+		Networks:     i.Networks,
+		Retry:        retry,
+		Limits:       limits,
+		Timeout:      i.Timeout,
+		Var:          i.Var,
+		If:           i.If,
+		Parallel:     parallel,
+		Each:         each,
+		SubJob:       subjob,
+		GPUs:         i.GPUs,
+		Tags:         i.Tags,
+		Workdir:      i.Workdir,
+		Priority:     i.Priority,
+		NodeSelector: maps.Clone(i.NodeSelector),
+		Resources:    resources,
 	}
 }
 
@@ -237,6 +251,14 @@ func (l *Limits) toTaskLimits() *tork.TaskLimits {
 	}
 }
 
+func (r *Resources) toTaskResources() *tork.TaskResources {
+	return &tork.TaskResources{
+		CPUs:   r.CPUs,
+		Memory: r.Memory,
+		GPUs:   r.GPUs,
+	}
+}
+
 func (r *Retry) toTaskRetry() *tork.TaskRetry {
 	return &tork.TaskRetry{
 		Limit: r.Limit,
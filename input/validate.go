@@ -29,6 +29,12 @@ func (ji Job) Validate(ds datastore.Datastore) error {
 	if err := validate.RegisterValidation("expr", validateExpr); err != nil {
 		return err
 	}
+	if err := validate.RegisterValidation("cpus", validateCPUs); err != nil {
+		return err
+	}
+	if err := validate.RegisterValidation("memory", validateMemory); err != nil {
+		return err
+	}
 	validate.RegisterStructValidation(validateMount, Mount{})
 	validate.RegisterStructValidation(taskInputValidation, Task{})
 	validate.RegisterStructValidation(validatePermission(ds), Permission{})
@@ -46,6 +52,12 @@ func (ji ScheduledJob) Validate(ds datastore.Datastore) error {
 	if err := validate.RegisterValidation("expr", validateExpr); err != nil {
 		return err
 	}
+	if err := validate.RegisterValidation("cpus", validateCPUs); err != nil {
+		return err
+	}
+	if err := validate.RegisterValidation("memory", validateMemory); err != nil {
+		return err
+	}
 	validate.RegisterStructValidation(validateMount, Mount{})
 	validate.RegisterStructValidation(taskInputValidation, Task{})
 	validate.RegisterStructValidation(validatePermission(ds), Permission{})
@@ -116,6 +128,24 @@ func validateDuration(fl validator.FieldLevel) bool {
 	return err == nil
 }
 
+func validateCPUs(fl validator.FieldLevel) bool {
+	v := fl.Field().String()
+	if v == "" {
+		return true
+	}
+	_, err := (&tork.TaskResources{CPUs: v}).Parse()
+	return err == nil
+}
+
+func validateMemory(fl validator.FieldLevel) bool {
+	v := fl.Field().String()
+	if v == "" {
+		return true
+	}
+	_, err := (&tork.TaskResources{Memory: v}).Parse()
+	return err == nil
+}
+
 func validateQueue(fl validator.FieldLevel) bool {
 	v := fl.Field().String()
 	if v == "" {
@@ -196,4 +226,10 @@ func compositeTaskValidation(sl validator.StructLevel) {
 	if t.Timeout != "" {
 		sl.ReportError(t.Timeout, "timeout", "Timeout", "invalidcompositetask", "")
 	}
+	if len(t.NodeSelector) > 0 {
+		sl.ReportError(t.NodeSelector, "nodeSelector", "NodeSelector", "invalidcompositetask", "")
+	}
+	if t.Resources != nil {
+		sl.ReportError(t.Resources, "resources", "Resources", "invalidcompositetask", "")
+	}
 }
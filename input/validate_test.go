@@ -727,3 +727,39 @@ func TestValidateCron(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateJobTaskResources(t *testing.T) {
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	j := Job{
+		Name: "test job",
+		Tasks: []Task{
+			{
+				Name:         "some task",
+				Image:        "some:image",
+				NodeSelector: map[string]string{"gpu": "a100"},
+				Resources: &Resources{
+					CPUs:   "1.5",
+					Memory: "512m",
+					GPUs:   1,
+				},
+			},
+		},
+	}
+	err = j.Validate(ds)
+	assert.NoError(t, err)
+
+	j.Tasks[0].Resources.CPUs = "lots"
+	err = j.Validate(ds)
+	assert.Error(t, err)
+	errs := err.(validator.ValidationErrors)
+	assert.Equal(t, "CPUs", errs[0].Field())
+
+	j.Tasks[0].Resources.CPUs = "2"
+	j.Tasks[0].Resources.Memory = "1zb"
+	err = j.Validate(ds)
+	assert.Error(t, err)
+	errs = err.(validator.ValidationErrors)
+	assert.Equal(t, "Memory", errs[0].Field())
+	assert.NoError(t, ds.Close())
+}
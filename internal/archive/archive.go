@@ -0,0 +1,116 @@
+// Package archive exports jobs, along with their tasks and logs, as
+// gzip compressed NDJSON to a directory or an object store before
+// they are deleted.
+package archive
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/runabol/tork"
+)
+
+const (
+	RecordTypeJob  = "job"
+	RecordTypeTask = "task"
+	RecordTypeLog  = "log"
+)
+
+// Record is a line of an archive.
+type Record struct {
+	Type string            `json:"type"`
+	Job  *tork.Job         `json:"job,omitempty"`
+	Task *tork.Task        `json:"task,omitempty"`
+	Log  *tork.TaskLogPart `json:"log,omitempty"`
+}
+
+// Store keeps archives.
+type Store interface {
+	Put(ctx context.Context, name string, r io.ReadSeeker) error
+}
+
+// Redacter redacts the secrets of jobs and of their tasks.
+type Redacter interface {
+	RedactJob(j *tork.Job)
+	RedactJobTask(j *tork.Job, t *tork.Task)
+}
+
+type Archiver struct {
+	store    Store
+	redacter Redacter
+}
+
+// NewArchiver creates an archiver which keeps archives in the store.
+// Unless the redacter is nil, the secrets of jobs are redacted from
+// archives just like they are from the API.
+func NewArchiver(store Store, redacter Redacter) *Archiver {
+	return &Archiver{
+		store:    store,
+		redacter: redacter,
+	}
+}
+
+// Writer writes the records of an archive.
+type Writer struct {
+	enc      *json.Encoder
+	redacter Redacter
+}
+
+// Archive creates the named archive out of the records written by
+// write. The archive is only stored once write succeeds.
+func (a *Archiver) Archive(ctx context.Context, name string, write func(w *Writer) error) error {
+	f, err := os.CreateTemp("", "tork-archive-*")
+	if err != nil {
+		return errors.Wrapf(err, "error creating archive file")
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+	gz := gzip.NewWriter(f)
+	if err := write(&Writer{enc: json.NewEncoder(gz), redacter: a.redacter}); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return errors.Wrapf(err, "error writing archive %s", name)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrapf(err, "error reading archive %s", name)
+	}
+	if err := a.store.Put(ctx, name, f); err != nil {
+		return errors.Wrapf(err, "error storing archive %s", name)
+	}
+	return nil
+}
+
+// WriteJob writes the job followed by its tasks.
+func (w *Writer) WriteJob(j *tork.Job, tasks []*tork.Task) error {
+	if w.redacter != nil {
+		// the tasks first, while the secrets
+		// of the job are still at hand
+		for _, t := range tasks {
+			w.redacter.RedactJobTask(j, t)
+		}
+		w.redacter.RedactJob(j)
+	}
+	if err := w.enc.Encode(Record{Type: RecordTypeJob, Job: j}); err != nil {
+		return errors.Wrapf(err, "error writing job %s to archive", j.ID)
+	}
+	for _, t := range tasks {
+		if err := w.enc.Encode(Record{Type: RecordTypeTask, Task: t}); err != nil {
+			return errors.Wrapf(err, "error writing task %s to archive", t.ID)
+		}
+	}
+	return nil
+}
+
+func (w *Writer) WriteLogPart(p *tork.TaskLogPart) error {
+	if err := w.enc.Encode(Record{Type: RecordTypeLog, Log: p}); err != nil {
+		return errors.Wrapf(err, "error writing log part %s to archive", p.ID)
+	}
+	return nil
+}
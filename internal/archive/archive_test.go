@@ -0,0 +1,78 @@
+package archive_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/internal/archive"
+	"github.com/runabol/tork/internal/redact"
+	"github.com/stretchr/testify/assert"
+)
+
+func readArchive(t *testing.T, fname string) []archive.Record {
+	f, err := os.Open(fname)
+	assert.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	records := make([]archive.Record, 0)
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		r := archive.Record{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		records = append(records, r)
+	}
+	assert.NoError(t, scanner.Err())
+	return records
+}
+
+func TestArchive(t *testing.T) {
+	dir := t.TempDir()
+	a := archive.NewArchiver(archive.NewDirStore(dir), redact.NewRedacter(nil))
+	j := &tork.Job{
+		ID:      "j1",
+		Secrets: map[string]string{"token": "s3cr3t"},
+	}
+	tasks := []*tork.Task{{
+		ID:    "t1",
+		JobID: "j1",
+		Env:   map[string]string{"TOKEN": "s3cr3t", "NAME": "value"},
+	}}
+	err := a.Archive(context.Background(), "jobs-1.ndjson.gz", func(w *archive.Writer) error {
+		if err := w.WriteJob(j, tasks); err != nil {
+			return err
+		}
+		return w.WriteLogPart(&tork.TaskLogPart{ID: "l1", TaskID: "t1", Number: 1, Contents: "hello"})
+	})
+	assert.NoError(t, err)
+
+	records := readArchive(t, filepath.Join(dir, "jobs-1.ndjson.gz"))
+	assert.Len(t, records, 3)
+	assert.Equal(t, archive.RecordTypeJob, records[0].Type)
+	assert.Equal(t, "j1", records[0].Job.ID)
+	assert.Equal(t, "[REDACTED]", records[0].Job.Secrets["token"])
+	assert.Equal(t, archive.RecordTypeTask, records[1].Type)
+	assert.Equal(t, "[REDACTED]", records[1].Task.Env["TOKEN"])
+	assert.Equal(t, "value", records[1].Task.Env["NAME"])
+	assert.Equal(t, archive.RecordTypeLog, records[2].Type)
+	assert.Equal(t, "hello", records[2].Log.Contents)
+}
+
+func TestArchiveWriteError(t *testing.T) {
+	dir := t.TempDir()
+	a := archive.NewArchiver(archive.NewDirStore(dir), nil)
+	err := a.Archive(context.Background(), "jobs-1.ndjson.gz", func(w *archive.Writer) error {
+		return errors.New("something happened")
+	})
+	assert.Error(t, err)
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
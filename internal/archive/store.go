@@ -0,0 +1,126 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/pkg/errors"
+)
+
+// DirStore keeps archives as the files of a directory.
+type DirStore struct {
+	dir string
+}
+
+func NewDirStore(dir string) *DirStore {
+	return &DirStore{dir: dir}
+}
+
+func (s *DirStore) Put(_ context.Context, name string, r io.ReadSeeker) error {
+	if !filepath.IsLocal(name) {
+		return errors.Errorf("invalid archive name: %s", name)
+	}
+	fname := filepath.Join(s.dir, name)
+	if err := os.MkdirAll(filepath.Dir(fname), 0o755); err != nil {
+		return errors.Wrapf(err, "error creating archive directory")
+	}
+	// write to a temporary file first, so that a
+	// partial archive is never mistaken for a whole one
+	tmp, err := os.CreateTemp(filepath.Dir(fname), ".tork-archive-*")
+	if err != nil {
+		return errors.Wrapf(err, "error creating archive file")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "error writing archive file")
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "error writing archive file")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "error writing archive file")
+	}
+	if err := os.Rename(tmp.Name(), fname); err != nil {
+		return errors.Wrapf(err, "error writing archive file")
+	}
+	return nil
+}
+
+// S3Config configures an S3Store. The Endpoint defaults to that of
+// AWS S3 in the region: set it to the URL of other S3 compatible
+// stores, e.g. MinIO. The Prefix is prepended to the names of
+// archives.
+type S3Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// S3Store keeps archives as the objects of a bucket of
+// AWS S3 or of another S3 compatible object store.
+type S3Store struct {
+	cfg    S3Config
+	client *minio.Client
+}
+
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("missing S3 bucket")
+	}
+	if cfg.Region == "" {
+		return nil, errors.New("missing S3 region")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("missing S3 credentials")
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", cfg.Region)
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, errors.Errorf("invalid S3 endpoint: %s", cfg.Endpoint)
+	}
+	cfg.Prefix = strings.Trim(cfg.Prefix, "/")
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, cfg.SessionToken),
+		Secure: endpoint.Scheme == "https",
+		Region: cfg.Region,
+		// path-style requests are supported by every S3 compatible store
+		BucketLookup: minio.BucketLookupPath,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating S3 client")
+	}
+	return &S3Store{cfg: cfg, client: client}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, name string, r io.ReadSeeker) error {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return errors.Wrapf(err, "error reading archive")
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrapf(err, "error reading archive")
+	}
+	key := path.Join(s.cfg.Prefix, name)
+	if _, err := s.client.PutObject(ctx, s.cfg.Bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: "application/gzip",
+	}); err != nil {
+		return errors.Wrapf(err, "error uploading %s to S3", key)
+	}
+	return nil
+}
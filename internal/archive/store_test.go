@@ -0,0 +1,81 @@
+package archive
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS3StorePut(t *testing.T) {
+	var got []byte
+	var gotPath, gotType, gotLength string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/"))
+		gotPath = r.URL.Path
+		gotType = r.Header.Get("Content-Type")
+		// the payload is signed chunk by chunk over plain HTTP
+		gotLength = r.Header.Get("X-Amz-Decoded-Content-Length")
+		b, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		got = b
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+	}))
+	defer srv.Close()
+	s, err := NewS3Store(S3Config{
+		Endpoint:        srv.URL,
+		Region:          "us-east-1",
+		Bucket:          "archives",
+		Prefix:          "/tork/",
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, s.Put(context.Background(), "jobs-1.ndjson.gz", strings.NewReader("some archive")))
+	assert.Equal(t, "/archives/tork/jobs-1.ndjson.gz", gotPath)
+	assert.Equal(t, "application/gzip", gotType)
+	assert.Equal(t, "12", gotLength)
+	assert.Contains(t, string(got), "\r\nsome archive\r\n")
+
+	_, err = NewS3Store(S3Config{Region: "us-east-1", AccessKeyID: "key", SecretAccessKey: "secret"})
+	assert.Error(t, err)
+}
+
+func TestS3StorePutError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("<Error><Code>AccessDenied</Code></Error>"))
+	}))
+	defer srv.Close()
+	s, err := NewS3Store(S3Config{
+		Endpoint:        srv.URL,
+		Region:          "us-east-1",
+		Bucket:          "archives",
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+	})
+	assert.NoError(t, err)
+	err = s.Put(context.Background(), "jobs-1.ndjson.gz", strings.NewReader("some archive"))
+	assert.ErrorContains(t, err, "Access Denied")
+}
+
+func TestDirStorePut(t *testing.T) {
+	dir := t.TempDir()
+	s := NewDirStore(filepath.Join(dir, "archives"))
+	assert.NoError(t, s.Put(context.Background(), "jobs-1.ndjson.gz", strings.NewReader("some archive")))
+	b, err := os.ReadFile(filepath.Join(dir, "archives", "jobs-1.ndjson.gz"))
+	assert.NoError(t, err)
+	assert.Equal(t, "some archive", string(b))
+	entries, err := os.ReadDir(filepath.Join(dir, "archives"))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	assert.Error(t, s.Put(context.Background(), "../escape", strings.NewReader("some archive")))
+}
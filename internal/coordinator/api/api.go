@@ -2,9 +2,12 @@ package api
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"slices"
 	"strconv"
 	"syscall"
 	"time"
@@ -14,32 +17,49 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
 
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/datastore/search"
 	"github.com/runabol/tork/health"
 
 	"github.com/runabol/tork/input"
 	"github.com/runabol/tork/internal/hash"
 	"github.com/runabol/tork/internal/httpx"
+	"github.com/runabol/tork/internal/metrics"
+	"github.com/runabol/tork/internal/secrets"
+	"github.com/runabol/tork/internal/tracing"
+	"github.com/runabol/tork/internal/wildcard"
 	"github.com/runabol/tork/middleware/job"
 	"github.com/runabol/tork/middleware/task"
 	"github.com/runabol/tork/middleware/web"
 
 	"github.com/runabol/tork"
 
+	"go.opentelemetry.io/otel/attribute"
 	"gopkg.in/yaml.v3"
 )
 
 const (
-	MIN_PORT          = 8000
-	MAX_PORT          = 8100
-	MAX_LOG_PAGE_SIZE = 100
+	MIN_PORT           = 8000
+	MAX_PORT           = 8100
+	MAX_LOG_PAGE_SIZE  = 100
+	MAX_JOB_PAGE_SIZE  = 100
+	MAX_TASK_PAGE_SIZE = 100
+	// pages of jobs past this offset must be
+	// reached by following the cursors of pages
+	MAX_JOB_PAGE_OFFSET = 10_000
 )
 
 type HealthResponse struct {
-	Status string `json:"status"`
+	Status  string `json:"status"`
+	Version string `json:"version"`
+	// Leader is the ID of the coordinator
+	// which currently leads the cluster
+	Leader string `json:"leader,omitempty"`
 }
 
 type API struct {
@@ -49,6 +69,8 @@ type API struct {
 	terminate  chan any
 	onReadJob  job.HandlerFunc
 	onReadTask task.HandlerFunc
+	secrets    *secrets.Store
+	resolver   *secrets.Resolver
 }
 
 type Config struct {
@@ -58,6 +80,13 @@ type Config struct {
 	Middleware Middleware
 	Endpoints  map[string]web.HandlerFunc
 	Enabled    map[string]bool
+	Secrets    *secrets.Store
+	Resolver   *secrets.Resolver
+	// TrustedProxies lists the IP ranges, in CIDR notation, of the
+	// proxies trusted to report the client's IP address through the
+	// X-Forwarded-For header. When empty, the address of the peer
+	// connected to the API is the client's.
+	TrustedProxies []string
 }
 
 type Middleware struct {
@@ -83,6 +112,12 @@ type Middleware struct {
 func NewAPI(cfg Config) (*API, error) {
 	r := echo.New()
 
+	ipExtractor, err := newIPExtractor(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	r.IPExtractor = ipExtractor
+
 	s := &API{
 		broker: cfg.Broker,
 		server: &http.Server{
@@ -90,6 +125,8 @@ func NewAPI(cfg Config) (*API, error) {
 			Handler: r,
 		},
 		ds:        cfg.DataStore,
+		secrets:   cfg.Secrets,
+		resolver:  cfg.Resolver,
 		terminate: make(chan any),
 		onReadJob: job.ApplyMiddleware(
 			job.NoOpHandlerFunc,
@@ -111,39 +148,98 @@ func NewAPI(cfg Config) (*API, error) {
 		r.Use(m)
 	}
 
+	r.Use(s.audit)
+
 	// built-in endpoints
 	if v, ok := cfg.Enabled["health"]; !ok || v {
 		r.GET("/health", s.health)
 	}
 	if v, ok := cfg.Enabled["tasks"]; !ok || v {
 		r.GET("/tasks/:id", s.getTask)
-		r.GET("/tasks/:id/log", s.getTaskLog)
+		r.GET("/tasks/:id/log", s.getTaskLog, s.require(tork.ACTION_JOB_READ_LOGS))
 	}
 	if v, ok := cfg.Enabled["queues"]; !ok || v {
-		r.GET("/queues", s.listQueues)
+		r.GET("/queues", s.listQueues, s.require(tork.ACTION_QUEUE_READ))
+		r.PUT("/queues/:name/pause", s.pauseQueue, s.requireQueue(tork.ACTION_QUEUE_MANAGE))
+		r.PUT("/queues/:name/resume", s.resumeQueue, s.requireQueue(tork.ACTION_QUEUE_MANAGE))
+		r.DELETE("/queues/:name/messages", s.purgeQueue, s.requireQueue(tork.ACTION_QUEUE_MANAGE))
 	}
 	if v, ok := cfg.Enabled["nodes"]; !ok || v {
-		r.GET("/nodes", s.listActiveNodes)
+		r.GET("/nodes", s.listActiveNodes, s.require(tork.ACTION_NODE_READ))
+		r.GET("/nodes/:id", s.getNode, s.require(tork.ACTION_NODE_READ))
+		r.PUT("/nodes/:id/drain", s.drainNode, s.require(tork.ACTION_NODE_MANAGE))
 	}
 	if v, ok := cfg.Enabled["jobs"]; !ok || v {
-		r.POST("/jobs", s.createJob)
+		r.POST("/jobs", s.createJob, s.require(tork.ACTION_JOB_SUBMIT))
 		r.GET("/jobs/:id", s.getJob)
-		r.GET("/jobs/:id/log", s.getJobLog)
+		r.GET("/jobs/:id/log", s.getJobLog, s.require(tork.ACTION_JOB_READ_LOGS))
+		r.GET("/jobs/:id/tasks", s.getJobTasks)
 		r.GET("/jobs", s.listJobs)
-		r.PUT("/jobs/:id/cancel", s.cancelJob)
-		r.PUT("/jobs/:id/restart", s.restartJob)
+		r.PUT("/jobs/:id/cancel", s.cancelJob, s.require(tork.ACTION_JOB_CANCEL))
+		r.PUT("/jobs/:id/restart", s.restartJob, s.require(tork.ACTION_JOB_RESTART))
+		r.DELETE("/jobs/:id", s.deleteJob, s.require(tork.ACTION_JOB_DELETE))
+		r.POST("/jobs/bulk", s.createBulkOperation)
+		r.GET("/jobs/bulk/:id", s.getBulkOperation)
 
-		r.POST("/scheduled-jobs", s.createScheduledJob)
+		r.POST("/scheduled-jobs", s.createScheduledJob, s.require(tork.ACTION_SCHEDULED_JOB_MANAGE))
 		r.GET("/scheduled-jobs", s.listScheduledJobs)
-		r.PUT("/scheduled-jobs/:id/pause", s.pauseScheduledJob)
-		r.PUT("/scheduled-jobs/:id/resume", s.resumeScheduledJob)
-		r.DELETE("/scheduled-jobs/:id", s.deleteScheduledJob)
+		r.PUT("/scheduled-jobs/:id/pause", s.pauseScheduledJob, s.require(tork.ACTION_SCHEDULED_JOB_MANAGE))
+		r.PUT("/scheduled-jobs/:id/resume", s.resumeScheduledJob, s.require(tork.ACTION_SCHEDULED_JOB_MANAGE))
+		r.DELETE("/scheduled-jobs/:id", s.deleteScheduledJob, s.require(tork.ACTION_SCHEDULED_JOB_MANAGE))
+	}
+	if v, ok := cfg.Enabled["audit"]; !ok || v {
+		r.GET("/audit", s.listAuditEvents, s.require(tork.ACTION_AUDIT_READ))
 	}
 	if v, ok := cfg.Enabled["metrics"]; !ok || v {
-		r.GET("/metrics", s.getMetrics)
+		r.GET("/metrics", s.getMetrics, s.require(tork.ACTION_STATS_READ))
+		r.GET("/metrics/prometheus", s.getPrometheusMetrics, s.require(tork.ACTION_STATS_READ))
+	}
+	if v, ok := cfg.Enabled["stats"]; !ok || v {
+		r.GET("/stats/jobs", s.getJobStats, s.require(tork.ACTION_STATS_READ))
+		r.GET("/stats/tasks", s.getTaskStats, s.require(tork.ACTION_STATS_READ))
 	}
 	if v, ok := cfg.Enabled["users"]; !ok || v {
-		r.POST("/users", s.createUser)
+		r.POST("/users", s.createUser, s.require(tork.ACTION_USER_MANAGE))
+		r.GET("/users/:username", s.getUser, s.require(tork.ACTION_USER_MANAGE))
+		r.PUT("/users/:username", s.updateUser, s.require(tork.ACTION_USER_MANAGE))
+		r.DELETE("/users/:username", s.deleteUser, s.require(tork.ACTION_USER_MANAGE))
+		r.PUT("/users/:username/disable", s.disableUser, s.require(tork.ACTION_USER_MANAGE))
+		r.PUT("/users/:username/enable", s.enableUser, s.require(tork.ACTION_USER_MANAGE))
+		r.PUT("/users/:username/password", s.changePassword)
+		r.GET("/users/:username/tokens", s.listUserTokens)
+		r.POST("/users/:username/tokens", s.createUserToken)
+		r.DELETE("/users/:username/tokens/:id", s.deleteUserToken)
+		r.GET("/users/:username/identities", s.listUserIdentities, s.require(tork.ACTION_USER_MANAGE))
+		r.POST("/users/:username/identities", s.linkUserIdentity, s.require(tork.ACTION_USER_MANAGE))
+		r.DELETE("/users/:username/identities/:id", s.unlinkUserIdentity, s.require(tork.ACTION_USER_MANAGE))
+		r.PUT("/users/:username/roles/:role", s.assignRole, s.require(tork.ACTION_USER_MANAGE))
+		r.DELETE("/users/:username/roles/:role", s.unassignRole, s.require(tork.ACTION_USER_MANAGE))
+
+		r.GET("/roles", s.listRoles, s.require(tork.ACTION_USER_MANAGE))
+		r.POST("/roles", s.createRole, s.require(tork.ACTION_USER_MANAGE))
+		r.DELETE("/roles/:role", s.deleteRole, s.require(tork.ACTION_USER_MANAGE))
+		r.GET("/roles/:role/policies", s.listPolicies, s.require(tork.ACTION_USER_MANAGE))
+		r.POST("/roles/:role/policies", s.createPolicy, s.require(tork.ACTION_USER_MANAGE))
+		r.DELETE("/roles/:role/policies/:id", s.deletePolicy, s.require(tork.ACTION_USER_MANAGE))
+
+		r.GET("/me/permissions", s.getMyPermissions)
+	}
+	if v, ok := cfg.Enabled["namespaces"]; !ok || v {
+		r.GET("/namespaces", s.listNamespaces)
+		r.POST("/namespaces", s.createNamespace, s.require(tork.ACTION_NAMESPACE_MANAGE))
+		r.GET("/namespaces/:name", s.getNamespace)
+		r.PUT("/namespaces/:name", s.updateNamespace, s.require(tork.ACTION_NAMESPACE_MANAGE))
+		r.DELETE("/namespaces/:name", s.deleteNamespace, s.require(tork.ACTION_NAMESPACE_MANAGE))
+		r.PUT("/namespaces/:name/users/:username", s.addNamespaceMember, s.require(tork.ACTION_NAMESPACE_MANAGE))
+		r.DELETE("/namespaces/:name/users/:username", s.removeNamespaceMember, s.require(tork.ACTION_NAMESPACE_MANAGE))
+		r.PUT("/namespaces/:name/roles/:role", s.addNamespaceMember, s.require(tork.ACTION_NAMESPACE_MANAGE))
+		r.DELETE("/namespaces/:name/roles/:role", s.removeNamespaceMember, s.require(tork.ACTION_NAMESPACE_MANAGE))
+	}
+	if v, ok := cfg.Enabled["secrets"]; (!ok || v) && s.secrets != nil {
+		r.GET("/secrets", s.listSecrets)
+		r.POST("/secrets", s.createSecret, s.require(tork.ACTION_SECRET_MANAGE))
+		r.PUT("/secrets/:name", s.updateSecret, s.require(tork.ACTION_SECRET_MANAGE))
+		r.DELETE("/secrets/:name", s.deleteSecret, s.require(tork.ACTION_SECRET_MANAGE))
 	}
 
 	// register additional custom endpoints
@@ -208,11 +304,39 @@ func (s *API) health(c echo.Context) error {
 		WithIndicator(health.ServiceDatastore, s.ds.HealthCheck).
 		WithIndicator(health.ServiceBroker, s.broker.HealthCheck).
 		Do(c.Request().Context())
+	resp := HealthResponse{
+		Status:  result.Status,
+		Version: result.Version,
+	}
 	if result.Status == health.StatusDown {
-		return c.JSON(http.StatusServiceUnavailable, result)
-	} else {
-		return c.JSON(http.StatusOK, result)
+		return c.JSON(http.StatusServiceUnavailable, resp)
+	}
+	leader, err := s.getLeader(c.Request().Context())
+	if err != nil {
+		log.Error().Err(err).Msg("error looking up the cluster leader")
+	} else if leader != nil {
+		resp.Leader = leader.ID
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// getLeader returns the active coordinator node which most
+// recently reported holding the cluster leadership, if any.
+func (s *API) getLeader(ctx context.Context) (*tork.Node, error) {
+	nodes, err := s.ds.GetActiveNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var leader *tork.Node
+	for _, n := range nodes {
+		if !n.Leader || n.Status != tork.NodeStatusUP {
+			continue
+		}
+		if leader == nil || n.LastHeartbeatAt.After(leader.LastHeartbeatAt) {
+			leader = n
+		}
 	}
+	return leader, nil
 }
 
 // listQueues
@@ -229,6 +353,68 @@ func (s *API) listQueues(c echo.Context) error {
 	return c.JSON(http.StatusOK, qs)
 }
 
+// pauseQueue
+// @Summary Pause a queue
+// @Description Workers finish the tasks they are currently
+// @Description executing but don't receive new tasks from the
+// @Description queue until it is resumed.
+// @Tags queues
+// @Produce application/json
+// @Success 200 {string} string "OK"
+// @Failure 400 {object} echo.HTTPError
+// @Router /queues/{name}/pause [put]
+// @Param name path string true "Queue name"
+func (s *API) pauseQueue(c echo.Context) error {
+	qname := c.Param("name")
+	if !broker.IsTaskQueue(qname) {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("queue %s can not be paused", qname))
+	}
+	if err := s.broker.PauseQueue(c.Request().Context(), qname); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+}
+
+// resumeQueue
+// @Summary Resume a paused queue
+// @Tags queues
+// @Produce application/json
+// @Success 200 {string} string "OK"
+// @Failure 400 {object} echo.HTTPError
+// @Router /queues/{name}/resume [put]
+// @Param name path string true "Queue name"
+func (s *API) resumeQueue(c echo.Context) error {
+	qname := c.Param("name")
+	if !broker.IsTaskQueue(qname) {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("queue %s can not be resumed", qname))
+	}
+	if err := s.broker.ResumeQueue(c.Request().Context(), qname); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+}
+
+// purgeQueue
+// @Summary Remove all pending messages from a queue
+// @Tags queues
+// @Produce application/json
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Router /queues/{name}/messages [delete]
+// @Param name path string true "Queue name"
+func (s *API) purgeQueue(c echo.Context) error {
+	qname := c.Param("name")
+	if !broker.IsTaskQueue(qname) {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("queue %s can not be purged", qname))
+	}
+	n, err := s.broker.PurgeQueue(c.Request().Context(), qname)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]any{"status": "OK", "purged": n})
+}
+
 // listActiveNodes
 // @Summary Get a list of active worker nodes
 // @Tags nodes
@@ -243,6 +429,50 @@ func (s *API) listActiveNodes(c echo.Context) error {
 	return c.JSON(http.StatusOK, nodes)
 }
 
+// getNode
+// @Summary Get a node along with the history of its telemetry
+// @Tags nodes
+// @Produce application/json
+// @Success 200 {object} tork.Node
+// @Failure 404 {object} echo.HTTPError
+// @Router /nodes/{id} [get]
+// @Param id path string true "Node ID"
+func (s *API) getNode(c echo.Context) error {
+	id := c.Param("id")
+	n, err := s.ds.GetNodeByID(c.Request().Context(), id)
+	if errors.Is(err, datastore.ErrNodeNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	since := time.Now().UTC().Add(-tork.NODE_HISTORY_DURATION)
+	if n.History, err = s.ds.GetNodeSamples(c.Request().Context(), id, since); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, n)
+}
+
+// drainNode
+// @Summary Drain a worker node
+// @Description The node stops accepting new tasks and shuts down once its in-flight tasks complete
+// @Tags nodes
+// @Produce application/json
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} echo.HTTPError
+// @Router /nodes/{id}/drain [put]
+// @Param id path string true "Node ID"
+func (s *API) drainNode(c echo.Context) error {
+	id := c.Param("id")
+	n, err := s.ds.GetNodeByID(c.Request().Context(), id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err := s.broker.PublishEvent(c.Request().Context(), broker.TOPIC_NODE_DRAIN, n); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+}
+
 // createJob
 // @Summary Create a new job
 // @Tags jobs
@@ -268,6 +498,21 @@ func (s *API) createJob(c echo.Context) error {
 	default:
 		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown content type: %s", contentType))
 	}
+	ji.Namespace = requestNamespace(c, ji.Namespace)
+	ns, err := s.authorizeNamespace(c.Request().Context(), ji.Namespace)
+	if err != nil {
+		return err
+	}
+	applyNamespaceDefaults(ns, &ji.Defaults)
+	if err := s.authorizeQueues(c.Request().Context(), ji.Queues()); err != nil {
+		return err
+	}
+	if err := s.authorizeSecrets(c.Request().Context(), ns.Name, ji.Tasks, ji.Secrets); err != nil {
+		return err
+	}
+	if err := s.checkQuota(c.Request().Context(), ns); err != nil {
+		return err
+	}
 	if ji.Wait != nil { // wait for job to complete before responding
 		timeout, err := time.ParseDuration(ji.Wait.Timeout)
 		if err != nil {
@@ -294,6 +539,7 @@ func (s *API) createJob(c echo.Context) error {
 		if _, err := s.SubmitJob(c.Request().Context(), &ji); err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		}
+		c.Set(auditTargetKey, ji.ID())
 		select {
 		case <-c.Request().Context().Done():
 			return echo.NewHTTPError(http.StatusRequestTimeout, "request cancelled")
@@ -308,16 +554,25 @@ func (s *API) createJob(c echo.Context) error {
 		if j, err := s.SubmitJob(c.Request().Context(), &ji); err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		} else {
+			c.Set(auditTargetKey, j.ID)
 			return c.JSON(http.StatusOK, tork.NewJobSummary(j))
 		}
 	}
 }
 
-func (s *API) SubmitJob(ctx context.Context, ji *input.Job) (*tork.Job, error) {
+func (s *API) SubmitJob(ctx context.Context, ji *input.Job) (j *tork.Job, err error) {
+	ctx, span := tracing.Start(ctx, "api.SubmitJob")
+	defer func() {
+		tracing.End(span, err)
+	}()
 	if err := ji.Validate(s.ds); err != nil {
 		return nil, err
 	}
-	j := ji.ToJob()
+	j = ji.ToJob()
+	span.SetAttributes(attribute.String("tork.job.id", j.ID))
+	if err := secrets.Bind(j); err != nil {
+		return nil, err
+	}
 	currentUser := ctx.Value(tork.USERNAME)
 	if currentUser != nil {
 		cu, ok := currentUser.(string)
@@ -380,6 +635,9 @@ func (s *API) getJob(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusNotFound, err)
 	}
+	if err := s.authorizeJobNamespace(ctx, j.Namespace); err != nil {
+		return err
+	}
 	if err := s.onReadJob(ctx, job.Read, j); err != nil {
 		return err
 	}
@@ -395,6 +653,7 @@ func (s *API) getJob(c echo.Context) error {
 // @Param id path string true "Job ID"
 // @Param page query int false "page number"
 // @Param size query int false "page size"
+// @Param cursor query string false "the nextCursor of the previous page"
 func (s *API) getJobLog(c echo.Context) error {
 	id := c.Param("id")
 	ps := c.QueryParam("page")
@@ -423,26 +682,93 @@ func (s *API) getJobLog(c echo.Context) error {
 	} else if size > MAX_LOG_PAGE_SIZE {
 		size = MAX_LOG_PAGE_SIZE
 	}
-	_, err = s.ds.GetJobByID(c.Request().Context(), id)
+	j, err := s.ds.GetJobByID(c.Request().Context(), id)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusNotFound, err.Error())
 	}
-	l, err := s.ds.GetJobLogParts(c.Request().Context(), id, q, page, size)
-	if err != nil {
+	if err := s.authorizeJobNamespace(c.Request().Context(), j.Namespace); err != nil {
+		return err
+	}
+	l, err := s.ds.GetJobLogParts(c.Request().Context(), id, q, c.QueryParam("cursor"), page, size)
+	if errors.Is(err, datastore.ErrInvalidCursor) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if err != nil {
 		return echo.NewHTTPError(http.StatusNotFound, err.Error())
 	}
 	return c.JSON(http.StatusOK, l)
 }
 
+// getJobTasks
+// @Summary Show a list of the tasks of a job
+// @Tags jobs
+// @Produce application/json
+// @Success 200 {object} []tork.TaskSummary
+// @Router /jobs/{id}/tasks [get]
+// @Param id path string true "Job ID"
+// @Param state query string false "task state"
+// @Param parent query string false "parent task ID"
+// @Param page query int false "page number"
+// @Param size query int false "page size"
+// @Param cursor query string false "the nextCursor of the previous page"
+func (s *API) getJobTasks(c echo.Context) error {
+	id := c.Param("id")
+	ps := c.QueryParam("page")
+	if ps == "" {
+		ps = "1"
+	}
+	page, err := strconv.Atoi(ps)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("invalid page number: %s", ps))
+	}
+	if page < 1 {
+		page = 1
+	}
+	si := c.QueryParam("size")
+	if si == "" {
+		si = "25"
+	}
+	size, err := strconv.Atoi(si)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("invalid size: %s", ps))
+	}
+	if size < 1 {
+		size = 1
+	} else if size > MAX_TASK_PAGE_SIZE {
+		size = MAX_TASK_PAGE_SIZE
+	}
+	j, err := s.ds.GetJobByID(c.Request().Context(), id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err := s.authorizeJobNamespace(c.Request().Context(), j.Namespace); err != nil {
+		return err
+	}
+	if err := s.authorizeJobPermissions(c.Request().Context(), j); err != nil {
+		return err
+	}
+	q := datastore.TaskQuery{
+		State:    strings.ToUpper(c.QueryParam("state")),
+		ParentID: c.QueryParam("parent"),
+	}
+	res, err := s.ds.GetJobTasks(c.Request().Context(), id, q, c.QueryParam("cursor"), page, size)
+	if errors.Is(err, datastore.ErrInvalidCursor) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
 // listJobs
 // @Summary Show a list of jobs
 // @Tags jobs
 // @Produce application/json
 // @Success 200 {object} []tork.JobSummary
 // @Router /jobs [get]
-// @Param q query string false "search string"
+// @Param q query string false "search query, e.g. state:FAILED created:>2026-01-01 sort:-created"
 // @Param page query int false "page number"
 // @Param size query int false "page size"
+// @Param cursor query string false "the nextCursor of the previous page"
 func (s *API) listJobs(c echo.Context) error {
 	ps := c.QueryParam("page")
 	if ps == "" {
@@ -465,10 +791,17 @@ func (s *API) listJobs(c echo.Context) error {
 	}
 	if size < 1 {
 		size = 1
-	} else if size > 20 {
-		size = 20
+	} else if size > MAX_JOB_PAGE_SIZE {
+		size = MAX_JOB_PAGE_SIZE
+	}
+	cursor := c.QueryParam("cursor")
+	if cursor == "" && (page-1)*size > MAX_JOB_PAGE_OFFSET {
+		return echo.NewHTTPError(http.StatusBadRequest, "page is too deep: use the cursor of the previous page instead")
+	}
+	q, err := search.Parse(c.QueryParam("q"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid query: %s", err.Error()))
 	}
-	q := c.QueryParam("q")
 	currentUser := c.Request().Context().Value(tork.USERNAME)
 	var username string
 	if currentUser != nil {
@@ -478,8 +811,14 @@ func (s *API) listJobs(c echo.Context) error {
 		}
 		username = cu
 	}
-	res, err := s.ds.GetJobs(c.Request().Context(), username, q, page, size)
+	ns, err := s.authorizeNamespace(c.Request().Context(), requestNamespace(c, ""))
 	if err != nil {
+		return err
+	}
+	res, err := s.ds.GetJobs(c.Request().Context(), username, ns.Name, q, cursor, page, size)
+	if errors.Is(err, datastore.ErrInvalidCursor) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 	return c.JSON(http.StatusOK, datastore.Page[*tork.JobSummary]{
@@ -488,6 +827,7 @@ func (s *API) listJobs(c echo.Context) error {
 		TotalPages: res.TotalPages,
 		Items:      res.Items,
 		TotalItems: res.TotalItems,
+		NextCursor: res.NextCursor,
 	})
 }
 
@@ -507,9 +847,22 @@ func (s *API) createScheduledJob(c echo.Context) error {
 	default:
 		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown content type: %s", contentType))
 	}
+	ji.Namespace = requestNamespace(c, ji.Namespace)
+	ns, err := s.authorizeNamespace(c.Request().Context(), ji.Namespace)
+	if err != nil {
+		return err
+	}
+	applyNamespaceDefaults(ns, &ji.Defaults)
+	if err := s.authorizeQueues(c.Request().Context(), ji.Queues()); err != nil {
+		return err
+	}
+	if err := s.authorizeSecrets(c.Request().Context(), ns.Name, ji.Tasks, ji.Secrets); err != nil {
+		return err
+	}
 	if sj, err := s.submitScheduledJob(c.Request().Context(), &ji); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	} else {
+		c.Set(auditTargetKey, sj.ID)
 		return c.JSON(http.StatusOK, tork.NewScheduledJobSummary(sj))
 	}
 }
@@ -574,8 +927,14 @@ func (s *API) listScheduledJobs(c echo.Context) error {
 		}
 		username = cu
 	}
-	res, err := s.ds.GetScheduledJobs(c.Request().Context(), username, page, size)
+	ns, err := s.authorizeNamespace(c.Request().Context(), requestNamespace(c, ""))
 	if err != nil {
+		return err
+	}
+	res, err := s.ds.GetScheduledJobs(c.Request().Context(), username, ns.Name, c.QueryParam("cursor"), page, size)
+	if errors.Is(err, datastore.ErrInvalidCursor) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 	return c.JSON(http.StatusOK, datastore.Page[*tork.ScheduledJobSummary]{
@@ -584,6 +943,7 @@ func (s *API) listScheduledJobs(c echo.Context) error {
 		TotalPages: res.TotalPages,
 		Items:      res.Items,
 		TotalItems: res.TotalItems,
+		NextCursor: res.NextCursor,
 	})
 }
 
@@ -593,6 +953,9 @@ func (s *API) pauseScheduledJob(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusNotFound, err.Error())
 	}
+	if err := s.authorizeJobNamespace(c.Request().Context(), j.Namespace); err != nil {
+		return err
+	}
 	if j.State != tork.ScheduledJobStateActive {
 		return echo.NewHTTPError(http.StatusBadRequest, "scheduled job is not active")
 	}
@@ -615,6 +978,9 @@ func (s *API) resumeScheduledJob(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusNotFound, err.Error())
 	}
+	if err := s.authorizeJobNamespace(c.Request().Context(), j.Namespace); err != nil {
+		return err
+	}
 	if j.State != tork.ScheduledJobStatePaused {
 		return echo.NewHTTPError(http.StatusBadRequest, "scheduled job is not paused")
 	}
@@ -637,6 +1003,9 @@ func (s *API) deleteScheduledJob(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusNotFound, err.Error())
 	}
+	if err := s.authorizeJobNamespace(c.Request().Context(), j.Namespace); err != nil {
+		return err
+	}
 	if err := s.ds.DeleteScheduledJob(c.Request().Context(), id); err != nil {
 		return err
 	}
@@ -664,6 +1033,9 @@ func (s *API) getTask(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusNotFound, err.Error())
 	}
+	if err := s.authorizeTaskJob(c.Request().Context(), t); err != nil {
+		return err
+	}
 	if err := s.onReadTask(c.Request().Context(), task.Read, t); err != nil {
 		return err
 	}
@@ -680,6 +1052,7 @@ func (s *API) getTask(c echo.Context) error {
 // @Param q query int false "string search"
 // @Param page query int false "page number"
 // @Param size query int false "page size"
+// @Param cursor query string false "the nextCursor of the previous page"
 func (s *API) getTaskLog(c echo.Context) error {
 	id := c.Param("id")
 	ps := c.QueryParam("page")
@@ -707,25 +1080,88 @@ func (s *API) getTaskLog(c echo.Context) error {
 	} else if size > MAX_LOG_PAGE_SIZE {
 		size = MAX_LOG_PAGE_SIZE
 	}
-	_, err = s.ds.GetTaskByID(c.Request().Context(), id)
+	t, err := s.ds.GetTaskByID(c.Request().Context(), id)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusNotFound, err.Error())
 	}
-	l, err := s.ds.GetTaskLogParts(c.Request().Context(), id, q, page, size)
-	if err != nil {
+	if err := s.authorizeTaskJob(c.Request().Context(), t); err != nil {
+		return err
+	}
+	l, err := s.ds.GetTaskLogParts(c.Request().Context(), id, q, c.QueryParam("cursor"), page, size)
+	if errors.Is(err, datastore.ErrInvalidCursor) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if err != nil {
 		return echo.NewHTTPError(http.StatusNotFound, err.Error())
 	}
 	return c.JSON(http.StatusOK, l)
 }
 
 func (s *API) getMetrics(c echo.Context) error {
-	metrics, err := s.ds.GetMetrics(c.Request().Context())
+	ns, err := s.authorizeNamespace(c.Request().Context(), requestNamespace(c, ""))
+	if err != nil {
+		return err
+	}
+	metrics, err := s.ds.GetMetrics(c.Request().Context(), ns.Name)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 	return c.JSON(http.StatusOK, metrics)
 }
 
+// getPrometheusMetrics
+// @Summary Get the metrics of the engine in the Prometheus text format
+// @Description Admins get the metrics of the whole engine unless they
+// @Description name a namespace, while others only get the metrics of
+// @Description the namespace they name, or of the default one.
+// @Tags metrics
+// @Produce plain
+// @Param namespace query string false "The namespace to scope the metrics to"
+// @Success 200 {string} string
+// @Router /metrics/prometheus [get]
+func (s *API) getPrometheusMetrics(c echo.Context) error {
+	ctx := c.Request().Context()
+	cu, err := s.currentUser(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	scoped := c.QueryParam("namespace") != ""
+	if cu != nil && !scoped {
+		admin, err := s.isAdmin(ctx, cu)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		scoped = !admin
+	}
+	var g prometheus.Gatherer
+	if scoped {
+		ns, err := s.authorizeNamespace(ctx, requestNamespace(c, ""))
+		if err != nil {
+			return err
+		}
+		g = metrics.NamespaceGatherer(metrics.Default, ns.Name)
+	} else {
+		// the queue depth is read on every scrape, by a registry of its own
+		qr := prometheus.NewRegistry()
+		qr.MustRegister(metrics.NewQueueDepthCollector(func() (map[string]int, error) {
+			qs, err := s.broker.Queues(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("error getting the queues for their depth")
+				return nil, err
+			}
+			depth := make(map[string]int, len(qs))
+			for _, q := range qs {
+				depth[q.Name] = q.Size
+			}
+			return depth, nil
+		}))
+		g = prometheus.Gatherers{metrics.Default, qr}
+	}
+	promhttp.HandlerFor(g, promhttp.HandlerOpts{
+		ErrorHandling: promhttp.ContinueOnError,
+	}).ServeHTTP(c.Response(), c.Request())
+	return nil
+}
+
 // Job
 // @Summary Restart a cancelled/failed job
 // @Tags jobs
@@ -741,11 +1177,11 @@ func (s *API) restartJob(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusNotFound, err.Error())
 	}
-	if j.State != tork.JobStateFailed && j.State != tork.JobStateCancelled {
-		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("job is %s and can not be restarted", j.State))
+	if err := s.authorizeJobNamespace(c.Request().Context(), j.Namespace); err != nil {
+		return err
 	}
-	if j.Position > len(j.Tasks) {
-		return echo.NewHTTPError(http.StatusBadRequest, "job has no more tasks to run")
+	if err := checkRestart(j); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 	j.State = tork.JobStateRestart
 	if err := s.broker.PublishJob(c.Request().Context(), j); err != nil {
@@ -755,6 +1191,17 @@ func (s *API) restartJob(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
 }
 
+// checkRestart reports why the job can't be restarted, if it can't.
+func checkRestart(j *tork.Job) error {
+	if j.State != tork.JobStateFailed && j.State != tork.JobStateCancelled {
+		return errors.Errorf("job is %s and can not be restarted", j.State)
+	}
+	if j.Position > len(j.Tasks) {
+		return errors.New("job has no more tasks to run")
+	}
+	return nil
+}
+
 // Job
 // @Summary Cancel a running job
 // @Tags jobs
@@ -770,8 +1217,11 @@ func (s *API) cancelJob(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusNotFound, err.Error())
 	}
-	if j.State != tork.JobStateRunning && j.State != tork.JobStateScheduled {
-		return echo.NewHTTPError(http.StatusBadRequest, "job is not running")
+	if err := s.authorizeJobNamespace(c.Request().Context(), j.Namespace); err != nil {
+		return err
+	}
+	if err := checkCancel(j); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 	j.State = tork.JobStateCancelled
 	if err := s.broker.PublishJob(c.Request().Context(), j); err != nil {
@@ -781,48 +1231,860 @@ func (s *API) cancelJob(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
 }
 
-// createUser
-// @Summary Create a new user
-// @Tags users
-// @Accept json
-// @Produce json
-// @Success 200 {object} tork.User
-// @Router /users [post]
-// @Param request body tork.User true "body"
-func (s *API) createUser(c echo.Context) error {
-	var u tork.User
-	body, err := io.ReadAll(c.Request().Body)
+// deleteJob
+// @Summary Delete a job along with its tasks and logs
+// @Tags jobs
+// @Produce application/json
+// @Success 200 {string} string "OK"
+// @Router /jobs/{id} [delete]
+// @Param id path string true "Job ID"
+// @Failure 404 {object} echo.HTTPError
+// @Failure 400 {object} echo.HTTPError
+func (s *API) deleteJob(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	j, err := s.ds.GetJobByID(ctx, id)
 	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err := s.authorizeJobNamespace(ctx, j.Namespace); err != nil {
 		return err
 	}
-	if err := json.Unmarshal(body, &u); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	if err := s.authorizeJobPermissions(ctx, j); err != nil {
+		return err
 	}
-	u.Username = strings.TrimSpace(u.Username)
-	if u.Username == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "must provide username")
+	if err := checkDelete(j); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
-	u.Password = strings.TrimSpace(u.Password)
-	if u.Password == "" {
-		return echo.NewHTTPError(http.StatusBadRequest, "must provide password")
+	if err := s.ds.DeleteJob(ctx, id); errors.Is(err, datastore.ErrJobNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
-	passwordHash, err := hash.Password(u.Password)
+	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+}
+
+// authorizeTaskJob checks the current user may access the job of a
+// task, which is where the task's namespace and permissions come from.
+func (s *API) authorizeTaskJob(ctx context.Context, t *tork.Task) error {
+	j, err := s.ds.GetJobByID(ctx, t.JobID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "invalid password")
+		return echo.NewHTTPError(http.StatusNotFound, datastore.ErrTaskNotFound.Error())
 	}
-	u.PasswordHash = passwordHash
-	u.Password = ""
-	_, err = s.ds.GetUser(c.Request().Context(), u.Username)
-	if err == nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "user already exists")
-	} else if !errors.Is(err, datastore.ErrUserNotFound) {
+	if err := s.authorizeJobNamespace(ctx, j.Namespace); err != nil {
 		return err
 	}
-	if err := s.ds.CreateUser(c.Request().Context(), &u); err != nil {
-		return err
-	} else {
-		return c.JSON(http.StatusOK, u)
+	return s.authorizeJobPermissions(ctx, j)
+}
+
+// authorizeJobPermissions checks the current user may access a job
+// restricted to some users or roles, returning a 404 rather than a
+// 403 just like such jobs are left out of the list of jobs.
+func (s *API) authorizeJobPermissions(ctx context.Context, j *tork.Job) error {
+	if len(j.Permissions) == 0 {
+		return nil
+	}
+	cu, err := s.currentUser(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if cu == nil {
+		return nil
+	}
+	roles, err := s.ds.GetUserRoles(ctx, cu.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	for _, r := range roles {
+		if r.Slug == tork.ROLE_ADMIN {
+			return nil
+		}
+	}
+	for _, p := range j.Permissions {
+		if p.User != nil && p.User.ID == cu.ID {
+			return nil
+		}
+		for _, r := range roles {
+			if p.Role != nil && p.Role.ID == r.ID {
+				return nil
+			}
+		}
+	}
+	return echo.NewHTTPError(http.StatusNotFound, datastore.ErrJobNotFound.Error())
+}
+
+// checkCancel reports why the job can't be cancelled, if it can't.
+func checkCancel(j *tork.Job) error {
+	if j.State != tork.JobStateRunning && j.State != tork.JobStateScheduled {
+		return errors.New("job is not running")
+	}
+	return nil
+}
+
+// checkDelete reports why the job can't be deleted, if it can't:
+// only jobs which are done running may be deleted.
+func checkDelete(j *tork.Job) error {
+	if j.State != tork.JobStateCompleted && j.State != tork.JobStateFailed && j.State != tork.JobStateCancelled {
+		return errors.Errorf("job is %s and can not be deleted", j.State)
+	}
+	return nil
+}
+
+// createUser
+// @Summary Create a new user
+// @Tags users
+// @Accept json
+// @Produce json
+// @Success 200 {object} tork.User
+// @Router /users [post]
+// @Param request body tork.User true "body"
+func (s *API) createUser(c echo.Context) error {
+	var u tork.User
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, &u); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	u.Username = strings.TrimSpace(u.Username)
+	if u.Username == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "must provide username")
+	}
+	u.Password = strings.TrimSpace(u.Password)
+	if u.Password == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "must provide password")
+	}
+	passwordHash, err := hash.Password(u.Password)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid password")
+	}
+	u.PasswordHash = passwordHash
+	u.Password = ""
+	_, err = s.ds.GetUser(c.Request().Context(), u.Username)
+	if err == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "user already exists")
+	} else if !errors.Is(err, datastore.ErrUserNotFound) {
+		return err
+	}
+	if err := s.ds.CreateUser(c.Request().Context(), &u); err != nil {
+		return err
+	} else {
+		c.Set(auditTargetKey, u.Username)
+		return c.JSON(http.StatusOK, u)
+	}
+}
+
+// getUser
+// @Summary Get a user by username
+// @Tags users
+// @Produce json
+// @Success 200 {object} tork.User
+// @Failure 404 {object} echo.HTTPError
+// @Router /users/{username} [get]
+// @Param username path string true "Username"
+func (s *API) getUser(c echo.Context) error {
+	u, err := s.ds.GetUser(c.Request().Context(), c.Param("username"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	return c.JSON(http.StatusOK, u)
+}
+
+// updateUser
+// @Summary Update a user's details
+// @Tags users
+// @Accept json
+// @Produce json
+// @Success 200 {object} tork.User
+// @Failure 404 {object} echo.HTTPError
+// @Router /users/{username} [put]
+// @Param username path string true "Username"
+// @Param request body tork.User true "body"
+func (s *API) updateUser(c echo.Context) error {
+	var body tork.User
+	if err := bindInputJSON(&body, c.Request().Body); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	u, err := s.ds.GetUser(c.Request().Context(), c.Param("username"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err := s.ds.UpdateUser(c.Request().Context(), u.ID, func(x *tork.User) error {
+		x.Name = strings.TrimSpace(body.Name)
+		return nil
+	}); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	u.Name = strings.TrimSpace(body.Name)
+	return c.JSON(http.StatusOK, u)
+}
+
+// deleteUser
+// @Summary Delete a user
+// @Description Users who own jobs can't be deleted. Disable them instead.
+// @Tags users
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} echo.HTTPError
+// @Failure 409 {object} echo.HTTPError
+// @Router /users/{username} [delete]
+// @Param username path string true "Username"
+func (s *API) deleteUser(c echo.Context) error {
+	u, err := s.ds.GetUser(c.Request().Context(), c.Param("username"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if u.Username == tork.USER_GUEST {
+		return echo.NewHTTPError(http.StatusBadRequest, "the guest user can not be deleted")
+	}
+	if err := s.ds.DeleteUser(c.Request().Context(), u.ID); err != nil {
+		if errors.Is(err, datastore.ErrUserInUse) {
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+}
+
+// disableUser
+// @Summary Disable a user
+// @Description A disabled user can no longer authenticate
+// @Tags users
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} echo.HTTPError
+// @Router /users/{username}/disable [put]
+// @Param username path string true "Username"
+func (s *API) disableUser(c echo.Context) error {
+	return s.setUserDisabled(c, true)
+}
+
+// enableUser
+// @Summary Enable a previously disabled user
+// @Tags users
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} echo.HTTPError
+// @Router /users/{username}/enable [put]
+// @Param username path string true "Username"
+func (s *API) enableUser(c echo.Context) error {
+	return s.setUserDisabled(c, false)
+}
+
+func (s *API) setUserDisabled(c echo.Context, disabled bool) error {
+	u, err := s.ds.GetUser(c.Request().Context(), c.Param("username"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if u.Username == tork.USER_GUEST {
+		return echo.NewHTTPError(http.StatusBadRequest, "the guest user can not be modified")
+	}
+	if err := s.ds.UpdateUser(c.Request().Context(), u.ID, func(x *tork.User) error {
+		x.Disabled = disabled
+		return nil
+	}); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+}
+
+// changePassword
+// @Summary Change a user's password
+// @Description Users can change their own password. Admins can change anyone's.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 403 {object} echo.HTTPError
+// @Failure 404 {object} echo.HTTPError
+// @Router /users/{username}/password [put]
+// @Param username path string true "Username"
+// @Param request body tork.User true "body"
+func (s *API) changePassword(c echo.Context) error {
+	ctx := c.Request().Context()
+	u, err := s.getSelfOrAdmin(c, "can't change another user's password")
+	if err != nil {
+		return err
+	}
+	var body tork.User
+	if err := bindInputJSON(&body, c.Request().Body); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	password := strings.TrimSpace(body.Password)
+	if password == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "must provide password")
+	}
+	passwordHash, err := hash.Password(password)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid password")
+	}
+	if err := s.ds.UpdateUser(ctx, u.ID, func(x *tork.User) error {
+		x.PasswordHash = passwordHash
+		return nil
+	}); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+}
+
+// getSelfOrAdmin returns the user named in the request's path, as long
+// as it's the current user or the current user may manage users.
+func (s *API) getSelfOrAdmin(c echo.Context, forbidden string) (*tork.User, error) {
+	ctx := c.Request().Context()
+	u, err := s.ds.GetUser(ctx, c.Param("username"))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	cu, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if cu != nil && cu.ID != u.ID {
+		allowed, err := s.isAllowed(ctx, cu, tork.ACTION_USER_MANAGE, "")
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if !allowed {
+			return nil, echo.NewHTTPError(http.StatusForbidden, forbidden)
+		}
+	}
+	return u, nil
+}
+
+// listUserTokens
+// @Summary Get a list of a user's personal access tokens
+// @Tags users
+// @Produce json
+// @Success 200 {object} []tork.UserToken
+// @Failure 404 {object} echo.HTTPError
+// @Router /users/{username}/tokens [get]
+// @Param username path string true "Username"
+func (s *API) listUserTokens(c echo.Context) error {
+	u, err := s.getSelfOrAdmin(c, "can't list another user's tokens")
+	if err != nil {
+		return err
+	}
+	tokens, err := s.ds.GetUserTokens(c.Request().Context(), u.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// createUserToken
+// @Summary Create a personal access token
+// @Description The token is only ever returned in the response to this request
+// @Tags users
+// @Accept json
+// @Produce json
+// @Success 200 {object} tork.UserToken
+// @Failure 400 {object} echo.HTTPError
+// @Router /users/{username}/tokens [post]
+// @Param username path string true "Username"
+// @Param request body tork.UserToken true "body"
+func (s *API) createUserToken(c echo.Context) error {
+	u, err := s.getSelfOrAdmin(c, "can't create a token for another user")
+	if err != nil {
+		return err
+	}
+	var body tork.UserToken
+	if err := bindInputJSON(&body, c.Request().Body); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "must provide name")
+	}
+	for _, scope := range body.Scopes {
+		if scope != tork.TOKEN_SCOPE_READ && scope != tork.TOKEN_SCOPE_WRITE {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid scope: %s", scope))
+		}
+	}
+	if body.ExpiresAt != nil && body.ExpiresAt.Before(time.Now()) {
+		return echo.NewHTTPError(http.StatusBadRequest, "expiresAt must be in the future")
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	token := tork.TOKEN_PREFIX + hex.EncodeToString(secret)
+	t := &tork.UserToken{
+		UserID:    u.ID,
+		Name:      name,
+		TokenHash: hash.Token(token),
+		Scopes:    body.Scopes,
+		ExpiresAt: body.ExpiresAt,
+	}
+	if err := s.ds.CreateUserToken(c.Request().Context(), t); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	t.Token = token
+	return c.JSON(http.StatusOK, t)
+}
+
+// deleteUserToken
+// @Summary Revoke a personal access token
+// @Tags users
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} echo.HTTPError
+// @Router /users/{username}/tokens/{id} [delete]
+// @Param username path string true "Username"
+// @Param id path string true "Token ID"
+func (s *API) deleteUserToken(c echo.Context) error {
+	u, err := s.getSelfOrAdmin(c, "can't revoke another user's token")
+	if err != nil {
+		return err
+	}
+	if err := s.ds.DeleteUserToken(c.Request().Context(), u.ID, c.Param("id")); err != nil {
+		if errors.Is(err, datastore.ErrTokenNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+}
+
+// listUserIdentities
+// @Summary Get a list of the OIDC identities linked to a user
+// @Tags users
+// @Produce json
+// @Success 200 {object} []tork.UserIdentity
+// @Failure 404 {object} echo.HTTPError
+// @Router /users/{username}/identities [get]
+// @Param username path string true "Username"
+func (s *API) listUserIdentities(c echo.Context) error {
+	ctx := c.Request().Context()
+	u, err := s.ds.GetUser(ctx, c.Param("username"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	identities, err := s.ds.GetUserIdentities(ctx, u.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, identities)
+}
+
+// linkUserIdentity
+// @Summary Link an OIDC identity to a user
+// @Description Lets the user log in with the ID tokens of the issuer bearing the subject
+// @Tags users
+// @Accept json
+// @Produce json
+// @Success 200 {object} tork.UserIdentity
+// @Failure 400 {object} echo.HTTPError
+// @Failure 404 {object} echo.HTTPError
+// @Router /users/{username}/identities [post]
+// @Param username path string true "Username"
+// @Param request body tork.UserIdentity true "body"
+func (s *API) linkUserIdentity(c echo.Context) error {
+	ctx := c.Request().Context()
+	u, err := s.ds.GetUser(ctx, c.Param("username"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	var body tork.UserIdentity
+	if err := bindInputJSON(&body, c.Request().Body); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	i := &tork.UserIdentity{
+		UserID:  u.ID,
+		Issuer:  strings.TrimSpace(body.Issuer),
+		Subject: strings.TrimSpace(body.Subject),
+	}
+	if i.Issuer == "" || i.Subject == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "must provide issuer and subject")
+	}
+	if _, err := s.ds.GetUserByIdentity(ctx, i.Issuer, i.Subject); err == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "identity is already linked to a user")
+	} else if !errors.Is(err, datastore.ErrUserNotFound) {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if err := s.ds.CreateUserIdentity(ctx, i); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, i)
+}
+
+// unlinkUserIdentity
+// @Summary Unlink an OIDC identity from a user
+// @Tags users
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} echo.HTTPError
+// @Router /users/{username}/identities/{id} [delete]
+// @Param username path string true "Username"
+// @Param id path string true "Identity ID"
+func (s *API) unlinkUserIdentity(c echo.Context) error {
+	ctx := c.Request().Context()
+	u, err := s.ds.GetUser(ctx, c.Param("username"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err := s.ds.DeleteUserIdentity(ctx, u.ID, c.Param("id")); err != nil {
+		if errors.Is(err, datastore.ErrIdentityNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+}
+
+// assignRole
+// @Summary Assign a role to a user
+// @Tags users
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} echo.HTTPError
+// @Router /users/{username}/roles/{role} [put]
+// @Param username path string true "Username"
+// @Param role path string true "Role slug"
+func (s *API) assignRole(c echo.Context) error {
+	ctx := c.Request().Context()
+	u, r, err := s.getUserAndRole(c)
+	if err != nil {
+		return err
+	}
+	roles, err := s.ds.GetUserRoles(ctx, u.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	for _, ur := range roles {
+		if ur.ID == r.ID {
+			return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+		}
+	}
+	if err := s.ds.AssignRole(ctx, u.ID, r.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+}
+
+// unassignRole
+// @Summary Remove a role from a user
+// @Tags users
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} echo.HTTPError
+// @Router /users/{username}/roles/{role} [delete]
+// @Param username path string true "Username"
+// @Param role path string true "Role slug"
+func (s *API) unassignRole(c echo.Context) error {
+	u, r, err := s.getUserAndRole(c)
+	if err != nil {
+		return err
+	}
+	if err := s.ds.UnassignRole(c.Request().Context(), u.ID, r.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+}
+
+func (s *API) getUserAndRole(c echo.Context) (*tork.User, *tork.Role, error) {
+	u, err := s.ds.GetUser(c.Request().Context(), c.Param("username"))
+	if err != nil {
+		return nil, nil, echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	r, err := s.ds.GetRole(c.Request().Context(), c.Param("role"))
+	if err != nil {
+		return nil, nil, echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	return u, r, nil
+}
+
+// listRoles
+// @Summary Get a list of roles
+// @Tags roles
+// @Produce json
+// @Success 200 {object} []tork.Role
+// @Router /roles [get]
+func (s *API) listRoles(c echo.Context) error {
+	roles, err := s.ds.GetRoles(c.Request().Context())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, roles)
+}
+
+// createRole
+// @Summary Create a new role
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Success 200 {object} tork.Role
+// @Router /roles [post]
+// @Param request body tork.Role true "body"
+func (s *API) createRole(c echo.Context) error {
+	var r tork.Role
+	if err := bindInputJSON(&r, c.Request().Body); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	r.Slug = strings.TrimSpace(r.Slug)
+	if r.Slug == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "must provide slug")
+	}
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		r.Name = r.Slug
+	}
+	_, err := s.ds.GetRole(c.Request().Context(), r.Slug)
+	if err == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "role already exists")
+	} else if !errors.Is(err, datastore.ErrRoleNotFound) {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if err := s.ds.CreateRole(c.Request().Context(), &r); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	c.Set(auditTargetKey, r.Slug)
+	return c.JSON(http.StatusOK, r)
+}
+
+// deleteRole
+// @Summary Delete a role
+// @Description The role is removed from every user and permission which references it
+// @Tags roles
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} echo.HTTPError
+// @Router /roles/{role} [delete]
+// @Param role path string true "Role slug"
+func (s *API) deleteRole(c echo.Context) error {
+	r, err := s.ds.GetRole(c.Request().Context(), c.Param("role"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if r.Slug == tork.ROLE_PUBLIC || r.Slug == tork.ROLE_ADMIN {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("the %s role can not be deleted", r.Slug))
+	}
+	if err := s.ds.DeleteRole(c.Request().Context(), r.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+}
+
+// listPolicies
+// @Summary Get a list of the policies granted to a role
+// @Tags roles
+// @Produce json
+// @Success 200 {object} []tork.Policy
+// @Failure 404 {object} echo.HTTPError
+// @Router /roles/{role}/policies [get]
+// @Param role path string true "Role slug"
+func (s *API) listPolicies(c echo.Context) error {
+	r, err := s.ds.GetRole(c.Request().Context(), c.Param("role"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	policies, err := s.ds.GetPolicies(c.Request().Context(), r.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, policies)
+}
+
+// createPolicy
+// @Summary Grant an action to a role
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Success 200 {object} tork.Policy
+// @Failure 400 {object} echo.HTTPError
+// @Router /roles/{role}/policies [post]
+// @Param role path string true "Role slug"
+// @Param request body tork.Policy true "body"
+func (s *API) createPolicy(c echo.Context) error {
+	r, err := s.ds.GetRole(c.Request().Context(), c.Param("role"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	var p tork.Policy
+	if err := bindInputJSON(&p, c.Request().Body); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if !slices.Contains(tork.ACTIONS, p.Action) {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown action: %s", p.Action))
+	}
+	p.Role = r
+	p.Resource = strings.TrimSpace(p.Resource)
+	if err := s.ds.CreatePolicy(c.Request().Context(), &p); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, p)
+}
+
+// deletePolicy
+// @Summary Revoke a policy from a role
+// @Tags roles
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} echo.HTTPError
+// @Router /roles/{role}/policies/{id} [delete]
+// @Param role path string true "Role slug"
+// @Param id path string true "Policy ID"
+func (s *API) deletePolicy(c echo.Context) error {
+	ctx := c.Request().Context()
+	r, err := s.ds.GetRole(ctx, c.Param("role"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	policies, err := s.ds.GetPolicies(ctx, r.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	idx := slices.IndexFunc(policies, func(p *tork.Policy) bool {
+		return p.ID == c.Param("id")
+	})
+	if idx == -1 {
+		return echo.NewHTTPError(http.StatusNotFound, datastore.ErrPolicyNotFound.Error())
+	}
+	if err := s.ds.DeletePolicy(ctx, policies[idx].ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+}
+
+// getMyPermissions
+// @Summary Get the actions granted to the current user
+// @Tags users
+// @Produce json
+// @Success 200 {object} []tork.Policy
+// @Router /me/permissions [get]
+func (s *API) getMyPermissions(c echo.Context) error {
+	ctx := c.Request().Context()
+	cu, err := s.currentUser(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if cu == nil {
+		return c.JSON(http.StatusOK, allPolicies())
+	}
+	policies, err := s.userPolicies(ctx, cu)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, policies)
+}
+
+// require restricts a route to users granted the action. When
+// authentication is turned off there is no current user and
+// the route stays open like the rest of the API.
+func (s *API) require(action string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if err := s.authorize(c.Request().Context(), action, ""); err != nil {
+				return err
+			}
+			return next(c)
+		}
+	}
+}
+
+// requireQueue restricts a route to users granted the
+// action on the queue named in the request's path.
+func (s *API) requireQueue(action string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if err := s.authorize(c.Request().Context(), action, c.Param("name")); err != nil {
+				return err
+			}
+			return next(c)
+		}
+	}
+}
+
+func (s *API) authorizeQueues(ctx context.Context, queues []string) error {
+	for _, q := range queues {
+		if err := s.authorize(ctx, tork.ACTION_QUEUE_USE, q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *API) authorize(ctx context.Context, action, resource string) error {
+	cu, err := s.currentUser(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if cu == nil {
+		return nil
+	}
+	allowed, err := s.isAllowed(ctx, cu, action, resource)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if !allowed {
+		if resource != "" {
+			return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("%s on %s is not permitted", action, resource))
+		}
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("%s is not permitted", action))
+	}
+	return nil
+}
+
+func (s *API) isAllowed(ctx context.Context, u *tork.User, action, resource string) (bool, error) {
+	policies, err := s.userPolicies(ctx, u)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range policies {
+		if p.Action == action && wildcard.Match(p.Resource, resource) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// userPolicies returns the policies in effect for the user:
+// those of its roles and of the public role, or all
+// of them for admins.
+func (s *API) userPolicies(ctx context.Context, u *tork.User) ([]*tork.Policy, error) {
+	admin, err := s.isAdmin(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	if admin {
+		return allPolicies(), nil
+	}
+	return s.ds.GetUserPolicies(ctx, u.ID)
+}
+
+func allPolicies() []*tork.Policy {
+	result := make([]*tork.Policy, len(tork.ACTIONS))
+	for i, action := range tork.ACTIONS {
+		result[i] = &tork.Policy{Action: action, Resource: "*"}
+	}
+	return result
+}
+
+// currentUser returns the authenticated user of the request
+// or nil when the request wasn't authenticated.
+func (s *API) currentUser(ctx context.Context) (*tork.User, error) {
+	v := ctx.Value(tork.USERNAME)
+	if v == nil {
+		return nil, nil
+	}
+	username, ok := v.(string)
+	if !ok {
+		return nil, errors.Errorf("error casting current user")
+	}
+	return s.ds.GetUser(ctx, username)
+}
+
+func (s *API) isAdmin(ctx context.Context, u *tork.User) (bool, error) {
+	roles, err := s.ds.GetUserRoles(ctx, u.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range roles {
+		if r.Slug == tork.ROLE_ADMIN {
+			return true, nil
+		}
 	}
+	return false, nil
 }
 
 func (s *API) Start() error {
@@ -21,6 +21,8 @@ import (
 
 	"github.com/runabol/tork/broker"
 
+	"github.com/runabol/tork/internal/hash"
+	"github.com/runabol/tork/internal/metrics"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/stretchr/testify/assert"
 )
@@ -56,6 +58,79 @@ func Test_getQueues(t *testing.T) {
 	assert.NoError(t, ds.Close())
 }
 
+func Test_pauseAndResumeQueue(t *testing.T) {
+	b := broker.NewInMemoryBroker()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    b,
+	})
+	assert.NoError(t, err)
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, nil)
+		assert.NoError(t, err)
+		w := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+	paused := func() bool {
+		qis, err := b.Queues(context.Background())
+		assert.NoError(t, err)
+		for _, qi := range qis {
+			if qi.Name == "some-queue" {
+				return qi.Paused
+			}
+		}
+		return false
+	}
+
+	assert.Equal(t, http.StatusOK, do("PUT", "/queues/some-queue/pause").Code)
+	assert.True(t, paused())
+	assert.Equal(t, http.StatusOK, do("PUT", "/queues/some-queue/resume").Code)
+	assert.False(t, paused())
+
+	// coordinator queues can't be paused or resumed
+	assert.Equal(t, http.StatusBadRequest, do("PUT", "/queues/"+broker.QUEUE_PENDING+"/pause").Code)
+	assert.Equal(t, http.StatusBadRequest, do("PUT", "/queues/"+broker.QUEUE_PENDING+"/resume").Code)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_purgeQueue(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    b,
+	})
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, b.PublishTask(ctx, "some-queue", &tork.Task{ID: uuid.NewUUID()}))
+	}
+	do := func(path string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("DELETE", path, nil)
+		assert.NoError(t, err)
+		w := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("/queues/some-queue/messages")
+	assert.Equal(t, http.StatusOK, w.Code)
+	res := map[string]any{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, float64(3), res["purged"])
+
+	// coordinator queues can't be purged
+	assert.Equal(t, http.StatusBadRequest, do("/queues/"+broker.QUEUE_PENDING+"/messages").Code)
+
+	// broker errors are server errors
+	assert.Equal(t, http.StatusInternalServerError, do("/queues/no-such-queue/messages").Code)
+	assert.NoError(t, ds.Close())
+}
+
 func Test_listJobs(t *testing.T) {
 	b := broker.NewInMemoryBroker()
 	ds, err := postgres.NewTestDatastore()
@@ -118,10 +193,44 @@ func Test_listJobs(t *testing.T) {
 	err = json.Unmarshal(body, &js)
 	assert.NoError(t, err)
 
-	assert.Equal(t, 20, js.Size)
-	assert.Equal(t, 6, js.TotalPages)
+	assert.Equal(t, 50, js.Size)
+	assert.Equal(t, 3, js.TotalPages)
 	assert.Equal(t, 1, js.Number)
 	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, js.NextCursor)
+
+	req, err = http.NewRequest("GET", "/jobs?size=50&cursor="+js.NextCursor, nil)
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	body, err = io.ReadAll(w.Body)
+	assert.NoError(t, err)
+
+	js = datastore.Page[*tork.Job]{}
+	err = json.Unmarshal(body, &js)
+	assert.NoError(t, err)
+	assert.Equal(t, 50, js.Size)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, err = http.NewRequest("GET", "/jobs?page=1&size=500", nil)
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	body, err = io.ReadAll(w.Body)
+	assert.NoError(t, err)
+
+	js = datastore.Page[*tork.Job]{}
+	err = json.Unmarshal(body, &js)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, js.Size)
+
+	for _, q := range []string{"/jobs?q=bogus:field", "/jobs?cursor=garbage", "/jobs?page=1000&size=100"} {
+		req, err = http.NewRequest("GET", q, nil)
+		assert.NoError(t, err)
+		w = httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, q)
+	}
 	assert.NoError(t, ds.Close())
 }
 
@@ -163,6 +272,48 @@ func Test_getActiveNodes(t *testing.T) {
 	assert.NoError(t, ds.Close())
 }
 
+func Test_getNode(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	n := &tork.Node{
+		ID:              "1234",
+		LastHeartbeatAt: time.Now().UTC(),
+		MemoryUsed:      1024,
+		MemoryTotal:     4096,
+		Runtime:         &tork.NodeRuntime{Type: "shell"},
+	}
+	assert.NoError(t, ds.CreateNode(ctx, n))
+	old := n.Sample()
+	old.Time = time.Now().UTC().Add(-tork.NODE_HISTORY_DURATION - time.Minute)
+	assert.NoError(t, ds.CreateNodeSample(ctx, n.ID, old))
+	assert.NoError(t, ds.CreateNodeSample(ctx, n.ID, n.Sample()))
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+	})
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest("GET", "/nodes/1234", nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	n2 := tork.Node{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &n2))
+	assert.Equal(t, int64(4096), n2.MemoryTotal)
+	assert.Equal(t, "shell", n2.Runtime.Type)
+	assert.Len(t, n2.History, 1)
+	assert.Equal(t, int64(1024), n2.History[0].MemoryUsed)
+
+	req, err = http.NewRequest("GET", "/nodes/2345", nil)
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NoError(t, ds.Close())
+}
+
 func Test_healthOK(t *testing.T) {
 	ds, err := postgres.NewTestDatastore()
 	assert.NoError(t, err)
@@ -184,6 +335,76 @@ func Test_healthOK(t *testing.T) {
 	assert.NoError(t, ds.Close())
 }
 
+func Test_getPrometheusMetrics(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	b := broker.NewInMemoryBroker()
+	assert.NoError(t, b.PublishTask(ctx, "some-queue", &tork.Task{ID: uuid.NewUUID()}))
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    b,
+	})
+	assert.NoError(t, err)
+	req, err := http.NewRequest("GET", "/metrics/prometheus", nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	body, err := io.ReadAll(w.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, string(body), "tork_queue_depth{queue=\"some-queue\"} 1\n")
+	assert.Contains(t, string(body), "# TYPE tork_task_duration_seconds histogram")
+
+	metrics.JobsTotal.WithLabelValues("default", "COMPLETED").Inc()
+	metrics.JobsTotal.WithLabelValues("other", "COMPLETED").Inc()
+	req, err = http.NewRequest("GET", "/metrics/prometheus?namespace=default", nil)
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	body, err = io.ReadAll(w.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, string(body), "tork_jobs_total{namespace=\"default\",state=\"COMPLETED\"}")
+	assert.NotContains(t, string(body), "namespace=\"other\"")
+	assert.NotContains(t, string(body), "tork_queue_depth")
+	assert.NoError(t, ds.Close())
+}
+
+func Test_healthLeader(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	err = ds.CreateNode(ctx, &tork.Node{
+		ID:              "1234",
+		Status:          tork.NodeStatusUP,
+		LastHeartbeatAt: time.Now().UTC(),
+		Leader:          true,
+	})
+	assert.NoError(t, err)
+	err = ds.CreateNode(ctx, &tork.Node{
+		ID:              "5678",
+		Status:          tork.NodeStatusUP,
+		LastHeartbeatAt: time.Now().UTC(),
+	})
+	assert.NoError(t, err)
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+	})
+	assert.NoError(t, err)
+	req, err := http.NewRequest("GET", "/health", nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	body, err := io.ReadAll(w.Body)
+
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), "\"leader\":\"1234\"")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, ds.Close())
+}
+
 func Test_healthNotOK(t *testing.T) {
 	schemaName := fmt.Sprintf("tork%d", rand.Int())
 	dsn := `host=localhost user=tork password=tork dbname=tork search_path=%s sslmode=disable`
@@ -366,6 +587,171 @@ func Test_getJob(t *testing.T) {
 	assert.NoError(t, ds.Close())
 }
 
+func Test_getJobTasks(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	j1 := tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateRunning,
+		CreatedAt: time.Now().UTC(),
+	}
+	err = ds.CreateJob(ctx, &j1)
+	assert.NoError(t, err)
+	now := time.Now().UTC()
+	parent := tork.Task{
+		ID:        uuid.NewUUID(),
+		JobID:     j1.ID,
+		Position:  1,
+		State:     tork.TaskStateRunning,
+		CreatedAt: &now,
+	}
+	err = ds.CreateTask(ctx, &parent)
+	assert.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		err := ds.CreateTask(ctx, &tork.Task{
+			ID:        uuid.NewUUID(),
+			JobID:     j1.ID,
+			ParentID:  parent.ID,
+			Position:  1,
+			State:     tork.TaskStateCompleted,
+			CreatedAt: &now,
+		})
+		assert.NoError(t, err)
+	}
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+	})
+	assert.NoError(t, err)
+
+	get := func(url string) (int, datastore.Page[*tork.TaskSummary]) {
+		req, err := http.NewRequest("GET", url, nil)
+		assert.NoError(t, err)
+		w := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(w, req)
+		p := datastore.Page[*tork.TaskSummary]{}
+		if w.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+		}
+		return w.Code, p
+	}
+
+	code, p := get(fmt.Sprintf("/jobs/%s/tasks", j1.ID))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 4, p.TotalItems)
+
+	code, p = get(fmt.Sprintf("/jobs/%s/tasks?state=completed&parent=%s&size=2", j1.ID, parent.ID))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 3, p.TotalItems)
+	assert.Len(t, p.Items, 2)
+	assert.Equal(t, parent.ID, p.Items[0].ParentID)
+	assert.NotEmpty(t, p.NextCursor)
+
+	code, p2 := get(fmt.Sprintf("/jobs/%s/tasks?state=completed&parent=%s&size=2&cursor=%s", j1.ID, parent.ID, p.NextCursor))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, p2.Items, 1)
+	assert.Empty(t, p2.NextCursor)
+
+	code, _ = get(fmt.Sprintf("/jobs/%s/tasks?cursor=bogus", j1.ID))
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = get("/jobs/no-such-job/tasks")
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_getJobTasksRestricted(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	bob := &tork.User{Username: "bob", Name: "Bob"}
+	assert.NoError(t, ds.CreateUser(ctx, bob))
+	carol := &tork.User{Username: "carol", Name: "Carol"}
+	assert.NoError(t, ds.CreateUser(ctx, carol))
+	j1 := tork.Job{
+		ID:          uuid.NewUUID(),
+		State:       tork.JobStateRunning,
+		CreatedAt:   time.Now().UTC(),
+		Permissions: []*tork.Permission{{User: bob}},
+	}
+	assert.NoError(t, ds.CreateJob(ctx, &j1))
+	now := time.Now().UTC()
+	assert.NoError(t, ds.CreateTask(ctx, &tork.Task{
+		ID:        uuid.NewUUID(),
+		JobID:     j1.ID,
+		Position:  1,
+		State:     tork.TaskStateRunning,
+		CreatedAt: &now,
+	}))
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+		Middleware: Middleware{
+			Echo: []echo.MiddlewareFunc{
+				func(next echo.HandlerFunc) echo.HandlerFunc {
+					return func(c echo.Context) error {
+						username := c.Request().Header.Get("X-Username")
+						c.SetRequest(c.Request().WithContext(context.WithValue(c.Request().Context(), tork.USERNAME, username)))
+						return next(c)
+					}
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	get := func(username string) int {
+		req, err := http.NewRequest("GET", fmt.Sprintf("/jobs/%s/tasks", j1.ID), nil)
+		assert.NoError(t, err)
+		req.Header.Add("X-Username", username)
+		w := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, get("bob"))
+	assert.Equal(t, http.StatusNotFound, get("carol"))
+	assert.NoError(t, ds.Close())
+}
+
+func Test_deleteJob(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	j1 := tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateCompleted,
+		CreatedAt: time.Now().UTC(),
+	}
+	assert.NoError(t, ds.CreateJob(ctx, &j1))
+	j2 := tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateRunning,
+		CreatedAt: time.Now().UTC(),
+	}
+	assert.NoError(t, ds.CreateJob(ctx, &j2))
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+	})
+	assert.NoError(t, err)
+
+	del := func(id string) int {
+		req, err := http.NewRequest("DELETE", fmt.Sprintf("/jobs/%s", id), nil)
+		assert.NoError(t, err)
+		w := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, del(j1.ID))
+	assert.Equal(t, http.StatusNotFound, del(j1.ID))
+	// running jobs must be cancelled first
+	assert.Equal(t, http.StatusBadRequest, del(j2.ID))
+	assert.Equal(t, http.StatusNotFound, del(uuid.NewUUID()))
+	assert.NoError(t, ds.Close())
+}
+
 func Test_cancelRunningJob(t *testing.T) {
 	ctx := context.Background()
 	ds, err := postgres.NewTestDatastore()
@@ -1053,3 +1439,327 @@ func Test_deleteScheduledJob(t *testing.T) {
 
 	assert.NoError(t, ds.Close())
 }
+
+func Test_manageUsers(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+	})
+	assert.NoError(t, err)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Add("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/users", `{"username":"jdoe","name":"John","password":"secret"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = do("PUT", "/users/jdoe", `{"name":"John Doe"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = do("GET", "/users/jdoe", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	u := tork.User{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &u))
+	assert.Equal(t, "John Doe", u.Name)
+	assert.NotContains(t, w.Body.String(), "secret")
+
+	w = do("PUT", "/users/jdoe/disable", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	u2, err := ds.GetUser(ctx, "jdoe")
+	assert.NoError(t, err)
+	assert.True(t, u2.Disabled)
+
+	w = do("PUT", "/users/jdoe/enable", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = do("PUT", "/users/jdoe/password", `{"password":"other"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	u3, err := ds.GetUser(ctx, "jdoe")
+	assert.NoError(t, err)
+	assert.NotEqual(t, u2.PasswordHash, u3.PasswordHash)
+	assert.False(t, u3.Disabled)
+
+	w = do("POST", "/roles", `{"slug":"ops","name":"Ops"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = do("GET", "/roles", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"slug":"ops"`)
+
+	w = do("PUT", "/users/jdoe/roles/ops", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	roles, err := ds.GetUserRoles(ctx, u3.ID)
+	assert.NoError(t, err)
+	assert.Len(t, roles, 1)
+
+	w = do("DELETE", "/users/jdoe/roles/ops", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	roles, err = ds.GetUserRoles(ctx, u3.ID)
+	assert.NoError(t, err)
+	assert.Len(t, roles, 0)
+
+	w = do("DELETE", "/roles/ops", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do("DELETE", "/roles/public", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do("DELETE", "/users/jdoe", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do("GET", "/users/jdoe", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	assert.NoError(t, ds.Close())
+}
+
+func Test_userTokens(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+	})
+	assert.NoError(t, err)
+
+	u := &tork.User{Username: uuid.NewShortUUID(), Name: "Tester"}
+	err = ds.CreateUser(ctx, u)
+	assert.NoError(t, err)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Add("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", fmt.Sprintf("/users/%s/tokens", u.Username), `{"name":"ci","scopes":["admin"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do("POST", fmt.Sprintf("/users/%s/tokens", u.Username), `{"name":"ci","scopes":["read"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	tk := tork.UserToken{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tk))
+	assert.True(t, strings.HasPrefix(tk.Token, tork.TOKEN_PREFIX))
+
+	stored, err := ds.GetUserTokenByHash(ctx, hash.Token(tk.Token))
+	assert.NoError(t, err)
+	assert.Equal(t, tk.ID, stored.ID)
+
+	w = do("GET", fmt.Sprintf("/users/%s/tokens", u.Username), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), tk.ID)
+	assert.NotContains(t, w.Body.String(), tk.Token)
+
+	w = do("DELETE", fmt.Sprintf("/users/%s/tokens/%s", u.Username, tk.ID), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do("DELETE", fmt.Sprintf("/users/%s/tokens/%s", u.Username, tk.ID), "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	assert.NoError(t, ds.Close())
+}
+
+func Test_userIdentities(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+	})
+	assert.NoError(t, err)
+
+	u := &tork.User{Username: uuid.NewShortUUID(), Name: "Tester"}
+	err = ds.CreateUser(ctx, u)
+	assert.NoError(t, err)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Add("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", fmt.Sprintf("/users/%s/identities", u.Username), `{"issuer":"https://login.example.com"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	subject := uuid.NewUUID()
+	body := fmt.Sprintf(`{"issuer":"https://login.example.com","subject":"%s"}`, subject)
+	w = do("POST", fmt.Sprintf("/users/%s/identities", u.Username), body)
+	assert.Equal(t, http.StatusOK, w.Code)
+	i := tork.UserIdentity{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &i))
+
+	linked, err := ds.GetUserByIdentity(ctx, "https://login.example.com", subject)
+	assert.NoError(t, err)
+	assert.Equal(t, u.ID, linked.ID)
+
+	// an identity can only be linked to one user
+	w = do("POST", fmt.Sprintf("/users/%s/identities", u.Username), body)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do("GET", fmt.Sprintf("/users/%s/identities", u.Username), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), subject)
+
+	w = do("DELETE", fmt.Sprintf("/users/%s/identities/%s", u.Username, i.ID), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do("DELETE", fmt.Sprintf("/users/%s/identities/%s", u.Username, i.ID), "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	_, err = ds.GetUserByIdentity(ctx, "https://login.example.com", subject)
+	assert.ErrorIs(t, err, datastore.ErrUserNotFound)
+
+	assert.NoError(t, ds.Close())
+}
+
+func Test_requireAdmin(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	admin, err := ds.GetRole(ctx, tork.ROLE_ADMIN)
+	assert.NoError(t, err)
+	alice := &tork.User{Username: "alice", Name: "Alice"}
+	assert.NoError(t, ds.CreateUser(ctx, alice))
+	assert.NoError(t, ds.AssignRole(ctx, alice.ID, admin.ID))
+	bob := &tork.User{Username: "bob", Name: "Bob"}
+	assert.NoError(t, ds.CreateUser(ctx, bob))
+
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+		Middleware: Middleware{
+			Echo: []echo.MiddlewareFunc{
+				func(next echo.HandlerFunc) echo.HandlerFunc {
+					return func(c echo.Context) error {
+						username := c.Request().Header.Get("X-Username")
+						c.SetRequest(c.Request().WithContext(context.WithValue(c.Request().Context(), tork.USERNAME, username)))
+						return next(c)
+					}
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	do := func(username, method, path, body string) int {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("X-Username", username)
+		w := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, do("bob", "GET", "/users/alice", ""))
+	assert.Equal(t, http.StatusForbidden, do("bob", "GET", "/roles", ""))
+	assert.Equal(t, http.StatusForbidden, do("bob", "PUT", "/users/alice/password", `{"password":"x"}`))
+	assert.Equal(t, http.StatusOK, do("bob", "PUT", "/users/bob/password", `{"password":"x"}`))
+	assert.Equal(t, http.StatusOK, do("alice", "GET", "/users/bob", ""))
+	assert.Equal(t, http.StatusOK, do("alice", "PUT", "/users/bob/password", `{"password":"y"}`))
+	assert.Equal(t, http.StatusBadRequest, do("alice", "DELETE", "/roles/admin", ""))
+
+	assert.NoError(t, ds.Close())
+}
+
+func Test_policies(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	admin, err := ds.GetRole(ctx, tork.ROLE_ADMIN)
+	assert.NoError(t, err)
+	alice := &tork.User{Username: "alice", Name: "Alice"}
+	assert.NoError(t, ds.CreateUser(ctx, alice))
+	assert.NoError(t, ds.AssignRole(ctx, alice.ID, admin.ID))
+	bob := &tork.User{Username: "bob", Name: "Bob"}
+	assert.NoError(t, ds.CreateUser(ctx, bob))
+
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+		Middleware: Middleware{
+			Echo: []echo.MiddlewareFunc{
+				func(next echo.HandlerFunc) echo.HandlerFunc {
+					return func(c echo.Context) error {
+						username := c.Request().Header.Get("X-Username")
+						c.SetRequest(c.Request().WithContext(context.WithValue(c.Request().Context(), tork.USERNAME, username)))
+						return next(c)
+					}
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	do := func(username, method, path, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("X-Username", username)
+		w := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	job := `{"name":"test job","tasks":[{"name":"test task","image":"some:image","queue":"gpu"}]}`
+
+	// the default policies of the public role preserve the previous behavior
+	assert.Equal(t, http.StatusOK, do("bob", "POST", "/jobs", job).Code)
+	w := do("bob", "GET", "/me/permissions", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), tork.ACTION_JOB_SUBMIT)
+	assert.NotContains(t, w.Body.String(), tork.ACTION_USER_MANAGE)
+	w = do("alice", "GET", "/me/permissions", "")
+	assert.Contains(t, w.Body.String(), tork.ACTION_USER_MANAGE)
+
+	// everyone sees the queues and nodes but only admins manage them
+	assert.NotContains(t, do("bob", "GET", "/me/permissions", "").Body.String(), tork.ACTION_QUEUE_MANAGE)
+	assert.Equal(t, http.StatusOK, do("bob", "GET", "/queues", "").Code)
+	assert.Equal(t, http.StatusForbidden, do("bob", "PUT", "/queues/default/pause", "").Code)
+	assert.Equal(t, http.StatusOK, do("bob", "GET", "/nodes", "").Code)
+	assert.Equal(t, http.StatusForbidden, do("bob", "PUT", "/nodes/1234/drain", "").Code)
+	assert.Equal(t, http.StatusOK, do("alice", "GET", "/queues", "").Code)
+	assert.Equal(t, http.StatusOK, do("alice", "GET", "/nodes", "").Code)
+	assert.Equal(t, http.StatusOK, do("bob", "GET", "/stats/jobs", "").Code)
+
+	// restrict queue usage to the default queue
+	w = do("alice", "GET", "/roles/public/policies", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	policies := []*tork.Policy{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &policies))
+	for _, p := range policies {
+		if p.Action == tork.ACTION_QUEUE_USE {
+			assert.Equal(t, http.StatusOK, do("alice", "DELETE", "/roles/public/policies/"+p.ID, "").Code)
+		}
+	}
+	assert.Equal(t, http.StatusBadRequest, do("alice", "POST", "/roles/public/policies", `{"action":"fly"}`).Code)
+	assert.Equal(t, http.StatusOK, do("alice", "POST", "/roles/public/policies", `{"action":"queue:use","resource":"default"}`).Code)
+
+	assert.Equal(t, http.StatusForbidden, do("bob", "POST", "/jobs", job).Code)
+	assert.Equal(t, http.StatusOK, do("alice", "POST", "/jobs", job).Code)
+	assert.Equal(t, http.StatusForbidden, do("bob", "POST", "/roles/public/policies", `{"action":"queue:use"}`).Code)
+
+	// grant a role the use of the gpu queue
+	gpu := &tork.Role{Slug: "gpu-users", Name: "GPU Users"}
+	assert.NoError(t, ds.CreateRole(ctx, gpu))
+	assert.NoError(t, ds.AssignRole(ctx, bob.ID, gpu.ID))
+	assert.Equal(t, http.StatusOK, do("alice", "POST", "/roles/gpu-users/policies", `{"action":"queue:use","resource":"gpu*"}`).Code)
+	assert.Equal(t, http.StatusOK, do("bob", "POST", "/jobs", job).Code)
+
+	assert.NoError(t, ds.Close())
+}
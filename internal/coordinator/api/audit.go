@@ -0,0 +1,177 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore"
+)
+
+// auditTargetKey lets handlers which create a resource name it
+// as the target of the audit event, since its ID isn't part of
+// the request's path.
+const auditTargetKey = "audit.target"
+
+var auditTargetTypes = map[string]string{
+	"jobs":           tork.AUDIT_TARGET_JOB,
+	"tasks":          tork.AUDIT_TARGET_TASK,
+	"scheduled-jobs": tork.AUDIT_TARGET_SCHEDULED_JOB,
+	"queues":         tork.AUDIT_TARGET_QUEUE,
+	"nodes":          tork.AUDIT_TARGET_NODE,
+	"users":          tork.AUDIT_TARGET_USER,
+	"roles":          tork.AUDIT_TARGET_ROLE,
+	"namespaces":     tork.AUDIT_TARGET_NAMESPACE,
+	"secrets":        tork.AUDIT_TARGET_SECRET,
+}
+
+// audit records every mutating API call, whether it succeeded or not.
+func (s *API) audit(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		if req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == http.MethodOptions {
+			return next(c)
+		}
+		err := next(c)
+		status := c.Response().Status
+		if err != nil {
+			var herr *echo.HTTPError
+			if errors.As(err, &herr) {
+				status = herr.Code
+			} else {
+				status = http.StatusInternalServerError
+			}
+		}
+		ev := &tork.AuditEvent{
+			Action:   fmt.Sprintf("%s %s", req.Method, c.Path()),
+			RemoteIP: c.RealIP(),
+			Status:   status,
+		}
+		if username, ok := req.Context().Value(tork.USERNAME).(string); ok {
+			ev.Username = username
+		}
+		ev.TargetType, ev.TargetID = auditTarget(c)
+		if aerr := s.ds.CreateAuditEvent(context.WithoutCancel(req.Context()), ev); aerr != nil {
+			log.Error().Err(aerr).Msgf("error recording audit event for %s", ev.Action)
+		}
+		return err
+	}
+}
+
+// newIPExtractor returns how to tell the IP address of the client
+// which made a request. Forwarding headers are only honored when
+// set by one of the trusted proxies, lest clients spoof them.
+func newIPExtractor(trustedProxies []string) (echo.IPExtractor, error) {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+	opts := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, cidr := range trustedProxies {
+		_, ipnet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid trusted proxy %s", cidr)
+		}
+		opts = append(opts, echo.TrustIPRange(ipnet))
+	}
+	return echo.ExtractIPFromXFFHeader(opts...), nil
+}
+
+func auditTarget(c echo.Context) (string, string) {
+	resource, _, _ := strings.Cut(strings.TrimPrefix(c.Path(), "/"), "/")
+	targetType := auditTargetTypes[resource]
+	if id, ok := c.Get(auditTargetKey).(string); ok {
+		return targetType, id
+	}
+	switch targetType {
+	case tork.AUDIT_TARGET_USER:
+		return targetType, c.Param("username")
+	case tork.AUDIT_TARGET_ROLE:
+		return targetType, c.Param("role")
+	case tork.AUDIT_TARGET_QUEUE, tork.AUDIT_TARGET_NAMESPACE, tork.AUDIT_TARGET_SECRET:
+		return targetType, c.Param("name")
+	default:
+		return targetType, c.Param("id")
+	}
+}
+
+// listAuditEvents
+// @Summary Get a list of audit events
+// @Tags audit
+// @Produce application/json
+// @Success 200 {object} []tork.AuditEvent
+// @Router /audit [get]
+// @Param username query string false "username"
+// @Param action query string false "action, e.g. PUT /jobs/:id/cancel"
+// @Param type query string false "target type"
+// @Param target query string false "target id"
+// @Param since query string false "RFC 3339 timestamp"
+// @Param until query string false "RFC 3339 timestamp"
+// @Param page query int false "page number"
+// @Param size query int false "page size"
+func (s *API) listAuditEvents(c echo.Context) error {
+	ps := c.QueryParam("page")
+	if ps == "" {
+		ps = "1"
+	}
+	page, err := strconv.Atoi(ps)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid page number: %s", ps))
+	}
+	if page < 1 {
+		page = 1
+	}
+	si := c.QueryParam("size")
+	if si == "" {
+		si = "10"
+	}
+	size, err := strconv.Atoi(si)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid size: %s", si))
+	}
+	if size < 1 {
+		size = 1
+	} else if size > 100 {
+		size = 100
+	}
+	q := datastore.AuditQuery{
+		Username:   c.QueryParam("username"),
+		Action:     c.QueryParam("action"),
+		TargetType: c.QueryParam("type"),
+		TargetID:   c.QueryParam("target"),
+	}
+	if q.Since, err = parseTime(c.QueryParam("since")); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid since: %s", err.Error()))
+	}
+	if q.Until, err = parseTime(c.QueryParam("until")); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid until: %s", err.Error()))
+	}
+	res, err := s.ds.GetAuditEvents(c.Request().Context(), q, page, size)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func parseTime(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, err
+	}
+	t = t.UTC()
+	return &t, nil
+}
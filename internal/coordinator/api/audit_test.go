@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/broker"
+	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/datastore/postgres"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_audit(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	admin, err := ds.GetRole(ctx, tork.ROLE_ADMIN)
+	assert.NoError(t, err)
+	alice := &tork.User{Username: "alice", Name: "Alice"}
+	assert.NoError(t, ds.CreateUser(ctx, alice))
+	assert.NoError(t, ds.AssignRole(ctx, alice.ID, admin.ID))
+	bob := &tork.User{Username: "bob", Name: "Bob"}
+	assert.NoError(t, ds.CreateUser(ctx, bob))
+
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+		Middleware: Middleware{
+			Echo: []echo.MiddlewareFunc{
+				func(next echo.HandlerFunc) echo.HandlerFunc {
+					return func(c echo.Context) error {
+						username := c.Request().Header.Get("X-Username")
+						c.SetRequest(c.Request().WithContext(context.WithValue(c.Request().Context(), tork.USERNAME, username)))
+						return next(c)
+					}
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	do := func(username, method, path, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("X-Username", username)
+		w := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("bob", "POST", "/jobs", `{"name":"test job","tasks":[{"name":"test task","image":"some:image"}]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	js := tork.JobSummary{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &js))
+
+	w = do("bob", "PUT", fmt.Sprintf("/jobs/%s/cancel", js.ID), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// reads aren't audited
+	w = do("bob", "GET", fmt.Sprintf("/jobs/%s", js.ID), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	events, err := ds.GetAuditEvents(ctx, datastore.AuditQuery{TargetID: js.ID}, 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, events.TotalItems)
+	assert.Equal(t, "PUT /jobs/:id/cancel", events.Items[0].Action)
+	assert.Equal(t, "bob", events.Items[0].Username)
+	assert.Equal(t, tork.AUDIT_TARGET_JOB, events.Items[0].TargetType)
+	assert.Equal(t, http.StatusOK, events.Items[0].Status)
+	assert.Equal(t, "POST /jobs", events.Items[1].Action)
+
+	// reading the audit log requires the audit:read action
+	w = do("bob", "GET", "/audit?target="+js.ID, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = do("alice", "GET", "/audit?username=bob&action="+"PUT%20/jobs/:id/cancel", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	page := datastore.Page[*tork.AuditEvent]{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, 1, page.TotalItems)
+	assert.Equal(t, js.ID, page.Items[0].TargetID)
+
+	w = do("alice", "GET", "/audit?since=yesterday", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	assert.NoError(t, ds.Close())
+}
+
+func Test_newIPExtractor(t *testing.T) {
+	req := httptest.NewRequest("PUT", "/jobs/1234/cancel", nil)
+	req.RemoteAddr = "10.1.2.3:41234"
+	req.Header.Set(echo.HeaderXForwardedFor, "6.6.6.6")
+	req.Header.Set(echo.HeaderXRealIP, "6.6.6.6")
+
+	// forwarding headers are ignored without trusted proxies
+	extract, err := newIPExtractor(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.1.2.3", extract(req))
+
+	extract, err = newIPExtractor([]string{"10.0.0.0/8"})
+	assert.NoError(t, err)
+	assert.Equal(t, "6.6.6.6", extract(req))
+
+	extract, err = newIPExtractor([]string{"192.168.0.0/16"})
+	assert.NoError(t, err)
+	assert.Equal(t, "10.1.2.3", extract(req))
+
+	_, err = newIPExtractor([]string{"10.0.0.0"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,282 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/datastore/search"
+)
+
+const (
+	// bulk operations may apply to at most this many jobs
+	MAX_BULK_JOBS = 10_000
+	// the number of jobs matching a query fetched at a time
+	bulkPageSize = 100
+	// a bulk operation saves its progress every so many jobs
+	bulkProgressInterval = 50
+)
+
+// bulkActions maps the actions of bulk operations
+// to the policy action they require.
+var bulkActions = map[tork.BulkAction]string{
+	tork.BulkActionCancel:  tork.ACTION_JOB_CANCEL,
+	tork.BulkActionRestart: tork.ACTION_JOB_RESTART,
+	tork.BulkActionDelete:  tork.ACTION_JOB_DELETE,
+	tork.BulkActionRetag:   tork.ACTION_JOB_SUBMIT,
+}
+
+var errBulkInterrupted = errors.New("interrupted by the shutdown of the coordinator")
+
+type bulkRequest struct {
+	Action    tork.BulkAction `json:"action"`
+	IDs       []string        `json:"ids,omitempty"`
+	Query     string          `json:"q,omitempty"`
+	Tags      []string        `json:"tags,omitempty"`
+	Namespace string          `json:"namespace,omitempty"`
+}
+
+// createBulkOperation
+// @Summary Apply an action to many jobs
+// @Description Cancels, restarts, deletes or retags either the listed jobs
+// @Description or the jobs matching a search query, in the background.
+// @Tags jobs
+// @Accept json
+// @Produce json
+// @Success 202 {object} tork.BulkOperation
+// @Failure 400 {object} echo.HTTPError
+// @Router /jobs/bulk [post]
+// @Param request body bulkRequest true "body"
+func (s *API) createBulkOperation(c echo.Context) error {
+	ctx := c.Request().Context()
+	var req bulkRequest
+	if err := bindInputJSON(&req, c.Request().Body); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	action, ok := bulkActions[req.Action]
+	if !ok {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown bulk action: %s", req.Action))
+	}
+	if err := s.authorize(ctx, action, ""); err != nil {
+		return err
+	}
+	if (len(req.IDs) == 0) == (req.Query == "") {
+		return echo.NewHTTPError(http.StatusBadRequest, "must provide either job ids or a search query")
+	}
+	if len(req.IDs) > MAX_BULK_JOBS {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("can not apply to more than %d jobs at once", MAX_BULK_JOBS))
+	}
+	if req.Action == tork.BulkActionRetag && req.Tags == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "must provide the tags to retag the jobs with")
+	} else if req.Action != tork.BulkActionRetag && len(req.Tags) > 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("tags are not supported by %s", req.Action))
+	}
+	ns, err := s.authorizeNamespace(ctx, requestNamespace(c, req.Namespace))
+	if err != nil {
+		return err
+	}
+	var username string
+	if cu, ok := ctx.Value(tork.USERNAME).(string); ok {
+		username = cu
+	}
+	op := &tork.BulkOperation{
+		Action:    req.Action,
+		Namespace: ns.Name,
+		Query:     req.Query,
+		Tags:      req.Tags,
+		State:     tork.BulkOperationStateRunning,
+		CreatedBy: username,
+	}
+	ids := make([]string, 0, len(req.IDs))
+	seen := make(map[string]bool)
+	for _, id := range req.IDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	op.Total = len(ids)
+	var q *search.Query
+	var first *datastore.Page[*tork.JobSummary]
+	if req.Query != "" {
+		q, err = search.Parse(req.Query)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid query: %s", err.Error()))
+		}
+		// the jobs are walked in the order they were created, which
+		// the action can't change, so none are skipped or repeated
+		q.Sort = search.DefaultSort
+		first, err = s.ds.GetJobs(ctx, username, ns.Name, q, "", 1, bulkPageSize)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		if first.TotalItems > MAX_BULK_JOBS {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("query matches %d jobs, can not apply to more than %d jobs at once", first.TotalItems, MAX_BULK_JOBS))
+		}
+		op.Total = first.TotalItems
+	}
+	if err := s.ds.CreateBulkOperation(ctx, op); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	go s.runBulkOperation(context.WithoutCancel(ctx), op.Clone(), ids, q, first)
+	return c.JSON(http.StatusAccepted, op)
+}
+
+// getBulkOperation
+// @Summary Get the progress of a bulk operation
+// @Tags jobs
+// @Produce json
+// @Success 200 {object} tork.BulkOperation
+// @Failure 404 {object} echo.HTTPError
+// @Router /jobs/bulk/{id} [get]
+// @Param id path string true "Bulk operation ID"
+func (s *API) getBulkOperation(c echo.Context) error {
+	ctx := c.Request().Context()
+	op, err := s.ds.GetBulkOperationByID(ctx, c.Param("id"))
+	if errors.Is(err, datastore.ErrBulkOperationNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if _, err := s.authorizeNamespace(ctx, op.Namespace); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, op)
+}
+
+// runBulkOperation applies the action of the operation to either the
+// listed jobs or the jobs matching the query, starting with the first
+// page of them, saving the progress of the operation as it goes.
+func (s *API) runBulkOperation(ctx context.Context, op *tork.BulkOperation, ids []string, q *search.Query, first *datastore.Page[*tork.JobSummary]) {
+	apply := func(id string) error {
+		select {
+		case <-s.terminate:
+			return errBulkInterrupted
+		default:
+		}
+		op.AddResult(s.applyBulkAction(ctx, op, id))
+		if len(op.Results)%bulkProgressInterval == 0 {
+			if err := s.saveBulkOperation(ctx, op); err != nil {
+				log.Error().Err(err).Msgf("error saving the progress of bulk operation %s", op.ID)
+			}
+		}
+		return nil
+	}
+	var err error
+	if q == nil {
+		for _, id := range ids {
+			if err = apply(id); err != nil {
+				break
+			}
+		}
+	} else {
+		page := first
+	pages:
+		for {
+			for _, j := range page.Items {
+				if len(op.Results) >= MAX_BULK_JOBS {
+					break pages
+				}
+				if err = apply(j.ID); err != nil {
+					break pages
+				}
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			page, err = s.ds.GetJobs(ctx, op.CreatedBy, op.Namespace, q, page.NextCursor, 1, bulkPageSize)
+			if err != nil {
+				break
+			}
+		}
+	}
+	now := time.Now().UTC()
+	op.CompletedAt = &now
+	if err != nil {
+		op.State = tork.BulkOperationStateFailed
+		op.Error = err.Error()
+	} else {
+		op.State = tork.BulkOperationStateCompleted
+		op.Total = len(op.Results)
+	}
+	if err := s.saveBulkOperation(ctx, op); err != nil {
+		log.Error().Err(err).Msgf("error saving bulk operation %s", op.ID)
+	}
+}
+
+func (s *API) saveBulkOperation(ctx context.Context, op *tork.BulkOperation) error {
+	return s.ds.UpdateBulkOperation(ctx, op.ID, func(u *tork.BulkOperation) error {
+		u.State = op.State
+		u.Total = op.Total
+		u.Succeeded = op.Succeeded
+		u.Skipped = op.Skipped
+		u.Failed = op.Failed
+		u.Error = op.Error
+		u.Results = op.Results
+		u.CompletedAt = op.CompletedAt
+		return nil
+	})
+}
+
+// applyBulkAction applies the action of the operation to a job, under
+// the same rules as applying the action to the job on its own.
+func (s *API) applyBulkAction(ctx context.Context, op *tork.BulkOperation, id string) *tork.BulkResult {
+	failed := func(err error) *tork.BulkResult {
+		return &tork.BulkResult{JobID: id, Outcome: tork.BulkOutcomeFailed, Error: err.Error()}
+	}
+	skipped := func(err error) *tork.BulkResult {
+		return &tork.BulkResult{JobID: id, Outcome: tork.BulkOutcomeSkipped, Error: err.Error()}
+	}
+	j, err := s.ds.GetJobByID(ctx, id)
+	if err != nil {
+		return failed(err)
+	}
+	// the operation is only authorized for its namespace
+	if j.Namespace != op.Namespace {
+		return failed(datastore.ErrJobNotFound)
+	}
+	if err := s.authorizeJobPermissions(ctx, j); err != nil {
+		return failed(datastore.ErrJobNotFound)
+	}
+	switch op.Action {
+	case tork.BulkActionCancel:
+		if err := checkCancel(j); err != nil {
+			return skipped(err)
+		}
+		j.State = tork.JobStateCancelled
+		if err := s.broker.PublishJob(ctx, j); err != nil {
+			return failed(err)
+		}
+	case tork.BulkActionRestart:
+		if err := checkRestart(j); err != nil {
+			return skipped(err)
+		}
+		j.State = tork.JobStateRestart
+		if err := s.broker.PublishJob(ctx, j); err != nil {
+			return failed(err)
+		}
+	case tork.BulkActionDelete:
+		if err := checkDelete(j); err != nil {
+			return skipped(err)
+		}
+		if err := s.ds.DeleteJob(ctx, id); err != nil {
+			return failed(err)
+		}
+	case tork.BulkActionRetag:
+		if err := s.ds.UpdateJob(ctx, id, func(u *tork.Job) error {
+			u.Tags = op.Tags
+			return nil
+		}); err != nil {
+			return failed(err)
+		}
+	default:
+		return failed(errors.Errorf("unknown bulk action: %s", op.Action))
+	}
+	return &tork.BulkResult{JobID: id, Outcome: tork.BulkOutcomeOK}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/broker"
+	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/datastore/postgres"
+	"github.com/runabol/tork/internal/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_bulkOperations(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	tag := uuid.NewShortUUID()
+	running := make([]string, 0)
+	for i := 0; i < 3; i++ {
+		j := &tork.Job{
+			ID:        uuid.NewUUID(),
+			State:     tork.JobStateRunning,
+			Tags:      []string{tag},
+			CreatedAt: time.Now().UTC(),
+		}
+		assert.NoError(t, ds.CreateJob(ctx, j))
+		running = append(running, j.ID)
+	}
+	completed := &tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateCompleted,
+		Tags:      []string{tag},
+		CreatedAt: time.Now().UTC(),
+	}
+	assert.NoError(t, ds.CreateJob(ctx, completed))
+
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+	})
+	assert.NoError(t, err)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Add("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+	wait := func(w *httptest.ResponseRecorder) *tork.BulkOperation {
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		op := &tork.BulkOperation{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), op))
+		for i := 0; i < 50 && op.State == tork.BulkOperationStateRunning; i++ {
+			time.Sleep(100 * time.Millisecond)
+			w := do("GET", "/jobs/bulk/"+op.ID, "")
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), op))
+		}
+		assert.Equal(t, tork.BulkOperationStateCompleted, op.State)
+		return op
+	}
+
+	ids, err := json.Marshal(append(running, completed.ID, "no-such-job"))
+	assert.NoError(t, err)
+	op := wait(do("POST", "/jobs/bulk", fmt.Sprintf(`{"action":"cancel","ids":%s}`, ids)))
+	assert.Equal(t, 5, op.Total)
+	assert.Equal(t, 3, op.Succeeded)
+	assert.Equal(t, 1, op.Skipped)
+	assert.Equal(t, 1, op.Failed)
+	assert.Len(t, op.Results, 5)
+	assert.Equal(t, tork.BulkResult{JobID: completed.ID, Outcome: tork.BulkOutcomeSkipped, Error: "job is not running"}, *op.Results[3])
+
+	op = wait(do("POST", "/jobs/bulk", fmt.Sprintf(`{"action":"retag","q":"tag:%s","tags":["cleaned-up"]}`, tag)))
+	assert.Equal(t, 4, op.Total)
+	assert.Equal(t, 4, op.Succeeded)
+	j, err := ds.GetJobByID(ctx, completed.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cleaned-up"}, j.Tags)
+
+	op = wait(do("POST", "/jobs/bulk", fmt.Sprintf(`{"action":"delete","ids":["%s","%s"]}`, completed.ID, running[0])))
+	assert.Equal(t, 1, op.Succeeded)
+	assert.Equal(t, 1, op.Skipped)
+	_, err = ds.GetJobByID(ctx, completed.ID)
+	assert.ErrorIs(t, err, datastore.ErrJobNotFound)
+
+	for _, body := range []string{
+		`{"action":"explode","ids":["1"]}`,
+		`{"action":"cancel"}`,
+		`{"action":"cancel","ids":["1"],"q":"state:RUNNING"}`,
+		`{"action":"cancel","q":"state:"}`,
+		`{"action":"retag","ids":["1"]}`,
+		`{"action":"cancel","ids":["1"],"tags":["a"]}`,
+	} {
+		w := do("POST", "/jobs/bulk", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	w := do("GET", "/jobs/bulk/no-such-operation", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NoError(t, ds.Close())
+}
@@ -0,0 +1,299 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/input"
+)
+
+var namespaceNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,62}[a-z0-9])?$`)
+
+// requestNamespace returns the namespace a request is scoped
+// to: the one named by the request body, if any, else by the
+// namespace query parameter, else the default namespace.
+func requestNamespace(c echo.Context, name string) string {
+	if name != "" {
+		return name
+	}
+	if name = c.QueryParam("namespace"); name != "" {
+		return name
+	}
+	return tork.NAMESPACE_DEFAULT
+}
+
+// authorizeNamespace returns the namespace provided the current
+// user may access it. Every user may access the default namespace
+// while others are restricted to their members and to admins.
+func (s *API) authorizeNamespace(ctx context.Context, name string) (*tork.Namespace, error) {
+	ns, err := s.ds.GetNamespace(ctx, name)
+	if errors.Is(err, datastore.ErrNamespaceNotFound) {
+		return nil, echo.NewHTTPError(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if ns.Name == tork.NAMESPACE_DEFAULT {
+		return ns, nil
+	}
+	cu, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if cu == nil {
+		return ns, nil
+	}
+	admin, err := s.isAdmin(ctx, cu)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if admin {
+		return ns, nil
+	}
+	member, err := s.ds.IsNamespaceMember(ctx, ns.ID, cu.ID)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if !member {
+		return nil, echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("access to namespace %s is not permitted", ns.Name))
+	}
+	return ns, nil
+}
+
+// authorizeJobNamespace checks the current user may access the
+// namespace of the given job, returning a 404 rather than a 403
+// so as not to disclose jobs of other namespaces.
+func (s *API) authorizeJobNamespace(ctx context.Context, namespace string) error {
+	if _, err := s.authorizeNamespace(ctx, namespace); err != nil {
+		var he *echo.HTTPError
+		if errors.As(err, &he) && he.Code == http.StatusForbidden {
+			return echo.NewHTTPError(http.StatusNotFound, datastore.ErrJobNotFound.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+// applyNamespaceDefaults routes the job's tasks to the namespace's
+// default queue unless the job names a default queue of its own.
+func applyNamespaceDefaults(ns *tork.Namespace, defaults **input.Defaults) {
+	if ns.DefaultQueue == "" {
+		return
+	}
+	if *defaults == nil {
+		*defaults = &input.Defaults{}
+	}
+	if (*defaults).Queue == "" {
+		(*defaults).Queue = ns.DefaultQueue
+	}
+}
+
+// checkQuota rejects a job submission which would exceed
+// the namespace's limit on active jobs.
+func (s *API) checkQuota(ctx context.Context, ns *tork.Namespace) error {
+	if ns.Quota == nil || ns.Quota.MaxActiveJobs <= 0 {
+		return nil
+	}
+	active, err := s.ds.CountActiveJobs(ctx, ns.Name)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if active >= ns.Quota.MaxActiveJobs {
+		return echo.NewHTTPError(http.StatusTooManyRequests,
+			fmt.Sprintf("namespace %s has reached its quota of %d active jobs", ns.Name, ns.Quota.MaxActiveJobs))
+	}
+	return nil
+}
+
+// listNamespaces
+// @Summary Get a list of namespaces
+// @Tags namespaces
+// @Produce json
+// @Success 200 {object} []tork.Namespace
+// @Router /namespaces [get]
+func (s *API) listNamespaces(c echo.Context) error {
+	ctx := c.Request().Context()
+	nss, err := s.ds.GetNamespaces(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	result := make([]*tork.Namespace, 0, len(nss))
+	for _, ns := range nss {
+		if _, err := s.authorizeNamespace(ctx, ns.Name); err != nil {
+			continue
+		}
+		result = append(result, ns)
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// getNamespace
+// @Summary Get a namespace and its members
+// @Tags namespaces
+// @Produce json
+// @Success 200 {object} tork.Namespace
+// @Failure 404 {object} echo.HTTPError
+// @Router /namespaces/{name} [get]
+// @Param name path string true "Namespace name"
+func (s *API) getNamespace(c echo.Context) error {
+	ns, err := s.authorizeNamespace(c.Request().Context(), c.Param("name"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, ns)
+}
+
+// createNamespace
+// @Summary Create a new namespace
+// @Tags namespaces
+// @Accept json
+// @Produce json
+// @Success 200 {object} tork.Namespace
+// @Failure 400 {object} echo.HTTPError
+// @Router /namespaces [post]
+// @Param request body tork.Namespace true "body"
+func (s *API) createNamespace(c echo.Context) error {
+	var ns tork.Namespace
+	if err := bindInputJSON(&ns, c.Request().Body); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	ns.Name = strings.TrimSpace(ns.Name)
+	if !namespaceNamePattern.MatchString(ns.Name) {
+		return echo.NewHTTPError(http.StatusBadRequest, "namespace name must consist of up to 64 lowercase alphanumeric characters or '-'")
+	}
+	if ns.Quota != nil && ns.Quota.MaxActiveJobs < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "quota.maxActiveJobs can not be negative")
+	}
+	ns.Members = nil
+	_, err := s.ds.GetNamespace(c.Request().Context(), ns.Name)
+	if err == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "namespace already exists")
+	} else if !errors.Is(err, datastore.ErrNamespaceNotFound) {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if err := s.ds.CreateNamespace(c.Request().Context(), &ns); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	c.Set(auditTargetKey, ns.Name)
+	return c.JSON(http.StatusOK, ns)
+}
+
+// updateNamespace
+// @Summary Update a namespace's description, default queue and quota
+// @Tags namespaces
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} echo.HTTPError
+// @Router /namespaces/{name} [put]
+// @Param name path string true "Namespace name"
+// @Param request body tork.Namespace true "body"
+func (s *API) updateNamespace(c echo.Context) error {
+	var req tork.Namespace
+	if err := bindInputJSON(&req, c.Request().Body); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if req.Quota != nil && req.Quota.MaxActiveJobs < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "quota.maxActiveJobs can not be negative")
+	}
+	err := s.ds.UpdateNamespace(c.Request().Context(), c.Param("name"), func(n *tork.Namespace) error {
+		n.Description = req.Description
+		n.DefaultQueue = req.DefaultQueue
+		n.Quota = req.Quota
+		return nil
+	})
+	if errors.Is(err, datastore.ErrNamespaceNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+}
+
+// deleteNamespace
+// @Summary Delete a namespace
+// @Description Only namespaces without jobs or scheduled jobs can be deleted
+// @Tags namespaces
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} echo.HTTPError
+// @Failure 400 {object} echo.HTTPError
+// @Router /namespaces/{name} [delete]
+// @Param name path string true "Namespace name"
+func (s *API) deleteNamespace(c echo.Context) error {
+	name := c.Param("name")
+	if name == tork.NAMESPACE_DEFAULT {
+		return echo.NewHTTPError(http.StatusBadRequest, "the default namespace can not be deleted")
+	}
+	err := s.ds.DeleteNamespace(c.Request().Context(), name)
+	if errors.Is(err, datastore.ErrNamespaceNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	} else if errors.Is(err, datastore.ErrNamespaceInUse) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+}
+
+// addNamespaceMember
+// @Summary Grant a user, or the users of a role, access to a namespace
+// @Tags namespaces
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} echo.HTTPError
+// @Router /namespaces/{name}/users/{username} [put]
+// @Router /namespaces/{name}/roles/{role} [put]
+// @Param name path string true "Namespace name"
+// @Param username path string false "Username"
+// @Param role path string false "Role slug"
+func (s *API) addNamespaceMember(c echo.Context) error {
+	return s.updateNamespaceMember(c, s.ds.AddNamespaceMember)
+}
+
+// removeNamespaceMember
+// @Summary Revoke the access of a user, or of the users of a role, to a namespace
+// @Tags namespaces
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} echo.HTTPError
+// @Router /namespaces/{name}/users/{username} [delete]
+// @Router /namespaces/{name}/roles/{role} [delete]
+// @Param name path string true "Namespace name"
+// @Param username path string false "Username"
+// @Param role path string false "Role slug"
+func (s *API) removeNamespaceMember(c echo.Context) error {
+	return s.updateNamespaceMember(c, s.ds.RemoveNamespaceMember)
+}
+
+func (s *API) updateNamespaceMember(c echo.Context, update func(ctx context.Context, namespaceID string, m *tork.NamespaceMember) error) error {
+	ctx := c.Request().Context()
+	ns, err := s.ds.GetNamespace(ctx, c.Param("name"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	m := &tork.NamespaceMember{}
+	if username := c.Param("username"); username != "" {
+		u, err := s.ds.GetUser(ctx, username)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		m.User = u
+	} else {
+		r, err := s.ds.GetRole(ctx, c.Param("role"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		m.Role = r
+	}
+	if err := update(ctx, ns.ID, m); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+}
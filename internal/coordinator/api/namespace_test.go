@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/broker"
+	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/datastore/postgres"
+	"github.com/runabol/tork/internal/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_namespaces(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	admin, err := ds.GetRole(ctx, tork.ROLE_ADMIN)
+	assert.NoError(t, err)
+	alice := &tork.User{Username: "alice", Name: "Alice"}
+	assert.NoError(t, ds.CreateUser(ctx, alice))
+	assert.NoError(t, ds.AssignRole(ctx, alice.ID, admin.ID))
+	bob := &tork.User{Username: "bob", Name: "Bob"}
+	assert.NoError(t, ds.CreateUser(ctx, bob))
+	carol := &tork.User{Username: "carol", Name: "Carol"}
+	assert.NoError(t, ds.CreateUser(ctx, carol))
+
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+		Middleware: Middleware{
+			Echo: []echo.MiddlewareFunc{
+				func(next echo.HandlerFunc) echo.HandlerFunc {
+					return func(c echo.Context) error {
+						username := c.Request().Header.Get("X-Username")
+						c.SetRequest(c.Request().WithContext(context.WithValue(c.Request().Context(), tork.USERNAME, username)))
+						return next(c)
+					}
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	do := func(username, method, path, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("X-Username", username)
+		w := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// managing namespaces requires the namespace:manage action
+	w := do("bob", "POST", "/namespaces", `{"name":"team-a"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = do("alice", "POST", "/namespaces", `{"name":"Team A"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do("alice", "POST", "/namespaces", `{"name":"team-a","defaultQueue":"team-a","quota":{"maxActiveJobs":1}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = do("alice", "PUT", "/namespaces/team-a/users/bob", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// members see the namespace, others don't
+	w = do("bob", "GET", "/namespaces", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	nss := []*tork.Namespace{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &nss))
+	assert.Len(t, nss, 2)
+
+	w = do("carol", "GET", "/namespaces", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	nss = []*tork.Namespace{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &nss))
+	assert.Len(t, nss, 1)
+
+	w = do("carol", "GET", "/namespaces/team-a", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// jobs are submitted to the namespace's default queue
+	w = do("bob", "POST", "/jobs?namespace=team-a", `{"name":"test job","tasks":[{"name":"test task","image":"some:image"}]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	js := tork.JobSummary{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &js))
+	assert.Equal(t, "team-a", js.Namespace)
+	j, err := ds.GetJobByID(ctx, js.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "team-a", j.Defaults.Queue)
+
+	// the quota allows a single active job
+	w = do("bob", "POST", "/jobs", `{"name":"test job","namespace":"team-a","tasks":[{"name":"test task","image":"some:image"}]}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	w = do("carol", "POST", "/jobs?namespace=team-a", `{"name":"test job","tasks":[{"name":"test task","image":"some:image"}]}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = do("carol", "POST", "/jobs", `{"name":"test job","tasks":[{"name":"test task","image":"some:image"}]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// job listings are scoped to a single namespace
+	w = do("bob", "GET", "/jobs?namespace=team-a", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	page := datastore.Page[*tork.JobSummary]{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Equal(t, 1, page.TotalItems)
+	assert.Equal(t, js.ID, page.Items[0].ID)
+
+	w = do("carol", "GET", "/jobs?namespace=team-a", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = do("carol", "GET", fmt.Sprintf("/jobs/%s", js.ID), "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = do("bob", "GET", fmt.Sprintf("/jobs/%s", js.ID), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// so are the job's tasks and their logs
+	now := time.Now().UTC()
+	tk := &tork.Task{ID: uuid.NewUUID(), JobID: js.ID, Name: "test task", CreatedAt: &now}
+	assert.NoError(t, ds.CreateTask(ctx, tk))
+
+	w = do("carol", "GET", fmt.Sprintf("/tasks/%s", tk.ID), "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = do("carol", "GET", fmt.Sprintf("/tasks/%s/log", tk.ID), "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = do("bob", "GET", fmt.Sprintf("/tasks/%s", tk.ID), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = do("bob", "GET", fmt.Sprintf("/tasks/%s/log", tk.ID), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = do("alice", "DELETE", "/namespaces/team-a", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do("alice", "DELETE", "/namespaces/default", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	assert.NoError(t, ds.Close())
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/internal/secrets"
+)
+
+var secretNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// secretResource names a stored secret in policies, which may
+// grant the use of all the secrets of a namespace as
+// "<namespace>/*". Secrets of providers are named by their
+// reference, e.g. "vault:kv/data/app#token".
+func secretResource(namespace, name string) string {
+	return fmt.Sprintf("%s/%s", namespace, name)
+}
+
+// authorizeSecrets checks that the secrets referenced by the tasks
+// exist and that the current user may use them: the stored secrets
+// of the namespace and the secrets of registered secret providers.
+func (s *API) authorizeSecrets(ctx context.Context, namespace string, tasks any, inline map[string]string) error {
+	if s.secrets != nil {
+		names, err := secrets.Stored(tasks, inline)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		for _, name := range names {
+			if _, err := s.ds.GetSecret(ctx, namespace, name); errors.Is(err, datastore.ErrSecretNotFound) {
+				return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown secret: %s", name))
+			} else if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			}
+			if err := s.authorize(ctx, tork.ACTION_SECRET_USE, secretResource(namespace, name)); err != nil {
+				return err
+			}
+		}
+	}
+	refs, err := secrets.ProviderRefs(tasks)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	for _, ref := range refs {
+		scheme, _, err := secrets.ParseRef(ref)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if s.resolver == nil || !s.resolver.HasProvider(scheme) {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown secret provider: %s", scheme))
+		}
+		if err := s.authorize(ctx, tork.ACTION_SECRET_USE, ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listSecrets
+// @Summary Get a list of the secrets of a namespace
+// @Description Secret values are never returned
+// @Tags secrets
+// @Produce json
+// @Success 200 {object} []tork.Secret
+// @Router /secrets [get]
+// @Param namespace query string false "Namespace"
+func (s *API) listSecrets(c echo.Context) error {
+	ctx := c.Request().Context()
+	ns, err := s.authorizeNamespace(ctx, requestNamespace(c, ""))
+	if err != nil {
+		return err
+	}
+	secs, err := s.ds.GetSecrets(ctx, ns.Name)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	for _, sec := range secs {
+		sec.Value = ""
+	}
+	return c.JSON(http.StatusOK, secs)
+}
+
+// createSecret
+// @Summary Create a new secret
+// @Tags secrets
+// @Accept json
+// @Produce json
+// @Success 200 {object} tork.Secret
+// @Failure 400 {object} echo.HTTPError
+// @Router /secrets [post]
+// @Param request body tork.Secret true "body"
+func (s *API) createSecret(c echo.Context) error {
+	ctx := c.Request().Context()
+	var sec tork.Secret
+	if err := bindInputJSON(&sec, c.Request().Body); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if !secretNamePattern.MatchString(sec.Name) {
+		return echo.NewHTTPError(http.StatusBadRequest, "secret name must consist of up to 64 alphanumeric characters or '_' and must not start with a digit")
+	}
+	if sec.Value == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "secret value is required")
+	}
+	ns, err := s.authorizeNamespace(ctx, requestNamespace(c, sec.Namespace))
+	if err != nil {
+		return err
+	}
+	sec.Namespace = ns.Name
+	_, err = s.ds.GetSecret(ctx, sec.Namespace, sec.Name)
+	if err == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "secret already exists")
+	} else if !errors.Is(err, datastore.ErrSecretNotFound) {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	ciphertext, err := s.secrets.Seal(sec.Value)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	sec.Value = ""
+	sec.Ciphertext = ciphertext
+	if err := s.ds.CreateSecret(ctx, &sec); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	c.Set(auditTargetKey, sec.Name)
+	return c.JSON(http.StatusOK, sec)
+}
+
+// updateSecret
+// @Summary Update the value of a secret
+// @Tags secrets
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} echo.HTTPError
+// @Router /secrets/{name} [put]
+// @Param name path string true "Secret name"
+// @Param namespace query string false "Namespace"
+// @Param request body tork.Secret true "body"
+func (s *API) updateSecret(c echo.Context) error {
+	ctx := c.Request().Context()
+	var req tork.Secret
+	if err := bindInputJSON(&req, c.Request().Body); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if req.Value == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "secret value is required")
+	}
+	ns, err := s.authorizeNamespace(ctx, requestNamespace(c, req.Namespace))
+	if err != nil {
+		return err
+	}
+	ciphertext, err := s.secrets.Seal(req.Value)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	err = s.ds.UpdateSecret(ctx, ns.Name, c.Param("name"), func(u *tork.Secret) error {
+		u.Ciphertext = ciphertext
+		return nil
+	})
+	if errors.Is(err, datastore.ErrSecretNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+}
+
+// deleteSecret
+// @Summary Delete a secret
+// @Tags secrets
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} echo.HTTPError
+// @Router /secrets/{name} [delete]
+// @Param name path string true "Secret name"
+// @Param namespace query string false "Namespace"
+func (s *API) deleteSecret(c echo.Context) error {
+	ctx := c.Request().Context()
+	ns, err := s.authorizeNamespace(ctx, requestNamespace(c, ""))
+	if err != nil {
+		return err
+	}
+	err = s.ds.DeleteSecret(ctx, ns.Name, c.Param("name"))
+	if errors.Is(err, datastore.ErrSecretNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/broker"
+	"github.com/runabol/tork/datastore/postgres"
+	"github.com/runabol/tork/internal/secrets"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_secrets(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	admin, err := ds.GetRole(ctx, tork.ROLE_ADMIN)
+	assert.NoError(t, err)
+	alice := &tork.User{Username: "alice", Name: "Alice"}
+	assert.NoError(t, ds.CreateUser(ctx, alice))
+	assert.NoError(t, ds.AssignRole(ctx, alice.ID, admin.ID))
+	bob := &tork.User{Username: "bob", Name: "Bob"}
+	assert.NoError(t, ds.CreateUser(ctx, bob))
+
+	store, err := secrets.NewStore(ds, make([]byte, 32))
+	assert.NoError(t, err)
+
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+		Secrets:   store,
+		Resolver: secrets.NewResolver(store, map[string]tork.SecretProvider{
+			"env": secrets.NewEnvProvider("TORK_SECRET_"),
+		}),
+		Middleware: Middleware{
+			Echo: []echo.MiddlewareFunc{
+				func(next echo.HandlerFunc) echo.HandlerFunc {
+					return func(c echo.Context) error {
+						username := c.Request().Header.Get("X-Username")
+						c.SetRequest(c.Request().WithContext(context.WithValue(c.Request().Context(), tork.USERNAME, username)))
+						return next(c)
+					}
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	do := func(username, method, path, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("X-Username", username)
+		w := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	name := "DB_PASSWORD"
+
+	// managing secrets requires the secret:manage action
+	w := do("bob", "POST", "/secrets", `{"name":"`+name+`","value":"hush"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = do("alice", "POST", "/secrets", `{"name":"1nvalid","value":"hush"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do("alice", "POST", "/secrets", `{"name":"`+name+`","value":"hush"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "hush")
+
+	w = do("alice", "POST", "/secrets", `{"name":"`+name+`","value":"hush"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// the value is encrypted at rest
+	sec, err := ds.GetSecret(ctx, tork.NAMESPACE_DEFAULT, name)
+	assert.NoError(t, err)
+	assert.NotContains(t, sec.Ciphertext, "hush")
+	values, err := store.Resolve(ctx, tork.NAMESPACE_DEFAULT, []string{name})
+	assert.NoError(t, err)
+	assert.Equal(t, "hush", values[name])
+
+	// values are never returned
+	w = do("bob", "GET", "/secrets", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	secs := []*tork.Secret{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &secs))
+	for _, s := range secs {
+		assert.Empty(t, s.Value)
+	}
+	assert.NotContains(t, w.Body.String(), "hush")
+
+	// using a secret requires the secret:use action
+	job := `{"name":"test job","tasks":[{"name":"test task","image":"some:image","env":{"PASSWORD":"{{ secrets.` + name + ` }}"}}]}`
+	w = do("bob", "POST", "/jobs", job)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = do("alice", "POST", "/jobs", `{"name":"test job","tasks":[{"name":"test task","image":"some:image","env":{"PASSWORD":"{{ secrets.UNKNOWN_SECRET }}"}}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do("alice", "POST", "/jobs", job)
+	assert.Equal(t, http.StatusOK, w.Code)
+	js := tork.JobSummary{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &js))
+	j, err := ds.GetJobByID(ctx, js.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, secrets.Placeholder(name), j.Context.Secrets[name])
+	assert.Empty(t, j.Secrets)
+
+	// secrets of providers are referenced as secret("<scheme>:<path>")
+	w = do("bob", "POST", "/jobs", `{"name":"test job","tasks":[{"name":"test task","image":"some:image","env":{"TOKEN":"{{ secret(\"env:TOKEN\") }}"}}]}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = do("alice", "POST", "/jobs", `{"name":"test job","tasks":[{"name":"test task","image":"some:image","env":{"TOKEN":"{{ secret(\"vault:kv/data/app#token\") }}"}}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do("alice", "POST", "/jobs", `{"name":"test job","tasks":[{"name":"test task","image":"some:image","env":{"TOKEN":"{{ secret(\"env:TOKEN\") }}"}}]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = do("alice", "PUT", "/secrets/"+name, `{"value":"hush2"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	values, err = store.Resolve(ctx, tork.NAMESPACE_DEFAULT, []string{name})
+	assert.NoError(t, err)
+	assert.Equal(t, "hush2", values[name])
+
+	w = do("alice", "DELETE", "/secrets/"+name, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do("alice", "DELETE", "/secrets/"+name, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	assert.NoError(t, ds.Close())
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore"
+)
+
+// defaultStatsWindow is the time window of the stats
+// when the request doesn't start it.
+const defaultStatsWindow = time.Hour * 24 * 7
+
+// getJobStats
+// @Summary Get the count, success rate and durations of the jobs which
+// completed, failed or were cancelled within a time window, by group
+// @Tags stats
+// @Produce application/json
+// @Success 200 {object} []tork.Stats
+// @Router /stats/jobs [get]
+// @Param by query string false "name | tag | user, default: name"
+// @Param since query string false "RFC 3339 timestamp, default: 7 days ago"
+// @Param until query string false "RFC 3339 timestamp"
+func (s *API) getJobStats(c echo.Context) error {
+	return s.getStats(c, s.ds.GetJobStats)
+}
+
+// getTaskStats
+// @Summary Get the count, success rate and durations of the tasks which
+// completed, failed or were cancelled within a time window, by group
+// @Tags stats
+// @Produce application/json
+// @Success 200 {object} []tork.Stats
+// @Router /stats/tasks [get]
+// @Param by query string false "name (of the job) | tag | queue | image | user, default: name"
+// @Param since query string false "RFC 3339 timestamp, default: 7 days ago"
+// @Param until query string false "RFC 3339 timestamp"
+func (s *API) getTaskStats(c echo.Context) error {
+	return s.getStats(c, s.ds.GetTaskStats)
+}
+
+func (s *API) getStats(c echo.Context, get func(ctx context.Context, currentUser, namespace string, q datastore.StatsQuery) ([]*tork.Stats, error)) error {
+	q := datastore.StatsQuery{GroupBy: c.QueryParam("by")}
+	if q.GroupBy == "" {
+		q.GroupBy = datastore.StatsByName
+	}
+	var err error
+	if q.Since, err = parseTime(c.QueryParam("since")); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid since: %s", err.Error()))
+	}
+	if q.Until, err = parseTime(c.QueryParam("until")); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid until: %s", err.Error()))
+	}
+	if q.Since == nil {
+		since := time.Now().UTC().Add(-defaultStatsWindow)
+		q.Since = &since
+	}
+	username, _ := c.Request().Context().Value(tork.USERNAME).(string)
+	ns, err := s.authorizeNamespace(c.Request().Context(), requestNamespace(c, ""))
+	if err != nil {
+		return err
+	}
+	stats, err := get(c.Request().Context(), username, ns.Name, q)
+	if errors.Is(err, datastore.ErrInvalidStatsGroup) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/broker"
+	"github.com/runabol/tork/datastore/postgres"
+	"github.com/runabol/tork/internal/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_getStats(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	name := uuid.NewShortUUID()
+	startedAt := time.Now().UTC().Add(-time.Minute)
+	for i := 0; i < 4; i++ {
+		j := &tork.Job{
+			ID:        uuid.NewUUID(),
+			Name:      name,
+			State:     tork.JobStateRunning,
+			CreatedAt: startedAt,
+			StartedAt: &startedAt,
+		}
+		assert.NoError(t, ds.CreateJob(ctx, j))
+		assert.NoError(t, ds.CreateTask(ctx, &tork.Task{
+			ID:        uuid.NewUUID(),
+			JobID:     j.ID,
+			Queue:     "default",
+			State:     tork.TaskStateFailed,
+			CreatedAt: &startedAt,
+		}))
+		assert.NoError(t, ds.UpdateJob(ctx, j.ID, func(u *tork.Job) error {
+			now := time.Now().UTC()
+			if i == 0 {
+				u.State = tork.JobStateFailed
+				u.FailedAt = &now
+			} else {
+				u.State = tork.JobStateCompleted
+				u.CompletedAt = &now
+			}
+			return nil
+		}))
+	}
+
+	api, err := NewAPI(Config{
+		DataStore: ds,
+		Broker:    broker.NewInMemoryBroker(),
+	})
+	assert.NoError(t, err)
+
+	get := func(path string) (*httptest.ResponseRecorder, []*tork.Stats) {
+		req, err := http.NewRequest("GET", path, nil)
+		assert.NoError(t, err)
+		w := httptest.NewRecorder()
+		api.server.Handler.ServeHTTP(w, req)
+		stats := make([]*tork.Stats, 0)
+		if w.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+		}
+		return w, stats
+	}
+
+	w, stats := get("/stats/jobs")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, stats, 1)
+	assert.Equal(t, name, stats[0].Group)
+	assert.Equal(t, 4, stats[0].Count)
+	assert.Equal(t, 0.75, stats[0].SuccessRate)
+	assert.Greater(t, stats[0].P50Duration, float64(0))
+
+	w, stats = get("/stats/tasks?by=queue")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, stats, 1)
+	assert.Equal(t, "default", stats[0].Group)
+	assert.Equal(t, 4, stats[0].Failed)
+	assert.Equal(t, float64(0), stats[0].SuccessRate)
+
+	w, stats = get("/stats/jobs?since=" + time.Now().UTC().Add(time.Minute).Format(time.RFC3339))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, stats)
+
+	w, _ = get("/stats/jobs?by=image")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w, _ = get("/stats/jobs?since=yesterday")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	assert.NoError(t, ds.Close())
+}
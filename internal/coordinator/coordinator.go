@@ -13,7 +13,11 @@ import (
 	"github.com/runabol/tork/datastore"
 	"github.com/runabol/tork/internal/coordinator/api"
 	"github.com/runabol/tork/internal/coordinator/handlers"
+	"github.com/runabol/tork/internal/coordinator/reaper"
+	"github.com/runabol/tork/internal/coordinator/scheduler"
 	"github.com/runabol/tork/internal/host"
+	"github.com/runabol/tork/internal/secrets"
+	"github.com/runabol/tork/internal/tracing"
 	"github.com/runabol/tork/locker"
 
 	"github.com/runabol/tork/input"
@@ -47,19 +51,37 @@ type Coordinator struct {
 	onLogPart      func(*tork.TaskLogPart)
 	onProgress     task.HandlerFunc
 	onScheduledJob func(ctx context.Context, s *tork.ScheduledJob) error
+	reaper         *reaper.Reaper
+	elector        *locker.LeaderElector
 	stop           chan any
 }
 
 type Config struct {
-	Name       string
-	Broker     broker.Broker
-	DataStore  datastore.Datastore
-	Locker     locker.Locker
+	Name      string
+	Broker    broker.Broker
+	DataStore datastore.Datastore
+	Locker    locker.Locker
+	// Elector is used to elect the coordinator which runs the
+	// cluster-wide duties (cron, reaper). Defaults to an elector
+	// backed by the Locker.
+	Elector    *locker.LeaderElector
 	Address    string
 	Queues     map[string]int
 	Endpoints  map[string]web.HandlerFunc
 	Enabled    map[string]bool
 	Middleware Middleware
+	// ReaperInterval is the time between two consecutive
+	// checks for dead worker nodes and their orphaned tasks
+	ReaperInterval time.Duration
+	// Secrets is the store of the secrets referenced by jobs.
+	// Stored secrets are disabled when nil.
+	Secrets *secrets.Store
+	// SecretResolver resolves the secrets referenced by tasks on
+	// dispatch. Defaults to a resolver of the stored secrets.
+	SecretResolver *secrets.Resolver
+	// TrustedProxies lists the IP ranges of the proxies trusted
+	// to report the IP address of the clients of the API.
+	TrustedProxies []string
 }
 
 type Middleware struct {
@@ -80,9 +102,15 @@ func NewCoordinator(cfg Config) (*Coordinator, error) {
 	if cfg.Locker == nil {
 		return nil, errors.New("most provide a locker")
 	}
+	if cfg.Elector == nil {
+		cfg.Elector = locker.NewLeaderElector(cfg.Locker)
+	}
 	if cfg.Queues == nil {
 		cfg.Queues = make(map[string]int)
 	}
+	if cfg.SecretResolver == nil && cfg.Secrets != nil {
+		cfg.SecretResolver = secrets.NewResolver(cfg.Secrets, nil)
+	}
 	if cfg.Endpoints == nil {
 		cfg.Endpoints = make(map[string]web.HandlerFunc)
 	}
@@ -123,15 +151,23 @@ func NewCoordinator(cfg Config) (*Coordinator, error) {
 			Job:  cfg.Middleware.Job,
 			Task: cfg.Middleware.Task,
 		},
-		Endpoints: cfg.Endpoints,
-		Enabled:   cfg.Enabled,
+		Endpoints:      cfg.Endpoints,
+		Enabled:        cfg.Enabled,
+		Secrets:        cfg.Secrets,
+		Resolver:       cfg.SecretResolver,
+		TrustedProxies: cfg.TrustedProxies,
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	var schedOpts []scheduler.Option
+	if cfg.SecretResolver != nil {
+		schedOpts = append(schedOpts, scheduler.WithSecrets(cfg.SecretResolver))
+	}
+
 	onPending := task.ApplyMiddleware(
-		handlers.NewPendingHandler(cfg.DataStore, cfg.Broker),
+		handlers.NewPendingHandler(cfg.DataStore, cfg.Broker, schedOpts...),
 		cfg.Middleware.Task,
 	)
 
@@ -166,7 +202,8 @@ func NewCoordinator(cfg Config) (*Coordinator, error) {
 		handlers.NewJobHandler(
 			cfg.DataStore,
 			cfg.Broker,
-			cfg.Middleware.Task...,
+			handlers.WithTaskMiddleware(cfg.Middleware.Task...),
+			handlers.WithSchedulerOptions(schedOpts...),
 		),
 		cfg.Middleware.Job,
 	)
@@ -186,11 +223,18 @@ func NewCoordinator(cfg Config) (*Coordinator, error) {
 		cfg.Middleware.Task,
 	)
 
-	onScheduledJob, err := handlers.NewJobSchedulerHandler(cfg.DataStore, cfg.Broker, cfg.Locker)
+	onScheduledJob, err := handlers.NewJobSchedulerHandler(cfg.DataStore, cfg.Broker, cfg.Elector)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error initializing the job scheduler")
 	}
 
+	r := reaper.NewReaper(
+		cfg.DataStore,
+		cfg.Broker,
+		cfg.Elector,
+		reaper.WithInterval(cfg.ReaperInterval),
+	)
+
 	return &Coordinator{
 		id:             uuid.NewShortUUID(),
 		startTime:      time.Now(),
@@ -208,6 +252,8 @@ func NewCoordinator(cfg Config) (*Coordinator, error) {
 		onLogPart:      onLogPart,
 		onProgress:     onProgress,
 		onScheduledJob: onScheduledJob,
+		reaper:         r,
+		elector:        cfg.Elector,
 		stop:           make(chan any),
 	}, nil
 }
@@ -231,22 +277,22 @@ func (c *Coordinator) Start() error {
 			var err error
 			switch qname {
 			case broker.QUEUE_PENDING:
-				pendingHandler := c.taskHandler(c.onPending)
+				pendingHandler := c.taskHandler("coordinator.pending", c.onPending)
 				err = c.broker.SubscribeForTasks(qname, func(t *tork.Task) error {
 					return pendingHandler(context.Background(), task.StateChange, t)
 				})
 			case broker.QUEUE_COMPLETED:
-				completedHandler := c.taskHandler(c.onCompleted)
+				completedHandler := c.taskHandler("coordinator.completed", c.onCompleted)
 				err = c.broker.SubscribeForTasks(qname, func(t *tork.Task) error {
 					return completedHandler(context.Background(), task.StateChange, t)
 				})
 			case broker.QUEUE_STARTED:
-				startedHandler := c.taskHandler(c.onStarted)
+				startedHandler := c.taskHandler("coordinator.started", c.onStarted)
 				err = c.broker.SubscribeForTasks(qname, func(t *tork.Task) error {
 					return startedHandler(context.Background(), task.StateChange, t)
 				})
 			case broker.QUEUE_ERROR:
-				errorHandler := c.taskHandler(c.onError)
+				errorHandler := c.taskHandler("coordinator.error", c.onError)
 				err = c.broker.SubscribeForTasks(qname, func(t *tork.Task) error {
 					return errorHandler(context.Background(), task.StateChange, t)
 				})
@@ -255,7 +301,7 @@ func (c *Coordinator) Start() error {
 					return c.onHeartbeat(context.Background(), n)
 				})
 			case broker.QUEUE_JOBS:
-				jobHandler := c.jobHandler(c.onJob)
+				jobHandler := c.jobHandler("coordinator.job", c.onJob)
 				err = c.broker.SubscribeForJobs(func(j *tork.Job) error {
 					return jobHandler(context.Background(), job.StateChange, j)
 				})
@@ -264,7 +310,7 @@ func (c *Coordinator) Start() error {
 					c.onLogPart(p)
 				})
 			case broker.QUEUE_PROGRESS:
-				progressHandler := c.taskHandler(c.onProgress)
+				progressHandler := c.taskHandler("coordinator.progress", c.onProgress)
 				err = c.broker.SubscribeForTaskProgress(func(t *tork.Task) error {
 					return progressHandler(context.Background(), task.Progress, t)
 				})
@@ -286,15 +332,27 @@ func (c *Coordinator) Start() error {
 	}); err != nil {
 		return err
 	}
+	// let the rest of the cluster know
+	// as soon as the leadership changes
+	c.elector.OnChange(func(bool) {
+		c.sendHeartbeat()
+	})
+	c.elector.Start()
 	go c.sendHeartbeats()
+	c.reaper.Start()
 	return nil
 }
 
-func (c *Coordinator) taskHandler(handler task.HandlerFunc) task.HandlerFunc {
+// taskHandler wraps the handler of a task queue in a span
+// which continues the trace of the task.
+func (c *Coordinator) taskHandler(name string, handler task.HandlerFunc) task.HandlerFunc {
 	onError := handlers.NewErrorHandler(c.ds, c.broker)
 	return func(ctx context.Context, et task.EventType, t *tork.Task) error {
+		ctx, span := tracing.StartTask(ctx, name, t)
+		defer span.End()
 		err := handler(ctx, et, t)
 		if err != nil {
+			tracing.RecordError(span, err)
 			now := time.Now().UTC()
 			t.FailedAt = &now
 			t.State = tork.TaskStateFailed
@@ -305,11 +363,16 @@ func (c *Coordinator) taskHandler(handler task.HandlerFunc) task.HandlerFunc {
 	}
 }
 
-func (c *Coordinator) jobHandler(handler job.HandlerFunc) job.HandlerFunc {
+// jobHandler wraps the handler of jobs in a span
+// which continues the trace of the job.
+func (c *Coordinator) jobHandler(name string, handler job.HandlerFunc) job.HandlerFunc {
 	onError := handlers.NewJobHandler(c.ds, c.broker)
 	return func(ctx context.Context, et job.EventType, j *tork.Job) error {
+		ctx, span := tracing.StartJob(ctx, name, j)
+		defer span.End()
 		err := handler(ctx, et, j)
 		if err != nil {
+			tracing.RecordError(span, err)
 			now := time.Now().UTC()
 			j.FailedAt = &now
 			j.State = tork.JobStateFailed
@@ -322,6 +385,8 @@ func (c *Coordinator) jobHandler(handler job.HandlerFunc) job.HandlerFunc {
 func (c *Coordinator) Stop() error {
 	log.Debug().Msgf("shutting down %s", c.Name)
 	close(c.stop)
+	c.reaper.Stop()
+	c.elector.Stop()
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 	if err := c.broker.Shutdown(ctx); err != nil {
@@ -335,30 +400,7 @@ func (c *Coordinator) Stop() error {
 
 func (c *Coordinator) sendHeartbeats() {
 	for {
-		status := tork.NodeStatusUP
-		hostname, err := os.Hostname()
-		if err != nil {
-			log.Error().Err(err).Msgf("failed to get hostname for coordinator %s", c.id)
-		}
-		cpuPercent := host.GetCPUPercent()
-		err = c.broker.PublishHeartbeat(
-			context.Background(),
-			&tork.Node{
-				ID:              c.id,
-				Name:            c.Name,
-				StartedAt:       c.startTime,
-				Status:          status,
-				CPUPercent:      cpuPercent,
-				LastHeartbeatAt: time.Now().UTC(),
-				Hostname:        hostname,
-				Version:         tork.Version,
-			},
-		)
-		if err != nil {
-			log.Error().
-				Err(err).
-				Msgf("error publishing heartbeat for %s", c.id)
-		}
+		c.sendHeartbeat()
 		select {
 		case <-c.stop:
 			return
@@ -366,3 +408,34 @@ func (c *Coordinator) sendHeartbeats() {
 		}
 	}
 }
+
+func (c *Coordinator) sendHeartbeat() {
+	status := tork.NodeStatusUP
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to get hostname for coordinator %s", c.id)
+	}
+	cpuPercent := host.GetCPUPercent()
+	err = c.broker.PublishHeartbeat(
+		context.Background(),
+		&tork.Node{
+			ID:              c.id,
+			Name:            c.Name,
+			StartedAt:       c.startTime,
+			Status:          status,
+			CPUPercent:      cpuPercent,
+			LastHeartbeatAt: time.Now().UTC(),
+			Hostname:        hostname,
+			Version:         tork.Version,
+			Leader:          c.elector.IsLeader(),
+			MemoryUsed:      host.GetMemoryUsed(),
+			MemoryTotal:     host.GetMemoryTotal(),
+			LoadAverage:     host.GetLoadAverage(),
+		},
+	)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msgf("error publishing heartbeat for %s", c.id)
+	}
+}
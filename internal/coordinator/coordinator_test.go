@@ -114,7 +114,7 @@ func TestTaskMiddlewareWithError(t *testing.T) {
 	err = ds.CreateTask(ctx, tk)
 	assert.NoError(t, err)
 
-	result := c.taskHandler(c.onPending)(ctx, task.StateChange, tk)
+	result := c.taskHandler("coordinator.pending", c.onPending)(ctx, task.StateChange, tk)
 	assert.NoError(t, result)
 
 	tk2, err := ds.GetTaskByID(ctx, tk.ID)
@@ -236,7 +236,7 @@ func TestJobMiddlewareError(t *testing.T) {
 	err = ds.CreateJob(ctx, j1)
 	assert.NoError(t, err)
 
-	result := c.jobHandler(c.onJob)(ctx, task.StateChange, j1)
+	result := c.jobHandler("coordinator.job", c.onJob)(ctx, task.StateChange, j1)
 	assert.NoError(t, result)
 	j2, err := ds.GetJobByID(ctx, j1.ID)
 	assert.NoError(t, err)
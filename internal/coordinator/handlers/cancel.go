@@ -8,6 +8,7 @@ import (
 	"github.com/runabol/tork"
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/internal/metrics"
 	"github.com/runabol/tork/middleware/job"
 )
 
@@ -26,16 +27,21 @@ func NewCancelHandler(ds datastore.Datastore, b broker.Broker) job.HandlerFunc {
 
 func (h *cancelHandler) handle(ctx context.Context, _ job.EventType, j *tork.Job) error {
 	// mark the job as cancelled
+	var cancelled bool
 	if err := h.ds.UpdateJob(ctx, j.ID, func(u *tork.Job) error {
 		if u.State != tork.JobStateRunning && u.State != tork.JobStateScheduled {
 			// job is not running -- nothing to cancel
 			return nil
 		}
 		u.State = tork.JobStateCancelled
+		cancelled = true
 		return nil
 	}); err != nil {
 		return err
 	}
+	if cancelled {
+		metrics.JobsTotal.WithLabelValues(j.Namespace, string(tork.JobStateCancelled)).Inc()
+	}
 	// if there's a parent task notify the parent job to cancel as well
 	if j.ParentID != "" {
 		pt, err := h.ds.GetTaskByID(ctx, j.ParentID)
@@ -52,18 +58,18 @@ func (h *cancelHandler) handle(ctx context.Context, _ job.EventType, j *tork.Job
 		}
 	}
 	// cancel all running tasks
-	if err := cancelActiveTasks(ctx, h.ds, h.broker, j.ID); err != nil {
+	if err := cancelActiveTasks(ctx, h.ds, h.broker, j); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func cancelActiveTasks(ctx context.Context, ds datastore.Datastore, b broker.Broker, jobID string) error {
+func cancelActiveTasks(ctx context.Context, ds datastore.Datastore, b broker.Broker, j *tork.Job) error {
 	// get a list of active tasks for the job
-	tasks, err := ds.GetActiveTasks(ctx, jobID)
+	tasks, err := ds.GetActiveTasks(ctx, j.ID)
 	if err != nil {
-		return errors.Wrapf(err, "error getting active tasks for job: %s", jobID)
+		return errors.Wrapf(err, "error getting active tasks for job: %s", j.ID)
 	}
 	for _, t := range tasks {
 		t.State = tork.TaskStateCancelled
@@ -74,6 +80,7 @@ func cancelActiveTasks(ctx context.Context, ds datastore.Datastore, b broker.Bro
 		}); err != nil {
 			return errors.Wrapf(err, "error cancelling task: %s", t.ID)
 		}
+		metrics.TasksTotal.WithLabelValues(j.Namespace, string(tork.TaskStateCancelled)).Inc()
 		// if this task is a sub-job, notify the sub-job to cancel
 		if t.SubJob != nil {
 			// cancel the sub-job
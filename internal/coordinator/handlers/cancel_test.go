@@ -47,7 +47,7 @@ func Test_cancelActiveTasks(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Len(t, actives, 1)
 
-	err = cancelActiveTasks(ctx, ds, b, j1.ID)
+	err = cancelActiveTasks(ctx, ds, b, j1)
 	assert.NoError(t, err)
 
 	actives, err = ds.GetActiveTasks(ctx, j1.ID)
@@ -12,6 +12,7 @@ import (
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/datastore"
 	"github.com/runabol/tork/internal/eval"
+	"github.com/runabol/tork/internal/metrics"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/runabol/tork/middleware/job"
 	"github.com/runabol/tork/middleware/task"
@@ -38,7 +39,25 @@ func (h *completedHandler) handle(ctx context.Context, et task.EventType, t *tor
 		return errors.Errorf("invalid completion state: %s", t.State)
 	}
 	t.CompletedAt = &now
-	return h.completeTask(ctx, t)
+	if err := h.completeTask(ctx, t); err != nil {
+		return err
+	}
+	h.recordMetrics(ctx, t, now)
+	return nil
+}
+
+// recordMetrics counts the completed task. A failure to do so
+// is only logged, as the task is already completed by then.
+func (h *completedHandler) recordMetrics(ctx context.Context, t *tork.Task, now time.Time) {
+	if t.StartedAt != nil {
+		metrics.TaskDuration.WithLabelValues(t.Queue, t.Image).Observe(now.Sub(*t.StartedAt).Seconds())
+	}
+	ns, err := h.ds.GetJobNamespace(ctx, t.JobID)
+	if err != nil {
+		log.Error().Err(err).Msgf("error getting the namespace of job %s for the metrics", t.JobID)
+		return
+	}
+	metrics.TasksTotal.WithLabelValues(ns, string(t.State)).Inc()
 }
 
 func (h *completedHandler) completeTask(ctx context.Context, t *tork.Task) error {
@@ -72,6 +91,7 @@ func (h *completedHandler) completeEachTask(ctx context.Context, t *tork.Task) e
 			u.State = t.State
 			u.CompletedAt = t.CompletedAt
 			u.Result = t.Result
+			u.Usage = t.Usage
 			return nil
 		}); err != nil {
 			return errors.Wrapf(err, "error updating task in datastore")
@@ -145,6 +165,7 @@ func (h *completedHandler) completeParallelTask(ctx context.Context, t *tork.Tas
 			u.State = t.State
 			u.CompletedAt = t.CompletedAt
 			u.Result = t.Result
+			u.Usage = t.Usage
 			return nil
 		}); err != nil {
 			return errors.Wrapf(err, "error updating task in datastore")
@@ -201,6 +222,7 @@ func (c *completedHandler) completeTopLevelTask(ctx context.Context, t *tork.Tas
 			u.State = t.State
 			u.CompletedAt = t.CompletedAt
 			u.Result = t.Result
+			u.Usage = t.Usage
 			return nil
 		}); err != nil {
 			return errors.Wrapf(err, "error updating task in datastore")
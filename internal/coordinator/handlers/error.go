@@ -10,6 +10,7 @@ import (
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/datastore"
 	"github.com/runabol/tork/internal/eval"
+	"github.com/runabol/tork/internal/metrics"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/runabol/tork/middleware/job"
 	"github.com/runabol/tork/middleware/task"
@@ -45,29 +46,49 @@ func (h *errorHandler) handle(ctx context.Context, et task.EventType, t *tork.Ta
 	t.FailedAt = &now
 
 	// mark the task as FAILED
+	var failed bool
+	var startedAt *time.Time
 	if err := h.ds.UpdateTask(ctx, t.ID, func(u *tork.Task) error {
 		if u.IsActive() {
 			u.State = tork.TaskStateFailed
 			u.FailedAt = t.FailedAt
 			u.Error = t.Error
+			u.Usage = t.Usage
+			failed = true
+			startedAt = u.StartedAt
 		}
 		return nil
 	}); err != nil {
 		return errors.Wrapf(err, "error marking task %s as FAILED", t.ID)
 	}
+	if failed {
+		metrics.TasksTotal.WithLabelValues(j.Namespace, string(tork.TaskStateFailed)).Inc()
+		if startedAt != nil {
+			metrics.TaskDuration.WithLabelValues(t.Queue, t.Image).Observe(now.Sub(*startedAt).Seconds())
+		}
+	}
 	// eligible for retry?
 	if (j.State == tork.JobStateRunning || j.State == tork.JobStateScheduled) &&
 		t.Retry != nil &&
 		t.Retry.Attempts < t.Retry.Limit {
-		// create a new retry task
+		// create a new retry task off the stored task rather than the
+		// one reported by the worker, which has its secrets resolved
+		stored, err := h.ds.GetTaskByID(ctx, t.ID)
+		if err != nil {
+			return errors.Wrapf(err, "error getting task %s", t.ID)
+		}
 		now := time.Now().UTC()
-		rt := t.Clone()
+		rt := stored.Clone()
 		rt.ID = uuid.NewUUID()
 		rt.CreatedAt = &now
 		rt.Retry.Attempts = rt.Retry.Attempts + 1
 		rt.State = tork.TaskStatePending
 		rt.Error = ""
 		rt.FailedAt = nil
+		rt.ScheduledAt = nil
+		rt.StartedAt = nil
+		rt.NodeID = ""
+		rt.Usage = nil
 		if err := eval.EvaluateTask(rt, j.Context.AsMap()); err != nil {
 			return errors.Wrapf(err, "error evaluating task")
 		}
@@ -8,6 +8,7 @@ import (
 	"github.com/runabol/tork"
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/datastore/postgres"
+	"github.com/runabol/tork/internal/secrets"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/runabol/tork/middleware/task"
 	"github.com/stretchr/testify/assert"
@@ -181,3 +182,87 @@ func Test_handleFailedTaskRetry(t *testing.T) {
 	assert.Equal(t, tork.JobStateRunning, j2.State)
 	assert.NoError(t, ds.Close())
 }
+
+func Test_handleFailedTaskRetryWithSecret(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+
+	retried := make(chan *tork.Task, 1)
+	err := b.SubscribeForTasks(broker.QUEUE_PENDING, func(tk *tork.Task) error {
+		retried <- tk
+		return nil
+	})
+	assert.NoError(t, err)
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	store, err := secrets.NewStore(ds, []byte("0123456789abcdef0123456789abcdef"))
+	assert.NoError(t, err)
+	name := "DB_PASSWORD_" + uuid.NewShortUUID()
+	sealed, err := store.Seal("hush")
+	assert.NoError(t, err)
+	assert.NoError(t, ds.CreateSecret(ctx, &tork.Secret{
+		Name:       name,
+		Namespace:  tork.NAMESPACE_DEFAULT,
+		Ciphertext: sealed,
+	}))
+
+	handler := NewErrorHandler(ds, b)
+
+	now := time.Now().UTC()
+	j1 := &tork.Job{
+		ID:        uuid.NewUUID(),
+		State:     tork.JobStateRunning,
+		Namespace: tork.NAMESPACE_DEFAULT,
+		Position:  1,
+		TaskCount: 1,
+		Tasks: []*tork.Task{
+			{
+				Name: "task-1",
+			},
+		},
+		Context: tork.JobContext{
+			Secrets: map[string]string{name: secrets.Placeholder(name)},
+		},
+	}
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+
+	t1 := &tork.Task{
+		ID:        uuid.NewUUID(),
+		State:     tork.TaskStateRunning,
+		StartedAt: &now,
+		NodeID:    uuid.NewUUID(),
+		JobID:     j1.ID,
+		Position:  1,
+		Env:       map[string]string{"PASSWORD": secrets.Placeholder(name)},
+		Retry: &tork.TaskRetry{
+			Limit: 1,
+		},
+		CreatedAt: &now,
+	}
+	err = ds.CreateTask(ctx, t1)
+	assert.NoError(t, err)
+
+	// the worker reports the task it was dispatched, secrets resolved
+	reported, err := secrets.NewResolver(store, nil).ResolveTask(ctx, j1, t1)
+	assert.NoError(t, err)
+	assert.Equal(t, "hush", reported.Env["PASSWORD"])
+	reported.Error = "something went wrong"
+
+	err = handler(ctx, task.StateChange, reported)
+	assert.NoError(t, err)
+
+	rt := <-retried
+	assert.Equal(t, secrets.Placeholder(name), rt.Env["PASSWORD"])
+	assert.Equal(t, 1, rt.Retry.Attempts)
+	assert.Empty(t, rt.NodeID)
+
+	stored, err := ds.GetTaskByID(ctx, rt.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, secrets.Placeholder(name), stored.Env["PASSWORD"])
+	assert.Equal(t, tork.TaskStatePending, stored.State)
+
+	assert.NoError(t, ds.Close())
+}
@@ -27,17 +27,37 @@ func (h *heartbeatHandler) handle(ctx context.Context, n *tork.Node) error {
 			Str("node-id", n.ID).
 			Str("hostname", n.Hostname).
 			Msg("received first heartbeat")
-		return h.ds.CreateNode(ctx, n)
+		if err := h.ds.CreateNode(ctx, n); err != nil {
+			return err
+		}
+		return h.ds.CreateNodeSample(ctx, n.ID, n.Sample())
 	}
-	return h.ds.UpdateNode(ctx, n.ID, func(u *tork.Node) error {
+	var stale bool
+	if err := h.ds.UpdateNode(ctx, n.ID, func(u *tork.Node) error {
 		// ignore "old" heartbeats
 		if u.LastHeartbeatAt.After(n.LastHeartbeatAt) {
+			stale = true
 			return nil
 		}
 		u.LastHeartbeatAt = n.LastHeartbeatAt
 		u.CPUPercent = n.CPUPercent
 		u.Status = n.Status
 		u.TaskCount = n.TaskCount
+		u.Labels = n.Labels
+		u.Capacity = n.Capacity
+		u.Allocated = n.Allocated
+		u.Leader = n.Leader
+		u.MemoryUsed = n.MemoryUsed
+		u.MemoryTotal = n.MemoryTotal
+		u.DiskFree = n.DiskFree
+		u.LoadAverage = n.LoadAverage
+		u.Runtime = n.Runtime
+		return nil
+	}); err != nil {
+		return err
+	}
+	if stale {
 		return nil
-	})
+	}
+	return h.ds.CreateNodeSample(ctx, n.ID, n.Sample())
 }
@@ -43,6 +43,15 @@ func Test_handleHeartbeat(t *testing.T) {
 		CPUPercent:      75,
 		Status:          tork.NodeStatusDown,
 		TaskCount:       3,
+		Labels:          map[string]string{"region": "eu"},
+		Capacity:        &tork.NodeResources{CPUs: 4},
+		Allocated:       &tork.NodeResources{CPUs: 1},
+		Leader:          true,
+		MemoryUsed:      1024,
+		MemoryTotal:     4096,
+		DiskFree:        2048,
+		LoadAverage:     []float64{0.5, 0.25, 0.1},
+		Runtime:         &tork.NodeRuntime{Type: "docker", Version: "26.1.5", Containers: 2},
 	}
 
 	err = handler(ctx, &n2)
@@ -54,6 +63,15 @@ func Test_handleHeartbeat(t *testing.T) {
 	assert.Equal(t, n2.CPUPercent, n22.CPUPercent)
 	assert.Equal(t, n2.Status, n22.Status)
 	assert.Equal(t, n2.TaskCount, n22.TaskCount)
+	assert.Equal(t, n2.Labels, n22.Labels)
+	assert.Equal(t, n2.Capacity, n22.Capacity)
+	assert.Equal(t, n2.Allocated, n22.Allocated)
+	assert.Equal(t, n2.Leader, n22.Leader)
+	assert.Equal(t, n2.MemoryUsed, n22.MemoryUsed)
+	assert.Equal(t, n2.MemoryTotal, n22.MemoryTotal)
+	assert.Equal(t, n2.DiskFree, n22.DiskFree)
+	assert.Equal(t, n2.LoadAverage, n22.LoadAverage)
+	assert.Equal(t, n2.Runtime, n22.Runtime)
 
 	n3 := tork.Node{
 		ID:              n1.ID,
@@ -68,5 +86,14 @@ func Test_handleHeartbeat(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, n2.LastHeartbeatAt.Unix(), n33.LastHeartbeatAt.Unix()) // should keep the latest
 	assert.Equal(t, n3.CPUPercent, n33.CPUPercent)
+
+	samples, err := ds.GetNodeSamples(ctx, n1.ID, time.Now().UTC().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, samples, 2) // the old heartbeat isn't sampled
+	assert.Equal(t, n1.LastHeartbeatAt.Unix(), samples[0].Time.Unix())
+	assert.Equal(t, n2.LastHeartbeatAt.Unix(), samples[1].Time.Unix())
+	assert.Equal(t, n2.MemoryUsed, samples[1].MemoryUsed)
+	assert.Equal(t, 0.5, samples[1].LoadAverage)
+	assert.Equal(t, 2, samples[1].Containers)
 	assert.NoError(t, ds.Close())
 }
@@ -9,7 +9,9 @@ import (
 	"github.com/runabol/tork"
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/internal/coordinator/scheduler"
 	"github.com/runabol/tork/internal/eval"
+	"github.com/runabol/tork/internal/metrics"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/runabol/tork/middleware/job"
 	"github.com/runabol/tork/middleware/task"
@@ -22,11 +24,38 @@ type jobHandler struct {
 	onCancel  job.HandlerFunc
 }
 
-func NewJobHandler(ds datastore.Datastore, b broker.Broker, mw ...task.MiddlewareFunc) job.HandlerFunc {
+type jobHandlerOptions struct {
+	mw    []task.MiddlewareFunc
+	sched []scheduler.Option
+}
+
+type JobHandlerOption func(o *jobHandlerOptions)
+
+// WithTaskMiddleware applies the middleware to the
+// job's first task when the job is started.
+func WithTaskMiddleware(mw ...task.MiddlewareFunc) JobHandlerOption {
+	return func(o *jobHandlerOptions) {
+		o.mw = append(o.mw, mw...)
+	}
+}
+
+// WithSchedulerOptions configures the scheduler which
+// dispatches the job's first task when the job is started.
+func WithSchedulerOptions(opts ...scheduler.Option) JobHandlerOption {
+	return func(o *jobHandlerOptions) {
+		o.sched = append(o.sched, opts...)
+	}
+}
+
+func NewJobHandler(ds datastore.Datastore, b broker.Broker, opts ...JobHandlerOption) job.HandlerFunc {
+	o := &jobHandlerOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
 	h := &jobHandler{
 		ds:        ds,
 		broker:    b,
-		onPending: task.ApplyMiddleware(NewPendingHandler(ds, b), mw),
+		onPending: task.ApplyMiddleware(NewPendingHandler(ds, b, o.sched...), o.mw),
 		onCancel:  NewCancelHandler(ds, b),
 	}
 	return h.handle
@@ -126,6 +155,7 @@ func (h *jobHandler) completeJob(ctx context.Context, j *tork.Job) error {
 	}); err != nil {
 		return errors.Wrapf(err, "error updating job in datastore")
 	}
+	metrics.JobsTotal.WithLabelValues(j.Namespace, string(j.State)).Inc()
 	// if this is a sub-job -- complete/fail the parent task
 	if j.ParentID != "" {
 		parent, err := h.ds.GetTaskByID(ctx, j.ParentID)
@@ -196,6 +226,7 @@ func (h *jobHandler) restartJob(ctx context.Context, j *tork.Job) error {
 
 func (h *jobHandler) failJob(ctx context.Context, j *tork.Job) error {
 	// mark the job as FAILED
+	var failed bool
 	if err := h.ds.UpdateJob(ctx, j.ID, func(u *tork.Job) error {
 		// we only want to make the job as FAILED
 		// if it's actually running as opposed to
@@ -203,11 +234,15 @@ func (h *jobHandler) failJob(ctx context.Context, j *tork.Job) error {
 		if u.State == tork.JobStateRunning || u.State == tork.JobStateScheduled {
 			u.State = tork.JobStateFailed
 			u.FailedAt = j.FailedAt
+			failed = true
 		}
 		return nil
 	}); err != nil {
 		return errors.Wrapf(err, "error marking the job as failed in the datastore")
 	}
+	if failed {
+		metrics.JobsTotal.WithLabelValues(j.Namespace, string(tork.JobStateFailed)).Inc()
+	}
 	// if this is a sub-job -- FAIL the parent task
 	if j.ParentID != "" {
 		parent, err := h.ds.GetTaskByID(ctx, j.ParentID)
@@ -220,7 +255,7 @@ func (h *jobHandler) failJob(ctx context.Context, j *tork.Job) error {
 		return h.broker.PublishTask(ctx, broker.QUEUE_ERROR, parent)
 	}
 	// cancel all currently running tasks
-	if err := cancelActiveTasks(ctx, h.ds, h.broker, j.ID); err != nil {
+	if err := cancelActiveTasks(ctx, h.ds, h.broker, j); err != nil {
 		return err
 	}
 	j, err := h.ds.GetJobByID(ctx, j.ID)
@@ -20,11 +20,11 @@ type pendingHandler struct {
 	broker broker.Broker
 }
 
-func NewPendingHandler(ds datastore.Datastore, b broker.Broker) task.HandlerFunc {
+func NewPendingHandler(ds datastore.Datastore, b broker.Broker, opts ...scheduler.Option) task.HandlerFunc {
 	h := &pendingHandler{
 		ds:     ds,
 		broker: b,
-		sched:  *scheduler.NewScheduler(ds, b),
+		sched:  *scheduler.NewScheduler(ds, b, opts...),
 	}
 	return h.handle
 }
@@ -11,14 +11,11 @@ import (
 	"github.com/runabol/tork"
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/internal/secrets"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/runabol/tork/locker"
 )
 
-// minScheduledJobLockTTL is the minimum time a scheduled
-// job lock should be held
-const minScheduledJobLockTTL = 10 * time.Second
-
 type jobSchedulerHandler struct {
 	ds        datastore.Datastore
 	broker    broker.Broker
@@ -27,39 +24,21 @@ type jobSchedulerHandler struct {
 	m         map[string]gocron.Job
 }
 
-type glocker struct {
-	locker locker.Locker
-}
-
-type glock struct {
-	key       string
-	lock      locker.Lock
-	createdAt time.Time
-}
-
-func (l glock) Unlock(ctx context.Context) error {
-	// ensure that the lock is held for at least minLockTTL
-	// to mitigate drifting coordinators from re-acquiring
-	// the lock
-	elapsed := time.Since(l.createdAt)
-	if elapsed < minScheduledJobLockTTL {
-		time.Sleep(minScheduledJobLockTTL - elapsed)
-	}
-	log.Debug().Msgf("Releasing lock for %s", l.key)
-	return l.lock.ReleaseLock(ctx)
+// gelector adapts the cluster's leader elector to gocron
+// so that scheduled jobs only fire on the leader.
+type gelector struct {
+	elector locker.Elector
 }
 
-func (d glocker) Lock(ctx context.Context, key string) (gocron.Lock, error) {
-	lock, err := d.locker.AcquireLock(ctx, key)
-	if err != nil {
-		return nil, err
+func (e gelector) IsLeader(_ context.Context) error {
+	if !e.elector.IsLeader() {
+		return errors.New("not the leader")
 	}
-	log.Debug().Msgf("Acquired lock for %s", key)
-	return &glock{lock: lock, key: key, createdAt: time.Now()}, nil
+	return nil
 }
 
-func NewJobSchedulerHandler(ds datastore.Datastore, b broker.Broker, l locker.Locker) (func(ctx context.Context, s *tork.ScheduledJob) error, error) {
-	sc, err := gocron.NewScheduler(gocron.WithDistributedLocker(glocker{locker: l}))
+func NewJobSchedulerHandler(ds datastore.Datastore, b broker.Broker, e locker.Elector) (func(ctx context.Context, s *tork.ScheduledJob) error, error) {
+	sc, err := gocron.NewScheduler(gocron.WithDistributedElector(gelector{elector: e}))
 	if err != nil {
 		return nil, err
 	}
@@ -106,6 +85,13 @@ func (h *jobSchedulerHandler) handleActive(ctx context.Context, s *tork.Schedule
 		gocron.CronJob(s.Cron, false),
 		gocron.NewTask(
 			func(sj *tork.ScheduledJob) {
+				if over, err := h.overQuota(ctx, s.Namespace); err != nil {
+					log.Error().Err(err).Msgf("error checking the quota of namespace %s", s.Namespace)
+					return
+				} else if over {
+					log.Warn().Msgf("skipping scheduled job %s: namespace %s has reached its quota of active jobs", s.ID, s.Namespace)
+					return
+				}
 				now := time.Now().UTC()
 				job := &tork.Job{
 					ID:          uuid.NewUUID(),
@@ -114,6 +100,7 @@ func (h *jobSchedulerHandler) handleActive(ctx context.Context, s *tork.Schedule
 					Permissions: s.Permissions,
 					Tags:        s.Tags,
 					Name:        s.Name,
+					Namespace:   s.Namespace,
 					Description: s.Description,
 					State:       tork.JobStatePending,
 					Tasks:       s.Tasks,
@@ -129,6 +116,10 @@ func (h *jobSchedulerHandler) handleActive(ctx context.Context, s *tork.Schedule
 						Cron: s.Cron,
 					},
 				}
+				if err := secrets.Bind(job); err != nil {
+					log.Error().Err(err).Msgf("error binding secrets of scheduled job instance: %s", s.ID)
+					return
+				}
 				if err := h.ds.CreateJob(ctx, job); err != nil {
 					log.Error().Err(err).Msgf("error creating scheduled job instance: %s", s.ID)
 				}
@@ -165,3 +156,23 @@ func (h *jobSchedulerHandler) handlePaused(_ context.Context, s *tork.ScheduledJ
 	h.mu.Unlock()
 	return nil
 }
+
+// overQuota reports whether the namespace already
+// has as many active jobs as its quota allows.
+func (h *jobSchedulerHandler) overQuota(ctx context.Context, namespace string) (bool, error) {
+	if namespace == "" {
+		namespace = tork.NAMESPACE_DEFAULT
+	}
+	ns, err := h.ds.GetNamespace(ctx, namespace)
+	if err != nil {
+		return false, err
+	}
+	if ns.Quota == nil || ns.Quota.MaxActiveJobs <= 0 {
+		return false, nil
+	}
+	active, err := h.ds.CountActiveJobs(ctx, ns.Name)
+	if err != nil {
+		return false, err
+	}
+	return active >= ns.Quota.MaxActiveJobs, nil
+}
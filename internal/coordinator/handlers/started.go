@@ -8,6 +8,7 @@ import (
 	"github.com/runabol/tork"
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/internal/metrics"
 	"github.com/runabol/tork/middleware/job"
 	"github.com/runabol/tork/middleware/task"
 )
@@ -55,7 +56,8 @@ func (h *startedHandler) handle(ctx context.Context, et task.EventType, t *tork.
 			return err
 		}
 	}
-	return h.ds.UpdateTask(ctx, t.ID, func(u *tork.Task) error {
+	var waited *time.Duration
+	if err := h.ds.UpdateTask(ctx, t.ID, func(u *tork.Task) error {
 		// we don't want to mark the task as RUNNING
 		// if an out-of-order task completion/failure
 		// arrived earlier
@@ -64,6 +66,10 @@ func (h *startedHandler) handle(ctx context.Context, et task.EventType, t *tork.
 			t.StartedAt = &now
 			u.State = tork.TaskStateRunning
 			u.StartedAt = &now
+			if u.ScheduledAt != nil {
+				d := now.Sub(*u.ScheduledAt)
+				waited = &d
+			}
 		}
 		// if the worker crashed, the task
 		// would automatically be returned
@@ -73,5 +79,11 @@ func (h *startedHandler) handle(ctx context.Context, et task.EventType, t *tork.
 		// node that picked up the task.
 		u.NodeID = t.NodeID
 		return nil
-	})
+	}); err != nil {
+		return err
+	}
+	if waited != nil {
+		metrics.TaskScheduleToStart.WithLabelValues(t.Queue).Observe(waited.Seconds())
+	}
+	return nil
 }
@@ -0,0 +1,143 @@
+package reaper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/broker"
+	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/locker"
+)
+
+const (
+	// DefaultInterval is the default time between two
+	// consecutive runs of the reaper
+	DefaultInterval = time.Minute
+)
+
+// Reaper periodically looks for worker nodes which have stopped
+// sending heartbeats, marks them as DOWN and fails the tasks
+// which were running on them so that the coordinator's error
+// handler can retry or fail them according to their retry policy.
+type Reaper struct {
+	ds       datastore.Datastore
+	broker   broker.Broker
+	elector  locker.Elector
+	interval time.Duration
+	stop     chan any
+}
+
+type Option = func(r *Reaper)
+
+// WithInterval sets the time between two consecutive runs
+// of the reaper.
+func WithInterval(d time.Duration) Option {
+	return func(r *Reaper) {
+		r.interval = d
+	}
+}
+
+func NewReaper(ds datastore.Datastore, b broker.Broker, e locker.Elector, opts ...Option) *Reaper {
+	r := &Reaper{
+		ds:       ds,
+		broker:   b,
+		elector:  e,
+		interval: DefaultInterval,
+		stop:     make(chan any),
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	if r.interval <= 0 {
+		r.interval = DefaultInterval
+	}
+	return r
+}
+
+func (r *Reaper) Start() {
+	go func() {
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-time.After(r.interval):
+				if err := r.Reap(context.Background()); err != nil {
+					log.Error().Err(err).Msg("error reaping dead nodes")
+				}
+			}
+		}
+	}()
+}
+
+func (r *Reaper) Stop() {
+	close(r.stop)
+}
+
+// Reap runs a single pass of the reaper. Passes are
+// skipped on coordinators which aren't the cluster leader.
+func (r *Reaper) Reap(ctx context.Context) error {
+	if !r.elector.IsLeader() {
+		return nil
+	}
+	nodes, err := r.ds.GetStaleNodes(ctx, time.Now().UTC().Add(-tork.LAST_HEARTBEAT_TIMEOUT))
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		if err := r.reapNode(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Reaper) rescheduleTask(ctx context.Context, t *tork.Task) error {
+	t.State = tork.TaskStatePending
+	if err := r.ds.UpdateTask(ctx, t.ID, func(u *tork.Task) error {
+		u.State = t.State
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "error updating orphaned task %s", t.ID)
+	}
+	if err := r.broker.PublishTask(ctx, broker.QUEUE_PENDING, t); err != nil {
+		return errors.Wrapf(err, "error rescheduling orphaned task %s", t.ID)
+	}
+	return nil
+}
+
+func (r *Reaper) reapNode(ctx context.Context, n *tork.Node) error {
+	log.Info().Msgf("node %s (%s) missed its heartbeats since %s. marking it as DOWN", n.ID, n.Name, n.LastHeartbeatAt)
+	if err := r.ds.UpdateNode(ctx, n.ID, func(u *tork.Node) error {
+		u.Status = tork.NodeStatusDown
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "error marking node %s as DOWN", n.ID)
+	}
+	tasks, err := r.ds.GetActiveTasksByNodeID(ctx, n.ID)
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		log.Info().Msgf("task %s was orphaned by node %s", t.ID, n.ID)
+		if t.State == tork.TaskStateScheduled && t.NodeID == "" {
+			// the node never started the task so it
+			// can safely be placed on another one
+			if err := r.rescheduleTask(ctx, t); err != nil {
+				return err
+			}
+			continue
+		}
+		now := time.Now().UTC()
+		t.State = tork.TaskStateFailed
+		t.FailedAt = &now
+		t.Error = fmt.Sprintf("node %s stopped responding", n.ID)
+		if err := r.broker.PublishTask(ctx, broker.QUEUE_ERROR, t); err != nil {
+			return errors.Wrapf(err, "error publishing orphaned task %s", t.ID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package reaper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/broker"
+	"github.com/runabol/tork/datastore/postgres"
+	"github.com/runabol/tork/internal/uuid"
+	"github.com/runabol/tork/locker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReap(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+
+	failed := make(chan *tork.Task, 1)
+	err := b.SubscribeForTasks(broker.QUEUE_ERROR, func(t *tork.Task) error {
+		failed <- t
+		return nil
+	})
+	assert.NoError(t, err)
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	n1 := &tork.Node{
+		ID:              uuid.NewUUID(),
+		Status:          tork.NodeStatusUP,
+		LastHeartbeatAt: time.Now().UTC().Add(-time.Minute * 10),
+	}
+	err = ds.CreateNode(ctx, n1)
+	assert.NoError(t, err)
+
+	j1 := &tork.Job{
+		ID:    uuid.NewUUID(),
+		State: tork.JobStateRunning,
+	}
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+	t1 := &tork.Task{
+		ID:        uuid.NewUUID(),
+		JobID:     j1.ID,
+		State:     tork.TaskStateRunning,
+		NodeID:    n1.ID,
+		CreatedAt: &now,
+	}
+	err = ds.CreateTask(ctx, t1)
+	assert.NoError(t, err)
+
+	e := locker.NewLeaderElector(locker.NewInMemoryLocker())
+	e.Start()
+	defer e.Stop()
+	assert.Eventually(t, e.IsLeader, time.Second, time.Millisecond*50)
+
+	r := NewReaper(ds, b, e)
+	err = r.Reap(ctx)
+	assert.NoError(t, err)
+
+	n11, err := ds.GetNodeByID(ctx, n1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.NodeStatusDown, n11.Status)
+
+	select {
+	case t11 := <-failed:
+		assert.Equal(t, t1.ID, t11.ID)
+		assert.Equal(t, tork.TaskStateFailed, t11.State)
+		assert.NotEmpty(t, t11.Error)
+	case <-time.After(time.Second):
+		t.Fatal("expected the orphaned task to be failed")
+	}
+	assert.NoError(t, ds.Close())
+}
+
+func TestReapPlacedTask(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+
+	pending := make(chan *tork.Task, 1)
+	err := b.SubscribeForTasks(broker.QUEUE_PENDING, func(t *tork.Task) error {
+		pending <- t
+		return nil
+	})
+	assert.NoError(t, err)
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	n1 := &tork.Node{
+		ID:              uuid.NewShortUUID(),
+		Status:          tork.NodeStatusUP,
+		LastHeartbeatAt: time.Now().UTC().Add(-time.Minute * 10),
+	}
+	n1.Queue = broker.QUEUE_EXCLUSIVE_PREFIX + n1.ID
+	assert.NoError(t, ds.CreateNode(ctx, n1))
+
+	j1 := &tork.Job{
+		ID:    uuid.NewUUID(),
+		State: tork.JobStateRunning,
+	}
+	assert.NoError(t, ds.CreateJob(ctx, j1))
+
+	// placed on the node, which died before starting it
+	now := time.Now().UTC()
+	t1 := &tork.Task{
+		ID:        uuid.NewUUID(),
+		JobID:     j1.ID,
+		State:     tork.TaskStateScheduled,
+		Queue:     n1.Queue,
+		CreatedAt: &now,
+	}
+	assert.NoError(t, ds.CreateTask(ctx, t1))
+
+	e := locker.NewLeaderElector(locker.NewInMemoryLocker())
+	e.Start()
+	defer e.Stop()
+	assert.Eventually(t, e.IsLeader, time.Second, time.Millisecond*50)
+
+	r := NewReaper(ds, b, e)
+	assert.NoError(t, r.Reap(ctx))
+
+	select {
+	case t11 := <-pending:
+		assert.Equal(t, t1.ID, t11.ID)
+		assert.Equal(t, tork.TaskStatePending, t11.State)
+	case <-time.After(time.Second):
+		t.Fatal("expected the orphaned task to be rescheduled")
+	}
+
+	t11, err := ds.GetTaskByID(ctx, t1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.TaskStatePending, t11.State)
+	assert.NoError(t, ds.Close())
+}
+
+func TestReapNotLeader(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+
+	n1 := &tork.Node{
+		ID:              uuid.NewUUID(),
+		Status:          tork.NodeStatusUP,
+		LastHeartbeatAt: time.Now().UTC().Add(-time.Minute * 10),
+	}
+	err = ds.CreateNode(ctx, n1)
+	assert.NoError(t, err)
+
+	// never started, so never the leader
+	e := locker.NewLeaderElector(locker.NewInMemoryLocker())
+
+	r := NewReaper(ds, b, e)
+	err = r.Reap(ctx)
+	assert.NoError(t, err)
+
+	n11, err := ds.GetNodeByID(ctx, n1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, tork.NodeStatusOffline, n11.Status)
+
+	assert.NoError(t, ds.Close())
+}
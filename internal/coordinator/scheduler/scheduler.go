@@ -4,26 +4,62 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"slices"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
 	"github.com/runabol/tork"
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/datastore"
 	"github.com/runabol/tork/internal/eval"
+	"github.com/runabol/tork/internal/secrets"
+	"github.com/runabol/tork/internal/tracing"
 	"github.com/runabol/tork/internal/uuid"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// RequeueDelay is how long a task waits before its placement is
+// retried when every node which could run it is busy.
+const RequeueDelay = time.Second * 5
+
+// errNodesBusy is returned when there are nodes able to run the
+// task but none has enough free resources for it at the moment.
+var errNodesBusy = errors.New("no node has enough free resources")
+
 type Scheduler struct {
-	ds     datastore.Datastore
-	broker broker.Broker
+	ds           datastore.Datastore
+	broker       broker.Broker
+	secrets      *secrets.Resolver
+	requeueDelay time.Duration
+}
+
+type Option func(s *Scheduler)
+
+// WithSecrets resolves the references tasks make to secrets
+// when dispatching them to the workers.
+func WithSecrets(r *secrets.Resolver) Option {
+	return func(s *Scheduler) {
+		s.secrets = r
+	}
 }
 
-func NewScheduler(ds datastore.Datastore, b broker.Broker) *Scheduler {
-	return &Scheduler{ds: ds, broker: b}
+func NewScheduler(ds datastore.Datastore, b broker.Broker, opts ...Option) *Scheduler {
+	s := &Scheduler{ds: ds, broker: b, requeueDelay: RequeueDelay}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-func (s *Scheduler) ScheduleTask(ctx context.Context, t *tork.Task) error {
+func (s *Scheduler) ScheduleTask(ctx context.Context, t *tork.Task) (err error) {
+	ctx, span := tracing.Start(ctx, "scheduler.ScheduleTask",
+		attribute.String("tork.task.id", t.ID),
+		attribute.String("tork.job.id", t.JobID),
+	)
+	defer func() {
+		tracing.End(span, err)
+	}()
 	if t.Parallel != nil {
 		return s.scheduleParallelTask(ctx, t)
 	} else if t.Each != nil {
@@ -74,9 +110,36 @@ func (s *Scheduler) scheduleRegularTask(ctx context.Context, t *tork.Task) error
 	if t.Queue == "" {
 		t.Queue = broker.QUEUE_DEFAULT
 	}
+	// tasks with placement constraints are routed
+	// directly to the exclusive queue of a node
+	if len(t.NodeSelector) > 0 || t.Resources != nil {
+		n, err := s.placeTask(ctx, t)
+		if errors.Is(err, errNodesBusy) {
+			return s.requeueTask(t)
+		} else if err != nil {
+			return err
+		}
+		t.Queue = n.Queue
+	}
 	// mark task state as scheduled
 	t.State = tork.TaskStateScheduled
 	t.ScheduledAt = &now
+	// the worker receives the values of the secrets referenced
+	// by the task while the datastore keeps the references
+	dispatched := t
+	if s.secrets != nil {
+		rt, err := s.secrets.ResolveTask(ctx, job, t)
+		if err != nil {
+			return errors.Wrapf(err, "error resolving secrets for task %s", t.ID)
+		}
+		dispatched = rt
+	}
+	if redact := secretValues(job, dispatched); len(redact) > 0 {
+		if dispatched == t {
+			dispatched = t.Clone()
+		}
+		dispatched.Redact = redact
+	}
 	if err := s.ds.UpdateTask(ctx, t.ID, func(u *tork.Task) error {
 		u.State = t.State
 		u.ScheduledAt = t.ScheduledAt
@@ -89,7 +152,112 @@ func (s *Scheduler) scheduleRegularTask(ctx context.Context, t *tork.Task) error
 	}); err != nil {
 		return errors.Wrapf(err, "error updating task in datastore")
 	}
-	return s.broker.PublishTask(ctx, t.Queue, t)
+	return s.broker.PublishTask(ctx, t.Queue, dispatched)
+}
+
+// secretValues returns the values of the secrets of the job, those
+// substituted into the dispatched task and the registry password of
+// the task, for the worker to mask in the log output of the task.
+func secretValues(job *tork.Job, t *tork.Task) []string {
+	values := slices.Clone(t.Redact)
+	for _, v := range job.Secrets {
+		values = append(values, v)
+	}
+	if t.Registry != nil && t.Registry.Password != "" {
+		values = append(values, t.Registry.Password)
+	}
+	slices.Sort(values)
+	return slices.Compact(values)
+}
+
+// placeTask picks the node that the task should run on: out of the
+// UP nodes matching the task's node selector and with enough free
+// resources for it, the one with the most free capacity. The
+// requested resources are then reserved on the node until its next
+// heartbeat reports the actual allocation. If the nodes able to run
+// the task are all busy, errNodesBusy is returned.
+func (s *Scheduler) placeTask(ctx context.Context, t *tork.Task) (*tork.Node, error) {
+	var req tork.NodeResources
+	if t.Resources != nil {
+		r, err := t.Resources.Parse()
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid resources for task %s", t.ID)
+		}
+		req = r
+	}
+	nodes, err := s.ds.GetActiveNodes(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting active nodes")
+	}
+	var selected *tork.Node
+	var busy bool
+	for _, n := range nodes {
+		// skips nodes which are DOWN, OFFLINE or DRAINING
+		if n.Status != tork.NodeStatusUP {
+			continue
+		}
+		if !n.Matches(t.NodeSelector) {
+			continue
+		}
+		if t.Resources != nil && (n.Capacity == nil || !n.Capacity.Fits(req)) {
+			continue
+		}
+		// don't park the task on a node which would
+		// have to wait for resources to be released
+		if t.Resources != nil && !n.Free().Fits(req) {
+			busy = true
+			continue
+		}
+		if selected == nil || hasMoreFree(n, selected) {
+			selected = n
+		}
+	}
+	if selected == nil && busy {
+		return nil, errNodesBusy
+	} else if selected == nil {
+		return nil, errors.Errorf("no eligible node found for task %s", t.ID)
+	}
+	if t.Resources != nil {
+		if err := s.ds.UpdateNode(ctx, selected.ID, func(u *tork.Node) error {
+			var allocated tork.NodeResources
+			if u.Allocated != nil {
+				allocated = *u.Allocated
+			}
+			allocated = allocated.Add(req)
+			u.Allocated = &allocated
+			return nil
+		}); err != nil {
+			return nil, errors.Wrapf(err, "error reserving resources on node %s", selected.ID)
+		}
+	}
+	return selected, nil
+}
+
+// requeueTask hands the task back to the pending queue once the
+// requeue delay elapsed, for its placement to be retried.
+func (s *Scheduler) requeueTask(t *tork.Task) error {
+	log.Debug().Msgf("no node has enough free resources for task %s. retrying in %s", t.ID, s.requeueDelay)
+	t = t.Clone()
+	time.AfterFunc(s.requeueDelay, func() {
+		if err := s.broker.PublishTask(context.Background(), broker.QUEUE_PENDING, t); err != nil {
+			log.Error().Err(err).Msgf("error requeuing task %s", t.ID)
+		}
+	})
+	return nil
+}
+
+func hasMoreFree(n1, n2 *tork.Node) bool {
+	f1, f2 := n1.Free(), n2.Free()
+	if f1.CPUs != f2.CPUs {
+		return f1.CPUs > f2.CPUs
+	}
+	if f1.Memory != f2.Memory {
+		return f1.Memory > f2.Memory
+	}
+	if f1.GPUs != f2.GPUs {
+		return f1.GPUs > f2.GPUs
+	}
+	return n1.TaskCount < n2.TaskCount
 }
 
 func (s *Scheduler) scheduleSubJob(ctx context.Context, t *tork.Task) error {
@@ -112,6 +280,7 @@ func (s *Scheduler) scheduleAttachedSubJob(ctx context.Context, t *tork.Task) er
 		Permissions: job.Permissions,
 		ParentID:    t.ID,
 		Name:        t.SubJob.Name,
+		Namespace:   job.Namespace,
 		Description: t.SubJob.Description,
 		State:       tork.JobStatePending,
 		Tasks:       t.SubJob.Tasks,
@@ -126,6 +295,9 @@ func (s *Scheduler) scheduleAttachedSubJob(ctx context.Context, t *tork.Task) er
 		Webhooks:   t.SubJob.Webhooks,
 		AutoDelete: t.SubJob.AutoDelete,
 	}
+	if err := secrets.Bind(subjob); err != nil {
+		return errors.Wrapf(err, "error binding subjob secrets")
+	}
 	if err := s.ds.UpdateTask(ctx, t.ID, func(u *tork.Task) error {
 		u.State = tork.TaskStateRunning
 		u.ScheduledAt = &now
@@ -153,6 +325,7 @@ func (s *Scheduler) scheduleDetachedSubJob(ctx context.Context, t *tork.Task) er
 		CreatedAt:   now,
 		Permissions: job.Permissions,
 		Name:        t.SubJob.Name,
+		Namespace:   job.Namespace,
 		Description: t.SubJob.Description,
 		State:       tork.JobStatePending,
 		Tasks:       t.SubJob.Tasks,
@@ -164,6 +337,9 @@ func (s *Scheduler) scheduleDetachedSubJob(ctx context.Context, t *tork.Task) er
 		Webhooks:    t.SubJob.Webhooks,
 		AutoDelete:  t.SubJob.AutoDelete,
 	}
+	if err := secrets.Bind(subjob); err != nil {
+		return errors.Wrapf(err, "error binding subjob secrets")
+	}
 	if err := s.ds.CreateJob(ctx, subjob); err != nil {
 		return errors.Wrapf(err, "error creating subjob")
 	}
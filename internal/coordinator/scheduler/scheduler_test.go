@@ -61,6 +61,49 @@ func Test_scheduleRegularTask(t *testing.T) {
 	assert.NoError(t, ds.Close())
 }
 
+func Test_scheduleRegularTaskRedact(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+
+	dispatched := make(chan *tork.Task, 1)
+	err := b.SubscribeForTasks("test-queue", func(t *tork.Task) error {
+		dispatched <- t
+		return nil
+	})
+	assert.NoError(t, err)
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	s := NewScheduler(ds, b)
+
+	j1 := &tork.Job{
+		ID:      uuid.NewUUID(),
+		Name:    "test job",
+		Secrets: map[string]string{"password": "s3cr3t"},
+	}
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+
+	now := time.Now().UTC()
+	tk := &tork.Task{
+		ID:        uuid.NewUUID(),
+		Queue:     "test-queue",
+		JobID:     j1.ID,
+		CreatedAt: &now,
+		Registry:  &tork.Registry{Username: "me", Password: "r3g1stry"},
+	}
+	err = ds.CreateTask(ctx, tk)
+	assert.NoError(t, err)
+
+	err = s.scheduleRegularTask(ctx, tk)
+	assert.NoError(t, err)
+
+	d := <-dispatched
+	assert.Equal(t, []string{"r3g1stry", "s3cr3t"}, d.Redact)
+	assert.Empty(t, tk.Redact)
+	assert.NoError(t, ds.Close())
+}
+
 func Test_scheduleRegularTaskOverrideDefaultQueue(t *testing.T) {
 	ctx := context.Background()
 	b := broker.NewInMemoryBroker()
@@ -111,6 +154,160 @@ func Test_scheduleRegularTaskOverrideDefaultQueue(t *testing.T) {
 	assert.NoError(t, ds.Close())
 }
 
+func Test_scheduleRegularTaskPlacement(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	s := NewScheduler(ds, b)
+
+	now := time.Now().UTC()
+	newNode := func(status tork.NodeStatus, region string, cpus, allocated float64) *tork.Node {
+		id := uuid.NewShortUUID()
+		n := &tork.Node{
+			ID:              id,
+			Queue:           fmt.Sprintf("%s%s", broker.QUEUE_EXCLUSIVE_PREFIX, id),
+			Status:          status,
+			StartedAt:       now,
+			LastHeartbeatAt: now,
+			Labels:          map[string]string{"region": region},
+			Capacity:        &tork.NodeResources{CPUs: cpus, Memory: 1024 * 1024 * 1024},
+			Allocated:       &tork.NodeResources{CPUs: allocated},
+		}
+		assert.NoError(t, ds.CreateNode(ctx, n))
+		return n
+	}
+	newNode(tork.NodeStatusUP, "eu", 4, 3)
+	n2 := newNode(tork.NodeStatusUP, "eu", 4, 1)
+	newNode(tork.NodeStatusDraining, "eu", 8, 0)
+	newNode(tork.NodeStatusUP, "us", 16, 0)
+	newNode(tork.NodeStatusUP, "eu", 0.5, 0)
+
+	processed := make(chan *tork.Task)
+	err = b.SubscribeForTasks(n2.Queue, func(t *tork.Task) error {
+		processed <- t
+		return nil
+	})
+	assert.NoError(t, err)
+
+	j1 := &tork.Job{
+		ID:   uuid.NewUUID(),
+		Name: "test job",
+	}
+	err = ds.CreateJob(ctx, j1)
+	assert.NoError(t, err)
+
+	tk := &tork.Task{
+		ID:           uuid.NewUUID(),
+		JobID:        j1.ID,
+		CreatedAt:    &now,
+		NodeSelector: map[string]string{"region": "eu"},
+		Resources:    &tork.TaskResources{CPUs: "1"},
+	}
+	err = ds.CreateTask(ctx, tk)
+	assert.NoError(t, err)
+
+	err = s.scheduleRegularTask(ctx, tk)
+	assert.NoError(t, err)
+
+	placed := <-processed
+	assert.Equal(t, n2.Queue, placed.Queue)
+
+	n, err := ds.GetNodeByID(ctx, n2.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), n.Allocated.CPUs)
+
+	tk2 := &tork.Task{
+		ID:           uuid.NewUUID(),
+		JobID:        j1.ID,
+		CreatedAt:    &now,
+		NodeSelector: map[string]string{"region": "ap"},
+	}
+	err = ds.CreateTask(ctx, tk2)
+	assert.NoError(t, err)
+
+	err = s.scheduleRegularTask(ctx, tk2)
+	assert.Error(t, err)
+	assert.NoError(t, ds.Close())
+}
+
+func Test_scheduleRegularTaskNodesBusy(t *testing.T) {
+	ctx := context.Background()
+	b := broker.NewInMemoryBroker()
+
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	s := NewScheduler(ds, b)
+	s.requeueDelay = time.Millisecond * 10
+
+	now := time.Now().UTC()
+	id := uuid.NewShortUUID()
+	n := &tork.Node{
+		ID:              id,
+		Queue:           fmt.Sprintf("%s%s", broker.QUEUE_EXCLUSIVE_PREFIX, id),
+		Status:          tork.NodeStatusUP,
+		StartedAt:       now,
+		LastHeartbeatAt: now,
+		Capacity:        &tork.NodeResources{CPUs: 2},
+		Allocated:       &tork.NodeResources{CPUs: 2},
+	}
+	assert.NoError(t, ds.CreateNode(ctx, n))
+
+	placed := make(chan *tork.Task, 1)
+	err = b.SubscribeForTasks(n.Queue, func(t *tork.Task) error {
+		placed <- t
+		return nil
+	})
+	assert.NoError(t, err)
+	requeued := make(chan *tork.Task, 1)
+	err = b.SubscribeForTasks(broker.QUEUE_PENDING, func(t *tork.Task) error {
+		requeued <- t
+		return nil
+	})
+	assert.NoError(t, err)
+
+	j1 := &tork.Job{
+		ID:   uuid.NewUUID(),
+		Name: "test job",
+	}
+	assert.NoError(t, ds.CreateJob(ctx, j1))
+
+	tk := &tork.Task{
+		ID:        uuid.NewUUID(),
+		JobID:     j1.ID,
+		CreatedAt: &now,
+		Resources: &tork.TaskResources{CPUs: "1"},
+	}
+	assert.NoError(t, ds.CreateTask(ctx, tk))
+
+	// the node could run the task but is fully allocated
+	assert.NoError(t, s.scheduleRegularTask(ctx, tk))
+
+	select {
+	case rt := <-requeued:
+		assert.Equal(t, tk.ID, rt.ID)
+	case <-time.After(time.Second):
+		t.Fatal("task was not requeued")
+	}
+	assert.Len(t, placed, 0)
+
+	n, err = ds.GetNodeByID(ctx, n.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), n.Allocated.CPUs)
+
+	// no node could ever run the task
+	tk2 := &tork.Task{
+		ID:        uuid.NewUUID(),
+		JobID:     j1.ID,
+		CreatedAt: &now,
+		Resources: &tork.TaskResources{CPUs: "4"},
+	}
+	assert.NoError(t, ds.CreateTask(ctx, tk2))
+	assert.Error(t, s.scheduleRegularTask(ctx, tk2))
+	assert.NoError(t, ds.Close())
+}
+
 func Test_scheduleRegularTaskJobDefaults(t *testing.T) {
 	ctx := context.Background()
 	b := broker.NewInMemoryBroker()
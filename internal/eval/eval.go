@@ -177,6 +177,7 @@ func EvaluateExpr(ex string, c map[string]any) (any, error) {
 	env := map[string]any{
 		"randomInt": randomInt,
 		"sequence":  sequence,
+		"secret":    secret,
 	}
 	for k, v := range c {
 		env[k] = v
@@ -318,3 +318,26 @@ func BenchmarkEval(b *testing.B) {
 		assert.Equal(b, "SOME DATA", t1.Env["HELLO"])
 	}
 }
+
+func TestEvalSecret(t *testing.T) {
+	t1 := &tork.Task{
+		Env: map[string]string{
+			"TOKEN": `{{ secret("vault:kv/data/app#token") }}`,
+		},
+	}
+	err := eval.EvaluateTask(t1, map[string]any{})
+	assert.NoError(t, err)
+	// the lookup is deferred to the dispatch of the task
+	assert.Equal(t, `{{ secret("vault:kv/data/app#token") }}`, t1.Env["TOKEN"])
+	// and re-evaluating the reference is a no-op
+	err = eval.EvaluateTask(t1, map[string]any{})
+	assert.NoError(t, err)
+	assert.Equal(t, `{{ secret("vault:kv/data/app#token") }}`, t1.Env["TOKEN"])
+
+	t2 := &tork.Task{
+		Env: map[string]string{
+			"TOKEN": `{{ secret("no-scheme") }}`,
+		},
+	}
+	assert.Error(t, eval.EvaluateTask(t2, map[string]any{}))
+}
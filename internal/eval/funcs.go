@@ -5,6 +5,7 @@ import (
 	"reflect"
 
 	"github.com/pkg/errors"
+	"github.com/runabol/tork/internal/secrets"
 )
 
 func randomInt(args ...any) (int, error) {
@@ -35,3 +36,14 @@ func sequence(start, stop int) []int {
 	}
 	return result
 }
+
+// secret defers the lookup of a secret held by a secret provider
+// to the dispatch of the task, by evaluating to the canonical
+// reference to the secret. This keeps the secret's value out of
+// the task's record.
+func secret(ref string) (string, error) {
+	if _, _, err := secrets.ParseRef(ref); err != nil {
+		return "", err
+	}
+	return secrets.ProviderPlaceholder(ref), nil
+}
@@ -13,3 +13,11 @@ func TestHashPassword(t *testing.T) {
 	match := hash.CheckPasswordHash("1234", hashed)
 	assert.True(t, match)
 }
+
+func TestHashToken(t *testing.T) {
+	h1 := hash.Token("tork_1234")
+	h2 := hash.Token("tork_1234")
+	assert.Equal(t, h1, h2)
+	assert.NotEqual(t, "tork_1234", h1)
+	assert.NotEqual(t, h1, hash.Token("tork_5678"))
+}
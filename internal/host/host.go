@@ -1,8 +1,13 @@
 package host
 
 import (
+	"runtime"
+
 	"github.com/rs/zerolog/log"
 	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
 )
 
 func GetCPUPercent() float64 {
@@ -15,3 +20,62 @@ func GetCPUPercent() float64 {
 	}
 	return perc[0]
 }
+
+func GetCPUCount() int {
+	n, err := cpu.Counts(true)
+	if err != nil || n == 0 {
+		log.Debug().
+			Err(err).
+			Msgf("error getting CPU count")
+		return runtime.NumCPU()
+	}
+	return n
+}
+
+func GetMemoryTotal() int64 {
+	vm, err := mem.VirtualMemory()
+	if err != nil {
+		log.Debug().
+			Err(err).
+			Msgf("error getting total memory")
+		return 0
+	}
+	return int64(vm.Total)
+}
+
+func GetMemoryUsed() int64 {
+	vm, err := mem.VirtualMemory()
+	if err != nil {
+		log.Debug().
+			Err(err).
+			Msgf("error getting used memory")
+		return 0
+	}
+	return int64(vm.Used)
+}
+
+// GetDiskFree returns the free space, in bytes, of
+// the file system the path is on.
+func GetDiskFree(path string) int64 {
+	du, err := disk.Usage(path)
+	if err != nil {
+		log.Debug().
+			Err(err).
+			Msgf("error getting disk usage of %s", path)
+		return 0
+	}
+	return int64(du.Free)
+}
+
+// GetLoadAverage returns the load average of
+// the last 1, 5 and 15 minutes.
+func GetLoadAverage() []float64 {
+	avg, err := load.Avg()
+	if err != nil {
+		log.Debug().
+			Err(err).
+			Msgf("error getting load average")
+		return nil
+	}
+	return []float64{avg.Load1, avg.Load5, avg.Load15}
+}
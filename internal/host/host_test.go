@@ -1,6 +1,7 @@
 package host
 
 import (
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -10,3 +11,15 @@ func TestGetStats(t *testing.T) {
 	cpuPercent := GetCPUPercent()
 	assert.GreaterOrEqual(t, cpuPercent, float64(0))
 }
+
+func TestGetCapacity(t *testing.T) {
+	assert.Greater(t, GetCPUCount(), 0)
+	assert.Greater(t, GetMemoryTotal(), int64(0))
+}
+
+func TestGetTelemetry(t *testing.T) {
+	assert.Greater(t, GetMemoryUsed(), int64(0))
+	assert.Greater(t, GetDiskFree(os.TempDir()), int64(0))
+	assert.Equal(t, int64(0), GetDiskFree("/no/such/dir"))
+	assert.Len(t, GetLoadAverage(), 3)
+}
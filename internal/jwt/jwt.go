@@ -0,0 +1,344 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrInvalidSignature = errors.New("invalid token signature")
+	ErrExpiredToken     = errors.New("token is expired")
+	ErrMissingExpiry    = errors.New("token has no expiry")
+)
+
+// KeySet holds the public keys, as published in a JWKS
+// document, which are trusted to sign JSON Web Tokens.
+type KeySet struct {
+	keys []jwk
+}
+
+type jwk struct {
+	kid string
+	alg string
+	key crypto.PublicKey
+}
+
+type rawKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// LoadKeySet reads a JWKS document from the given file.
+func LoadKeySet(path string) (*KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading JWKS file %s", path)
+	}
+	return ParseKeySet(data)
+}
+
+func ParseKeySet(data []byte) (*KeySet, error) {
+	doc := struct {
+		Keys []rawKey `json:"keys"`
+	}{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrapf(err, "error parsing JWKS")
+	}
+	ks := &KeySet{}
+	for _, rk := range doc.Keys {
+		if rk.Use != "" && rk.Use != "sig" {
+			continue
+		}
+		key, err := rk.publicKey()
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing key %s", rk.Kid)
+		}
+		ks.keys = append(ks.keys, jwk{kid: rk.Kid, alg: rk.Alg, key: key})
+	}
+	if len(ks.keys) == 0 {
+		return nil, errors.New("JWKS contains no signing keys")
+	}
+	return ks, nil
+}
+
+func (rk rawKey) publicKey() (crypto.PublicKey, error) {
+	switch rk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(rk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(rk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch rk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("unsupported curve: %s", rk.Crv)
+		}
+		x, err := decodeBigInt(rk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(rk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if rk.Crv != "Ed25519" {
+			return nil, errors.Errorf("unsupported curve: %s", rk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(rk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, errors.Errorf("unsupported key type: %s", rk.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Claims are the decoded claims of a verified token.
+type Claims map[string]any
+
+// String returns the value of a string claim
+// or an empty string if it's missing.
+func (c Claims) String(name string) string {
+	v, _ := c[name].(string)
+	return v
+}
+
+// Strings returns the values of a claim which holds either
+// a single string or an array of strings.
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+type verifyOptions struct {
+	issuer   string
+	audience string
+	leeway   time.Duration
+}
+
+type VerifyOption = func(o *verifyOptions)
+
+// WithIssuer requires the token's iss claim to match.
+func WithIssuer(iss string) VerifyOption {
+	return func(o *verifyOptions) {
+		o.issuer = iss
+	}
+}
+
+// WithAudience requires the token's aud claim to contain aud.
+func WithAudience(aud string) VerifyOption {
+	return func(o *verifyOptions) {
+		o.audience = aud
+	}
+}
+
+// WithLeeway tolerates clock skew when checking exp and nbf.
+func WithLeeway(d time.Duration) VerifyOption {
+	return func(o *verifyOptions) {
+		o.leeway = d
+	}
+}
+
+// Verify checks the signature of a compact-serialized JWT against
+// the key set, validates its time-based claims -- exp is required --
+// along with any required issuer and audience, and returns its claims.
+func (ks *KeySet) Verify(token string, opts ...VerifyOption) (Claims, error) {
+	o := &verifyOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, k := range ks.keys {
+		if header.Kid != "" && k.kid != "" && k.kid != header.Kid {
+			continue
+		}
+		if k.alg != "" && k.alg != header.Alg {
+			continue
+		}
+		if err := verifySignature(header.Alg, k.key, signed, sig); err == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrInvalidSignature
+	}
+	claims := Claims{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	now := time.Now()
+	// a token without exp would be valid forever
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, ErrMissingExpiry
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(o.leeway)) {
+		return nil, ErrExpiredToken
+	}
+	if nbf, ok := claims["nbf"].(float64); ok {
+		if now.Before(time.Unix(int64(nbf), 0).Add(-o.leeway)) {
+			return nil, errors.New("token is not valid yet")
+		}
+	}
+	if o.issuer != "" && claims.String("iss") != o.issuer {
+		return nil, errors.New("unexpected token issuer")
+	}
+	if o.audience != "" && !hasAudience(claims["aud"], o.audience) {
+		return nil, errors.New("unexpected token audience")
+	}
+	return claims, nil
+}
+
+func hasAudience(aud any, expected string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == expected
+	case []any:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == expected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	var h crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		h = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		h = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		h = crypto.SHA512
+	case "EdDSA":
+		k, ok := key.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(k, signed, sig) {
+			return ErrInvalidSignature
+		}
+		return nil
+	default:
+		// symmetric algorithms and "none" are deliberately
+		// unsupported: a JWKS only ever holds public keys
+		return errors.Errorf("unsupported algorithm: %s", alg)
+	}
+	hasher := h.New()
+	hasher.Write(signed)
+	digest := hasher.Sum(nil)
+	switch alg[0] {
+	case 'R':
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrInvalidSignature
+		}
+		return rsa.VerifyPKCS1v15(k, h, digest, sig)
+	case 'P':
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrInvalidSignature
+		}
+		return rsa.VerifyPSS(k, h, digest, sig, nil)
+	default:
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return ErrInvalidSignature
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+}
@@ -0,0 +1,160 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	h, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	assert.NoError(t, err)
+	c, err := json.Marshal(claims)
+	assert.NoError(t, err)
+	signed := b64(h) + "." + b64(c)
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		assert.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		assert.NoError(t, err)
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(signed))
+	}
+	return signed + "." + b64(sig)
+}
+
+func testKeys(t *testing.T) (*rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey, *KeySet) {
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ek, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	epub, edk, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	jwks := fmt.Sprintf(`{"keys":[
+		{"kty":"RSA","kid":"rsa-1","alg":"RS256","use":"sig","n":"%s","e":"%s"},
+		{"kty":"EC","kid":"ec-1","crv":"P-256","x":"%s","y":"%s"},
+		{"kty":"OKP","kid":"ed-1","crv":"Ed25519","x":"%s"},
+		{"kty":"RSA","kid":"enc-1","use":"enc","n":"AQAB","e":"AQAB"}
+	]}`,
+		b64(rk.N.Bytes()), b64(big.NewInt(int64(rk.E)).Bytes()),
+		b64(ek.X.Bytes()), b64(ek.Y.Bytes()),
+		b64(epub),
+	)
+	ks, err := ParseKeySet([]byte(jwks))
+	assert.NoError(t, err)
+	assert.Len(t, ks.keys, 3)
+	return rk, ek, edk, ks
+}
+
+func TestVerify(t *testing.T) {
+	rk, ek, edk, ks := testKeys(t)
+	claims := map[string]any{
+		"sub": "jdoe",
+		"iss": "https://issuer.example.com",
+		"aud": []string{"tork"},
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+
+	c, err := ks.Verify(sign(t, "RS256", "rsa-1", rk, claims))
+	assert.NoError(t, err)
+	assert.Equal(t, "jdoe", c.String("sub"))
+
+	_, err = ks.Verify(sign(t, "ES256", "ec-1", ek, claims))
+	assert.NoError(t, err)
+
+	_, err = ks.Verify(sign(t, "EdDSA", "", edk, claims),
+		WithIssuer("https://issuer.example.com"),
+		WithAudience("tork"),
+	)
+	assert.NoError(t, err)
+}
+
+func TestVerifyRejects(t *testing.T) {
+	rk, _, _, ks := testKeys(t)
+	valid := map[string]any{
+		"sub": "jdoe",
+		"iss": "https://issuer.example.com",
+		"aud": "tork",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+
+	// tampered payload
+	tok := sign(t, "RS256", "rsa-1", rk, valid)
+	other := sign(t, "RS256", "rsa-1", rk, map[string]any{"sub": "admin"})
+	parts := strings.Split(tok, ".")
+	forged := parts[0] + "." + strings.Split(other, ".")[1] + "." + parts[2]
+	_, err := ks.Verify(forged)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	// unknown signing key
+	unknown, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	_, err = ks.Verify(sign(t, "RS256", "rsa-1", unknown, valid))
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	// algorithm "none"
+	h := b64([]byte(`{"alg":"none"}`))
+	p := b64([]byte(`{"sub":"jdoe"}`))
+	_, err = ks.Verify(h + "." + p + ".")
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	// expired
+	expired := map[string]any{"sub": "jdoe", "exp": time.Now().Add(-time.Hour).Unix()}
+	_, err = ks.Verify(sign(t, "RS256", "rsa-1", rk, expired))
+	assert.ErrorIs(t, err, ErrExpiredToken)
+	_, err = ks.Verify(sign(t, "RS256", "rsa-1", rk, expired), WithLeeway(time.Hour*2))
+	assert.NoError(t, err)
+
+	// no expiry
+	_, err = ks.Verify(sign(t, "RS256", "rsa-1", rk, map[string]any{"sub": "jdoe"}))
+	assert.ErrorIs(t, err, ErrMissingExpiry)
+
+	// wrong issuer and audience
+	_, err = ks.Verify(tok, WithIssuer("https://other.example.com"))
+	assert.Error(t, err)
+	_, err = ks.Verify(tok, WithAudience("other"))
+	assert.Error(t, err)
+
+	// malformed
+	_, err = ks.Verify("not-a-token")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestParseKeySetNoKeys(t *testing.T) {
+	_, err := ParseKeySet([]byte(`{"keys":[]}`))
+	assert.Error(t, err)
+	_, err = ParseKeySet([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestClaimsStrings(t *testing.T) {
+	c := Claims{"one": "a", "many": []any{"a", "b", 1}}
+	assert.Equal(t, []string{"a"}, c.Strings("one"))
+	assert.Equal(t, []string{"a", "b"}, c.Strings("many"))
+	assert.Nil(t, c.Strings("missing"))
+}
@@ -0,0 +1,78 @@
+// Package metrics keeps the Prometheus metrics of the engine.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// LabelNamespace is the label of the metrics
+// which are broken down by namespace.
+const LabelNamespace = "namespace"
+
+// DefaultBuckets suit the latency of requests and queries, in seconds.
+var DefaultBuckets = prometheus.DefBuckets
+
+// NamespaceGatherer gathers only the series of the namespace from g,
+// leaving out the metrics which are not broken down by namespace.
+func NamespaceGatherer(g prometheus.Gatherer, namespace string) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := g.Gather()
+		scoped := make([]*dto.MetricFamily, 0, len(mfs))
+		for _, mf := range mfs {
+			ms := make([]*dto.Metric, 0, len(mf.Metric))
+			namespaced := false
+			for _, m := range mf.Metric {
+				for _, l := range m.Label {
+					if l.GetName() != LabelNamespace {
+						continue
+					}
+					namespaced = true
+					if l.GetValue() == namespace {
+						ms = append(ms, m)
+					}
+				}
+			}
+			if !namespaced {
+				continue
+			}
+			mf.Metric = ms
+			scoped = append(scoped, mf)
+		}
+		return scoped, err
+	})
+}
+
+// QueueDepthCollector reports the number of messages waiting in
+// each queue, as returned by depth, whenever it gets collected.
+type QueueDepthCollector struct {
+	desc  *prometheus.Desc
+	depth func() (map[string]int, error)
+}
+
+func NewQueueDepthCollector(depth func() (map[string]int, error)) *QueueDepthCollector {
+	return &QueueDepthCollector{
+		desc: prometheus.NewDesc(
+			"tork_queue_depth",
+			"The number of messages waiting in the queue.",
+			[]string{"queue"},
+			nil,
+		),
+		depth: depth,
+	}
+}
+
+func (c *QueueDepthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *QueueDepthCollector) Collect(ch chan<- prometheus.Metric) {
+	qs, err := c.depth()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	for name, size := range qs {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(size), name)
+	}
+}
@@ -0,0 +1,96 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/runabol/tork/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// scrape serves the metrics of g and parses them back
+// the way Prometheus would.
+func scrape(t *testing.T, g prometheus.Gatherer) (int, map[string]*dto.MetricFamily) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	promhttp.HandlerFor(g, promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError}).ServeHTTP(w, req)
+	var p expfmt.TextParser
+	mfs, err := p.TextToMetricFamilies(w.Body)
+	assert.NoError(t, err)
+	return w.Code, mfs
+}
+
+func TestDefault(t *testing.T) {
+	metrics.JobsTotal.WithLabelValues("default", "COMPLETED").Inc()
+	metrics.TaskDuration.WithLabelValues("default", "ubuntu:mantic").Observe(3)
+	metrics.WorkerTasksRunning.WithLabelValues("default").Inc()
+	code, mfs := scrape(t, metrics.Default)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, dto.MetricType_COUNTER, mfs["tork_jobs_total"].GetType())
+	assert.Equal(t, dto.MetricType_HISTOGRAM, mfs["tork_task_duration_seconds"].GetType())
+	assert.Equal(t, dto.MetricType_GAUGE, mfs["tork_worker_tasks_running"].GetType())
+}
+
+func TestNamespaceGatherer(t *testing.T) {
+	r := prometheus.NewRegistry()
+	jobs := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "some_jobs_total", Help: "Some help."}, []string{metrics.LabelNamespace, "state"})
+	failures := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "some_failures_total", Help: "Some help."}, []string{"event"})
+	r.MustRegister(jobs, failures)
+	jobs.WithLabelValues("default", "COMPLETED").Inc()
+	jobs.WithLabelValues("default", "FAILED").Add(2)
+	jobs.WithLabelValues("other", "COMPLETED").Inc()
+	failures.WithLabelValues("job.StateChange").Inc()
+
+	_, mfs := scrape(t, metrics.NamespaceGatherer(r, "default"))
+	assert.Len(t, mfs, 1)
+	ms := mfs["some_jobs_total"].GetMetric()
+	assert.Len(t, ms, 2)
+	for _, m := range ms {
+		for _, l := range m.GetLabel() {
+			if l.GetName() == metrics.LabelNamespace {
+				assert.Equal(t, "default", l.GetValue())
+			}
+		}
+	}
+
+	_, mfs = scrape(t, metrics.NamespaceGatherer(r, "none"))
+	assert.Empty(t, mfs)
+}
+
+func TestQueueDepthCollector(t *testing.T) {
+	r := prometheus.NewRegistry()
+	r.MustRegister(metrics.NewQueueDepthCollector(func() (map[string]int, error) {
+		return map[string]int{"default": 3, "x-pending": 0}, nil
+	}))
+	code, mfs := scrape(t, r)
+	assert.Equal(t, http.StatusOK, code)
+	mf := mfs["tork_queue_depth"]
+	assert.Equal(t, dto.MetricType_GAUGE, mf.GetType())
+	depth := make(map[string]float64)
+	for _, m := range mf.GetMetric() {
+		depth[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+	}
+	assert.Equal(t, map[string]float64{"default": 3, "x-pending": 0}, depth)
+}
+
+func TestQueueDepthCollectorError(t *testing.T) {
+	r := prometheus.NewRegistry()
+	r.MustRegister(metrics.NewQueueDepthCollector(func() (map[string]int, error) {
+		return nil, errors.New("broker is down")
+	}))
+	jobs := prometheus.NewCounter(prometheus.CounterOpts{Name: "some_jobs_total", Help: "Some help."})
+	r.MustRegister(jobs)
+	_, err := r.Gather()
+	assert.ErrorContains(t, err, "broker is down")
+	// the other metrics are still served
+	code, mfs := scrape(t, r)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, mfs, "some_jobs_total")
+	assert.NotContains(t, mfs, "tork_queue_depth")
+}
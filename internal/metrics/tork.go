@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Default is the registry of the metrics of the engine.
+var Default = prometheus.NewRegistry()
+
+var (
+	taskBuckets  = []float64{1, 5, 15, 30, 60, 300, 900, 1800, 3600, 7200, 21600}
+	queueBuckets = []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300, 900}
+)
+
+var (
+	// JobsTotal counts the jobs which reached a final state.
+	JobsTotal = promauto.With(Default).NewCounterVec(prometheus.CounterOpts{
+		Name: "tork_jobs_total",
+		Help: "The number of jobs which completed, failed or were cancelled.",
+	}, []string{LabelNamespace, "state"})
+	// TasksTotal counts the tasks which reached a final state.
+	TasksTotal = promauto.With(Default).NewCounterVec(prometheus.CounterOpts{
+		Name: "tork_tasks_total",
+		Help: "The number of tasks which completed, failed or were cancelled.",
+	}, []string{LabelNamespace, "state"})
+	// TaskScheduleToStart observes the time tasks
+	// spent waiting in their queue for a worker.
+	TaskScheduleToStart = promauto.With(Default).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tork_task_schedule_to_start_seconds",
+		Help:    "The time between the scheduling of tasks and their start.",
+		Buckets: queueBuckets,
+	}, []string{"queue"})
+	// TaskDuration observes the time tasks took to complete or fail.
+	TaskDuration = promauto.With(Default).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tork_task_duration_seconds",
+		Help:    "The time tasks ran for until they completed or failed.",
+		Buckets: taskBuckets,
+	}, []string{"queue", "image"})
+	// WebhookFailures counts the webhook calls which failed
+	// after running out of attempts.
+	WebhookFailures = promauto.With(Default).NewCounterVec(prometheus.CounterOpts{
+		Name: "tork_webhook_failures_total",
+		Help: "The number of webhook calls which failed.",
+	}, []string{"event"})
+	// BrokerPublishErrors counts the messages the broker failed to publish.
+	BrokerPublishErrors = promauto.With(Default).NewCounterVec(prometheus.CounterOpts{
+		Name: "tork_broker_publish_errors_total",
+		Help: "The number of messages the broker failed to publish.",
+	}, []string{"broker", "queue"})
+	// DatastoreQueryDuration observes the latency of datastore operations.
+	DatastoreQueryDuration = promauto.With(Default).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "tork_datastore_query_duration_seconds",
+		Help:    "The latency of datastore operations.",
+		Buckets: DefaultBuckets,
+	}, []string{"operation"})
+	// WorkerTasksRunning is the number of tasks the worker is running.
+	WorkerTasksRunning = promauto.With(Default).NewGaugeVec(prometheus.GaugeOpts{
+		Name: "tork_worker_tasks_running",
+		Help: "The number of tasks the worker is running.",
+	}, []string{"queue"})
+	// WorkerTasksTotal counts the tasks the worker ran.
+	WorkerTasksTotal = promauto.With(Default).NewCounterVec(prometheus.CounterOpts{
+		Name: "tork_worker_tasks_total",
+		Help: "The number of tasks the worker ran to completion or failure.",
+	}, []string{"queue", "state"})
+)
@@ -17,6 +17,13 @@ const (
 type Redacter struct {
 	matchers []Matcher
 	ds       datastore.Datastore
+	secrets  Secrets
+}
+
+// Secrets looks up the values of the secrets a job references
+// from outside of the job, e.g. from a secret provider.
+type Secrets interface {
+	Values(ctx context.Context, j *tork.Job) (map[string]string, error)
 }
 
 func NewRedacter(ds datastore.Datastore, matchers ...Matcher) *Redacter {
@@ -29,6 +36,13 @@ func NewRedacter(ds datastore.Datastore, matchers ...Matcher) *Redacter {
 	}
 }
 
+// WithSecrets also redacts the values of the
+// secrets jobs reference from outside of the job.
+func (r *Redacter) WithSecrets(s Secrets) *Redacter {
+	r.secrets = s
+	return r
+}
+
 type Matcher func(string) bool
 
 var defaultMatchers = []Matcher{
@@ -55,7 +69,24 @@ func (r *Redacter) RedactTask(t *tork.Task) {
 		log.Error().Err(err).Msgf("error getting job for task %s", t.ID)
 		return
 	}
-	r.doRedactTask(t, job.Secrets)
+	r.doRedactTask(t, r.jobSecrets(job))
+}
+
+// jobSecrets returns the values of the job's inline
+// secrets along with those of the secrets it references.
+func (r *Redacter) jobSecrets(j *tork.Job) map[string]string {
+	if r.secrets == nil {
+		return j.Secrets
+	}
+	values, err := r.secrets.Values(context.Background(), j)
+	if err != nil {
+		log.Error().Err(err).Msgf("error getting the secrets of job %s", j.ID)
+		return j.Secrets
+	}
+	for k, v := range j.Secrets {
+		values[k] = v
+	}
+	return values
 }
 
 func (r *Redacter) doRedactTask(t *tork.Task, secrets map[string]string) {
@@ -87,27 +118,34 @@ func (r *Redacter) doRedactTask(t *tork.Task, secrets map[string]string) {
 	}
 }
 
+// RedactJobTask redacts a task of the job, without
+// looking the job up.
+func (r *Redacter) RedactJobTask(j *tork.Job, t *tork.Task) {
+	r.doRedactTask(t, r.jobSecrets(j))
+}
+
 func (r *Redacter) RedactJob(j *tork.Job) {
 	redacted := j
+	secrets := r.jobSecrets(j)
 	// redact inputs
-	redacted.Inputs = r.redactVars(redacted.Inputs, j.Secrets)
+	redacted.Inputs = r.redactVars(redacted.Inputs, secrets)
 	// redact webhook headers
 	for _, w := range j.Webhooks {
 		if w.Headers != nil {
-			w.Headers = r.redactVars(w.Headers, j.Secrets)
+			w.Headers = r.redactVars(w.Headers, secrets)
 		}
 	}
 	// redact context
-	redacted.Context.Inputs = r.redactVars(redacted.Context.Inputs, j.Secrets)
-	redacted.Context.Secrets = r.redactVars(redacted.Context.Secrets, j.Secrets)
-	redacted.Context.Tasks = r.redactVars(redacted.Context.Tasks, j.Secrets)
+	redacted.Context.Inputs = r.redactVars(redacted.Context.Inputs, secrets)
+	redacted.Context.Secrets = r.redactVars(redacted.Context.Secrets, secrets)
+	redacted.Context.Tasks = r.redactVars(redacted.Context.Tasks, secrets)
 	// redact tasks
 	for _, t := range redacted.Tasks {
-		r.doRedactTask(t, j.Secrets)
+		r.doRedactTask(t, secrets)
 	}
 	// redact execution
 	for _, t := range redacted.Execution {
-		r.doRedactTask(t, j.Secrets)
+		r.doRedactTask(t, secrets)
 	}
 	for k := range j.Secrets {
 		redacted.Secrets[k] = redactedStr
@@ -226,3 +226,37 @@ func TestRedactJobWildcard(t *testing.T) {
 	assert.Equal(t, "hello world", j.Tasks[0].Env["harmless"])
 	assert.NoError(t, ds.Close())
 }
+
+type staticSecrets map[string]string
+
+func (s staticSecrets) Values(_ context.Context, _ *tork.Job) (map[string]string, error) {
+	values := make(map[string]string)
+	for k, v := range s {
+		values[k] = v
+	}
+	return values, nil
+}
+
+func TestRedactJobReferencedSecrets(t *testing.T) {
+	j := &tork.Job{
+		Tasks: []*tork.Task{
+			{
+				Env: map[string]string{
+					"TOKEN": `{{ secret("vault:kv/data/app#token") }}`,
+				},
+			},
+		},
+		Context: tork.JobContext{
+			Tasks: map[string]string{
+				"echo":  "t0k3n",
+				"other": "hello world",
+			},
+		},
+	}
+
+	redacter := NewRedacter(nil).WithSecrets(staticSecrets{"vault:kv/data/app#token": "t0k3n"})
+	redacter.RedactJob(j)
+
+	assert.Equal(t, "[REDACTED]", j.Context.Tasks["echo"])
+	assert.Equal(t, "hello world", j.Context.Tasks["other"])
+}
@@ -0,0 +1,87 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// values shorter than this are not masked in
+// streams, as they would mask too much output.
+const minStreamSecretLength = 4
+
+// Stream masks the values of secrets, as well as their base64 and
+// URL encodings, in output which arrives in chunks split at arbitrary
+// points, such as the log of a task.
+type Stream struct {
+	replacer *strings.Replacer
+	patterns []string
+}
+
+func NewStream(secrets ...string) *Stream {
+	seen := make(map[string]bool)
+	patterns := make([]string, 0)
+	add := func(p string) {
+		if len(p) >= minStreamSecretLength && !seen[p] {
+			seen[p] = true
+			patterns = append(patterns, p)
+		}
+	}
+	for _, s := range secrets {
+		if len(s) < minStreamSecretLength {
+			continue
+		}
+		add(s)
+		add(base64.StdEncoding.EncodeToString([]byte(s)))
+		add(base64.RawStdEncoding.EncodeToString([]byte(s)))
+		add(base64.URLEncoding.EncodeToString([]byte(s)))
+		add(base64.RawURLEncoding.EncodeToString([]byte(s)))
+		add(url.QueryEscape(s))
+		add(url.PathEscape(s))
+	}
+	// the replacer tries the patterns in order,
+	// so prefer the longest of overlapping ones
+	sort.Slice(patterns, func(i, j int) bool {
+		return len(patterns[i]) > len(patterns[j])
+	})
+	oldnew := make([]string, 0, len(patterns)*2)
+	for _, p := range patterns {
+		oldnew = append(oldnew, p, redactedStr)
+	}
+	return &Stream{
+		replacer: strings.NewReplacer(oldnew...),
+		patterns: patterns,
+	}
+}
+
+// Redact masks the secrets in the chunk. Unless it is the final chunk,
+// the trailing bytes which may be the beginning of a secret are held
+// back and returned separately, to be prepended to the next chunk.
+func (s *Stream) Redact(chunk []byte, final bool) ([]byte, []byte) {
+	if len(s.patterns) == 0 {
+		return chunk, nil
+	}
+	redacted := []byte(s.replacer.Replace(string(chunk)))
+	if final {
+		return redacted, nil
+	}
+	n := s.pending(redacted)
+	return redacted[:len(redacted)-n], redacted[len(redacted)-n:]
+}
+
+// pending returns the length of the longest suffix of
+// b which is a proper prefix of one of the patterns.
+func (s *Stream) pending(b []byte) int {
+	longest := 0
+	for _, p := range s.patterns {
+		for n := min(len(p)-1, len(b)); n > longest; n-- {
+			if bytes.HasSuffix(b, []byte(p[:n])) {
+				longest = n
+				break
+			}
+		}
+	}
+	return longest
+}
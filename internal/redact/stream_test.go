@@ -0,0 +1,52 @@
+package redact
+
+import (
+	"encoding/base64"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamRedact(t *testing.T) {
+	s := NewStream("s3cr3t&pass", "abc")
+
+	out, pending := s.Redact([]byte("password is s3cr3t&pass\n"), false)
+	assert.Equal(t, "password is [REDACTED]\n", string(out))
+	assert.Empty(t, pending)
+
+	encoded := base64.StdEncoding.EncodeToString([]byte("s3cr3t&pass"))
+	out, _ = s.Redact([]byte("b64: "+encoded+"\n"), false)
+	assert.Equal(t, "b64: [REDACTED]\n", string(out))
+
+	out, _ = s.Redact([]byte("url: ?p="+url.QueryEscape("s3cr3t&pass")+"\n"), false)
+	assert.Equal(t, "url: ?p=[REDACTED]\n", string(out))
+
+	// values too short to be masked
+	out, _ = s.Redact([]byte("abc\n"), false)
+	assert.Equal(t, "abc\n", string(out))
+}
+
+func TestStreamRedactAcrossChunks(t *testing.T) {
+	s := NewStream("s3cr3t&pass")
+
+	out, pending := s.Redact([]byte("password is s3cr"), false)
+	assert.Equal(t, "password is ", string(out))
+	assert.Equal(t, "s3cr", string(pending))
+
+	out, pending = s.Redact(append(pending, []byte("3t&pass and more")...), false)
+	assert.Equal(t, "[REDACTED] and more", string(out))
+	assert.Empty(t, pending)
+
+	// the final chunk is not held back
+	out, pending = s.Redact([]byte("ends with s3c"), true)
+	assert.Equal(t, "ends with s3c", string(out))
+	assert.Empty(t, pending)
+}
+
+func TestStreamNoSecrets(t *testing.T) {
+	s := NewStream()
+	out, pending := s.Redact([]byte("hello s3cr"), false)
+	assert.Equal(t, "hello s3cr", string(out))
+	assert.Empty(t, pending)
+}
@@ -0,0 +1,67 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Cipher encrypts secret values at rest using AES-GCM.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// ParseKey decodes a base64 encoded AES key.
+func ParseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid secrets key")
+	}
+	return key, nil
+}
+
+// NewCipher creates a cipher from a 16, 24 or 32 byte key,
+// selecting AES-128, AES-192 or AES-256 respectively.
+func NewCipher(key []byte) (*Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid secrets key")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// Seal encrypts the plaintext under a random nonce and returns
+// the nonce and ciphertext, base64 encoded.
+func (c *Cipher) Seal(plaintext string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", errors.Wrapf(err, "error generating nonce")
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value produced by Seal.
+func (c *Cipher) Open(ciphertext string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid ciphertext")
+	}
+	ns := c.aead.NonceSize()
+	if len(sealed) < ns {
+		return "", errors.New("invalid ciphertext")
+	}
+	plaintext, err := c.aead.Open(nil, sealed[:ns], sealed[ns:], nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "error decrypting secret")
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,154 @@
+package secrets
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const envelopePrefix = "tork:enc:v1:"
+
+// Keyring envelope-encrypts values: each value is encrypted under a
+// data key of its own, which is in turn encrypted -- wrapped -- under
+// the primary key of the ring. Values whose data key is wrapped under
+// one of the previous keys of the ring can still be decrypted, and
+// rotating the primary key only requires re-wrapping the data keys.
+type Keyring struct {
+	primary string
+	keys    map[string]*Cipher
+}
+
+// KeyID identifies a key without disclosing it.
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+func NewKeyring(primary []byte, previous ...[]byte) (*Keyring, error) {
+	k := &Keyring{
+		primary: KeyID(primary),
+		keys:    make(map[string]*Cipher),
+	}
+	for _, key := range append([][]byte{primary}, previous...) {
+		c, err := NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[KeyID(key)] = c
+	}
+	return k, nil
+}
+
+// ParseKeyring creates a keyring from base64 encoded keys.
+func ParseKeyring(primary string, previous ...string) (*Keyring, error) {
+	key, err := ParseKey(primary)
+	if err != nil {
+		return nil, err
+	}
+	prev := make([][]byte, len(previous))
+	for i, p := range previous {
+		if prev[i], err = ParseKey(p); err != nil {
+			return nil, err
+		}
+	}
+	return NewKeyring(key, prev...)
+}
+
+// IsEnvelope reports whether the value was produced by Seal.
+func IsEnvelope(s string) bool {
+	return strings.HasPrefix(s, envelopePrefix)
+}
+
+// Seal encrypts the plaintext under a new data key.
+func (k *Keyring) Seal(plaintext []byte) (string, error) {
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return "", errors.Wrapf(err, "error generating data key")
+	}
+	c, err := NewCipher(dek)
+	if err != nil {
+		return "", err
+	}
+	ct, err := c.Seal(string(plaintext))
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := k.keys[k.primary].Seal(base64.StdEncoding.EncodeToString(dek))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%s:%s:%s", envelopePrefix, k.primary, wrapped, ct), nil
+}
+
+func parseEnvelope(envelope string) (kid, wrapped, ct string, err error) {
+	parts := strings.Split(strings.TrimPrefix(envelope, envelopePrefix), ":")
+	if !IsEnvelope(envelope) || len(parts) != 3 {
+		return "", "", "", errors.New("invalid envelope")
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+func (k *Keyring) unwrap(kid, wrapped string) (*Cipher, error) {
+	kek, ok := k.keys[kid]
+	if !ok {
+		return nil, errors.Errorf("unknown encryption key %s", kid)
+	}
+	encoded, err := kek.Open(wrapped)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error unwrapping data key")
+	}
+	dek, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid data key")
+	}
+	return NewCipher(dek)
+}
+
+// Open decrypts a value produced by Seal.
+func (k *Keyring) Open(envelope string) ([]byte, error) {
+	kid, wrapped, ct, err := parseEnvelope(envelope)
+	if err != nil {
+		return nil, err
+	}
+	c, err := k.unwrap(kid, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	pt, err := c.Open(ct)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(pt), nil
+}
+
+// Rewrap re-wraps the data key of the value under the primary key,
+// reporting whether it was wrapped under another key. The value
+// itself is not re-encrypted.
+func (k *Keyring) Rewrap(envelope string) (string, bool, error) {
+	kid, wrapped, ct, err := parseEnvelope(envelope)
+	if err != nil {
+		return "", false, err
+	}
+	if kid == k.primary {
+		return envelope, false, nil
+	}
+	kek, ok := k.keys[kid]
+	if !ok {
+		return "", false, errors.Errorf("unknown encryption key %s", kid)
+	}
+	encoded, err := kek.Open(wrapped)
+	if err != nil {
+		return "", false, errors.Wrapf(err, "error unwrapping data key")
+	}
+	rewrapped, err := k.keys[k.primary].Seal(encoded)
+	if err != nil {
+		return "", false, err
+	}
+	return fmt.Sprintf("%s%s:%s:%s", envelopePrefix, k.primary, rewrapped, ct), true, nil
+}
@@ -0,0 +1,89 @@
+package secrets_test
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"github.com/runabol/tork/internal/secrets"
+	"github.com/stretchr/testify/assert"
+)
+
+func newKey(t *testing.T) []byte {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	assert.NoError(t, err)
+	return key
+}
+
+func TestKeyring(t *testing.T) {
+	kr, err := secrets.NewKeyring(newKey(t))
+	assert.NoError(t, err)
+
+	env, err := kr.Seal([]byte(`{"PASSWORD":"secret"}`))
+	assert.NoError(t, err)
+	assert.True(t, secrets.IsEnvelope(env))
+	assert.NotContains(t, env, "secret")
+
+	env2, err := kr.Seal([]byte(`{"PASSWORD":"secret"}`))
+	assert.NoError(t, err)
+	assert.NotEqual(t, env, env2)
+
+	pt, err := kr.Open(env)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"PASSWORD":"secret"}`, string(pt))
+
+	other, err := secrets.NewKeyring(newKey(t))
+	assert.NoError(t, err)
+	_, err = other.Open(env)
+	assert.Error(t, err)
+
+	_, err = kr.Open("tork:enc:v1:bad")
+	assert.Error(t, err)
+	assert.False(t, secrets.IsEnvelope(`{"PASSWORD":"secret"}`))
+
+	_, err = secrets.NewKeyring([]byte("short"))
+	assert.Error(t, err)
+}
+
+func TestKeyringRotation(t *testing.T) {
+	oldKey := newKey(t)
+	currentKey := newKey(t)
+
+	old, err := secrets.NewKeyring(oldKey)
+	assert.NoError(t, err)
+	env, err := old.Seal([]byte("hello"))
+	assert.NoError(t, err)
+
+	kr, err := secrets.ParseKeyring(
+		base64.StdEncoding.EncodeToString(currentKey),
+		base64.StdEncoding.EncodeToString(oldKey),
+	)
+	assert.NoError(t, err)
+
+	// values sealed under a previous key can still be opened
+	pt, err := kr.Open(env)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(pt))
+
+	rewrapped, ok, err := kr.Rewrap(env)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.NotEqual(t, env, rewrapped)
+
+	_, ok, err = kr.Rewrap(rewrapped)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// once re-wrapped the previous key is no longer needed
+	current, err := secrets.NewKeyring(currentKey)
+	assert.NoError(t, err)
+	pt, err = current.Open(rewrapped)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(pt))
+	_, err = current.Open(env)
+	assert.Error(t, err)
+
+	_, err = secrets.ParseKeyring("not base64!")
+	assert.Error(t, err)
+}
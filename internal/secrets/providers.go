@@ -0,0 +1,116 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// EnvProvider looks secrets up from the environment variables of
+// the coordinator. Only variables starting with the prefix are
+// exposed, so "env:DB_PASSWORD" names the <prefix>DB_PASSWORD
+// variable.
+type EnvProvider struct {
+	prefix string
+}
+
+func NewEnvProvider(prefix string) *EnvProvider {
+	return &EnvProvider{prefix: prefix}
+}
+
+func (p *EnvProvider) GetSecret(_ context.Context, path string) (string, error) {
+	v, ok := os.LookupEnv(p.prefix + path)
+	if !ok {
+		return "", errors.Errorf("environment variable %s%s is not set", p.prefix, path)
+	}
+	return v, nil
+}
+
+// FileProvider looks secrets up from the files of a directory,
+// typically where an orchestrator mounts secrets on the
+// coordinator -- e.g. "file:db/password" names the file
+// <dir>/db/password. Trailing newlines are trimmed.
+type FileProvider struct {
+	dir string
+}
+
+func NewFileProvider(dir string) *FileProvider {
+	return &FileProvider{dir: dir}
+}
+
+func (p *FileProvider) GetSecret(_ context.Context, path string) (string, error) {
+	if !filepath.IsLocal(path) {
+		return "", errors.Errorf("invalid secret file path: %s", path)
+	}
+	b, err := os.ReadFile(filepath.Join(p.dir, path))
+	if err != nil {
+		return "", errors.Wrapf(err, "error reading secret file")
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// VaultProvider looks secrets up from the KV secrets engine of
+// HashiCorp Vault. Paths name the secret and the key within it,
+// e.g. "kv/data/app#token". Both versions of the KV engine are
+// supported.
+type VaultProvider struct {
+	addr   string
+	token  string
+	client *http.Client
+}
+
+func NewVaultProvider(addr, token string) *VaultProvider {
+	return &VaultProvider{
+		addr:   strings.TrimSuffix(addr, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *VaultProvider) GetSecret(ctx context.Context, path string) (string, error) {
+	secretPath, key, ok := strings.Cut(path, "#")
+	if !ok || key == "" {
+		return "", errors.Errorf("invalid vault secret path: %s. Expecting: <path>#<key>", path)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/v1/%s", p.addr, strings.TrimPrefix(secretPath, "/")), nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "error creating vault request")
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "error reading %s from vault", secretPath)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("error reading %s from vault: %s", secretPath, resp.Status)
+	}
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", errors.Wrapf(err, "error decoding vault response")
+	}
+	data := body.Data
+	// KV v2 nests the secret's data along with its metadata
+	if nested, ok := data["data"].(map[string]any); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+	v, ok := data[key]
+	if !ok {
+		return "", errors.Errorf("vault secret %s has no key %s", secretPath, key)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprintf("%v", v), nil
+}
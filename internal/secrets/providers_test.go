@@ -0,0 +1,119 @@
+package secrets_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/internal/secrets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRef(t *testing.T) {
+	scheme, path, err := secrets.ParseRef("vault:kv/data/app#token")
+	assert.NoError(t, err)
+	assert.Equal(t, "vault", scheme)
+	assert.Equal(t, "kv/data/app#token", path)
+
+	_, _, err = secrets.ParseRef("kv/data/app")
+	assert.Error(t, err)
+	_, _, err = secrets.ParseRef(`vault:some "path"`)
+	assert.Error(t, err)
+}
+
+func TestEnvProvider(t *testing.T) {
+	t.Setenv("TORK_SECRET_DB_PASSWORD", "hush")
+	t.Setenv("DB_PASSWORD", "other")
+	p := secrets.NewEnvProvider("TORK_SECRET_")
+	v, err := p.GetSecret(context.Background(), "DB_PASSWORD")
+	assert.NoError(t, err)
+	assert.Equal(t, "hush", v)
+	_, err = p.GetSecret(context.Background(), "NO_SUCH_SECRET")
+	assert.Error(t, err)
+}
+
+func TestFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "db"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "db", "password"), []byte("hush\n"), 0600))
+	p := secrets.NewFileProvider(dir)
+	v, err := p.GetSecret(context.Background(), "db/password")
+	assert.NoError(t, err)
+	assert.Equal(t, "hush", v)
+	_, err = p.GetSecret(context.Background(), "../etc/passwd")
+	assert.Error(t, err)
+	_, err = p.GetSecret(context.Background(), "db/nothing")
+	assert.Error(t, err)
+}
+
+func TestVaultProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/kv/data/app":
+			_, _ = w.Write([]byte(`{"data":{"data":{"token":"s3cr3t"},"metadata":{"version":1}}}`))
+		case "/v1/secret/app":
+			_, _ = w.Write([]byte(`{"data":{"token":"v1-s3cr3t"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	p := secrets.NewVaultProvider(srv.URL, "root")
+	v, err := p.GetSecret(ctx, "kv/data/app#token")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", v)
+	v, err = p.GetSecret(ctx, "secret/app#token")
+	assert.NoError(t, err)
+	assert.Equal(t, "v1-s3cr3t", v)
+	_, err = p.GetSecret(ctx, "kv/data/app#nokey")
+	assert.Error(t, err)
+	_, err = p.GetSecret(ctx, "kv/data/app")
+	assert.Error(t, err)
+	_, err = p.GetSecret(ctx, "kv/data/other#token")
+	assert.Error(t, err)
+	_, err = secrets.NewVaultProvider(srv.URL, "bad").GetSecret(ctx, "kv/data/app#token")
+	assert.Error(t, err)
+}
+
+func TestResolveProviderSecrets(t *testing.T) {
+	t.Setenv("TORK_SECRET_TOKEN", "t0k3n")
+	r := secrets.NewResolver(nil, map[string]tork.SecretProvider{
+		"env": secrets.NewEnvProvider("TORK_SECRET_"),
+	})
+	assert.True(t, r.HasProvider("env"))
+	assert.False(t, r.HasProvider("vault"))
+
+	j := &tork.Job{
+		Tasks: []*tork.Task{{
+			Env: map[string]string{"TOKEN": secrets.ProviderPlaceholder("env:TOKEN")},
+			Run: "echo {{ secret('env:TOKEN') }}",
+		}},
+	}
+	refs, err := secrets.ProviderRefs(j.Tasks)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"env:TOKEN"}, refs)
+
+	resolved, err := r.ResolveTask(context.Background(), j, j.Tasks[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "t0k3n", resolved.Env["TOKEN"])
+	assert.Equal(t, "echo t0k3n", resolved.Run)
+	assert.Equal(t, secrets.ProviderPlaceholder("env:TOKEN"), j.Tasks[0].Env["TOKEN"])
+
+	values, err := r.Values(context.Background(), j)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"env:TOKEN": "t0k3n"}, values)
+
+	j.Tasks[0].Env["OTHER"] = secrets.ProviderPlaceholder("vault:kv/data/app#token")
+	_, err = r.ResolveTask(context.Background(), j, j.Tasks[0])
+	assert.Error(t, err)
+}
@@ -0,0 +1,145 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/runabol/tork"
+)
+
+var (
+	refPattern = regexp.MustCompile(`{{\s*secrets\.([A-Za-z_][A-Za-z0-9_]*)\s*}}`)
+	// matches {{ secret("...") }} or {{ secret('...') }} within
+	// JSON, where the double quotes are escaped.
+	providerRefPattern = regexp.MustCompile(`{{\s*secret\(\s*(?:\\"([^"'\\\s]+)\\"|'([^"'\\\s]+)')\s*\)\s*}}`)
+	providerRef        = regexp.MustCompile(`^([a-z][a-z0-9_-]*):([^"'\\\s]+)$`)
+)
+
+// Placeholder returns the canonical reference to the named secret.
+func Placeholder(name string) string {
+	return fmt.Sprintf("{{ secrets.%s }}", name)
+}
+
+// ProviderPlaceholder returns the canonical reference to
+// a secret held by a secret provider.
+func ProviderPlaceholder(ref string) string {
+	return fmt.Sprintf(`{{ secret("%s") }}`, ref)
+}
+
+// ParseRef splits a reference to a secret held by a secret
+// provider, e.g. "vault:kv/data/app#token", into the provider's
+// scheme and the path of the secret.
+func ParseRef(ref string) (string, string, error) {
+	m := providerRef.FindStringSubmatch(ref)
+	if m == nil {
+		return "", "", errors.Errorf("invalid secret reference: %s. Expecting: <provider>:<path>", ref)
+	}
+	return m[1], m[2], nil
+}
+
+func marshal(v any) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// Refs returns the sorted names of the secrets referenced
+// anywhere within the given tasks.
+func Refs(tasks any) ([]string, error) {
+	s, err := marshal(tasks)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error marshalling tasks")
+	}
+	return refs(s), nil
+}
+
+func refs(s string) []string {
+	seen := make(map[string]bool)
+	names := make([]string, 0)
+	for _, m := range refPattern.FindAllStringSubmatch(s, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProviderRefs returns the sorted references to the secrets of
+// secret providers made anywhere within the given tasks.
+func ProviderRefs(tasks any) ([]string, error) {
+	s, err := marshal(tasks)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error marshalling tasks")
+	}
+	return providerRefs(s), nil
+}
+
+func providerRefs(s string) []string {
+	seen := make(map[string]bool)
+	result := make([]string, 0)
+	for _, m := range providerRefPattern.FindAllStringSubmatch(s, -1) {
+		ref := m[1] + m[2]
+		if !seen[ref] {
+			seen[ref] = true
+			result = append(result, ref)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Stored returns the names of the secrets referenced by the tasks
+// which are not supplied inline, and which must therefore come
+// from the secrets store.
+func Stored(tasks any, inline map[string]string) ([]string, error) {
+	names, err := Refs(tasks)
+	if err != nil {
+		return nil, err
+	}
+	return stored(names, inline), nil
+}
+
+func stored(names []string, inline map[string]string) []string {
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		if _, ok := inline[name]; !ok {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// Bind prepares the job's context so that references to stored
+// secrets evaluate to themselves and are left for the scheduler
+// to resolve when dispatching the task. This way the values of
+// stored secrets are never written to the job's record.
+func Bind(j *tork.Job) error {
+	names, err := Stored(j.Tasks, j.Secrets)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	// the context may share its map with the job's inline secrets
+	ctxSecrets := make(map[string]string, len(j.Context.Secrets)+len(names))
+	for k, v := range j.Context.Secrets {
+		ctxSecrets[k] = v
+	}
+	j.Context.Secrets = ctxSecrets
+	for _, name := range names {
+		j.Context.Secrets[name] = Placeholder(name)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/internal/cache"
+)
+
+// Lookup looks up the values of the named secrets of a namespace.
+type Lookup interface {
+	Resolve(ctx context.Context, namespace string, names []string) (map[string]string, error)
+}
+
+// Resolver resolves the references tasks make to secrets, whether
+// kept in the secrets store or by a secret provider.
+type Resolver struct {
+	store     Lookup
+	providers map[string]tork.SecretProvider
+	cache     *cache.Cache[string]
+}
+
+// NewResolver creates a resolver of the secrets of the store and of
+// the providers, keyed by scheme. Either may be omitted, in which
+// case references to their secrets are left unresolved.
+func NewResolver(store Lookup, providers map[string]tork.SecretProvider) *Resolver {
+	return &Resolver{
+		store:     store,
+		providers: providers,
+		cache:     cache.New[string](time.Minute, time.Minute),
+	}
+}
+
+// HasProvider reports whether a provider is registered for the scheme.
+func (r *Resolver) HasProvider(scheme string) bool {
+	_, ok := r.providers[scheme]
+	return ok
+}
+
+// HasStore reports whether references to stored secrets are resolved.
+func (r *Resolver) HasStore() bool {
+	return r.store != nil
+}
+
+func (r *Resolver) get(ctx context.Context, ref string) (string, error) {
+	scheme, path, err := ParseRef(ref)
+	if err != nil {
+		return "", err
+	}
+	p, ok := r.providers[scheme]
+	if !ok {
+		return "", errors.Errorf("unknown secret provider: %s", scheme)
+	}
+	v, err := p.GetSecret(ctx, path)
+	if err != nil {
+		return "", errors.Wrapf(err, "error getting secret %s", ref)
+	}
+	return v, nil
+}
+
+func (r *Resolver) resolve(ctx context.Context, j *tork.Job, s string) (map[string]string, map[string]string, error) {
+	values := make(map[string]string)
+	if names := stored(refs(s), j.Secrets); len(names) > 0 && r.store != nil {
+		v, err := r.store.Resolve(ctx, j.Namespace, names)
+		if err != nil {
+			return nil, nil, err
+		}
+		values = v
+	}
+	pvalues := make(map[string]string)
+	for _, ref := range providerRefs(s) {
+		v, err := r.get(ctx, ref)
+		if err != nil {
+			return nil, nil, err
+		}
+		pvalues[ref] = v
+	}
+	return values, pvalues, nil
+}
+
+// ResolveTask returns a copy of the task with every reference to
+// a stored secret, or to a secret of a provider, replaced by the
+// secret's value. The values substituted are added to the copy's
+// Redact, so that the worker masks exactly what it received. The
+// task itself is left untouched.
+func (r *Resolver) ResolveTask(ctx context.Context, j *tork.Job, t *tork.Task) (*tork.Task, error) {
+	s, err := marshal(t)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error marshalling task")
+	}
+	values, pvalues, err := r.resolve(ctx, j, s)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 && len(pvalues) == 0 {
+		return t, nil
+	}
+	s = refPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		v, ok := values[refPattern.FindStringSubmatch(ref)[1]]
+		if !ok {
+			return ref
+		}
+		return escape(v)
+	})
+	s = providerRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		m := providerRefPattern.FindStringSubmatch(ref)
+		v, ok := pvalues[m[1]+m[2]]
+		if !ok {
+			return ref
+		}
+		return escape(v)
+	})
+	resolved := &tork.Task{}
+	if err := json.Unmarshal([]byte(s), resolved); err != nil {
+		return nil, errors.Wrapf(err, "error resolving secrets")
+	}
+	for _, v := range values {
+		resolved.Redact = append(resolved.Redact, v)
+	}
+	for _, v := range pvalues {
+		resolved.Redact = append(resolved.Redact, v)
+	}
+	return resolved, nil
+}
+
+// escape encodes the value for splicing into a JSON string.
+func escape(v string) string {
+	escaped, _ := marshal(v)
+	return strings.TrimSuffix(strings.TrimPrefix(escaped, `"`), `"`)
+}
+
+// Values returns the values of all the secrets referenced by the
+// job's tasks, so that they may be redacted. Values are cached
+// briefly to spare the providers when the job is read repeatedly.
+func (r *Resolver) Values(ctx context.Context, j *tork.Job) (map[string]string, error) {
+	s, err := marshal(j.Tasks)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error marshalling tasks")
+	}
+	result := make(map[string]string)
+	if r.store != nil {
+		for _, name := range stored(refs(s), j.Secrets) {
+			key := j.Namespace + "/" + name
+			v, ok := r.cache.Get(key)
+			if !ok {
+				values, err := r.store.Resolve(ctx, j.Namespace, []string{name})
+				if err != nil {
+					return nil, err
+				}
+				v = values[name]
+				r.cache.Set(key, v)
+			}
+			result[key] = v
+		}
+	}
+	for _, ref := range providerRefs(s) {
+		v, ok := r.cache.Get(ref)
+		if !ok {
+			pv, err := r.get(ctx, ref)
+			if err != nil {
+				return nil, err
+			}
+			v = pv
+			r.cache.Set(ref, v)
+		}
+		result[ref] = v
+	}
+	return result, nil
+}
@@ -0,0 +1,146 @@
+package secrets_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/internal/secrets"
+	"github.com/stretchr/testify/assert"
+)
+
+type mapResolver map[string]string
+
+func (r mapResolver) Resolve(_ context.Context, namespace string, names []string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, name := range names {
+		v, ok := r[namespace+"/"+name]
+		if !ok {
+			return nil, errors.Errorf("unknown secret %s", name)
+		}
+		values[name] = v
+	}
+	return values, nil
+}
+
+func TestCipher(t *testing.T) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	assert.NoError(t, err)
+
+	parsed, err := secrets.ParseKey(base64.StdEncoding.EncodeToString(key))
+	assert.NoError(t, err)
+	assert.Equal(t, key, parsed)
+
+	c, err := secrets.NewCipher(key)
+	assert.NoError(t, err)
+
+	ct1, err := c.Seal("p@ssw0rd")
+	assert.NoError(t, err)
+	ct2, err := c.Seal("p@ssw0rd")
+	assert.NoError(t, err)
+	assert.NotEqual(t, ct1, ct2)
+	assert.NotContains(t, ct1, "p@ssw0rd")
+
+	pt, err := c.Open(ct1)
+	assert.NoError(t, err)
+	assert.Equal(t, "p@ssw0rd", pt)
+
+	other, err := secrets.NewCipher(make([]byte, 32))
+	assert.NoError(t, err)
+	_, err = other.Open(ct1)
+	assert.Error(t, err)
+
+	_, err = secrets.NewCipher([]byte("short"))
+	assert.Error(t, err)
+}
+
+func TestRefs(t *testing.T) {
+	names, err := secrets.Refs([]*tork.Task{
+		{
+			Name: "some task",
+			Env: map[string]string{
+				"DB_PASSWORD": "{{ secrets.DB_PASSWORD }}",
+				"TOKEN":       "{{secrets.token}}",
+			},
+			Run: "echo {{ secrets.DB_PASSWORD }} {{ inputs.x }}",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"DB_PASSWORD", "token"}, names)
+
+	names, err = secrets.Stored([]*tork.Task{{Env: map[string]string{
+		"A": "{{ secrets.a }}",
+		"B": "{{ secrets.b }}",
+	}}}, map[string]string{"a": "inline"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, names)
+}
+
+func TestBindAndResolve(t *testing.T) {
+	inline := map[string]string{"inline": "shh"}
+	j := &tork.Job{
+		Namespace: "team-a",
+		Secrets:   inline,
+		Context:   tork.JobContext{Secrets: inline},
+		Tasks: []*tork.Task{
+			{
+				Name: "some task",
+				Env: map[string]string{
+					"PASSWORD": "{{ secrets.password }}",
+					"INLINE":   "{{ secrets.inline }}",
+				},
+				Run: `echo "{{ secrets.password }}"`,
+			},
+		},
+	}
+	assert.NoError(t, secrets.Bind(j))
+	assert.Equal(t, "{{ secrets.password }}", j.Context.Secrets["password"])
+	// the job's inline secrets are left untouched
+	assert.Len(t, j.Secrets, 1)
+
+	ta := j.Tasks[0]
+	r := secrets.NewResolver(mapResolver{
+		"team-a/password": `pa"ss`,
+	}, nil)
+	resolved, err := r.ResolveTask(context.Background(), j, ta)
+	assert.NoError(t, err)
+	assert.Equal(t, `pa"ss`, resolved.Env["PASSWORD"])
+	assert.Equal(t, `echo "pa"ss"`, resolved.Run)
+	assert.Equal(t, []string{`pa"ss`}, resolved.Redact)
+	// inline references are resolved by the evaluation of the task
+	assert.Equal(t, "{{ secrets.inline }}", resolved.Env["INLINE"])
+	// the original task still holds the reference
+	assert.Equal(t, "{{ secrets.password }}", ta.Env["PASSWORD"])
+
+	j.Namespace = "team-b"
+	_, err = r.ResolveTask(context.Background(), j, ta)
+	assert.Error(t, err)
+}
+
+func TestResolveTaskRotatedSecret(t *testing.T) {
+	j := &tork.Job{
+		Namespace: "team-a",
+		Tasks: []*tork.Task{{
+			Name: "some task",
+			Env:  map[string]string{"PASSWORD": "{{ secrets.password }}"},
+		}},
+	}
+	assert.NoError(t, secrets.Bind(j))
+	store := mapResolver{"team-a/password": "old"}
+	r := secrets.NewResolver(store, nil)
+	values, err := r.Values(context.Background(), j)
+	assert.NoError(t, err)
+	assert.Equal(t, "old", values["team-a/password"])
+
+	// the values the worker masks are the ones it
+	// receives, regardless of those cached for reads
+	store["team-a/password"] = "new"
+	resolved, err := r.ResolveTask(context.Background(), j, j.Tasks[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "new", resolved.Env["PASSWORD"])
+	assert.Equal(t, []string{"new"}, resolved.Redact)
+}
@@ -0,0 +1,45 @@
+package secrets
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/runabol/tork/datastore"
+)
+
+// Store keeps secrets in the datastore, encrypted.
+type Store struct {
+	ds     datastore.Datastore
+	cipher *Cipher
+}
+
+func NewStore(ds datastore.Datastore, key []byte) (*Store, error) {
+	c, err := NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{ds: ds, cipher: c}, nil
+}
+
+// Seal encrypts a secret's value for storage.
+func (s *Store) Seal(value string) (string, error) {
+	return s.cipher.Seal(value)
+}
+
+// Resolve returns the decrypted values of the named secrets of
+// a namespace, failing if any of them does not exist.
+func (s *Store) Resolve(ctx context.Context, namespace string, names []string) (map[string]string, error) {
+	values := make(map[string]string, len(names))
+	for _, name := range names {
+		sec, err := s.ds.GetSecret(ctx, namespace, name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting secret %s", name)
+		}
+		v, err := s.cipher.Open(sec.Ciphertext)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error decrypting secret %s", name)
+		}
+		values[name] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// StdoutExporter writes spans as JSON, one per line.
+type StdoutExporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+type stdoutSpan struct {
+	Name          string         `json:"name"`
+	TraceID       string         `json:"traceId"`
+	SpanID        string         `json:"spanId"`
+	ParentSpanID  string         `json:"parentSpanId,omitempty"`
+	Service       string         `json:"service,omitempty"`
+	StartTime     time.Time      `json:"startTime"`
+	EndTime       time.Time      `json:"endTime"`
+	Attributes    map[string]any `json:"attributes,omitempty"`
+	Status        string         `json:"status"`
+	StatusMessage string         `json:"statusMessage,omitempty"`
+}
+
+func NewStdoutExporter(w io.Writer) *StdoutExporter {
+	return &StdoutExporter{enc: json.NewEncoder(w)}
+}
+
+func (e *StdoutExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, s := range spans {
+		out := stdoutSpan{
+			Name:          s.Name(),
+			TraceID:       s.SpanContext().TraceID().String(),
+			SpanID:        s.SpanContext().SpanID().String(),
+			StartTime:     s.StartTime(),
+			EndTime:       s.EndTime(),
+			Status:        s.Status().Code.String(),
+			StatusMessage: s.Status().Description,
+		}
+		if s.Parent().IsValid() {
+			out.ParentSpanID = s.Parent().SpanID().String()
+		}
+		if s.Resource() != nil {
+			if v, ok := s.Resource().Set().Value("service.name"); ok {
+				out.Service = v.AsString()
+			}
+		}
+		if attrs := s.Attributes(); len(attrs) > 0 {
+			out.Attributes = make(map[string]any, len(attrs))
+			for _, a := range attrs {
+				out.Attributes[string(a.Key)] = a.Value.AsInterface()
+			}
+		}
+		if err := e.enc.Encode(out); err != nil {
+			return errors.Wrapf(err, "error writing span %s", out.SpanID)
+		}
+	}
+	return nil
+}
+
+func (e *StdoutExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,145 @@
+// Package tracing follows jobs and tasks across the coordinator, the
+// broker and the workers with OpenTelemetry spans.
+package tracing
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/runabol/tork"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/maps"
+)
+
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+const instrumentationName = "github.com/runabol/tork"
+
+// the trace context travels in the headers of jobs and tasks
+var propagator = propagation.TraceContext{}
+
+type Config struct {
+	// Exporter is either otlp or stdout.
+	Exporter string
+	// Endpoint is the URL of the OTLP/HTTP endpoint, e.g.
+	// http://localhost:4318. Unless set, it follows the
+	// OTEL_EXPORTER_OTLP_ENDPOINT environment variable.
+	Endpoint string
+	// ServiceName names the process in its traces,
+	// e.g. tork-coordinator.
+	ServiceName string
+	// SampleRatio is the share of traces which are sampled,
+	// between 0 and 1.
+	SampleRatio float64
+}
+
+// Setup installs the tracer provider which exports spans as configured
+// and returns the function which flushes and stops it.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	var exp sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case ExporterOTLP, "":
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		}
+		e, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error creating the OTLP exporter")
+		}
+		exp = e
+	case ExporterStdout:
+		exp = NewStdoutExporter(os.Stdout)
+	default:
+		return nil, errors.Errorf("unknown tracing exporter: %s", cfg.Exporter)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+		semconv.ServiceVersion(tork.Version),
+	))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating the tracing resource")
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagator)
+	return tp.Shutdown, nil
+}
+
+// Start starts a span. Until Setup is called, spans are not recorded.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// StartTask starts a span about the task,
+// continuing the trace its headers carry.
+func StartTask(ctx context.Context, name string, t *tork.Task) (context.Context, trace.Span) {
+	return Start(Extract(ctx, t.Headers), name,
+		attribute.String("tork.task.id", t.ID),
+		attribute.String("tork.task.state", t.State),
+		attribute.String("tork.job.id", t.JobID),
+	)
+}
+
+// StartJob starts a span about the job,
+// continuing the trace its headers carry.
+func StartJob(ctx context.Context, name string, j *tork.Job) (context.Context, trace.Span) {
+	return Start(Extract(ctx, j.Headers), name,
+		attribute.String("tork.job.id", j.ID),
+		attribute.String("tork.job.state", j.State),
+	)
+}
+
+// RecordError records the error on the span and marks it as failed.
+func RecordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// End records the error, if any, and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		RecordError(span, err)
+	}
+	span.End()
+}
+
+// Inject returns a copy of the headers carrying the trace context of
+// ctx. Lacking a trace context, the headers are returned as they are.
+func Inject(ctx context.Context, headers map[string]string) map[string]string {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return headers
+	}
+	carrier := propagation.MapCarrier(maps.Clone(headers))
+	if carrier == nil {
+		carrier = make(propagation.MapCarrier)
+	}
+	propagator.Inject(ctx, carrier)
+	return carrier
+}
+
+// Extract returns a copy of ctx with the trace
+// context the headers carry, if any.
+func Extract(ctx context.Context, headers map[string]string) context.Context {
+	if len(headers) == 0 {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.MapCarrier(headers))
+}
@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/runabol/tork"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestInjectExtract(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	ctx, span := tp.Tracer("test").Start(context.Background(), "parent")
+	defer span.End()
+
+	headers := map[string]string{"some": "header"}
+	injected := Inject(ctx, headers)
+	assert.Contains(t, injected, "traceparent")
+	assert.Equal(t, "header", injected["some"])
+	assert.NotContains(t, headers, "traceparent")
+
+	sc := trace.SpanContextFromContext(Extract(context.Background(), injected))
+	assert.True(t, sc.IsRemote())
+	assert.Equal(t, span.SpanContext().TraceID(), sc.TraceID())
+	assert.Equal(t, span.SpanContext().SpanID(), sc.SpanID())
+}
+
+func TestInjectWithoutSpan(t *testing.T) {
+	headers := map[string]string{"some": "header"}
+	assert.Equal(t, headers, Inject(context.Background(), headers))
+	assert.Nil(t, Inject(context.Background(), nil))
+}
+
+func TestExtractWithoutHeaders(t *testing.T) {
+	ctx := Extract(context.Background(), nil)
+	assert.False(t, trace.SpanContextFromContext(ctx).IsValid())
+}
+
+func TestStartTask(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	ctx, parent := Start(context.Background(), "parent")
+	parent.End()
+
+	tk := &tork.Task{
+		ID:      "1234",
+		JobID:   "5678",
+		State:   tork.TaskStatePending,
+		Headers: Inject(ctx, nil),
+	}
+	_, span := StartTask(context.Background(), "child", tk)
+	span.End()
+
+	ended := sr.Ended()
+	assert.Len(t, ended, 2)
+	assert.Equal(t, parent.SpanContext().TraceID(), ended[1].SpanContext().TraceID())
+	assert.Equal(t, parent.SpanContext().SpanID(), ended[1].Parent().SpanID())
+	assert.Contains(t, ended[1].Attributes(), attribute.String("tork.task.id", "1234"))
+	assert.Contains(t, ended[1].Attributes(), attribute.String("tork.job.id", "5678"))
+}
+
+func TestStdoutExporter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(NewStdoutExporter(buf)))
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	_, child := tp.Tracer("test").Start(ctx, "child")
+	RecordError(child, assert.AnError)
+	child.End()
+	parent.End()
+
+	dec := json.NewDecoder(buf)
+	var spans []stdoutSpan
+	for dec.More() {
+		s := stdoutSpan{}
+		assert.NoError(t, dec.Decode(&s))
+		spans = append(spans, s)
+	}
+	assert.Len(t, spans, 2)
+	assert.Equal(t, "child", spans[0].Name)
+	assert.Equal(t, "Error", spans[0].Status)
+	assert.Equal(t, spans[1].SpanID, spans[0].ParentSpanID)
+	assert.Equal(t, spans[1].TraceID, spans[0].TraceID)
+	assert.Equal(t, "parent", spans[1].Name)
+	assert.Empty(t, spans[1].ParentSpanID)
+}
+
+func TestEnd(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+
+	_, span := tp.Tracer("test").Start(context.Background(), "ok")
+	End(span, nil)
+	_, span = tp.Tracer("test").Start(context.Background(), "failed")
+	End(span, assert.AnError)
+
+	ended := sr.Ended()
+	assert.Len(t, ended, 2)
+	assert.Equal(t, "Unset", ended[0].Status().Code.String())
+	assert.Equal(t, "Error", ended[1].Status().Code.String())
+	assert.Equal(t, assert.AnError.Error(), ended[1].Status().Description)
+}
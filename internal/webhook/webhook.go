@@ -10,6 +10,7 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/runabol/tork"
 	"github.com/runabol/tork/internal/fns"
+	"github.com/runabol/tork/internal/metrics"
 )
 
 const (
@@ -38,6 +39,14 @@ func isRetryable(statusCode int) bool {
 }
 
 func Call(wh *tork.Webhook, body any) error {
+	if err := call(wh, body); err != nil {
+		metrics.WebhookFailures.WithLabelValues(wh.Event).Inc()
+		return err
+	}
+	return nil
+}
+
+func call(wh *tork.Webhook, body any) error {
 	b, err := json.Marshal(body)
 	if err != nil {
 		return errors.Wrapf(err, "[Webhook] error serializing body")
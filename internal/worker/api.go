@@ -9,10 +9,12 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog/log"
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/health"
 	"github.com/runabol/tork/internal/httpx"
+	"github.com/runabol/tork/internal/metrics"
 	"github.com/runabol/tork/internal/syncx"
 	"github.com/runabol/tork/runtime"
 )
@@ -42,6 +44,7 @@ func newAPI(cfg Config, tasks *syncx.Map[string, runningTask]) *api {
 		},
 	}
 	r.GET("/health", s.health)
+	r.GET("/metrics/prometheus", s.prometheusMetrics)
 	return s
 }
 
@@ -57,6 +60,11 @@ func (s *api) health(c echo.Context) error {
 	}
 }
 
+func (s *api) prometheusMetrics(c echo.Context) error {
+	promhttp.HandlerFor(metrics.Default, promhttp.HandlerOpts{}).ServeHTTP(c.Response(), c.Request())
+	return nil
+}
+
 func (s *api) start() error {
 	if s.server.Addr != "" {
 		if err := httpx.StartAsync(s.server); err != nil {
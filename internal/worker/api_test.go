@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/runabol/tork/broker"
+	"github.com/runabol/tork/internal/metrics"
 	"github.com/runabol/tork/internal/syncx"
 	"github.com/runabol/tork/runtime/docker"
 	"github.com/stretchr/testify/assert"
@@ -30,3 +31,19 @@ func Test_health(t *testing.T) {
 	assert.Contains(t, string(body), "\"status\":\"UP\"")
 	assert.Equal(t, http.StatusOK, w.Code)
 }
+
+func Test_prometheusMetrics(t *testing.T) {
+	api := newAPI(Config{
+		Broker: broker.NewInMemoryBroker(),
+	}, &syncx.Map[string, runningTask]{})
+	// series are only exposed once they have been touched
+	metrics.WorkerTasksRunning.WithLabelValues("some-queue").Add(0)
+	req, err := http.NewRequest("GET", "/metrics/prometheus", nil)
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	api.server.Handler.ServeHTTP(w, req)
+	body, err := io.ReadAll(w.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, string(body), "# TYPE tork_worker_tasks_running gauge")
+}
@@ -18,27 +18,45 @@ import (
 
 	"github.com/runabol/tork/internal/fns"
 	"github.com/runabol/tork/internal/host"
+	"github.com/runabol/tork/internal/metrics"
 	"github.com/runabol/tork/internal/syncx"
+	"github.com/runabol/tork/internal/tracing"
 	"github.com/runabol/tork/runtime"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/runabol/tork/internal/uuid"
 )
 
+const (
+	DefaultDrainTimeout = time.Minute
+)
+
 type Worker struct {
-	id         string
-	name       string
-	startTime  time.Time
-	runtime    runtime.Runtime
-	broker     broker.Broker
-	stop       chan any
-	queues     map[string]int
-	tasks      *syncx.Map[string, runningTask]
-	limits     Limits
-	api        *api
-	taskCount  int32
-	middleware []task.MiddlewareFunc
-	usedPorts  map[string]struct{}
-	mu         sync.Mutex
+	id           string
+	name         string
+	startTime    time.Time
+	runtime      runtime.Runtime
+	broker       broker.Broker
+	stop         chan any
+	queues       map[string]int
+	tasks        *syncx.Map[string, runningTask]
+	paused       *syncx.Map[string, bool]
+	limits       Limits
+	api          *api
+	taskCount    int32
+	inflight     int32
+	middleware   []task.MiddlewareFunc
+	usedPorts    map[string]struct{}
+	mu           sync.Mutex
+	draining     atomic.Bool
+	drained      chan any
+	drainTimeout time.Duration
+	labels       map[string]string
+	capacity     tork.NodeResources
+	allocated    tork.NodeResources
+	queued       tork.NodeResources
+	resMu        sync.Mutex
+	resCond      *sync.Cond
 }
 
 type Config struct {
@@ -49,6 +67,17 @@ type Config struct {
 	Queues     map[string]int
 	Limits     Limits
 	Middleware []task.MiddlewareFunc
+	// DrainTimeout is the maximum amount of time to wait
+	// for in-flight tasks to complete when draining the
+	// worker. Default: 1 minute
+	DrainTimeout time.Duration
+	// Labels are advertised in the worker's heartbeats
+	// and are matched against the tasks' node selectors.
+	Labels map[string]string
+	// Capacity is the amount of resources that the worker
+	// makes available to tasks placed on it. Any resource
+	// left unspecified is detected from the host.
+	Capacity tork.NodeResources
 }
 
 type Limits struct {
@@ -72,21 +101,36 @@ func NewWorker(cfg Config) (*Worker, error) {
 	if cfg.Runtime == nil {
 		return nil, errors.New("must provide runtime")
 	}
+	if cfg.DrainTimeout == 0 {
+		cfg.DrainTimeout = DefaultDrainTimeout
+	}
+	if cfg.Capacity.CPUs == 0 {
+		cfg.Capacity.CPUs = float64(host.GetCPUCount())
+	}
+	if cfg.Capacity.Memory == 0 {
+		cfg.Capacity.Memory = host.GetMemoryTotal()
+	}
 	tasks := new(syncx.Map[string, runningTask])
 	w := &Worker{
-		id:         uuid.NewShortUUID(),
-		name:       cfg.Name,
-		startTime:  time.Now().UTC(),
-		broker:     cfg.Broker,
-		runtime:    cfg.Runtime,
-		queues:     cfg.Queues,
-		tasks:      tasks,
-		limits:     cfg.Limits,
-		api:        newAPI(cfg, tasks),
-		stop:       make(chan any),
-		middleware: cfg.Middleware,
-		usedPorts:  make(map[string]struct{}),
+		id:           uuid.NewShortUUID(),
+		name:         cfg.Name,
+		startTime:    time.Now().UTC(),
+		broker:       cfg.Broker,
+		runtime:      cfg.Runtime,
+		queues:       cfg.Queues,
+		tasks:        tasks,
+		paused:       new(syncx.Map[string, bool]),
+		limits:       cfg.Limits,
+		api:          newAPI(cfg, tasks),
+		stop:         make(chan any),
+		middleware:   cfg.Middleware,
+		usedPorts:    make(map[string]struct{}),
+		drained:      make(chan any),
+		drainTimeout: cfg.DrainTimeout,
+		labels:       cfg.Labels,
+		capacity:     cfg.Capacity,
 	}
+	w.resCond = sync.NewCond(&w.resMu)
 	return w, nil
 }
 
@@ -106,7 +150,173 @@ func (w *Worker) handleTask(t *tork.Task) error {
 	return w.doHandleTask(context.Background(), t)
 }
 
-func (w *Worker) doHandleTask(ctx context.Context, t *tork.Task) error {
+// handleExclusiveTask handles the messages sent to the worker's own
+// queue: cancellation requests, and tasks that the scheduler placed
+// on this worker based on their node selector or resource requests.
+func (w *Worker) handleExclusiveTask(t *tork.Task) error {
+	if t.State == tork.TaskStateCancelled {
+		return w.cancelTask(t)
+	}
+	// placed tasks may have to wait for resources to free up
+	// so we don't want to hold up any subsequent cancellations
+	atomic.AddInt32(&w.inflight, 1)
+	go func() {
+		defer atomic.AddInt32(&w.inflight, -1)
+		if err := w.handlePlacedTask(t); err != nil {
+			log.Error().Err(err).Msgf("error handling task %s", t.ID)
+		}
+	}()
+	return nil
+}
+
+func (w *Worker) handlePlacedTask(t *tork.Task) error {
+	ctx := context.Background()
+	var req tork.NodeResources
+	if t.Resources != nil {
+		r, err := t.Resources.Parse()
+		if err != nil {
+			now := time.Now().UTC()
+			t.Error = err.Error()
+			t.FailedAt = &now
+			t.State = tork.TaskStateFailed
+			return w.broker.PublishTask(ctx, broker.QUEUE_ERROR, t)
+		}
+		req = r
+	}
+	if !w.reserve(req) {
+		// the worker started draining before the task had
+		// a chance to start so let the coordinator place it
+		// on another node
+		log.Debug().Msgf("worker %s is draining. returning task %s for rescheduling", w.id, t.ID)
+		return w.broker.PublishTask(ctx, broker.QUEUE_PENDING, t)
+	}
+	defer w.release(req)
+	return w.handleTask(t)
+}
+
+// reserve blocks until the requested resources are available on the
+// worker and allocates them. It returns false if the worker started
+// draining in the meantime.
+func (w *Worker) reserve(req tork.NodeResources) bool {
+	w.resMu.Lock()
+	defer w.resMu.Unlock()
+	// requests waiting for resources are reported as allocated
+	// in heartbeats so that the scheduler favors other nodes
+	w.queued = w.queued.Add(req)
+	defer func() {
+		w.queued = w.queued.Sub(req)
+	}()
+	for {
+		if w.draining.Load() {
+			return false
+		}
+		// a task is always allowed to run on an idle
+		// worker, even if it requests more than its capacity
+		if w.allocated == (tork.NodeResources{}) || w.capacity.Sub(w.allocated).Fits(req) {
+			w.allocated = w.allocated.Add(req)
+			return true
+		}
+		w.resCond.Wait()
+	}
+}
+
+func (w *Worker) release(req tork.NodeResources) {
+	w.resMu.Lock()
+	w.allocated = w.allocated.Sub(req)
+	w.resMu.Unlock()
+	w.resCond.Broadcast()
+}
+
+// queueHandler returns a task handler for the given queue which
+// hands back any task it receives while the queue is paused or
+// while the worker is draining. Either way its consumers are
+// cancelled, so those are only the tasks already on their way.
+func (w *Worker) queueHandler(qname string) func(t *tork.Task) error {
+	return func(t *tork.Task) error {
+		if paused, _ := w.paused.Get(qname); paused {
+			log.Debug().Msgf("queue %s is paused. returning task %s to the queue", qname, t.ID)
+			return w.broker.PublishTask(context.Background(), qname, t)
+		}
+		if w.draining.Load() {
+			log.Debug().Msgf("worker %s is draining. returning task %s to the queue", w.id, t.ID)
+			return w.broker.PublishTask(context.Background(), qname, t)
+		}
+		atomic.AddInt32(&w.inflight, 1)
+		defer atomic.AddInt32(&w.inflight, -1)
+		return w.handleTask(t)
+	}
+}
+
+func (w *Worker) handleNodeEvent(ev any) {
+	n, ok := ev.(*tork.Node)
+	if !ok {
+		log.Error().Msgf("expecting a *tork.Node but got %T", ev)
+		return
+	}
+	if n.ID != w.id {
+		return
+	}
+	go func() {
+		if err := w.Drain(); err != nil {
+			log.Error().Err(err).Msgf("error draining worker %s", w.id)
+		}
+	}()
+}
+
+func (w *Worker) handleQueueEvent(ev any) {
+	qi, ok := ev.(*broker.QueueInfo)
+	if !ok {
+		log.Error().Msgf("expecting a *broker.QueueInfo but got %T", ev)
+		return
+	}
+	concurrency, ok := w.queues[qi.Name]
+	if !ok {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	paused, _ := w.paused.Get(qi.Name)
+	if qi.Paused {
+		if paused {
+			return
+		}
+		log.Info().Msgf("queue %s paused. draining in-flight tasks", qi.Name)
+		w.paused.Set(qi.Name, true)
+		// stop consuming rather than handing
+		// the tasks back to the queue
+		if err := w.broker.UnsubscribeForTasks(qi.Name); err != nil {
+			log.Error().Err(err).Msgf("error unsubscribing from queue %s", qi.Name)
+		}
+		return
+	}
+	if !paused {
+		return
+	}
+	log.Info().Msgf("queue %s resumed", qi.Name)
+	w.paused.Delete(qi.Name)
+	if w.draining.Load() {
+		return
+	}
+	if err := w.subscribe(qi.Name, concurrency); err != nil {
+		log.Error().Err(err).Msgf("error re-subscribing to queue %s", qi.Name)
+	}
+}
+
+// subscribe creates the consumers of the shared queue.
+func (w *Worker) subscribe(qname string, concurrency int) error {
+	for i := 0; i < concurrency; i++ {
+		if err := w.broker.SubscribeForTasks(qname, w.queueHandler(qname)); err != nil {
+			return errors.Wrapf(err, "error subscribing for queue: %s", qname)
+		}
+	}
+	return nil
+}
+
+func (w *Worker) doHandleTask(ctx context.Context, t *tork.Task) (err error) {
+	ctx, span := tracing.StartTask(ctx, "worker.execute", t)
+	defer func() {
+		tracing.End(span, err)
+	}()
 	started := time.Now().UTC()
 	t.StartedAt = &started
 	t.NodeID = w.id
@@ -125,12 +335,15 @@ func (w *Worker) doHandleTask(ctx context.Context, t *tork.Task) error {
 		t.Timeout = w.limits.DefaultTimeout
 	}
 	adapter := func(ctx context.Context, et task.EventType, t *tork.Task) error {
-		return w.runTask(t)
+		return w.runTask(ctx, t)
 	}
 	// clone the task so that the downstream
 	// process can mutate the task without
 	// affecting the original
 	rt := t.Clone()
+	// the values to redact from the task's log are
+	// not reported back to the coordinator
+	t.Redact = nil
 	mw := task.ApplyMiddleware(adapter, w.middleware)
 	if err := mw(ctx, task.StateChange, rt); err != nil {
 		now := time.Now().UTC()
@@ -143,6 +356,7 @@ func (w *Worker) doHandleTask(ctx context.Context, t *tork.Task) error {
 	case tork.TaskStateCompleted:
 		t.Result = rt.Result
 		t.CompletedAt = rt.CompletedAt
+		t.Usage = rt.Usage
 		t.State = rt.State
 		if err := w.broker.PublishTask(ctx, broker.QUEUE_COMPLETED, t); err != nil {
 			return err
@@ -150,6 +364,7 @@ func (w *Worker) doHandleTask(ctx context.Context, t *tork.Task) error {
 	case tork.TaskStateFailed:
 		t.Error = rt.Error
 		t.FailedAt = rt.FailedAt
+		t.Usage = rt.Usage
 		t.State = rt.State
 		if err := w.broker.PublishTask(ctx, broker.QUEUE_ERROR, t); err != nil {
 			return err
@@ -160,15 +375,17 @@ func (w *Worker) doHandleTask(ctx context.Context, t *tork.Task) error {
 	return nil
 }
 
-func (w *Worker) runTask(t *tork.Task) error {
+func (w *Worker) runTask(ctx context.Context, t *tork.Task) error {
 	atomic.AddInt32(&w.taskCount, 1)
+	metrics.WorkerTasksRunning.WithLabelValues(t.Queue).Inc()
 	defer func() {
 		atomic.AddInt32(&w.taskCount, -1)
+		metrics.WorkerTasksRunning.WithLabelValues(t.Queue).Dec()
 	}()
 	// create a cancellation context in case
 	// the coordinator wants to cancel the
-	// task later on
-	ctx, cancel := context.WithCancel(context.Background())
+	// task later on, keeping only the span
+	ctx, cancel := context.WithCancel(trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx)))
 	defer cancel()
 	w.tasks.Set(t.ID, runningTask{
 		cancel: cancel,
@@ -182,6 +399,7 @@ func (w *Worker) runTask(t *tork.Task) error {
 	if err := w.doRunTask(ctx, t); err != nil {
 		return err
 	}
+	metrics.WorkerTasksTotal.WithLabelValues(t.Queue, string(t.State)).Inc()
 	return nil
 }
 
@@ -211,41 +429,70 @@ func (w *Worker) doRunTask(ctx context.Context, t *tork.Task) error {
 	return nil
 }
 
+func (w *Worker) sendHeartbeat() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	status := tork.NodeStatusUP
+	if w.draining.Load() {
+		status = tork.NodeStatusDraining
+	}
+	if err := w.runtime.HealthCheck(ctx); err != nil {
+		log.Error().Err(err).Msgf("node %s failed health check", w.id)
+		status = tork.NodeStatusDown
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to get hostname for worker %s", w.id)
+	}
+	cpuPercent := host.GetCPUPercent()
+	var rt *tork.NodeRuntime
+	if d, ok := w.runtime.(runtime.Describer); ok {
+		if rt, err = d.Describe(ctx); err != nil {
+			log.Error().Err(err).Msgf("failed to describe the runtime of worker %s", w.id)
+		}
+	}
+	workdir := os.TempDir()
+	if rt != nil && rt.WorkDir != "" {
+		workdir = rt.WorkDir
+	}
+	w.resMu.Lock()
+	allocated := w.allocated.Add(w.queued)
+	w.resMu.Unlock()
+	capacity := w.capacity
+	err = w.broker.PublishHeartbeat(
+		context.Background(),
+		&tork.Node{
+			ID:              w.id,
+			Name:            w.name,
+			StartedAt:       w.startTime,
+			CPUPercent:      cpuPercent,
+			Queue:           fmt.Sprintf("%s%s", broker.QUEUE_EXCLUSIVE_PREFIX, w.id),
+			Status:          status,
+			LastHeartbeatAt: time.Now().UTC(),
+			Hostname:        hostname,
+			Port:            w.api.port,
+			TaskCount:       int(atomic.LoadInt32(&w.taskCount)),
+			Version:         tork.Version,
+			Labels:          w.labels,
+			Capacity:        &capacity,
+			Allocated:       &allocated,
+			MemoryUsed:      host.GetMemoryUsed(),
+			MemoryTotal:     host.GetMemoryTotal(),
+			DiskFree:        host.GetDiskFree(workdir),
+			LoadAverage:     host.GetLoadAverage(),
+			Runtime:         rt,
+		},
+	)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msgf("error publishing heartbeat for %s", w.id)
+	}
+}
+
 func (w *Worker) sendHeartbeats() {
 	for {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-		defer cancel()
-		status := tork.NodeStatusUP
-		if err := w.runtime.HealthCheck(ctx); err != nil {
-			log.Error().Err(err).Msgf("node %s failed health check", w.id)
-			status = tork.NodeStatusDown
-		}
-		hostname, err := os.Hostname()
-		if err != nil {
-			log.Error().Err(err).Msgf("failed to get hostname for worker %s", w.id)
-		}
-		cpuPercent := host.GetCPUPercent()
-		err = w.broker.PublishHeartbeat(
-			context.Background(),
-			&tork.Node{
-				ID:              w.id,
-				Name:            w.name,
-				StartedAt:       w.startTime,
-				CPUPercent:      cpuPercent,
-				Queue:           fmt.Sprintf("%s%s", broker.QUEUE_EXCLUSIVE_PREFIX, w.id),
-				Status:          status,
-				LastHeartbeatAt: time.Now().UTC(),
-				Hostname:        hostname,
-				Port:            w.api.port,
-				TaskCount:       int(atomic.LoadInt32(&w.taskCount)),
-				Version:         tork.Version,
-			},
-		)
-		if err != nil {
-			log.Error().
-				Err(err).
-				Msgf("error publishing heartbeat for %s", w.id)
-		}
+		w.sendHeartbeat()
 		select {
 		case <-w.stop:
 			return
@@ -260,25 +507,78 @@ func (w *Worker) Start() error {
 		return err
 	}
 	// subscribe for a private queue for the node
-	if err := w.broker.SubscribeForTasks(fmt.Sprintf("%s%s", broker.QUEUE_EXCLUSIVE_PREFIX, w.id), w.cancelTask); err != nil {
+	if err := w.broker.SubscribeForTasks(fmt.Sprintf("%s%s", broker.QUEUE_EXCLUSIVE_PREFIX, w.id), w.handleExclusiveTask); err != nil {
 		return errors.Wrapf(err, "error subscribing for queue: %s", w.id)
 	}
+	// listen for queues being paused/resumed
+	if err := w.broker.SubscribeForEvents(context.Background(), broker.TOPIC_QUEUE, w.handleQueueEvent); err != nil {
+		return errors.Wrapf(err, "error subscribing for queue events")
+	}
+	// listen for drain requests
+	if err := w.broker.SubscribeForEvents(context.Background(), broker.TOPIC_NODE_DRAIN, w.handleNodeEvent); err != nil {
+		return errors.Wrapf(err, "error subscribing for node events")
+	}
 	// subscribe to shared work queues
 	for qname, concurrency := range w.queues {
 		if !broker.IsWorkerQueue(qname) {
 			continue
 		}
-		for i := 0; i < concurrency; i++ {
-			err := w.broker.SubscribeForTasks(qname, w.handleTask)
-			if err != nil {
-				return errors.Wrapf(err, "error subscribing for queue: %s", qname)
-			}
+		if err := w.subscribe(qname, concurrency); err != nil {
+			return err
 		}
 	}
 	go w.sendHeartbeats()
 	return nil
 }
 
+// Drain stops the worker from picking up new tasks from its shared
+// queues and waits for in-flight tasks to complete, or for the drain
+// timeout to expire, whichever comes first. Once drained, the channel
+// returned by Drained is closed.
+func (w *Worker) Drain() error {
+	if !w.draining.CompareAndSwap(false, true) {
+		<-w.drained
+		return nil
+	}
+	defer close(w.drained)
+	log.Info().Msgf("draining worker %s", w.id)
+	// wake up any placed tasks waiting for
+	// resources so they can be rescheduled
+	w.resMu.Lock()
+	w.resCond.Broadcast()
+	w.resMu.Unlock()
+	for qname := range w.queues {
+		if !broker.IsWorkerQueue(qname) {
+			continue
+		}
+		if err := w.broker.UnsubscribeForTasks(qname); err != nil {
+			return errors.Wrapf(err, "error unsubscribing from queue: %s", qname)
+		}
+	}
+	// let the coordinator know right away
+	// rather than on the next heartbeat
+	w.sendHeartbeat()
+	timeout := time.After(w.drainTimeout)
+	ticker := time.NewTicker(time.Millisecond * 100)
+	defer ticker.Stop()
+	for atomic.LoadInt32(&w.inflight) > 0 {
+		select {
+		case <-timeout:
+			log.Warn().Msgf("worker %s drain timeout exceeded with %d task(s) in-flight", w.id, atomic.LoadInt32(&w.inflight))
+			return nil
+		case <-ticker.C:
+		}
+	}
+	log.Info().Msgf("worker %s drained", w.id)
+	return nil
+}
+
+// Drained returns a channel which is closed once the worker
+// finished draining.
+func (w *Worker) Drained() <-chan any {
+	return w.drained
+}
+
 func (w *Worker) Stop() error {
 	log.Debug().Msgf("shutting down worker %s", w.id)
 	w.stop <- 1
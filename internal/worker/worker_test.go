@@ -2,6 +2,7 @@ package worker
 
 import (
 	"context"
+	"fmt"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -565,3 +566,239 @@ func Test_reservePort(t *testing.T) {
 	w.releasePort(port)
 	assert.NotContains(t, w.usedPorts, port)
 }
+
+func Test_drain(t *testing.T) {
+	rt, err := docker.NewDockerRuntime()
+	assert.NoError(t, err)
+
+	b := broker.NewInMemoryBroker()
+
+	w, err := NewWorker(Config{
+		Broker:  b,
+		Runtime: rt,
+	})
+	assert.NoError(t, err)
+
+	draining := make(chan any)
+	err = b.SubscribeForHeartbeats(func(n *tork.Node) error {
+		if n.Status == tork.NodeStatusDraining {
+			close(draining)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	starts := make(chan any, 2)
+	err = b.SubscribeForTasks(broker.QUEUE_STARTED, func(tk *tork.Task) error {
+		starts <- 1
+		return nil
+	})
+	assert.NoError(t, err)
+
+	completions := make(chan any, 2)
+	err = b.SubscribeForTasks(broker.QUEUE_COMPLETED, func(tk *tork.Task) error {
+		completions <- 1
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = w.Start()
+	assert.NoError(t, err)
+
+	err = b.PublishTask(context.Background(), broker.QUEUE_DEFAULT, &tork.Task{
+		ID:    uuid.NewUUID(),
+		State: tork.TaskStateScheduled,
+		Image: "ubuntu:mantic",
+		CMD:   []string{"sleep", "1"},
+	})
+	assert.NoError(t, err)
+
+	<-starts
+
+	// the in-flight task should complete before drain returns
+	assert.NoError(t, w.Drain())
+	select {
+	case <-completions:
+	case <-time.After(time.Second):
+		t.Fatal("in-flight task did not complete")
+	}
+	<-draining
+	<-w.Drained()
+
+	// no new tasks should be picked up
+	err = b.PublishTask(context.Background(), broker.QUEUE_DEFAULT, &tork.Task{
+		ID:    uuid.NewUUID(),
+		State: tork.TaskStateScheduled,
+		Image: "ubuntu:mantic",
+		CMD:   []string{"ls"},
+	})
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond * 500)
+	assert.Len(t, starts, 0)
+
+	assert.NoError(t, w.Stop())
+}
+
+func Test_drainEvent(t *testing.T) {
+	rt, err := docker.NewDockerRuntime()
+	assert.NoError(t, err)
+
+	b := broker.NewInMemoryBroker()
+
+	w, err := NewWorker(Config{
+		Broker:  b,
+		Runtime: rt,
+	})
+	assert.NoError(t, err)
+
+	err = w.Start()
+	assert.NoError(t, err)
+
+	// drain requests for other nodes should be ignored
+	err = b.PublishEvent(context.Background(), broker.TOPIC_NODE_DRAIN, &tork.Node{ID: uuid.NewShortUUID()})
+	assert.NoError(t, err)
+	err = b.PublishEvent(context.Background(), broker.TOPIC_NODE_DRAIN, &tork.Node{ID: w.id})
+	assert.NoError(t, err)
+
+	select {
+	case <-w.Drained():
+	case <-time.After(time.Second * 5):
+		t.Fatal("worker was not drained")
+	}
+	assert.NoError(t, w.Stop())
+}
+
+func Test_pauseQueue(t *testing.T) {
+	rt, err := docker.NewDockerRuntime()
+	assert.NoError(t, err)
+
+	b := broker.NewInMemoryBroker()
+	qname := fmt.Sprintf("test-%s", uuid.NewUUID())
+
+	w, err := NewWorker(Config{
+		Broker:  b,
+		Runtime: rt,
+		Queues:  map[string]int{qname: 2},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, w.Start())
+
+	subscribers := func() int {
+		qis, err := b.Queues(context.Background())
+		assert.NoError(t, err)
+		for _, qi := range qis {
+			if qi.Name == qname {
+				return qi.Subscribers
+			}
+		}
+		return 0
+	}
+	assert.Equal(t, 2, subscribers())
+
+	// the consumers are cancelled while the queue is paused
+	assert.NoError(t, b.PauseQueue(context.Background(), qname))
+	assert.Eventually(t, func() bool { return subscribers() == 0 }, time.Second, time.Millisecond*10)
+
+	// pausing twice doesn't change anything
+	assert.NoError(t, b.PauseQueue(context.Background(), qname))
+
+	assert.NoError(t, b.ResumeQueue(context.Background(), qname))
+	assert.Eventually(t, func() bool { return subscribers() == 2 }, time.Second, time.Millisecond*10)
+
+	// resuming twice doesn't subscribe twice
+	assert.NoError(t, b.ResumeQueue(context.Background(), qname))
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, 2, subscribers())
+
+	assert.NoError(t, w.Stop())
+}
+
+func Test_reserve(t *testing.T) {
+	rt, err := docker.NewDockerRuntime()
+	assert.NoError(t, err)
+
+	w, err := NewWorker(Config{
+		Broker:   broker.NewInMemoryBroker(),
+		Runtime:  rt,
+		Capacity: tork.NodeResources{CPUs: 2, Memory: 1024},
+	})
+	assert.NoError(t, err)
+
+	assert.True(t, w.reserve(tork.NodeResources{CPUs: 1.5}))
+
+	reserved := make(chan bool)
+	go func() {
+		reserved <- w.reserve(tork.NodeResources{CPUs: 1})
+	}()
+
+	select {
+	case <-reserved:
+		t.Fatal("should wait for resources to free up")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	w.release(tork.NodeResources{CPUs: 1.5})
+	assert.True(t, <-reserved)
+
+	go func() {
+		reserved <- w.reserve(tork.NodeResources{CPUs: 2})
+	}()
+
+	select {
+	case <-reserved:
+		t.Fatal("should wait for resources to free up")
+	case <-time.After(time.Millisecond * 100):
+	}
+
+	// draining should release any waiting reservations
+	assert.NoError(t, w.Drain())
+	assert.False(t, <-reserved)
+}
+
+func Test_handlePlacedTask(t *testing.T) {
+	rt, err := docker.NewDockerRuntime()
+	assert.NoError(t, err)
+
+	b := broker.NewInMemoryBroker()
+
+	w, err := NewWorker(Config{
+		Broker:  b,
+		Runtime: rt,
+		Labels:  map[string]string{"region": "eu"},
+	})
+	assert.NoError(t, err)
+
+	heartbeats := make(chan *tork.Node, 10)
+	err = b.SubscribeForHeartbeats(func(n *tork.Node) error {
+		heartbeats <- n
+		return nil
+	})
+	assert.NoError(t, err)
+
+	completions := make(chan any)
+	err = b.SubscribeForTasks(broker.QUEUE_COMPLETED, func(tk *tork.Task) error {
+		close(completions)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = w.Start()
+	assert.NoError(t, err)
+
+	n := <-heartbeats
+	assert.Equal(t, map[string]string{"region": "eu"}, n.Labels)
+	assert.Greater(t, n.Capacity.CPUs, float64(0))
+
+	err = b.PublishTask(context.Background(), n.Queue, &tork.Task{
+		ID:           uuid.NewUUID(),
+		State:        tork.TaskStateScheduled,
+		Image:        "ubuntu:mantic",
+		CMD:          []string{"ls"},
+		NodeSelector: map[string]string{"region": "eu"},
+		Resources:    &tork.TaskResources{CPUs: "1"},
+	})
+	assert.NoError(t, err)
+
+	<-completions
+	assert.NoError(t, w.Stop())
+}
@@ -29,6 +29,7 @@ type Job struct {
 	ID          string            `json:"id,omitempty"`
 	ParentID    string            `json:"parentId,omitempty"`
 	Name        string            `json:"name,omitempty"`
+	Namespace   string            `json:"namespace,omitempty"`
 	Description string            `json:"description,omitempty"`
 	Tags        []string          `json:"tags,omitempty"`
 	State       JobState          `json:"state,omitempty"`
@@ -54,11 +55,18 @@ type Job struct {
 	Secrets     map[string]string `json:"secrets,omitempty"`
 	Progress    float64           `json:"progress,omitempty"`
 	Schedule    *JobSchedule      `json:"schedule,omitempty"`
+	// Usage totals the resources the tasks of the
+	// job used. It is computed, not persisted.
+	Usage *TaskUsage `json:"usage,omitempty"`
+	// Headers carry the metadata of the job as it passes through
+	// the broker, e.g. the trace context. They are not persisted.
+	Headers map[string]string `json:"headers,omitempty"`
 }
 
 type ScheduledJob struct {
 	ID          string            `json:"id,omitempty"`
 	Name        string            `json:"name,omitempty"`
+	Namespace   string            `json:"namespace,omitempty"`
 	Description string            `json:"description,omitempty"`
 	Cron        string            `json:"cron,omitempty"`
 	State       ScheduledJobState `json:"state,omitempty"`
@@ -93,6 +101,7 @@ type JobSummary struct {
 	ParentID    string            `json:"parentId,omitempty"`
 	Inputs      map[string]string `json:"inputs,omitempty"`
 	Name        string            `json:"name,omitempty"`
+	Namespace   string            `json:"namespace,omitempty"`
 	Description string            `json:"description,omitempty"`
 	Tags        []string          `json:"tags,omitempty"`
 	State       JobState          `json:"state,omitempty"`
@@ -114,6 +123,7 @@ type ScheduledJobSummary struct {
 	Inputs      map[string]string `json:"inputs,omitempty"`
 	State       ScheduledJobState `json:"state,omitempty"`
 	Name        string            `json:"name,omitempty"`
+	Namespace   string            `json:"namespace,omitempty"`
 	Description string            `json:"description,omitempty"`
 	Tags        []string          `json:"tags,omitempty"`
 	CreatedAt   time.Time         `json:"createdAt,omitempty"`
@@ -171,6 +181,7 @@ func (j *Job) Clone() *Job {
 	return &Job{
 		ID:          j.ID,
 		Name:        j.Name,
+		Namespace:   j.Namespace,
 		Description: j.Description,
 		Tags:        j.Tags,
 		State:       j.State,
@@ -196,6 +207,8 @@ func (j *Job) Clone() *Job {
 		AutoDelete:  autoDelete,
 		Progress:    j.Progress,
 		Schedule:    schedule,
+		Usage:       j.Usage.Clone(),
+		Headers:     maps.Clone(j.Headers),
 	}
 }
 
@@ -216,6 +229,7 @@ func (j *ScheduledJob) Clone() *ScheduledJob {
 		ID:          j.ID,
 		Cron:        j.Cron,
 		Name:        j.Name,
+		Namespace:   j.Namespace,
 		Description: j.Description,
 		Tags:        j.Tags,
 		CreatedAt:   j.CreatedAt,
@@ -270,6 +284,7 @@ func NewJobSummary(j *Job) *JobSummary {
 		CreatedBy:   j.CreatedBy,
 		ParentID:    j.ParentID,
 		Name:        j.Name,
+		Namespace:   j.Namespace,
 		Description: j.Description,
 		Tags:        j.Tags,
 		Inputs:      maps.Clone(j.Inputs),
@@ -292,6 +307,7 @@ func NewScheduledJobSummary(sj *ScheduledJob) *ScheduledJobSummary {
 		ID:          sj.ID,
 		CreatedBy:   sj.CreatedBy,
 		Name:        sj.Name,
+		Namespace:   sj.Namespace,
 		State:       sj.State,
 		Description: sj.Description,
 		Tags:        sj.Tags,
@@ -9,7 +9,7 @@ import (
 
 type InMemoryLocker struct {
 	mu    sync.Mutex
-	locks map[string]struct{}
+	locks map[string]*inmemLock
 }
 
 type inmemLock struct {
@@ -18,12 +18,21 @@ type inmemLock struct {
 }
 
 func (l *inmemLock) ReleaseLock(_ context.Context) error {
-	return l.locker.releaseLock(l.key)
+	return l.locker.releaseLock(l)
+}
+
+func (l *inmemLock) RenewLock(_ context.Context) error {
+	l.locker.mu.Lock()
+	defer l.locker.mu.Unlock()
+	if l.locker.locks[l.key] != l {
+		return errors.Errorf("lock for key '%s' is no longer held", l.key)
+	}
+	return nil
 }
 
 func NewInMemoryLocker() *InMemoryLocker {
 	return &InMemoryLocker{
-		locks: make(map[string]struct{}),
+		locks: make(map[string]*inmemLock),
 	}
 }
 
@@ -33,16 +42,19 @@ func (m *InMemoryLocker) AcquireLock(ctx context.Context, key string) (Lock, err
 	if _, exists := m.locks[key]; exists {
 		return nil, errors.Errorf("failed to acquire lock for key '%s'", key)
 	}
-	m.locks[key] = struct{}{}
-	return &inmemLock{key: key, locker: m}, nil
+	l := &inmemLock{key: key, locker: m}
+	m.locks[key] = l
+	return l, nil
 }
 
-func (m *InMemoryLocker) releaseLock(key string) error {
+func (m *InMemoryLocker) releaseLock(l *inmemLock) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	if _, exists := m.locks[key]; !exists {
-		return errors.Errorf("failed to release lock for key '%s'", key)
+	// a lock which was taken over by someone
+	// else must not release the new holder's lock
+	if m.locks[l.key] != l {
+		return errors.Errorf("failed to release lock for key '%s'", l.key)
 	}
-	delete(m.locks, key)
+	delete(m.locks, l.key)
 	return nil
 }
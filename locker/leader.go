@@ -0,0 +1,171 @@
+package locker
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DefaultLeaderKey           = "tork.leader"
+	DefaultLeaseRenewInterval  = 5 * time.Second
+	minimumLeaseRenewInterval  = 100 * time.Millisecond
+	leaderElectionCallDeadline = 10 * time.Second
+)
+
+// Elector reports whether the current process is
+// the leader and should run the cluster-wide duties.
+type Elector interface {
+	IsLeader() bool
+}
+
+// LeaderElector elects a single leader amongst the processes
+// sharing the same Locker. The leader holds the lock on the
+// leader key for as long as it keeps renewing its lease. When
+// the leader goes away its lock is released and one of the
+// other candidates takes over on its next attempt.
+type LeaderElector struct {
+	locker    Locker
+	key       string
+	interval  time.Duration
+	lock      Lock
+	leader    atomic.Bool
+	mu        sync.Mutex
+	listeners []func(leader bool)
+	started   atomic.Bool
+	stopOnce  sync.Once
+	stop      chan any
+	stopped   chan any
+}
+
+type ElectorOption = func(e *LeaderElector)
+
+// WithLeaderKey sets the key of the lock contended for
+// by the leadership candidates.
+func WithLeaderKey(key string) ElectorOption {
+	return func(e *LeaderElector) {
+		e.key = key
+	}
+}
+
+// WithLeaseRenewInterval sets how often the leader renews its
+// lease and how often the other candidates try to take over.
+func WithLeaseRenewInterval(d time.Duration) ElectorOption {
+	return func(e *LeaderElector) {
+		e.interval = d
+	}
+}
+
+func NewLeaderElector(l Locker, opts ...ElectorOption) *LeaderElector {
+	e := &LeaderElector{
+		locker:   l,
+		key:      DefaultLeaderKey,
+		interval: DefaultLeaseRenewInterval,
+		stop:     make(chan any),
+		stopped:  make(chan any),
+	}
+	for _, o := range opts {
+		o(e)
+	}
+	if e.interval < minimumLeaseRenewInterval {
+		e.interval = minimumLeaseRenewInterval
+	}
+	return e
+}
+
+// IsLeader returns true if the current process
+// holds the leadership.
+func (e *LeaderElector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// OnChange registers a listener which is called
+// every time the leadership of the current process
+// is acquired or lost.
+func (e *LeaderElector) OnChange(fn func(leader bool)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.listeners = append(e.listeners, fn)
+}
+
+func (e *LeaderElector) Start() {
+	if !e.started.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		for {
+			e.campaign()
+			select {
+			case <-e.stop:
+				e.resign()
+				close(e.stopped)
+				return
+			case <-time.After(e.interval):
+			}
+		}
+	}()
+}
+
+// Stop gives up the leadership, if held, so that
+// another candidate can take over without waiting
+// for the lease to lapse.
+func (e *LeaderElector) Stop() {
+	if !e.started.Load() {
+		return
+	}
+	e.stopOnce.Do(func() { close(e.stop) })
+	<-e.stopped
+}
+
+func (e *LeaderElector) campaign() {
+	ctx, cancel := context.WithTimeout(context.Background(), leaderElectionCallDeadline)
+	defer cancel()
+	if e.lock == nil {
+		// the lock must outlive this call so it is not
+		// bound to the deadline of the campaign
+		lock, err := e.locker.AcquireLock(context.Background(), e.key)
+		if err != nil {
+			return
+		}
+		e.lock = lock
+		log.Info().Msg("acquired cluster leadership")
+		e.setLeader(true)
+		return
+	}
+	if err := e.lock.RenewLock(ctx); err != nil {
+		log.Warn().Err(err).Msg("lost cluster leadership")
+		if err := e.lock.ReleaseLock(ctx); err != nil {
+			log.Debug().Err(err).Msg("error releasing the leader lock")
+		}
+		e.lock = nil
+		e.setLeader(false)
+	}
+}
+
+func (e *LeaderElector) resign() {
+	if e.lock == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), leaderElectionCallDeadline)
+	defer cancel()
+	if err := e.lock.ReleaseLock(ctx); err != nil {
+		log.Error().Err(err).Msg("error releasing the leader lock")
+	}
+	e.lock = nil
+	log.Info().Msg("resigned cluster leadership")
+	e.setLeader(false)
+}
+
+func (e *LeaderElector) setLeader(leader bool) {
+	e.leader.Store(leader)
+	e.mu.Lock()
+	listeners := make([]func(bool), len(e.listeners))
+	copy(listeners, e.listeners)
+	e.mu.Unlock()
+	for _, fn := range listeners {
+		fn(leader)
+	}
+}
@@ -0,0 +1,70 @@
+package locker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeaderElector(t *testing.T) {
+	l := NewInMemoryLocker()
+
+	changes := make(chan bool, 10)
+	e1 := NewLeaderElector(l, WithLeaseRenewInterval(time.Millisecond*100))
+	e1.OnChange(func(leader bool) {
+		changes <- leader
+	})
+	e1.Start()
+
+	assert.True(t, <-changes)
+	assert.True(t, e1.IsLeader())
+
+	e2 := NewLeaderElector(l, WithLeaseRenewInterval(time.Millisecond*100))
+	e2.Start()
+	time.Sleep(time.Millisecond * 300)
+	assert.False(t, e2.IsLeader())
+
+	// failover
+	e1.Stop()
+	assert.False(t, <-changes)
+	assert.False(t, e1.IsLeader())
+
+	assert.Eventually(t, e2.IsLeader, time.Second, time.Millisecond*50)
+	e2.Stop()
+	assert.False(t, e2.IsLeader())
+}
+
+func TestLeaderElectorLostLease(t *testing.T) {
+	l := NewInMemoryLocker()
+	ctx := context.Background()
+
+	e := NewLeaderElector(l, WithLeaseRenewInterval(time.Millisecond*100))
+	e.Start()
+	assert.Eventually(t, e.IsLeader, time.Second, time.Millisecond*50)
+
+	// simulate the lease being taken away from the leader
+	l.mu.Lock()
+	delete(l.locks, DefaultLeaderKey)
+	l.mu.Unlock()
+	lock, err := l.AcquireLock(ctx, DefaultLeaderKey)
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool { return !e.IsLeader() }, time.Second, time.Millisecond*50)
+	// the demoted leader must not have released the new holder's lock
+	assert.NoError(t, lock.RenewLock(ctx))
+	assert.NoError(t, lock.ReleaseLock(ctx))
+	e.Stop()
+}
+
+func TestInmemoryLocker_RenewLock(t *testing.T) {
+	locker := NewInMemoryLocker()
+	ctx := context.Background()
+
+	lock, err := locker.AcquireLock(ctx, "test_key")
+	assert.NoError(t, err)
+	assert.NoError(t, lock.RenewLock(ctx))
+	assert.NoError(t, lock.ReleaseLock(ctx))
+	assert.Error(t, lock.RenewLock(ctx))
+}
@@ -11,6 +11,9 @@ const (
 
 type Lock interface {
 	ReleaseLock(ctx context.Context) error
+	// RenewLock extends the lease on the lock. It returns
+	// an error when the lock is no longer held.
+	RenewLock(ctx context.Context) error
 }
 
 type Locker interface {
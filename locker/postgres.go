@@ -16,13 +16,29 @@ type PostgresLocker struct {
 }
 
 type postgresLock struct {
-	tx *sqlx.Tx
+	tx      *sqlx.Tx
+	key     string
+	keyHash int64
 }
 
 func (l *postgresLock) ReleaseLock(ctx context.Context) error {
 	return l.tx.Rollback()
 }
 
+// RenewLock verifies that the transaction holding the advisory
+// lock is still alive. Transaction-level advisory locks are
+// re-entrant so re-acquiring it is a no-op while it's held.
+func (l *postgresLock) RenewLock(ctx context.Context) error {
+	var held bool
+	if err := l.tx.GetContext(ctx, &held, "SELECT pg_try_advisory_xact_lock($1)", l.keyHash); err != nil {
+		return errors.Wrapf(err, "failed to renew lock for key '%s'", l.key)
+	}
+	if !held {
+		return errors.Errorf("lock for key '%s' is no longer held", l.key)
+	}
+	return nil
+}
+
 func NewPostgresLocker(dsn string) (*PostgresLocker, error) {
 	db, err := sqlx.Connect("postgres", dsn)
 	if err != nil {
@@ -45,12 +61,14 @@ func (p *PostgresLocker) AcquireLock(ctx context.Context, key string) (Lock, err
 	}
 	var lockAttempt bool
 	if err := tx.GetContext(ctx, &lockAttempt, "SELECT pg_try_advisory_xact_lock($1)", keyHash); err != nil {
+		_ = tx.Rollback()
 		return nil, errors.Wrapf(err, "failed to acquire lock for key '%s'", key)
 	}
 	if !lockAttempt {
+		_ = tx.Rollback()
 		return nil, errors.Errorf("failed to acquire lock for key '%s'", key)
 	}
-	return &postgresLock{tx: tx}, nil
+	return &postgresLock{tx: tx, key: key, keyHash: keyHash}, nil
 }
 
 func hashKey(key string) int64 {
@@ -42,3 +42,17 @@ func Test_hashKey(t *testing.T) {
 	i := hashKey("2c7eb7e1951343468ce360c906003a22")
 	assert.Equal(t, int64(-414568140838410356), i)
 }
+
+func TestPostgresLocker_RenewLock(t *testing.T) {
+	dsn := "host=localhost user=tork password=tork dbname=tork port=5432 sslmode=disable"
+	locker, err := NewPostgresLocker(dsn)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+
+	lock, err := locker.AcquireLock(ctx, "test_renew_key")
+	assert.NoError(t, err)
+	assert.NoError(t, lock.RenewLock(ctx))
+	assert.NoError(t, lock.ReleaseLock(ctx))
+	assert.Error(t, lock.RenewLock(ctx))
+}
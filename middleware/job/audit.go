@@ -0,0 +1,32 @@
+package job
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore"
+)
+
+// Audit records the state transitions of jobs in the audit log.
+func Audit(ds datastore.Datastore) MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, et EventType, j *tork.Job) error {
+			if err := next(ctx, et, j); err != nil {
+				return err
+			}
+			if et != StateChange {
+				return nil
+			}
+			if err := ds.CreateAuditEvent(ctx, &tork.AuditEvent{
+				Action:     fmt.Sprintf("%s %s", StateChange, j.State),
+				TargetType: tork.AUDIT_TARGET_JOB,
+				TargetID:   j.ID,
+			}); err != nil {
+				log.Error().Err(err).Msgf("error recording audit event for job %s", j.ID)
+			}
+			return nil
+		}
+	}
+}
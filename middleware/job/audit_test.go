@@ -0,0 +1,34 @@
+package job
+
+import (
+	"context"
+	"testing"
+
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/datastore/postgres"
+	"github.com/runabol/tork/internal/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudit(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	hm := ApplyMiddleware(NoOpHandlerFunc, []MiddlewareFunc{Audit(ds)})
+
+	j := &tork.Job{
+		ID:    uuid.NewUUID(),
+		State: tork.JobStateCancelled,
+	}
+	assert.NoError(t, hm(ctx, StateChange, j))
+	assert.NoError(t, hm(ctx, Progress, j))
+
+	events, err := ds.GetAuditEvents(ctx, datastore.AuditQuery{TargetID: j.ID}, 1, 10)
+	assert.NoError(t, err)
+	assert.Len(t, events.Items, 1)
+	assert.Equal(t, "STATE_CHANGE CANCELLED", events.Items[0].Action)
+	assert.Equal(t, tork.AUDIT_TARGET_JOB, events.Items[0].TargetType)
+	assert.Empty(t, events.Items[0].Username)
+	assert.NoError(t, ds.Close())
+}
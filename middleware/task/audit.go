@@ -0,0 +1,32 @@
+package task
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore"
+)
+
+// Audit records the state transitions of tasks in the audit log.
+func Audit(ds datastore.Datastore) MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, et EventType, t *tork.Task) error {
+			if err := next(ctx, et, t); err != nil {
+				return err
+			}
+			if et != StateChange {
+				return nil
+			}
+			if err := ds.CreateAuditEvent(ctx, &tork.AuditEvent{
+				Action:     fmt.Sprintf("%s %s", StateChange, t.State),
+				TargetType: tork.AUDIT_TARGET_TASK,
+				TargetID:   t.ID,
+			}); err != nil {
+				log.Error().Err(err).Msgf("error recording audit event for task %s", t.ID)
+			}
+			return nil
+		}
+	}
+}
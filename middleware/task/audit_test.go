@@ -0,0 +1,35 @@
+package task
+
+import (
+	"context"
+	"testing"
+
+	"github.com/runabol/tork"
+	"github.com/runabol/tork/datastore"
+	"github.com/runabol/tork/datastore/postgres"
+	"github.com/runabol/tork/internal/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudit(t *testing.T) {
+	ctx := context.Background()
+	ds, err := postgres.NewTestDatastore()
+	assert.NoError(t, err)
+	hm := ApplyMiddleware(NoOpHandlerFunc, []MiddlewareFunc{Audit(ds)})
+
+	tk := &tork.Task{
+		ID:    uuid.NewUUID(),
+		State: tork.TaskStateFailed,
+	}
+	assert.NoError(t, hm(ctx, StateChange, tk))
+	assert.NoError(t, hm(ctx, Progress, tk))
+	assert.NoError(t, hm(ctx, Read, tk))
+
+	events, err := ds.GetAuditEvents(ctx, datastore.AuditQuery{TargetID: tk.ID}, 1, 10)
+	assert.NoError(t, err)
+	assert.Len(t, events.Items, 1)
+	assert.Equal(t, "STATE_CHANGE FAILED", events.Items[0].Action)
+	assert.Equal(t, tork.AUDIT_TARGET_TASK, events.Items[0].TargetType)
+	assert.Empty(t, events.Items[0].Username)
+	assert.NoError(t, ds.Close())
+}
@@ -0,0 +1,64 @@
+package tork
+
+import "time"
+
+const (
+	NAMESPACE_DEFAULT string = "default"
+)
+
+// Namespace partitions jobs and scheduled jobs between tenants.
+// Users see and act on the namespaces they, or one of their roles,
+// are members of. The default namespace is open to every user.
+type Namespace struct {
+	ID           string             `json:"id,omitempty"`
+	Name         string             `json:"name,omitempty"`
+	Description  string             `json:"description,omitempty"`
+	DefaultQueue string             `json:"defaultQueue,omitempty"`
+	Quota        *NamespaceQuota    `json:"quota,omitempty"`
+	Members      []*NamespaceMember `json:"members,omitempty"`
+	CreatedAt    *time.Time         `json:"createdAt,omitempty"`
+}
+
+// NamespaceMember grants a user, or every user of a role,
+// access to a namespace.
+type NamespaceMember struct {
+	User *User `json:"user,omitempty"`
+	Role *Role `json:"role,omitempty"`
+}
+
+// NamespaceQuota limits the resources a namespace may consume.
+// Zero values are unlimited.
+type NamespaceQuota struct {
+	MaxActiveJobs int `json:"maxActiveJobs,omitempty"`
+}
+
+func (n *Namespace) Clone() *Namespace {
+	var quota *NamespaceQuota
+	if n.Quota != nil {
+		quota = &NamespaceQuota{MaxActiveJobs: n.Quota.MaxActiveJobs}
+	}
+	members := make([]*NamespaceMember, len(n.Members))
+	for i, m := range n.Members {
+		members[i] = m.Clone()
+	}
+	return &Namespace{
+		ID:           n.ID,
+		Name:         n.Name,
+		Description:  n.Description,
+		DefaultQueue: n.DefaultQueue,
+		Quota:        quota,
+		Members:      members,
+		CreatedAt:    n.CreatedAt,
+	}
+}
+
+func (m *NamespaceMember) Clone() *NamespaceMember {
+	c := &NamespaceMember{}
+	if m.User != nil {
+		c.User = m.User.Clone()
+	}
+	if m.Role != nil {
+		c.Role = m.Role.Clone()
+	}
+	return c
+}
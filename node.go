@@ -1,32 +1,87 @@
 package tork
 
 import (
+	"slices"
 	"time"
+
+	"golang.org/x/exp/maps"
 )
 
 var LAST_HEARTBEAT_TIMEOUT = time.Minute * 5
 var HEARTBEAT_RATE = time.Second * 30
 
+// NODE_HISTORY_DURATION is how far back the
+// telemetry history of the nodes goes.
+var NODE_HISTORY_DURATION = time.Hour
+
 type NodeStatus string
 
 const (
 	NodeStatusUP      NodeStatus = "UP"
 	NodeStatusDown    NodeStatus = "DOWN"
 	NodeStatusOffline NodeStatus = "OFFLINE"
+	// NodeStatusDraining is reported by a worker which is
+	// finishing its in-flight tasks prior to shutting down
+	// and is no longer accepting new ones.
+	NodeStatusDraining NodeStatus = "DRAINING"
 )
 
 type Node struct {
-	ID              string     `json:"id,omitempty"`
-	Name            string     `json:"name,omitempty"`
-	StartedAt       time.Time  `json:"startedAt,omitempty"`
-	CPUPercent      float64    `json:"cpuPercent,omitempty"`
-	LastHeartbeatAt time.Time  `json:"lastHeartbeatAt,omitempty"`
-	Queue           string     `json:"queue,omitempty"`
-	Status          NodeStatus `json:"status,omitempty"`
-	Hostname        string     `json:"hostname,omitempty"`
-	Port            int        `json:"port,omitempty"`
-	TaskCount       int        `json:"taskCount,omitempty"`
-	Version         string     `json:"version"`
+	ID              string            `json:"id,omitempty"`
+	Name            string            `json:"name,omitempty"`
+	StartedAt       time.Time         `json:"startedAt,omitempty"`
+	CPUPercent      float64           `json:"cpuPercent,omitempty"`
+	LastHeartbeatAt time.Time         `json:"lastHeartbeatAt,omitempty"`
+	Queue           string            `json:"queue,omitempty"`
+	Status          NodeStatus        `json:"status,omitempty"`
+	Hostname        string            `json:"hostname,omitempty"`
+	Port            int               `json:"port,omitempty"`
+	TaskCount       int               `json:"taskCount,omitempty"`
+	Version         string            `json:"version"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Capacity        *NodeResources    `json:"capacity,omitempty"`
+	Allocated       *NodeResources    `json:"allocated,omitempty"`
+	// Leader is set on the coordinator which currently
+	// holds the leadership of the cluster.
+	Leader      bool         `json:"leader,omitempty"`
+	MemoryUsed  int64        `json:"memoryUsed,omitempty"`  // bytes
+	MemoryTotal int64        `json:"memoryTotal,omitempty"` // bytes
+	DiskFree    int64        `json:"diskFree,omitempty"`    // bytes, on the task workdir
+	LoadAverage []float64    `json:"loadAverage,omitempty"` // 1, 5 and 15 minutes
+	Runtime     *NodeRuntime `json:"runtime,omitempty"`
+	// History holds the telemetry of the node over the last
+	// NODE_HISTORY_DURATION, oldest first, when requested.
+	History []*NodeSample `json:"history,omitempty"`
+}
+
+// NodeRuntime describes the runtime environment
+// in which a worker executes its tasks.
+type NodeRuntime struct {
+	Type       string `json:"type,omitempty"`
+	Version    string `json:"version,omitempty"`
+	Containers int    `json:"containers"` // running
+	// WorkDir is the directory under which tasks
+	// get their working directories.
+	WorkDir string `json:"workdir,omitempty"`
+}
+
+// NodeSample is the telemetry a node sent with one of its heartbeats.
+type NodeSample struct {
+	Time        time.Time `json:"time"`
+	CPUPercent  float64   `json:"cpuPercent"`
+	MemoryUsed  int64     `json:"memoryUsed"`
+	DiskFree    int64     `json:"diskFree"`
+	LoadAverage float64   `json:"loadAverage"` // 1 minute
+	TaskCount   int       `json:"taskCount"`
+	Containers  int       `json:"containers"`
+}
+
+// NodeResources describes an amount of compute resources: either
+// the total capacity of a node or the portion of it which is in use.
+type NodeResources struct {
+	CPUs   float64 `json:"cpus,omitempty"`
+	Memory int64   `json:"memory,omitempty"` // bytes
+	GPUs   int     `json:"gpus,omitempty"`
 }
 
 func (n *Node) Clone() *Node {
@@ -42,5 +97,96 @@ func (n *Node) Clone() *Node {
 		Port:            n.Port,
 		TaskCount:       n.TaskCount,
 		Version:         n.Version,
+		Labels:          maps.Clone(n.Labels),
+		Capacity:        n.Capacity.Clone(),
+		Allocated:       n.Allocated.Clone(),
+		Leader:          n.Leader,
+		MemoryUsed:      n.MemoryUsed,
+		MemoryTotal:     n.MemoryTotal,
+		DiskFree:        n.DiskFree,
+		LoadAverage:     slices.Clone(n.LoadAverage),
+		Runtime:         n.Runtime.Clone(),
+		History:         slices.Clone(n.History),
+	}
+}
+
+// Sample returns the telemetry of the node as of its last heartbeat.
+func (n *Node) Sample() *NodeSample {
+	s := &NodeSample{
+		Time:       n.LastHeartbeatAt,
+		CPUPercent: n.CPUPercent,
+		MemoryUsed: n.MemoryUsed,
+		DiskFree:   n.DiskFree,
+		TaskCount:  n.TaskCount,
+	}
+	if len(n.LoadAverage) > 0 {
+		s.LoadAverage = n.LoadAverage[0]
 	}
+	if n.Runtime != nil {
+		s.Containers = n.Runtime.Containers
+	}
+	return s
+}
+
+func (r *NodeRuntime) Clone() *NodeRuntime {
+	if r == nil {
+		return nil
+	}
+	c := *r
+	return &c
+}
+
+// Free returns the resources of the node which are
+// not currently allocated to any task.
+func (n *Node) Free() NodeResources {
+	if n.Capacity == nil {
+		return NodeResources{}
+	}
+	if n.Allocated == nil {
+		return *n.Capacity
+	}
+	return n.Capacity.Sub(*n.Allocated)
+}
+
+// Matches returns true if the node carries all
+// the labels specified by the given selector.
+func (n *Node) Matches(selector map[string]string) bool {
+	for k, v := range selector {
+		if lv, ok := n.Labels[k]; !ok || lv != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *NodeResources) Clone() *NodeResources {
+	if r == nil {
+		return nil
+	}
+	return &NodeResources{
+		CPUs:   r.CPUs,
+		Memory: r.Memory,
+		GPUs:   r.GPUs,
+	}
+}
+
+func (r NodeResources) Add(o NodeResources) NodeResources {
+	return NodeResources{
+		CPUs:   r.CPUs + o.CPUs,
+		Memory: r.Memory + o.Memory,
+		GPUs:   r.GPUs + o.GPUs,
+	}
+}
+
+func (r NodeResources) Sub(o NodeResources) NodeResources {
+	return NodeResources{
+		CPUs:   r.CPUs - o.CPUs,
+		Memory: r.Memory - o.Memory,
+		GPUs:   r.GPUs - o.GPUs,
+	}
+}
+
+// Fits returns true if o is within the bounds of r.
+func (r NodeResources) Fits(o NodeResources) bool {
+	return o.CPUs <= r.CPUs && o.Memory <= r.Memory && o.GPUs <= r.GPUs
 }
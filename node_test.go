@@ -0,0 +1,80 @@
+package tork_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/runabol/tork"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeMatches(t *testing.T) {
+	n := &tork.Node{
+		Labels: map[string]string{
+			"region": "eu",
+			"gpu":    "a100",
+		},
+	}
+	assert.True(t, n.Matches(nil))
+	assert.True(t, n.Matches(map[string]string{"region": "eu"}))
+	assert.True(t, n.Matches(map[string]string{"region": "eu", "gpu": "a100"}))
+	assert.False(t, n.Matches(map[string]string{"region": "us"}))
+	assert.False(t, n.Matches(map[string]string{"disk": "ssd"}))
+}
+
+func TestNodeFree(t *testing.T) {
+	n := &tork.Node{}
+	assert.Equal(t, tork.NodeResources{}, n.Free())
+
+	n.Capacity = &tork.NodeResources{CPUs: 4, Memory: 1024, GPUs: 1}
+	assert.Equal(t, *n.Capacity, n.Free())
+
+	n.Allocated = &tork.NodeResources{CPUs: 1.5, Memory: 512}
+	free := n.Free()
+	assert.Equal(t, tork.NodeResources{CPUs: 2.5, Memory: 512, GPUs: 1}, free)
+	assert.True(t, free.Fits(tork.NodeResources{CPUs: 2, Memory: 512}))
+	assert.False(t, free.Fits(tork.NodeResources{GPUs: 2}))
+}
+
+func TestCloneNode(t *testing.T) {
+	n1 := &tork.Node{
+		ID:       "1234",
+		Labels:   map[string]string{"region": "eu"},
+		Capacity: &tork.NodeResources{CPUs: 4},
+	}
+	n2 := n1.Clone()
+	n2.Labels["region"] = "us"
+	n2.Capacity.CPUs = 2
+	assert.Equal(t, "eu", n1.Labels["region"])
+	assert.Equal(t, float64(4), n1.Capacity.CPUs)
+	assert.Nil(t, n2.Allocated)
+}
+
+func TestNodeSample(t *testing.T) {
+	now := time.Now().UTC()
+	n := &tork.Node{
+		LastHeartbeatAt: now,
+		CPUPercent:      50,
+		MemoryUsed:      1024,
+		DiskFree:        2048,
+		LoadAverage:     []float64{1.5, 1, 0.5},
+		TaskCount:       3,
+		Runtime:         &tork.NodeRuntime{Type: "docker", Containers: 4},
+	}
+	assert.Equal(t, &tork.NodeSample{
+		Time:        now,
+		CPUPercent:  50,
+		MemoryUsed:  1024,
+		DiskFree:    2048,
+		LoadAverage: 1.5,
+		TaskCount:   3,
+		Containers:  4,
+	}, n.Sample())
+
+	n2 := n.Clone()
+	n2.Runtime.Containers = 1
+	n2.LoadAverage[0] = 3
+	assert.Equal(t, 4, n.Runtime.Containers)
+	assert.Equal(t, 1.5, n.LoadAverage[0])
+	assert.Equal(t, &tork.NodeSample{}, (&tork.Node{}).Sample())
+}
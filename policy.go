@@ -0,0 +1,72 @@
+package tork
+
+import "time"
+
+const (
+	ACTION_JOB_SUBMIT           string = "job:submit"
+	ACTION_JOB_CANCEL           string = "job:cancel"
+	ACTION_JOB_RESTART          string = "job:restart"
+	ACTION_JOB_READ_LOGS        string = "job:logs"
+	ACTION_JOB_DELETE           string = "job:delete"
+	ACTION_SCHEDULED_JOB_MANAGE string = "scheduled-job:manage"
+	ACTION_QUEUE_USE            string = "queue:use"
+	ACTION_QUEUE_READ           string = "queue:read"
+	ACTION_QUEUE_MANAGE         string = "queue:manage"
+	ACTION_NODE_READ            string = "node:read"
+	ACTION_NODE_MANAGE          string = "node:manage"
+	ACTION_STATS_READ           string = "stats:read"
+	ACTION_USER_MANAGE          string = "user:manage"
+	ACTION_AUDIT_READ           string = "audit:read"
+	ACTION_NAMESPACE_MANAGE     string = "namespace:manage"
+	ACTION_SECRET_USE           string = "secret:use"
+	ACTION_SECRET_MANAGE        string = "secret:manage"
+)
+
+// ACTIONS lists every action a policy may grant.
+var ACTIONS = []string{
+	ACTION_JOB_SUBMIT,
+	ACTION_JOB_CANCEL,
+	ACTION_JOB_RESTART,
+	ACTION_JOB_READ_LOGS,
+	ACTION_JOB_DELETE,
+	ACTION_SCHEDULED_JOB_MANAGE,
+	ACTION_QUEUE_USE,
+	ACTION_QUEUE_READ,
+	ACTION_QUEUE_MANAGE,
+	ACTION_NODE_READ,
+	ACTION_NODE_MANAGE,
+	ACTION_STATS_READ,
+	ACTION_USER_MANAGE,
+	ACTION_AUDIT_READ,
+	ACTION_NAMESPACE_MANAGE,
+	ACTION_SECRET_USE,
+	ACTION_SECRET_MANAGE,
+}
+
+// Policy grants the members of a role an action. Resource is a
+// wildcard pattern naming what the action applies to -- e.g. the
+// queues a role may use -- and defaults to all resources.
+//
+// Policies granted to the public role apply to every user, while
+// members of the admin role are granted every action.
+type Policy struct {
+	ID        string     `json:"id,omitempty"`
+	Role      *Role      `json:"role,omitempty"`
+	Action    string     `json:"action,omitempty"`
+	Resource  string     `json:"resource,omitempty"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+}
+
+func (p *Policy) Clone() *Policy {
+	var role *Role
+	if p.Role != nil {
+		role = p.Role.Clone()
+	}
+	return &Policy{
+		ID:        p.ID,
+		Role:      role,
+		Action:    p.Action,
+		Resource:  p.Resource,
+		CreatedAt: p.CreatedAt,
+	}
+}
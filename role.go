@@ -4,6 +4,7 @@ import "time"
 
 const (
 	ROLE_PUBLIC string = "public"
+	ROLE_ADMIN  string = "admin"
 )
 
 type Role struct {
@@ -32,8 +32,10 @@ import (
 	"github.com/runabol/tork/internal/fns"
 	"github.com/runabol/tork/internal/logging"
 	"github.com/runabol/tork/internal/syncx"
+	"github.com/runabol/tork/internal/tracing"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/runabol/tork/runtime"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // defaultWorkdir is the directory where `Task.File`s are
@@ -153,8 +155,10 @@ func (d *DockerRuntime) Run(ctx context.Context, t *tork.Task) error {
 	}
 	var logger io.Writer
 	if d.broker != nil {
+		shipper := broker.NewLogShipper(d.broker, t.ID, t.Redact...)
+		defer shipper.Close()
 		logger = io.MultiWriter(
-			broker.NewLogShipper(d.broker, t.ID),
+			shipper,
 			logging.NewZerologWriter(t.ID, zerolog.DebugLevel),
 		)
 	} else {
@@ -187,7 +191,14 @@ func (d *DockerRuntime) Run(ctx context.Context, t *tork.Task) error {
 	return nil
 }
 
-func (d *DockerRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Writer) error {
+func (d *DockerRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Writer) (err error) {
+	ctx, span := tracing.Start(ctx, "runtime.run",
+		attribute.String("tork.task.id", t.ID),
+		attribute.String("container.image.name", t.Image),
+	)
+	defer func() {
+		tracing.End(span, err)
+	}()
 	if t.ID == "" {
 		return errors.New("task id is required")
 	}
@@ -369,6 +380,12 @@ func (d *DockerRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Write
 	defer cancel()
 	go d.reportProgress(pctx, resp.ID, t)
 
+	// account for the resources the task uses
+	usage := d.collectUsage(resp.ID)
+	defer func() {
+		t.Usage = usage.Usage()
+	}()
+
 	// read the container's stdout
 	out, err := d.client.ContainerLogs(
 		ctx,
@@ -607,6 +624,19 @@ func (d *DockerRuntime) HealthCheck(ctx context.Context) error {
 	return err
 }
 
+func (d *DockerRuntime) Describe(ctx context.Context) (*tork.NodeRuntime, error) {
+	info, err := d.client.Info(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting docker info")
+	}
+	return &tork.NodeRuntime{
+		Type:       runtime.Docker,
+		Version:    info.ServerVersion,
+		Containers: info.ContainersRunning,
+		WorkDir:    info.DockerRootDir,
+	}, nil
+}
+
 // take from https://github.com/docker/cli/blob/9bd5ec504afd13e82d5e50b60715e7190c1b2aa0/opts/opts.go#L393-L403
 func parseCPUs(limits *tork.TaskLimits) (int64, error) {
 	if limits == nil || limits.CPUs == "" {
@@ -650,7 +680,11 @@ func (r dockerLogsReader) Read(p []byte) (int, error) {
 	return n, err
 }
 
-func (d *DockerRuntime) imagePull(ctx context.Context, t *tork.Task, logger io.Writer) error {
+func (d *DockerRuntime) imagePull(ctx context.Context, t *tork.Task, logger io.Writer) (err error) {
+	ctx, span := tracing.Start(ctx, "runtime.imagePull", attribute.String("container.image.name", t.Image))
+	defer func() {
+		tracing.End(span, err)
+	}()
 	pr := &pullRequest{
 		ctx:    ctx,
 		image:  t.Image,
@@ -664,7 +698,7 @@ func (d *DockerRuntime) imagePull(ctx context.Context, t *tork.Task, logger io.W
 		}
 	}
 	d.pullq <- pr
-	err := <-pr.done
+	err = <-pr.done
 	return err
 }
 
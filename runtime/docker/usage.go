@@ -0,0 +1,92 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/rs/zerolog/log"
+	"github.com/runabol/tork"
+)
+
+// usageCollector follows the stats Docker streams, about once a
+// second, for a running container to account for the resources
+// its task uses.
+type usageCollector struct {
+	mu       sync.Mutex
+	usage    tork.TaskUsage
+	observed bool
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func (d *DockerRuntime) collectUsage(containerID string) *usageCollector {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &usageCollector{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(c.done)
+		stats, err := d.client.ContainerStats(ctx, containerID, true)
+		if err != nil {
+			log.Debug().Err(err).Msgf("error getting the stats of container %s", containerID)
+			return
+		}
+		defer stats.Body.Close()
+		dec := json.NewDecoder(stats.Body)
+		for {
+			var s types.StatsJSON
+			if err := dec.Decode(&s); err != nil {
+				return
+			}
+			c.observe(&s)
+		}
+	}()
+	return c
+}
+
+// observe accounts for a sample of the stats. The counters only ever
+// go up while the container runs, so the latest non-zero ones are
+// kept: a stopped container reports zeros.
+func (c *usageCollector) observe(s *types.StatsJSON) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.observed = true
+	cpu := float64(s.CPUStats.CPUUsage.TotalUsage) / 1e9
+	c.usage.CPUSeconds = max(c.usage.CPUSeconds, cpu)
+	// MaxUsage is only reported by cgroup v1
+	peak := max(s.MemoryStats.Usage, s.MemoryStats.MaxUsage)
+	c.usage.PeakMemory = max(c.usage.PeakMemory, int64(peak))
+	var rx, tx uint64
+	for _, n := range s.Networks {
+		rx += n.RxBytes
+		tx += n.TxBytes
+	}
+	c.usage.NetworkRx = max(c.usage.NetworkRx, int64(rx))
+	c.usage.NetworkTx = max(c.usage.NetworkTx, int64(tx))
+	var read, write uint64
+	for _, e := range s.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(e.Op) {
+		case "read":
+			read += e.Value
+		case "write":
+			write += e.Value
+		}
+	}
+	c.usage.BlockRead = max(c.usage.BlockRead, int64(read))
+	c.usage.BlockWrite = max(c.usage.BlockWrite, int64(write))
+}
+
+// Usage stops following the stats and returns the usage
+// they add up to, or nil if none could be read.
+func (c *usageCollector) Usage() *tork.TaskUsage {
+	c.cancel()
+	<-c.done
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.observed {
+		return nil
+	}
+	u := c.usage
+	return &u
+}
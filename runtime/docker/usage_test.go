@@ -0,0 +1,48 @@
+package docker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/runabol/tork"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsageCollectorObserve(t *testing.T) {
+	_, cancel := context.WithCancel(context.Background())
+	c := &usageCollector{cancel: cancel, done: make(chan struct{})}
+	close(c.done)
+	assert.Nil(t, c.Usage())
+
+	s := types.StatsJSON{}
+	s.CPUStats.CPUUsage.TotalUsage = 1_500_000_000
+	s.MemoryStats.Usage = 2048
+	s.Networks = map[string]types.NetworkStats{
+		"eth0": {RxBytes: 100, TxBytes: 50},
+		"eth1": {RxBytes: 10, TxBytes: 5},
+	}
+	s.BlkioStats.IoServiceBytesRecursive = []types.BlkioStatEntry{
+		{Op: "read", Value: 4096},
+		{Op: "write", Value: 512},
+		{Op: "Read", Value: 1024},
+	}
+	c.observe(&s)
+
+	// memory went down and the container then
+	// stopped, which zeroes the counters
+	s2 := types.StatsJSON{}
+	s2.CPUStats.CPUUsage.TotalUsage = 2_000_000_000
+	s2.MemoryStats.Usage = 1024
+	c.observe(&s2)
+	c.observe(&types.StatsJSON{})
+
+	assert.Equal(t, &tork.TaskUsage{
+		CPUSeconds: 2,
+		PeakMemory: 2048,
+		NetworkRx:  110,
+		NetworkTx:  55,
+		BlockRead:  5120,
+		BlockWrite: 512,
+	}, c.Usage())
+}
@@ -3,6 +3,7 @@ package podman
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -19,8 +20,10 @@ import (
 	"github.com/runabol/tork/broker"
 	"github.com/runabol/tork/internal/logging"
 	"github.com/runabol/tork/internal/syncx"
+	"github.com/runabol/tork/internal/tracing"
 	"github.com/runabol/tork/internal/uuid"
 	"github.com/runabol/tork/runtime"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -110,8 +113,10 @@ func (d *PodmanRuntime) Run(ctx context.Context, t *tork.Task) error {
 	// setup logging
 	var logger io.Writer
 	if d.broker != nil {
+		shipper := broker.NewLogShipper(d.broker, t.ID, t.Redact...)
+		defer shipper.Close()
 		logger = io.MultiWriter(
-			broker.NewLogShipper(d.broker, t.ID),
+			shipper,
 			logging.NewZerologWriter(t.ID, zerolog.DebugLevel),
 		)
 	} else {
@@ -145,7 +150,14 @@ func (d *PodmanRuntime) Run(ctx context.Context, t *tork.Task) error {
 	return nil
 }
 
-func (d *PodmanRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Writer) error {
+func (d *PodmanRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Writer) (err error) {
+	ctx, span := tracing.Start(ctx, "runtime.run",
+		attribute.String("tork.task.id", t.ID),
+		attribute.String("container.image.name", t.Image),
+	)
+	defer func() {
+		tracing.End(span, err)
+	}()
 	// Initiallize the work directory
 	workDir := path.Join(os.TempDir(), "tork", t.ID)
 	if err := os.MkdirAll(workDir, 0777); err != nil {
@@ -301,6 +313,12 @@ func (d *PodmanRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Write
 		return fmt.Errorf("failed to start container %s: %w", containerID, err)
 	}
 
+	// account for the resources the task uses
+	usage := d.collectUsage(containerID)
+	defer func() {
+		t.Usage = usage()
+	}()
+
 	// read logs
 	logsCmd := exec.CommandContext(ctx, "podman", "logs", "--follow", containerID)
 	logsCmd.Stdout = logger
@@ -353,6 +371,36 @@ func (d *PodmanRuntime) HealthCheck(ctx context.Context) error {
 	return nil
 }
 
+// podmanInfo is the part of the output of podman info the runtime uses.
+type podmanInfo struct {
+	Store struct {
+		GraphRoot      string `json:"graphRoot"`
+		ContainerStore struct {
+			Running int `json:"running"`
+		} `json:"containerStore"`
+	} `json:"store"`
+	Version struct {
+		Version string `json:"Version"`
+	} `json:"version"`
+}
+
+func (d *PodmanRuntime) Describe(ctx context.Context) (*tork.NodeRuntime, error) {
+	out, err := exec.CommandContext(ctx, "podman", "info", "--format", "json").Output()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting podman info")
+	}
+	info := podmanInfo{}
+	if err := json.Unmarshal(out, &info); err != nil {
+		return nil, errors.Wrap(err, "error parsing podman info")
+	}
+	return &tork.NodeRuntime{
+		Type:       runtime.Podman,
+		Version:    info.Version.Version,
+		Containers: info.Store.ContainerStore.Running,
+		WorkDir:    info.Store.GraphRoot,
+	}, nil
+}
+
 func (d *PodmanRuntime) reportProgress(ctx context.Context, progressFile string, t *tork.Task) {
 	for {
 		progress, err := d.readProgress(progressFile)
@@ -393,7 +441,11 @@ func (d *PodmanRuntime) readProgress(progressFile string) (float64, error) {
 	return progress, nil
 }
 
-func (d *PodmanRuntime) imagePull(ctx context.Context, t *tork.Task, logger io.Writer) error {
+func (d *PodmanRuntime) imagePull(ctx context.Context, t *tork.Task, logger io.Writer) (err error) {
+	ctx, span := tracing.Start(ctx, "runtime.imagePull", attribute.String("container.image.name", t.Image))
+	defer func() {
+		tracing.End(span, err)
+	}()
 	_, ok := d.images.Get(t.Image)
 	if ok {
 		return nil
@@ -405,7 +457,7 @@ func (d *PodmanRuntime) imagePull(ctx context.Context, t *tork.Task, logger io.W
 		done:   make(chan error),
 	}
 	d.pullq <- pr
-	err := <-pr.done
+	err = <-pr.done
 	if err == nil {
 		d.images.Set(t.Image, true)
 	}
@@ -0,0 +1,97 @@
+package podman
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/runabol/tork"
+)
+
+// the raw counters of podman stats, as opposed to their
+// human-readable forms
+const statsFormat = "{{.ContainerStats.CPUNano}} {{.ContainerStats.MemUsage}} " +
+	"{{.ContainerStats.NetInput}} {{.ContainerStats.NetOutput}} " +
+	"{{.ContainerStats.BlockInput}} {{.ContainerStats.BlockOutput}}"
+
+// collectUsage polls the stats of the container, once a second, to
+// account for the resources its task uses, until the returned
+// function is called to get them.
+func (d *PodmanRuntime) collectUsage(containerID string) func() *tork.TaskUsage {
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	var usage *tork.TaskUsage
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			out, err := exec.CommandContext(ctx, "podman", "stats", "--no-stream", "--format", statsFormat, containerID).Output()
+			if err == nil {
+				s, err := parseStats(string(out))
+				if err != nil {
+					log.Debug().Err(err).Msgf("error parsing the stats of container %s", containerID)
+				} else {
+					mu.Lock()
+					if usage == nil {
+						usage = &tork.TaskUsage{}
+					}
+					*usage = maxUsage(*usage, s)
+					mu.Unlock()
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+		}
+	}()
+	return func() *tork.TaskUsage {
+		cancel()
+		<-done
+		mu.Lock()
+		defer mu.Unlock()
+		return usage
+	}
+}
+
+func parseStats(out string) (tork.TaskUsage, error) {
+	fields := strings.Fields(out)
+	if len(fields) != 6 {
+		return tork.TaskUsage{}, errors.Errorf("unexpected stats: %s", out)
+	}
+	vals := make([]int64, len(fields))
+	for i, f := range fields {
+		v, err := strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return tork.TaskUsage{}, errors.Wrapf(err, "invalid stat: %s", f)
+		}
+		vals[i] = int64(v)
+	}
+	return tork.TaskUsage{
+		CPUSeconds: float64(vals[0]) / 1e9,
+		PeakMemory: vals[1],
+		NetworkRx:  vals[2],
+		NetworkTx:  vals[3],
+		BlockRead:  vals[4],
+		BlockWrite: vals[5],
+	}, nil
+}
+
+// maxUsage keeps the greatest of each counter: they only ever
+// go up while the container runs, but for the memory in use.
+func maxUsage(u, o tork.TaskUsage) tork.TaskUsage {
+	return tork.TaskUsage{
+		CPUSeconds: max(u.CPUSeconds, o.CPUSeconds),
+		PeakMemory: max(u.PeakMemory, o.PeakMemory),
+		NetworkRx:  max(u.NetworkRx, o.NetworkRx),
+		NetworkTx:  max(u.NetworkTx, o.NetworkTx),
+		BlockRead:  max(u.BlockRead, o.BlockRead),
+		BlockWrite: max(u.BlockWrite, o.BlockWrite),
+	}
+}
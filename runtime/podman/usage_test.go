@@ -0,0 +1,34 @@
+package podman
+
+import (
+	"testing"
+
+	"github.com/runabol/tork"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStats(t *testing.T) {
+	s, err := parseStats("1500000000 2048 100 50 4096 512\n")
+	assert.NoError(t, err)
+	assert.Equal(t, tork.TaskUsage{
+		CPUSeconds: 1.5,
+		PeakMemory: 2048,
+		NetworkRx:  100,
+		NetworkTx:  50,
+		BlockRead:  4096,
+		BlockWrite: 512,
+	}, s)
+
+	_, err = parseStats("1.5s 2kB")
+	assert.Error(t, err)
+	_, err = parseStats("1.5s 2048 100 50 4096 512")
+	assert.Error(t, err)
+}
+
+func TestMaxUsage(t *testing.T) {
+	u := maxUsage(
+		tork.TaskUsage{CPUSeconds: 1, PeakMemory: 4096, NetworkRx: 10},
+		tork.TaskUsage{CPUSeconds: 2, PeakMemory: 1024, NetworkRx: 20},
+	)
+	assert.Equal(t, tork.TaskUsage{CPUSeconds: 2, PeakMemory: 4096, NetworkRx: 20}, u)
+}
@@ -17,3 +17,9 @@ type Runtime interface {
 	Run(ctx context.Context, t *tork.Task) error
 	HealthCheck(ctx context.Context) error
 }
+
+// Describer is implemented by runtimes which can report
+// on themselves in the heartbeats of the worker.
+type Describer interface {
+	Describe(ctx context.Context) (*tork.NodeRuntime, error)
+}
@@ -21,7 +21,10 @@ import (
 	"github.com/runabol/tork/internal/logging"
 	"github.com/runabol/tork/internal/reexec"
 	"github.com/runabol/tork/internal/syncx"
+	"github.com/runabol/tork/internal/tracing"
 	"github.com/runabol/tork/internal/uuid"
+	"github.com/runabol/tork/runtime"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Rexec func(args ...string) *exec.Cmd
@@ -103,8 +106,10 @@ func (r *ShellRuntime) Run(ctx context.Context, t *tork.Task) error {
 	}
 	var logger io.Writer
 	if r.broker != nil {
+		shipper := broker.NewLogShipper(r.broker, t.ID, t.Redact...)
+		defer shipper.Close()
 		logger = io.MultiWriter(
-			broker.NewLogShipper(r.broker, t.ID),
+			shipper,
 			logging.NewZerologWriter(t.ID, zerolog.DebugLevel),
 		)
 	} else {
@@ -131,7 +136,11 @@ func (r *ShellRuntime) Run(ctx context.Context, t *tork.Task) error {
 	return nil
 }
 
-func (r *ShellRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Writer) error {
+func (r *ShellRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Writer) (err error) {
+	ctx, span := tracing.Start(ctx, "runtime.run", attribute.String("tork.task.id", t.ID))
+	defer func() {
+		tracing.End(span, err)
+	}()
 	defer r.cmds.Delete(t.ID)
 
 	workdir, err := os.MkdirTemp("", "tork")
@@ -236,6 +245,7 @@ func (r *ShellRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Writer
 	}()
 	select {
 	case err := <-errChan:
+		t.Usage = processUsage(cmd.ProcessState)
 		return errors.Wrapf(err, "error executing command")
 	case <-ctx.Done():
 		if err := cmd.Process.Kill(); err != nil {
@@ -243,6 +253,7 @@ func (r *ShellRuntime) doRun(ctx context.Context, t *tork.Task, logger io.Writer
 		}
 		return ctx.Err()
 	case <-doneChan:
+		t.Usage = processUsage(cmd.ProcessState)
 	}
 
 	output, err := os.ReadFile(fmt.Sprintf("%s/stdout", workdir))
@@ -320,3 +331,10 @@ func buildEnv() ([]string, error) {
 func (r *ShellRuntime) HealthCheck(ctx context.Context) error {
 	return nil
 }
+
+func (r *ShellRuntime) Describe(ctx context.Context) (*tork.NodeRuntime, error) {
+	return &tork.NodeRuntime{
+		Type:    runtime.Shell,
+		WorkDir: os.TempDir(),
+	}, nil
+}
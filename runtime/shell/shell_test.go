@@ -34,6 +34,28 @@ func TestShellRuntimeRunResult(t *testing.T) {
 	assert.Equal(t, "hello world", tk.Result)
 }
 
+func TestShellRuntimeRunUsage(t *testing.T) {
+	rt := NewShellRuntime(Config{
+		UID: DEFAULT_UID,
+		GID: DEFAULT_GID,
+		Rexec: func(args ...string) *exec.Cmd {
+			cmd := exec.Command(args[5], args[6:]...)
+			return cmd
+		},
+	})
+
+	tk := &tork.Task{
+		ID:  uuid.NewUUID(),
+		Run: "echo -n hello world > $REEXEC_TORK_OUTPUT",
+	}
+
+	err := rt.Run(context.Background(), tk)
+
+	assert.NoError(t, err)
+	assert.NotNil(t, tk.Usage)
+	assert.Greater(t, tk.Usage.PeakMemory, int64(0))
+}
+
 func TestShellRuntimeRunPath(t *testing.T) {
 	rt := NewShellRuntime(Config{
 		UID: DEFAULT_UID,
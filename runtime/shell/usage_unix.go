@@ -0,0 +1,33 @@
+//go:build freebsd || darwin || linux
+
+package shell
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+
+	"github.com/runabol/tork"
+)
+
+// processUsage returns the resources the process used,
+// as the operating system accounted for them.
+func processUsage(ps *os.ProcessState) *tork.TaskUsage {
+	if ps == nil {
+		return nil
+	}
+	u := &tork.TaskUsage{
+		CPUSeconds: (ps.UserTime() + ps.SystemTime()).Seconds(),
+	}
+	if ru, ok := ps.SysUsage().(*syscall.Rusage); ok {
+		// darwin reports the max RSS in bytes, others in kilobytes
+		u.PeakMemory = int64(ru.Maxrss)
+		if runtime.GOOS != "darwin" {
+			u.PeakMemory *= 1024
+		}
+		// blocks are counted in units of 512 bytes
+		u.BlockRead = int64(ru.Inblock) * 512
+		u.BlockWrite = int64(ru.Oublock) * 512
+	}
+	return u
+}
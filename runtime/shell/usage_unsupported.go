@@ -0,0 +1,19 @@
+//go:build !freebsd && !darwin && !linux
+
+package shell
+
+import (
+	"os"
+
+	"github.com/runabol/tork"
+)
+
+// processUsage returns the CPU time the process used.
+func processUsage(ps *os.ProcessState) *tork.TaskUsage {
+	if ps == nil {
+		return nil
+	}
+	return &tork.TaskUsage{
+		CPUSeconds: (ps.UserTime() + ps.SystemTime()).Seconds(),
+	}
+}
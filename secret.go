@@ -0,0 +1,40 @@
+package tork
+
+import (
+	"context"
+	"time"
+)
+
+// Secret is a value managed by the coordinator on behalf of jobs,
+// which reference it by name as {{ secrets.name }} instead of
+// carrying the value inline. Only the encrypted value is stored;
+// the plaintext Value is accepted on writes but never returned.
+type Secret struct {
+	ID         string     `json:"id,omitempty"`
+	Name       string     `json:"name,omitempty"`
+	Namespace  string     `json:"namespace,omitempty"`
+	Value      string     `json:"value,omitempty"`
+	Ciphertext string     `json:"-"`
+	CreatedAt  *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt  *time.Time `json:"updatedAt,omitempty"`
+}
+
+func (s *Secret) Clone() *Secret {
+	return &Secret{
+		ID:         s.ID,
+		Name:       s.Name,
+		Namespace:  s.Namespace,
+		Value:      s.Value,
+		Ciphertext: s.Ciphertext,
+		CreatedAt:  s.CreatedAt,
+		UpdatedAt:  s.UpdatedAt,
+	}
+}
+
+// SecretProvider looks up secrets kept outside of Tork, such as
+// in HashiCorp Vault. Jobs reference them as
+// {{ secret("<scheme>:<path>") }}, where scheme names the
+// provider and path is passed to it as is.
+type SecretProvider interface {
+	GetSecret(ctx context.Context, path string) (string, error)
+}
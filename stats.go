@@ -18,3 +18,18 @@ type NodeMetrics struct {
 	Running    int     `json:"online"`
 	CPUPercent float64 `json:"cpuPercent"`
 }
+
+// Stats aggregate the jobs or tasks of a group
+// which completed, failed or were cancelled.
+type Stats struct {
+	Group       string  `json:"group"`
+	Count       int     `json:"count"`
+	Completed   int     `json:"completed"`
+	Failed      int     `json:"failed"`
+	Cancelled   int     `json:"cancelled"`
+	SuccessRate float64 `json:"successRate"`
+	// P50Duration and P95Duration are percentiles of the time,
+	// in seconds, the completed jobs or tasks took to run.
+	P50Duration float64 `json:"p50Duration"`
+	P95Duration float64 `json:"p95Duration"`
+}
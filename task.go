@@ -2,8 +2,11 @@ package tork
 
 import (
 	"slices"
+	"strconv"
 	"time"
 
+	"github.com/docker/go-units"
+	"github.com/pkg/errors"
 	"golang.org/x/exp/maps"
 )
 
@@ -32,51 +35,61 @@ var TaskStateActive = []TaskState{
 
 // Task is the basic unit of work that a Worker can handle.
 type Task struct {
-	ID          string            `json:"id,omitempty"`
-	JobID       string            `json:"jobId,omitempty"`
-	ParentID    string            `json:"parentId,omitempty"`
-	Position    int               `json:"position,omitempty"`
-	Name        string            `json:"name,omitempty"`
-	Description string            `json:"description,omitempty"`
-	State       TaskState         `json:"state,omitempty"`
-	CreatedAt   *time.Time        `json:"createdAt,omitempty"`
-	ScheduledAt *time.Time        `json:"scheduledAt,omitempty"`
-	StartedAt   *time.Time        `json:"startedAt,omitempty"`
-	CompletedAt *time.Time        `json:"completedAt,omitempty"`
-	FailedAt    *time.Time        `json:"failedAt,omitempty"`
-	CMD         []string          `json:"cmd,omitempty"`
-	Entrypoint  []string          `json:"entrypoint,omitempty"`
-	Run         string            `json:"run,omitempty"`
-	Image       string            `json:"image,omitempty"`
-	Registry    *Registry         `json:"registry,omitempty"`
-	Env         map[string]string `json:"env,omitempty"`
-	Files       map[string]string `json:"files,omitempty"`
-	Queue       string            `json:"queue,omitempty"`
-	Error       string            `json:"error,omitempty"`
-	Pre         []*Task           `json:"pre,omitempty"`
-	Post        []*Task           `json:"post,omitempty"`
-	Mounts      []Mount           `json:"mounts,omitempty"`
-	Networks    []string          `json:"networks,omitempty"`
-	NodeID      string            `json:"nodeId,omitempty"`
-	Retry       *TaskRetry        `json:"retry,omitempty"`
-	Limits      *TaskLimits       `json:"limits,omitempty"`
-	Timeout     string            `json:"timeout,omitempty"`
-	Result      string            `json:"result,omitempty"`
-	Var         string            `json:"var,omitempty"`
-	If          string            `json:"if,omitempty"`
-	Parallel    *ParallelTask     `json:"parallel,omitempty"`
-	Each        *EachTask         `json:"each,omitempty"`
-	SubJob      *SubJobTask       `json:"subjob,omitempty"`
-	GPUs        string            `json:"gpus,omitempty"`
-	Tags        []string          `json:"tags,omitempty"`
-	Workdir     string            `json:"workdir,omitempty"`
-	Priority    int               `json:"priority,omitempty"`
-	Progress    float64           `json:"progress,omitempty"`
+	ID           string            `json:"id,omitempty"`
+	JobID        string            `json:"jobId,omitempty"`
+	ParentID     string            `json:"parentId,omitempty"`
+	Position     int               `json:"position,omitempty"`
+	Name         string            `json:"name,omitempty"`
+	Description  string            `json:"description,omitempty"`
+	State        TaskState         `json:"state,omitempty"`
+	CreatedAt    *time.Time        `json:"createdAt,omitempty"`
+	ScheduledAt  *time.Time        `json:"scheduledAt,omitempty"`
+	StartedAt    *time.Time        `json:"startedAt,omitempty"`
+	CompletedAt  *time.Time        `json:"completedAt,omitempty"`
+	FailedAt     *time.Time        `json:"failedAt,omitempty"`
+	CMD          []string          `json:"cmd,omitempty"`
+	Entrypoint   []string          `json:"entrypoint,omitempty"`
+	Run          string            `json:"run,omitempty"`
+	Image        string            `json:"image,omitempty"`
+	Registry     *Registry         `json:"registry,omitempty"`
+	Env          map[string]string `json:"env,omitempty"`
+	Files        map[string]string `json:"files,omitempty"`
+	Queue        string            `json:"queue,omitempty"`
+	Error        string            `json:"error,omitempty"`
+	Pre          []*Task           `json:"pre,omitempty"`
+	Post         []*Task           `json:"post,omitempty"`
+	Mounts       []Mount           `json:"mounts,omitempty"`
+	Networks     []string          `json:"networks,omitempty"`
+	NodeID       string            `json:"nodeId,omitempty"`
+	Retry        *TaskRetry        `json:"retry,omitempty"`
+	Limits       *TaskLimits       `json:"limits,omitempty"`
+	Timeout      string            `json:"timeout,omitempty"`
+	Result       string            `json:"result,omitempty"`
+	Var          string            `json:"var,omitempty"`
+	If           string            `json:"if,omitempty"`
+	Parallel     *ParallelTask     `json:"parallel,omitempty"`
+	Each         *EachTask         `json:"each,omitempty"`
+	SubJob       *SubJobTask       `json:"subjob,omitempty"`
+	GPUs         string            `json:"gpus,omitempty"`
+	Tags         []string          `json:"tags,omitempty"`
+	Workdir      string            `json:"workdir,omitempty"`
+	Priority     int               `json:"priority,omitempty"`
+	Progress     float64           `json:"progress,omitempty"`
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	Resources    *TaskResources    `json:"resources,omitempty"`
+	Usage        *TaskUsage        `json:"usage,omitempty"`
+	// Redact holds the values which the worker masks in the
+	// log output of the task. It is only set on dispatch.
+	Redact []string `json:"redact,omitempty"`
+	// Headers carry the metadata of the task as it passes through
+	// the broker, e.g. the trace context. They are not persisted.
+	Headers map[string]string `json:"headers,omitempty"`
 }
 
 type TaskSummary struct {
 	ID          string     `json:"id,omitempty"`
 	JobID       string     `json:"jobId,omitempty"`
+	ParentID    string     `json:"parentId,omitempty"`
 	Position    int        `json:"position,omitempty"`
 	Progress    float64    `json:"progress,omitempty"`
 	Name        string     `json:"name,omitempty"`
@@ -90,6 +103,7 @@ type TaskSummary struct {
 	Result      string     `json:"result,omitempty"`
 	Var         string     `json:"var,omitempty"`
 	Tags        []string   `json:"tags,omitempty"`
+	Usage       *TaskUsage `json:"usage,omitempty"`
 }
 
 type TaskLogPart struct {
@@ -138,6 +152,26 @@ type TaskLimits struct {
 	Memory string `json:"memory,omitempty"`
 }
 
+// TaskResources are the resources a task requests from the
+// node it runs on. Unlike TaskLimits, which are enforced by the
+// runtime, these are used for placing the task on a node.
+type TaskResources struct {
+	CPUs   string `json:"cpus,omitempty"`
+	Memory string `json:"memory,omitempty"`
+	GPUs   int    `json:"gpus,omitempty"`
+}
+
+// TaskUsage is the resources a task used while it ran,
+// as measured by the runtime. Byte counts are totals.
+type TaskUsage struct {
+	CPUSeconds float64 `json:"cpuSeconds"`
+	PeakMemory int64   `json:"peakMemory"` // bytes
+	NetworkRx  int64   `json:"networkRx,omitempty"`
+	NetworkTx  int64   `json:"networkTx,omitempty"`
+	BlockRead  int64   `json:"blockRead,omitempty"`
+	BlockWrite int64   `json:"blockWrite,omitempty"`
+}
+
 type Registry struct {
 	Username string `json:"username,omitempty"`
 	Password string `json:"password,omitempty"`
@@ -172,47 +206,56 @@ func (t *Task) Clone() *Task {
 	if t.Registry != nil {
 		registry = t.Registry.Clone()
 	}
+	var resources *TaskResources
+	if t.Resources != nil {
+		resources = t.Resources.Clone()
+	}
 	return &Task{
-		ID:          t.ID,
-		JobID:       t.JobID,
-		ParentID:    t.ParentID,
-		Position:    t.Position,
-		Name:        t.Name,
-		State:       t.State,
-		CreatedAt:   t.CreatedAt,
-		ScheduledAt: t.ScheduledAt,
-		StartedAt:   t.StartedAt,
-		CompletedAt: t.CompletedAt,
-		FailedAt:    t.FailedAt,
-		CMD:         t.CMD,
-		Entrypoint:  t.Entrypoint,
-		Run:         t.Run,
-		Image:       t.Image,
-		Registry:    registry,
-		Env:         maps.Clone(t.Env),
-		Files:       maps.Clone(t.Files),
-		Queue:       t.Queue,
-		Error:       t.Error,
-		Pre:         CloneTasks(t.Pre),
-		Post:        CloneTasks(t.Post),
-		Mounts:      slices.Clone(t.Mounts),
-		Networks:    t.Networks,
-		NodeID:      t.NodeID,
-		Retry:       retry,
-		Limits:      limits,
-		Timeout:     t.Timeout,
-		Result:      t.Result,
-		Var:         t.Var,
-		If:          t.If,
-		Parallel:    parallel,
-		Each:        each,
-		Description: t.Description,
-		SubJob:      subjob,
-		GPUs:        t.GPUs,
-		Tags:        t.Tags,
-		Workdir:     t.Workdir,
-		Priority:    t.Priority,
-		Progress:    t.Progress,
+		ID:           t.ID,
+		JobID:        t.JobID,
+		ParentID:     t.ParentID,
+		Position:     t.Position,
+		Name:         t.Name,
+		State:        t.State,
+		CreatedAt:    t.CreatedAt,
+		ScheduledAt:  t.ScheduledAt,
+		StartedAt:    t.StartedAt,
+		CompletedAt:  t.CompletedAt,
+		FailedAt:     t.FailedAt,
+		CMD:          t.CMD,
+		Entrypoint:   t.Entrypoint,
+		Run:          t.Run,
+		Image:        t.Image,
+		Registry:     registry,
+		Env:          maps.Clone(t.Env),
+		Files:        maps.Clone(t.Files),
+		Queue:        t.Queue,
+		Error:        t.Error,
+		Pre:          CloneTasks(t.Pre),
+		Post:         CloneTasks(t.Post),
+		Mounts:       slices.Clone(t.Mounts),
+		Networks:     t.Networks,
+		NodeID:       t.NodeID,
+		Retry:        retry,
+		Limits:       limits,
+		Timeout:      t.Timeout,
+		Result:       t.Result,
+		Var:          t.Var,
+		If:           t.If,
+		Parallel:     parallel,
+		Each:         each,
+		Description:  t.Description,
+		SubJob:       subjob,
+		GPUs:         t.GPUs,
+		Tags:         t.Tags,
+		Workdir:      t.Workdir,
+		Priority:     t.Priority,
+		Progress:     t.Progress,
+		NodeSelector: maps.Clone(t.NodeSelector),
+		Resources:    resources,
+		Usage:        t.Usage.Clone(),
+		Redact:       slices.Clone(t.Redact),
+		Headers:      maps.Clone(t.Headers),
 	}
 }
 
@@ -238,6 +281,75 @@ func (l *TaskLimits) Clone() *TaskLimits {
 	}
 }
 
+func (r *TaskResources) Clone() *TaskResources {
+	return &TaskResources{
+		CPUs:   r.CPUs,
+		Memory: r.Memory,
+		GPUs:   r.GPUs,
+	}
+}
+
+func (u *TaskUsage) Clone() *TaskUsage {
+	if u == nil {
+		return nil
+	}
+	c := *u
+	return &c
+}
+
+// Add sums the usage of two tasks up, but for the peak memory,
+// which is the greater of the two: tasks don't all run at once.
+func (u TaskUsage) Add(o TaskUsage) TaskUsage {
+	return TaskUsage{
+		CPUSeconds: u.CPUSeconds + o.CPUSeconds,
+		PeakMemory: max(u.PeakMemory, o.PeakMemory),
+		NetworkRx:  u.NetworkRx + o.NetworkRx,
+		NetworkTx:  u.NetworkTx + o.NetworkTx,
+		BlockRead:  u.BlockRead + o.BlockRead,
+		BlockWrite: u.BlockWrite + o.BlockWrite,
+	}
+}
+
+// TotalUsage adds the usage of the tasks up. It returns
+// nil when none of the tasks has its usage measured.
+func TotalUsage(tasks []*Task) *TaskUsage {
+	var total *TaskUsage
+	for _, t := range tasks {
+		if t.Usage == nil {
+			continue
+		}
+		if total == nil {
+			total = &TaskUsage{}
+		}
+		*total = total.Add(*t.Usage)
+	}
+	return total
+}
+
+// Parse converts the requested resources to their numeric form.
+func (r *TaskResources) Parse() (NodeResources, error) {
+	var nr NodeResources
+	if r.CPUs != "" {
+		cpus, err := strconv.ParseFloat(r.CPUs, 64)
+		if err != nil || cpus < 0 {
+			return nr, errors.Errorf("invalid cpus value: %s", r.CPUs)
+		}
+		nr.CPUs = cpus
+	}
+	if r.Memory != "" {
+		mem, err := units.RAMInBytes(r.Memory)
+		if err != nil || mem < 0 {
+			return nr, errors.Errorf("invalid memory value: %s", r.Memory)
+		}
+		nr.Memory = mem
+	}
+	if r.GPUs < 0 {
+		return nr, errors.Errorf("invalid gpus value: %d", r.GPUs)
+	}
+	nr.GPUs = r.GPUs
+	return nr, nil
+}
+
 func (e *EachTask) Clone() *EachTask {
 	return &EachTask{
 		Var:         e.Var,
@@ -287,6 +399,7 @@ func NewTaskSummary(t *Task) *TaskSummary {
 	return &TaskSummary{
 		ID:          t.ID,
 		JobID:       t.JobID,
+		ParentID:    t.ParentID,
 		Position:    t.Position,
 		Progress:    t.Progress,
 		Name:        t.Name,
@@ -300,5 +413,6 @@ func NewTaskSummary(t *Task) *TaskSummary {
 		Result:      t.Result,
 		Var:         t.Var,
 		Tags:        t.Tags,
+		Usage:       t.Usage.Clone(),
 	}
 }
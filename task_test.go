@@ -60,3 +60,45 @@ func TestIsActive(t *testing.T) {
 	}
 	assert.False(t, t5.IsActive())
 }
+
+func TestParseTaskResources(t *testing.T) {
+	r := &tork.TaskResources{
+		CPUs:   ".5",
+		Memory: "1g",
+		GPUs:   2,
+	}
+	nr, err := r.Parse()
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, nr.CPUs)
+	assert.Equal(t, int64(1024*1024*1024), nr.Memory)
+	assert.Equal(t, 2, nr.GPUs)
+
+	_, err = (&tork.TaskResources{CPUs: "bad"}).Parse()
+	assert.Error(t, err)
+
+	_, err = (&tork.TaskResources{Memory: "bad"}).Parse()
+	assert.Error(t, err)
+
+	_, err = (&tork.TaskResources{GPUs: -1}).Parse()
+	assert.Error(t, err)
+}
+
+func TestTotalUsage(t *testing.T) {
+	assert.Nil(t, tork.TotalUsage(nil))
+	assert.Nil(t, tork.TotalUsage([]*tork.Task{{}}))
+
+	t1 := &tork.Task{Usage: &tork.TaskUsage{CPUSeconds: 1.5, PeakMemory: 1024, NetworkRx: 10, BlockWrite: 512}}
+	t2 := &tork.Task{Usage: &tork.TaskUsage{CPUSeconds: 2, PeakMemory: 4096, NetworkRx: 5, NetworkTx: 7}}
+	total := tork.TotalUsage([]*tork.Task{t1, {}, t2})
+	assert.Equal(t, &tork.TaskUsage{
+		CPUSeconds: 3.5,
+		PeakMemory: 4096,
+		NetworkRx:  15,
+		NetworkTx:  7,
+		BlockWrite: 512,
+	}, total)
+
+	t3 := t1.Clone()
+	t3.Usage.CPUSeconds = 10
+	assert.Equal(t, 1.5, t1.Usage.CPUSeconds)
+}
@@ -9,6 +9,14 @@ const (
 	USERNAME   UsernameKey = "username"
 )
 
+const (
+	// TOKEN_PREFIX marks personal access tokens so they can be told
+	// apart from other bearer credentials such as JWTs.
+	TOKEN_PREFIX      = "tork_"
+	TOKEN_SCOPE_READ  = "read"
+	TOKEN_SCOPE_WRITE = "write"
+)
+
 type User struct {
 	ID           string     `json:"id,omitempty"`
 	Name         string     `json:"name,omitempty"`
@@ -29,3 +37,53 @@ func (u *User) Clone() *User {
 		Disabled:     u.Disabled,
 	}
 }
+
+// UserToken is a personal access token which lets a user
+// authenticate without sharing their password. Only a hash of
+// the token is stored; the token itself is returned once, upon
+// creation.
+type UserToken struct {
+	ID         string     `json:"id,omitempty"`
+	UserID     string     `json:"userId,omitempty"`
+	Name       string     `json:"name,omitempty"`
+	Token      string     `json:"token,omitempty"`
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes,omitempty"`
+	CreatedAt  *time.Time `json:"createdAt,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// UserIdentity links a user to the account which an OpenID Connect
+// provider identifies by the issuer and subject of its ID tokens.
+type UserIdentity struct {
+	ID        string     `json:"id,omitempty"`
+	UserID    string     `json:"userId,omitempty"`
+	Issuer    string     `json:"issuer,omitempty"`
+	Subject   string     `json:"subject,omitempty"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+}
+
+func (t *UserToken) IsExpired() bool {
+	return t.ExpiresAt != nil && t.ExpiresAt.Before(time.Now().UTC())
+}
+
+// Permits returns true if the token's scopes
+// allow a request with the given HTTP method.
+// A token without scopes is unrestricted and
+// the write scope implies the read scope.
+func (t *UserToken) Permits(method string) bool {
+	if len(t.Scopes) == 0 {
+		return true
+	}
+	scope := TOKEN_SCOPE_WRITE
+	if method == "GET" || method == "HEAD" || method == "OPTIONS" {
+		scope = TOKEN_SCOPE_READ
+	}
+	for _, s := range t.Scopes {
+		if s == scope || s == TOKEN_SCOPE_WRITE {
+			return true
+		}
+	}
+	return false
+}